@@ -0,0 +1,727 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/protocols/snap"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// snapTimeout is the time a node may take to answer a snap request.
+var snapTimeout = 10 * time.Second
+
+// softResponseLimit is the maximum response size served by snap/1 nodes.
+const softResponseLimit = 2 * 1024 * 1024
+
+var (
+	// fullRange is the limit hash covering the whole key space.
+	fullRange = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+	// rootPath is the compact encoded path of a trie root node.
+	rootPath = []byte{0}
+)
+
+// NewSnapSuite creates and returns a new snap-test suite that can be used to
+// test the given node, which must have imported the full blockchain given.
+func NewSnapSuite(dest *enode.Node, chainfile string, genesisfile string) (*Suite, error) {
+	chain, err := loadChain(chainfile, genesisfile)
+	if err != nil {
+		return nil, err
+	}
+	return &Suite{
+		Dest:      dest,
+		chain:     chain,
+		fullChain: chain,
+	}, nil
+}
+
+func (s *Suite) SnapTests() []utesting.Test {
+	return []utesting.Test{
+		{Name: "Status", Fn: s.TestSnapStatus},
+		{Name: "AccountRange", Fn: s.TestSnapGetAccountRange},
+		{Name: "StorageRanges", Fn: s.TestSnapGetStorageRanges},
+		{Name: "ByteCodes", Fn: s.TestSnapGetByteCodes},
+		{Name: "TrieNodes", Fn: s.TestSnapGetTrieNodes},
+		{Name: "Timeout", Fn: s.TestSnapTimeout},
+	}
+}
+
+// TestSnapStatus connects with the snap protocol enabled and checks that the
+// node advertises snap/1.
+func (s *Suite) TestSnapStatus(t *utesting.T) {
+	conn := s.dialSnap(t)
+	conn.Close()
+}
+
+type accRangeTest struct {
+	name string
+	req  GetAccountRange
+
+	nAccounts   int         // expected number of accounts, -1 if not checked
+	expectFirst common.Hash // expected first account, zero if not checked
+	expectMore  bool        // whether more accounts are expected past the range
+}
+
+// TestSnapGetAccountRange checks that account range responses are complete,
+// proven and respect the requested boundaries and byte limits.
+func (s *Suite) TestSnapGetAccountRange(t *utesting.T) {
+	conn := s.dialSnap(t)
+	defer conn.Close()
+
+	root := s.chain.Head().Root()
+	hashes, _ := s.allAccounts(t, conn)
+	if len(hashes) < 10 {
+		t.Fatalf("test chain state has only %d accounts, need at least 10", len(hashes))
+	}
+	last := hashes[len(hashes)-1]
+	tests := []accRangeTest{
+		{
+			name:        "byte limit 1",
+			req:         GetAccountRange{Root: root, Limit: fullRange, Bytes: 1},
+			nAccounts:   1,
+			expectFirst: hashes[0],
+			expectMore:  true,
+		},
+		{
+			name:        "limit inside state",
+			req:         GetAccountRange{Root: root, Limit: hashes[9], Bytes: softResponseLimit},
+			nAccounts:   10,
+			expectFirst: hashes[0],
+			expectMore:  true,
+		},
+		{
+			name:        "origin at account",
+			req:         GetAccountRange{Root: root, Origin: hashes[5], Limit: fullRange, Bytes: softResponseLimit},
+			nAccounts:   len(hashes) - 5,
+			expectFirst: hashes[5],
+		},
+		{
+			name:        "origin between accounts",
+			req:         GetAccountRange{Root: root, Origin: incHash(hashes[5]), Limit: fullRange, Bytes: softResponseLimit},
+			nAccounts:   len(hashes) - 6,
+			expectFirst: hashes[6],
+		},
+		{
+			// If no accounts exist in the range, the first one after it is returned.
+			name:        "empty range",
+			req:         GetAccountRange{Root: root, Origin: incHash(hashes[5]), Limit: incHash(incHash(hashes[5])), Bytes: softResponseLimit},
+			nAccounts:   1,
+			expectFirst: hashes[6],
+			expectMore:  true,
+		},
+		{
+			name:      "origin after last account",
+			req:       GetAccountRange{Root: root, Origin: incHash(last), Limit: fullRange, Bytes: softResponseLimit},
+			nAccounts: 0,
+		},
+	}
+	for _, tt := range tests {
+		if err := conn.checkAccountRange(tt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	// Requests for unknown state roots are answered with an empty response.
+	res, err := conn.getAccountRange(&GetAccountRange{Root: randHash(), Limit: fullRange, Bytes: softResponseLimit})
+	if err != nil {
+		t.Fatalf("unknown root: %v", err)
+	}
+	if len(res.Accounts) > 0 || len(res.Proof) > 0 {
+		t.Errorf("unknown root: got %d accounts and %d proof nodes, want empty response", len(res.Accounts), len(res.Proof))
+	}
+}
+
+// checkAccountRange performs an account range request and checks the response
+// against the test expectations.
+func (c *Conn) checkAccountRange(tt accRangeTest) error {
+	req := tt.req
+	res, err := c.getAccountRange(&req)
+	if err != nil {
+		return err
+	}
+	hashes, _, more, err := verifyAccountRange(req.Root, req.Origin, res)
+	if err != nil {
+		return err
+	}
+	if tt.nAccounts >= 0 && len(hashes) != tt.nAccounts {
+		return fmt.Errorf("got %d accounts, want %d", len(hashes), tt.nAccounts)
+	}
+	if tt.expectFirst != (common.Hash{}) && len(hashes) > 0 && hashes[0] != tt.expectFirst {
+		return fmt.Errorf("wrong first account %x, want %x", hashes[0], tt.expectFirst)
+	}
+	if more != tt.expectMore {
+		return fmt.Errorf("wrong continuation flag %v, want %v", more, tt.expectMore)
+	}
+	return nil
+}
+
+// TestSnapGetStorageRanges checks that storage range responses are complete and
+// proven, and that large storage tries are split according to the byte limit.
+func (s *Suite) TestSnapGetStorageRanges(t *utesting.T) {
+	conn := s.dialSnap(t)
+	defer conn.Close()
+
+	var (
+		root             = s.chain.Head().Root()
+		hashes, accounts = s.allAccounts(t, conn)
+		contracts        []common.Hash
+		storageRoots     []common.Hash
+		eoa              common.Hash
+	)
+	for i, acc := range accounts {
+		if acc.Root != types.EmptyRootHash {
+			contracts = append(contracts, hashes[i])
+			storageRoots = append(storageRoots, acc.Root)
+		} else {
+			eoa = hashes[i]
+		}
+	}
+	if len(contracts) < 2 {
+		t.Fatalf("test chain state has %d accounts with storage, need at least 2", len(contracts))
+	}
+
+	// Fetch the storage of all contracts. This must be complete and needs no proofs.
+	res, err := conn.getStorageRanges(&GetStorageRanges{Root: root, Accounts: contracts, Bytes: softResponseLimit})
+	if err != nil {
+		t.Fatalf("all contracts: %v", err)
+	}
+	if len(res.Slots) != len(contracts) {
+		t.Fatalf("all contracts: got storage of %d accounts, want %d", len(res.Slots), len(contracts))
+	}
+	if _, err := verifyStorageRanges(storageRoots, nil, res); err != nil {
+		t.Fatalf("all contracts: %v", err)
+	}
+	// Pick the contract with the largest storage for the remaining tests.
+	var large int
+	for i := range res.Slots {
+		if len(res.Slots[i]) > len(res.Slots[large]) {
+			large = i
+		}
+	}
+	slots := res.Slots[large]
+	if len(slots) < 100 {
+		t.Fatalf("largest storage has only %d slots, need at least 100", len(slots))
+	}
+
+	// Fetching with a low byte limit returns a proven prefix of the storage.
+	req := &GetStorageRanges{Root: root, Accounts: contracts[large : large+1], Bytes: 1000}
+	res, err = conn.getStorageRanges(req)
+	if err != nil {
+		t.Fatalf("byte limit: %v", err)
+	}
+	more, err := verifyStorageRanges(storageRoots[large:large+1], nil, res)
+	if err != nil {
+		t.Fatalf("byte limit: %v", err)
+	}
+	if len(res.Slots) != 1 || len(res.Slots[0]) == 0 || len(res.Slots[0]) >= len(slots) || !more {
+		t.Fatalf("byte limit: got %d slot ranges, want one incomplete range", len(res.Slots))
+	}
+
+	// Fetching a range in large contract mode returns the slots within it.
+	origin, limit := slots[10].Hash, slots[20].Hash
+	req = &GetStorageRanges{Root: root, Accounts: contracts[large : large+1], Origin: origin[:], Limit: limit[:], Bytes: softResponseLimit}
+	res, err = conn.getStorageRanges(req)
+	if err != nil {
+		t.Fatalf("slot range: %v", err)
+	}
+	if _, err := verifyStorageRanges(storageRoots[large:large+1], origin[:], res); err != nil {
+		t.Fatalf("slot range: %v", err)
+	}
+	if len(res.Slots) != 1 || len(res.Slots[0]) != 11 {
+		t.Fatalf("slot range: got %v, want 11 slots", slotCounts(res.Slots))
+	} else if res.Slots[0][0].Hash != origin {
+		t.Fatalf("slot range: wrong first slot %x, want %x", res.Slots[0][0].Hash, origin)
+	}
+
+	// Accounts without storage have empty storage ranges.
+	if eoa != (common.Hash{}) {
+		res, err = conn.getStorageRanges(&GetStorageRanges{Root: root, Accounts: []common.Hash{eoa}, Bytes: softResponseLimit})
+		if err != nil {
+			t.Fatalf("account without storage: %v", err)
+		}
+		if n := slotCounts(res.Slots); len(n) > 1 || (len(n) == 1 && n[0] > 0) {
+			t.Fatalf("account without storage: got %v slots", n)
+		}
+	}
+
+	// Requests for unknown state roots are answered with an empty response.
+	res, err = conn.getStorageRanges(&GetStorageRanges{Root: randHash(), Accounts: contracts, Bytes: softResponseLimit})
+	if err != nil {
+		t.Fatalf("unknown root: %v", err)
+	}
+	if len(res.Slots) > 0 || len(res.Proof) > 0 {
+		t.Fatalf("unknown root: got %d slot ranges and %d proof nodes, want empty response", len(res.Slots), len(res.Proof))
+	}
+}
+
+// TestSnapGetByteCodes checks that bytecode responses contain the requested
+// codes in request order and respect the byte limit.
+func (s *Suite) TestSnapGetByteCodes(t *utesting.T) {
+	conn := s.dialSnap(t)
+	defer conn.Close()
+
+	var (
+		_, accounts = s.allAccounts(t, conn)
+		emptyCode   = crypto.Keccak256Hash(nil)
+		codeHashes  []common.Hash
+		seen        = make(map[common.Hash]bool)
+	)
+	for _, acc := range accounts {
+		hash := common.BytesToHash(acc.CodeHash)
+		if hash != emptyCode && !seen[hash] {
+			seen[hash] = true
+			codeHashes = append(codeHashes, hash)
+		}
+	}
+	if len(codeHashes) < 2 {
+		t.Fatalf("test chain state has %d contracts, need at least 2", len(codeHashes))
+	}
+	many := make([]common.Hash, 1024)
+	for i := range many {
+		many[i] = randHash()
+	}
+	tests := []struct {
+		name   string
+		hashes []common.Hash
+		bytes  uint64
+		nCodes int
+	}{
+		{name: "all codes", hashes: codeHashes, bytes: softResponseLimit, nCodes: len(codeHashes)},
+		{name: "empty request", hashes: nil, bytes: softResponseLimit, nCodes: 0},
+		{name: "unknown codes", hashes: []common.Hash{randHash(), randHash()}, bytes: softResponseLimit, nCodes: 0},
+		{name: "mixed codes", hashes: []common.Hash{randHash(), codeHashes[0], randHash(), codeHashes[1]}, bytes: softResponseLimit, nCodes: 2},
+		{name: "byte limit 1", hashes: codeHashes[:2], bytes: 1, nCodes: 1},
+		{name: "many unknown codes", hashes: many, bytes: softResponseLimit, nCodes: 0},
+	}
+	for _, tt := range tests {
+		res, err := conn.getByteCodes(&GetByteCodes{Hashes: tt.hashes, Bytes: tt.bytes})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(res.Codes) != tt.nCodes {
+			t.Errorf("%s: got %d codes, want %d", tt.name, len(res.Codes), tt.nCodes)
+		}
+		if err := verifyByteCodes(tt.hashes, res.Codes); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+// TestSnapGetTrieNodes checks that trie node responses contain the requested
+// account and storage trie nodes.
+func (s *Suite) TestSnapGetTrieNodes(t *utesting.T) {
+	conn := s.dialSnap(t)
+	defer conn.Close()
+
+	var (
+		root             = s.chain.Head().Root()
+		hashes, accounts = s.allAccounts(t, conn)
+		contract         common.Hash
+		storageRoot      common.Hash
+	)
+	for i, acc := range accounts {
+		if acc.Root != types.EmptyRootHash {
+			contract, storageRoot = hashes[i], acc.Root
+			break
+		}
+	}
+	if contract == (common.Hash{}) {
+		t.Fatal("test chain state has no accounts with storage")
+	}
+
+	// Fetch the root node and find the path and hash of one of its children.
+	res, err := conn.getTrieNodes(&GetTrieNodes{Root: root, Paths: []snap.TrieNodePathSet{{rootPath}}, Bytes: softResponseLimit})
+	if err != nil {
+		t.Fatalf("root node: %v", err)
+	}
+	if err := verifyTrieNodes([]common.Hash{root}, res.Nodes); err != nil {
+		t.Fatalf("root node: %v", err)
+	}
+	childPath, child, err := firstChild(res.Nodes[0])
+	if err != nil {
+		t.Fatalf("root node: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		paths  []snap.TrieNodePathSet
+		bytes  uint64
+		expect []common.Hash
+	}{
+		{
+			name:   "account trie child",
+			paths:  []snap.TrieNodePathSet{{childPath}},
+			bytes:  softResponseLimit,
+			expect: []common.Hash{child},
+		},
+		{
+			name:   "storage trie root",
+			paths:  []snap.TrieNodePathSet{{contract[:], rootPath}},
+			bytes:  softResponseLimit,
+			expect: []common.Hash{storageRoot},
+		},
+		{
+			name:   "account and storage nodes",
+			paths:  []snap.TrieNodePathSet{{rootPath}, {contract[:], rootPath}},
+			bytes:  softResponseLimit,
+			expect: []common.Hash{root, storageRoot},
+		},
+		{
+			name:   "byte limit 1",
+			paths:  []snap.TrieNodePathSet{{rootPath}, {contract[:], rootPath}},
+			bytes:  1,
+			expect: []common.Hash{root},
+		},
+	}
+	for _, tt := range tests {
+		res, err := conn.getTrieNodes(&GetTrieNodes{Root: root, Paths: tt.paths, Bytes: tt.bytes})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if err := verifyTrieNodes(tt.expect, res.Nodes); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	// Requests for unknown state roots are answered with an empty response.
+	res, err = conn.getTrieNodes(&GetTrieNodes{Root: randHash(), Paths: []snap.TrieNodePathSet{{rootPath}}, Bytes: softResponseLimit})
+	if err != nil {
+		t.Fatalf("unknown root: %v", err)
+	}
+	if len(res.Nodes) > 0 {
+		t.Fatalf("unknown root: got %d nodes, want empty response", len(res.Nodes))
+	}
+}
+
+// TestSnapTimeout checks that the node either answers or drops the connection
+// within the deadline for oversized and unserviceable requests, instead of
+// stalling the requester.
+func (s *Suite) TestSnapTimeout(t *utesting.T) {
+	conn := s.dialSnap(t)
+	defer func() { conn.Close() }()
+
+	var (
+		root      = s.chain.Head().Root()
+		hashes, _ = s.allAccounts(t, conn)
+		codes     = make([]common.Hash, 16384)
+		paths     = make([]snap.TrieNodePathSet, 16384)
+	)
+	for i := range codes {
+		codes[i] = randHash()
+		paths[i] = snap.TrieNodePathSet{randHash().Bytes()}
+	}
+	tests := []struct {
+		name string
+		id   uint64
+		req  Message
+	}{
+		{"oversized account range", 1, &GetAccountRange{ID: 1, Root: root, Limit: fullRange, Bytes: math.MaxUint64}},
+		{"oversized storage ranges", 2, &GetStorageRanges{ID: 2, Root: root, Accounts: hashes, Bytes: math.MaxUint64}},
+		{"unknown bytecodes", 3, &GetByteCodes{ID: 3, Hashes: codes, Bytes: math.MaxUint64}},
+		{"unknown trie nodes", 4, &GetTrieNodes{ID: 4, Root: root, Paths: paths, Bytes: math.MaxUint64}},
+		{"unknown root trie nodes", 5, &GetTrieNodes{ID: 5, Root: randHash(), Paths: paths, Bytes: math.MaxUint64}},
+	}
+	for _, tt := range tests {
+		_, err := conn.snapRequest(tt.req, tt.id, snapTimeout)
+		if err == nil {
+			continue
+		}
+		// The node may drop the connection instead of answering, but must not
+		// leave the request hanging
+		var nerr net.Error
+		switch {
+		case errors.As(err, &nerr) && nerr.Timeout():
+			t.Errorf("%s: no answer within %v", tt.name, snapTimeout)
+		case errors.As(err, &nerr), errors.Is(err, io.EOF), errors.Is(err, errSnapDisconnected):
+			t.Logf("%s: dropped: %v", tt.name, err)
+		default:
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		conn.Close()
+		conn = s.dialSnap(t)
+	}
+}
+
+// dialSnap connects to the node with both eth/66 and snap/1 enabled.
+func (s *Suite) dialSnap(t *utesting.T) *Conn {
+	conn, err := s.dial()
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	conn.caps = append(conn.caps, p2p.Cap{Name: "eth", Version: 66}, p2p.Cap{Name: "snap", Version: 1})
+	hello, ok := conn.handshake(t).(*Hello)
+	if !ok || !hasCap(hello.Caps, p2p.Cap{Name: "snap", Version: 1}) {
+		t.Fatalf("node does not support snap/1")
+	}
+	conn.statusExchange66(t, s.chain)
+	return conn
+}
+
+// allAccounts retrieves all accounts in the head state of the test chain.
+func (s *Suite) allAccounts(t *utesting.T, conn *Conn) ([]common.Hash, []*state.Account) {
+	var (
+		root     = s.chain.Head().Root()
+		origin   common.Hash
+		hashes   []common.Hash
+		accounts []*state.Account
+	)
+	for {
+		res, err := conn.getAccountRange(&GetAccountRange{Root: root, Origin: origin, Limit: fullRange, Bytes: softResponseLimit})
+		if err != nil {
+			t.Fatalf("could not fetch accounts: %v", err)
+		}
+		h, a, more, err := verifyAccountRange(root, origin, res)
+		if err != nil {
+			t.Fatalf("invalid account range: %v", err)
+		}
+		hashes, accounts = append(hashes, h...), append(accounts, a...)
+		if !more || len(h) == 0 {
+			return hashes, accounts
+		}
+		origin = incHash(h[len(h)-1])
+	}
+}
+
+func (c *Conn) getAccountRange(req *GetAccountRange) (*AccountRange, error) {
+	req.ID = rand.Uint64()
+	msg, err := c.snapRequest(req, req.ID, snapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := msg.(*AccountRange)
+	if !ok {
+		return nil, fmt.Errorf("account range response wrong: %T", msg)
+	}
+	return res, nil
+}
+
+func (c *Conn) getStorageRanges(req *GetStorageRanges) (*StorageRanges, error) {
+	req.ID = rand.Uint64()
+	msg, err := c.snapRequest(req, req.ID, snapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := msg.(*StorageRanges)
+	if !ok {
+		return nil, fmt.Errorf("storage ranges response wrong: %T", msg)
+	}
+	return res, nil
+}
+
+func (c *Conn) getByteCodes(req *GetByteCodes) (*ByteCodes, error) {
+	req.ID = rand.Uint64()
+	msg, err := c.snapRequest(req, req.ID, snapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := msg.(*ByteCodes)
+	if !ok {
+		return nil, fmt.Errorf("bytecodes response wrong: %T", msg)
+	}
+	return res, nil
+}
+
+func (c *Conn) getTrieNodes(req *GetTrieNodes) (*TrieNodes, error) {
+	req.ID = rand.Uint64()
+	msg, err := c.snapRequest(req, req.ID, snapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := msg.(*TrieNodes)
+	if !ok {
+		return nil, fmt.Errorf("trie nodes response wrong: %T", msg)
+	}
+	return res, nil
+}
+
+// verifyAccountRange checks that the accounts of a response are ordered and
+// proven to be a consecutive range of the state trie starting at origin. It
+// returns the accounts and whether the trie contains more accounts after them.
+func verifyAccountRange(root, origin common.Hash, res *AccountRange) ([]common.Hash, []*state.Account, bool, error) {
+	hashes, blobs, err := (*snap.AccountRangePacket)(res).Unpack()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	keys := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		if i == 0 && bytes.Compare(hash[:], origin[:]) < 0 {
+			return nil, nil, false, fmt.Errorf("account %x before origin %x", hash, origin)
+		}
+		if i > 0 && bytes.Compare(hashes[i-1][:], hash[:]) >= 0 {
+			return nil, nil, false, fmt.Errorf("accounts not monotonically increasing at #%d", i)
+		}
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	more, err := verifyRange(root, origin[:], keys, blobs, res.Proof)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	accounts := make([]*state.Account, len(blobs))
+	for i, blob := range blobs {
+		accounts[i] = new(state.Account)
+		if err := rlp.DecodeBytes(blob, accounts[i]); err != nil {
+			return nil, nil, false, fmt.Errorf("invalid account %x: %v", hashes[i], err)
+		}
+	}
+	return hashes, accounts, more, nil
+}
+
+// verifyStorageRanges checks the slot ranges of a response against the storage
+// roots of the requested accounts. Only the last range may be incomplete, which
+// needs to be proven. It returns whether the last range is incomplete.
+func verifyStorageRanges(roots []common.Hash, origin []byte, res *StorageRanges) (bool, error) {
+	hashset, slotset := (*snap.StorageRangesPacket)(res).Unpack()
+	if len(hashset) > len(roots) {
+		return false, fmt.Errorf("got %d slot ranges for %d accounts", len(hashset), len(roots))
+	}
+	var more bool
+	for i, hashes := range hashset {
+		keys := make([][]byte, len(hashes))
+		for j, hash := range hashes {
+			if j > 0 && bytes.Compare(hashes[j-1][:], hash[:]) >= 0 {
+				return false, fmt.Errorf("slots of account #%d not monotonically increasing at #%d", i, j)
+			}
+			keys[j] = common.CopyBytes(hash[:])
+		}
+		if i < len(hashset)-1 || len(res.Proof) == 0 {
+			// Without proofs, the range has to cover the entire storage trie.
+			if _, _, _, _, err := trie.VerifyRangeProof(roots[i], nil, nil, keys, slotset[i], nil); err != nil {
+				return false, fmt.Errorf("storage of account #%d: %v", i, err)
+			}
+			continue
+		}
+		start := origin
+		if len(start) == 0 {
+			start = common.Hash{}.Bytes()
+		}
+		var err error
+		if more, err = verifyRange(roots[i], start, keys, slotset[i], res.Proof); err != nil {
+			return false, fmt.Errorf("storage of account #%d: %v", i, err)
+		}
+	}
+	return more, nil
+}
+
+// verifyRange checks a range proof, returning whether more items exist after the
+// range.
+func verifyRange(root common.Hash, origin []byte, keys, values [][]byte, proof [][]byte) (bool, error) {
+	nodes := make(light.NodeList, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	var end []byte
+	if len(keys) > 0 {
+		end = keys[len(keys)-1]
+	}
+	_, _, _, more, err := trie.VerifyRangeProof(root, origin, end, keys, values, nodes.NodeSet())
+	return more, err
+}
+
+// verifyByteCodes checks that the codes of a response match the requested hashes
+// in request order. Unavailable codes may be left out.
+func verifyByteCodes(hashes []common.Hash, codes [][]byte) error {
+	next := 0
+	for i, code := range codes {
+		hash := crypto.Keccak256Hash(code)
+		for next < len(hashes) && hashes[next] != hash {
+			next++
+		}
+		if next == len(hashes) {
+			return fmt.Errorf("code #%d with hash %x not requested or out of order", i, hash)
+		}
+		next++
+	}
+	return nil
+}
+
+// verifyTrieNodes checks that the nodes of a response have the expected hashes.
+func verifyTrieNodes(expect []common.Hash, nodes [][]byte) error {
+	if len(nodes) != len(expect) {
+		return fmt.Errorf("got %d nodes, want %d", len(nodes), len(expect))
+	}
+	for i, node := range nodes {
+		if hash := crypto.Keccak256Hash(node); hash != expect[i] {
+			return fmt.Errorf("node #%d has hash %x, want %x", i, hash, expect[i])
+		}
+	}
+	return nil
+}
+
+// firstChild returns the compact encoded path and hash of the first child of a
+// full node that is referenced by hash.
+func firstChild(node []byte) ([]byte, common.Hash, error) {
+	var children []rlp.RawValue
+	if err := rlp.DecodeBytes(node, &children); err != nil {
+		return nil, common.Hash{}, err
+	}
+	if len(children) != 17 {
+		return nil, common.Hash{}, errors.New("root is not a full node")
+	}
+	for i, child := range children[:16] {
+		kind, content, _, err := rlp.Split(child)
+		if err == nil && kind == rlp.String && len(content) == common.HashLength {
+			// The compact encoding of a single nibble path has the odd flag set.
+			return []byte{0x10 | byte(i)}, common.BytesToHash(content), nil
+		}
+	}
+	return nil, common.Hash{}, errors.New("root has no hashed children")
+}
+
+// incHash returns the hash following h.
+func incHash(h common.Hash) common.Hash {
+	n := new(big.Int).SetBytes(h[:])
+	return common.BigToHash(n.Add(n, common.Big1))
+}
+
+// slotCounts returns the number of slots per range.
+func slotCounts(slots [][]*snap.StorageData) []int {
+	counts := make([]int, len(slots))
+	for i := range slots {
+		counts[i] = len(slots[i])
+	}
+	return counts
+}
+
+func hasCap(caps []p2p.Cap, c p2p.Cap) bool {
+	for _, have := range caps {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/eth/protocols/snap"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	baseProtoLen = 16 // Number of message codes reserved for the devp2p base protocol
+	ethProtoLen  = 17 // Number of message codes used by eth/66
+
+	// snapProtoOffset is the message code offset of snap/1, which is negotiated
+	// alongside eth/66 and sorts after it.
+	snapProtoOffset = baseProtoLen + ethProtoLen
+)
+
+// errSnapDisconnected is returned if the node disconnects while a snap request
+// is in flight.
+var errSnapDisconnected = errors.New("disconnected")
+
+// GetAccountRange represents an account range query.
+type GetAccountRange snap.GetAccountRangePacket
+
+func (msg GetAccountRange) Code() int { return snapProtoOffset + snap.GetAccountRangeMsg }
+
+// AccountRange is the response to GetAccountRange.
+type AccountRange snap.AccountRangePacket
+
+func (msg AccountRange) Code() int { return snapProtoOffset + snap.AccountRangeMsg }
+
+// GetStorageRanges represents a storage slot query.
+type GetStorageRanges snap.GetStorageRangesPacket
+
+func (msg GetStorageRanges) Code() int { return snapProtoOffset + snap.GetStorageRangesMsg }
+
+// StorageRanges is the response to GetStorageRanges.
+type StorageRanges snap.StorageRangesPacket
+
+func (msg StorageRanges) Code() int { return snapProtoOffset + snap.StorageRangesMsg }
+
+// GetByteCodes represents a contract bytecode query.
+type GetByteCodes snap.GetByteCodesPacket
+
+func (msg GetByteCodes) Code() int { return snapProtoOffset + snap.GetByteCodesMsg }
+
+// ByteCodes is the response to GetByteCodes.
+type ByteCodes snap.ByteCodesPacket
+
+func (msg ByteCodes) Code() int { return snapProtoOffset + snap.ByteCodesMsg }
+
+// GetTrieNodes represents a state trie node query.
+type GetTrieNodes snap.GetTrieNodesPacket
+
+func (msg GetTrieNodes) Code() int { return snapProtoOffset + snap.GetTrieNodesMsg }
+
+// TrieNodes is the response to GetTrieNodes.
+type TrieNodes snap.TrieNodesPacket
+
+func (msg TrieNodes) Code() int { return snapProtoOffset + snap.TrieNodesMsg }
+
+// snapRequest sends a snap request and waits for the response with the given
+// request ID, answering pings and skipping any eth protocol traffic meanwhile.
+func (c *Conn) snapRequest(req Message, id uint64, timeout time.Duration) (Message, error) {
+	defer c.SetReadDeadline(time.Time{})
+	c.SetReadDeadline(time.Now().Add(timeout))
+
+	if err := c.Write(req); err != nil {
+		return nil, fmt.Errorf("could not write to connection: %v", err)
+	}
+	for {
+		code, rawData, _, err := c.Conn.Read()
+		if err != nil {
+			return nil, fmt.Errorf("could not read from connection: %w", err)
+		}
+		var (
+			msg   Message
+			msgID *uint64
+		)
+		switch int(code) {
+		case (Ping{}).Code():
+			c.Write(&Pong{})
+			continue
+		case (Disconnect{}).Code():
+			var disc Disconnect
+			if err := rlp.DecodeBytes(rawData, &disc); err != nil {
+				return nil, fmt.Errorf("could not rlp decode disconnect: %v", err)
+			}
+			return nil, fmt.Errorf("%w: %v", errSnapDisconnected, disc.Reason)
+		case (AccountRange{}).Code():
+			res := new(AccountRange)
+			msg, msgID = res, &res.ID
+		case (StorageRanges{}).Code():
+			res := new(StorageRanges)
+			msg, msgID = res, &res.ID
+		case (ByteCodes{}).Code():
+			res := new(ByteCodes)
+			msg, msgID = res, &res.ID
+		case (TrieNodes{}).Code():
+			res := new(TrieNodes)
+			msg, msgID = res, &res.ID
+		default:
+			// Not a snap response, most likely eth protocol traffic.
+			continue
+		}
+		if err := rlp.DecodeBytes(rawData, msg); err != nil {
+			return nil, fmt.Errorf("could not rlp decode message: %v", err)
+		}
+		if *msgID != id {
+			return nil, fmt.Errorf("response ID mismatch: have %d, want %d", *msgID, id)
+		}
+		return msg, nil
+	}
+}
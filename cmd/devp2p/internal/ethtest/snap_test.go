@@ -0,0 +1,70 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestSnapChain checks that the snap test chain can be loaded.
+func TestSnapChain(t *testing.T) {
+	chainFile, err := filepath.Abs("./testdata/snap/chain.rlp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisFile, err := filepath.Abs("./testdata/snap/genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite, err := NewSnapSuite(nil, chainFile, genesisFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.chain.Len() != 65 {
+		t.Fatalf("wrong chain length %d, want 65", suite.chain.Len())
+	}
+	if suite.chain.chainConfig.Clique == nil {
+		t.Fatal("snap test chain is not a clique chain")
+	}
+}
+
+func TestVerifyByteCodes(t *testing.T) {
+	var (
+		codes  = [][]byte{{1}, {2}, {3}}
+		hashes = []common.Hash{crypto.Keccak256Hash(codes[0]), crypto.Keccak256Hash(codes[1]), crypto.Keccak256Hash(codes[2])}
+	)
+	tests := []struct {
+		codes [][]byte
+		ok    bool
+	}{
+		{codes: nil, ok: true},
+		{codes: codes, ok: true},
+		{codes: [][]byte{codes[0], codes[2]}, ok: true},
+		{codes: [][]byte{codes[2], codes[0]}, ok: false},
+		{codes: [][]byte{codes[0], codes[0]}, ok: false},
+		{codes: [][]byte{{4}}, ok: false},
+	}
+	for i, tt := range tests {
+		if err := verifyByteCodes(hashes, tt.codes); (err == nil) != tt.ok {
+			t.Errorf("test %d: unexpected result %v", i, err)
+		}
+	}
+}
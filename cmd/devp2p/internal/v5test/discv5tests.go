@@ -18,6 +18,7 @@ package v5test
 
 import (
 	"bytes"
+	"crypto/rand"
 	"net"
 	"sync"
 	"time"
@@ -55,6 +56,9 @@ func (s *Suite) AllTests() []utesting.Test {
 		{Name: "TalkRequest", Fn: s.TestTalkRequest},
 		{Name: "FindnodeZeroDistance", Fn: s.TestFindnodeZeroDistance},
 		{Name: "FindnodeResults", Fn: s.TestFindnodeResults},
+		{Name: "RequestTicket", Fn: s.TestRequestTicket},
+		{Name: "TopicQueryEmpty", Fn: s.TestTopicQueryEmpty},
+		{Name: "TopicRegistration", Fn: s.TestTopicRegistration},
 	}
 }
 
@@ -291,6 +295,103 @@ func (s *Suite) TestFindnodeResults(t *utesting.T) {
 	}
 }
 
+// This test sends REQUESTTICKET and expects a TICKET response.
+func (s *Suite) TestRequestTicket(t *utesting.T) {
+	conn, l1 := s.listen1(t)
+	defer conn.close()
+
+	id := conn.nextReqID()
+	switch resp := conn.reqresp(l1, &v5wire.RequestTicket{ReqID: id, Topic: randomTopic()}).(type) {
+	case *v5wire.Ticket:
+		if !bytes.Equal(resp.ReqID, id) {
+			t.Fatalf("wrong request ID %x in TICKET, want %x", resp.ReqID, id)
+		}
+		if len(resp.Ticket) == 0 {
+			t.Fatal("empty ticket in TICKET")
+		}
+	default:
+		t.Fatal("expected TICKET, got", resp.Name())
+	}
+}
+
+// This test sends TOPICQUERY for a topic nobody registered and expects an empty
+// NODES response.
+func (s *Suite) TestTopicQueryEmpty(t *utesting.T) {
+	conn, l1 := s.listen1(t)
+	defer conn.close()
+
+	nodes, err := conn.topicQuery(l1, randomTopic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) > 0 {
+		t.Fatalf("remote returned %d nodes for unused topic", len(nodes))
+	}
+}
+
+// In this test, a node registers in a topic using a ticket. The registration is
+// then checked by querying the topic from another node. The topic is random, so
+// its queue on the remote node is empty and the ticket should not require waiting.
+func (s *Suite) TestTopicRegistration(t *utesting.T) {
+	topic := randomTopic()
+
+	// Get a ticket and register.
+	reg, l1 := s.listen1(t)
+	defer reg.close()
+	reg.setEndpoint(l1)
+
+	var ticket []byte
+	switch resp := reg.reqresp(l1, &v5wire.RequestTicket{ReqID: reg.nextReqID(), Topic: topic}).(type) {
+	case *v5wire.Ticket:
+		ticket = resp.Ticket
+	default:
+		t.Fatal("expected TICKET, got", resp.Name())
+	}
+	regtopic := &v5wire.Regtopic{ReqID: reg.nextReqID(), Ticket: ticket, ENR: reg.localNode.Node().Record()}
+	switch resp := reg.reqresp(l1, regtopic).(type) {
+	case *v5wire.Regconfirmation:
+		if !bytes.Equal(resp.ReqID, regtopic.ReqID) {
+			t.Fatalf("wrong request ID %x in REGCONFIRMATION, want %x", resp.ReqID, regtopic.ReqID)
+		}
+		if !resp.Registered {
+			t.Fatal("registration in empty topic queue was rejected")
+		}
+	default:
+		t.Fatal("expected REGCONFIRMATION, got", resp.Name())
+	}
+
+	// Using the ticket from another node must fail.
+	other, l2 := s.listen1(t)
+	defer other.close()
+	other.setEndpoint(l2)
+
+	forged := &v5wire.Regtopic{ReqID: other.nextReqID(), Ticket: ticket, ENR: other.localNode.Node().Record()}
+	switch resp := other.reqresp(l2, forged).(type) {
+	case *v5wire.Regconfirmation:
+		if resp.Registered {
+			t.Fatal("registration with ticket of another node was accepted")
+		}
+	default:
+		t.Fatal("expected REGCONFIRMATION, got", resp.Name())
+	}
+
+	// Query the topic from the other node.
+	nodes, err := other.topicQuery(l2, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].ID() != reg.localNode.ID() {
+		t.Fatalf("remote returned %d nodes for topic, want the registered node", len(nodes))
+	}
+}
+
+// randomTopic creates a topic identifier nobody is registered in.
+func randomTopic() []byte {
+	topic := make([]byte, 32)
+	rand.Read(topic)
+	return topic
+}
+
 // A bystander is a node whose only purpose is filling a spot in the remote table.
 type bystander struct {
 	dest *enode.Node
@@ -142,9 +142,18 @@ func (tc *conn) reqresp(c net.PacketConn, req v5wire.Packet) v5wire.Packet {
 
 // findnode sends a FINDNODE request and waits for its responses.
 func (tc *conn) findnode(c net.PacketConn, dists []uint) ([]*enode.Node, error) {
+	return tc.nodesRequest(c, &v5wire.Findnode{ReqID: tc.nextReqID(), Distances: dists})
+}
+
+// topicQuery sends a TOPICQUERY request and waits for its responses.
+func (tc *conn) topicQuery(c net.PacketConn, topic []byte) ([]*enode.Node, error) {
+	return tc.nodesRequest(c, &v5wire.TopicQuery{ReqID: tc.nextReqID(), Topic: topic})
+}
+
+// nodesRequest sends a request answered by NODES and waits for its responses.
+func (tc *conn) nodesRequest(c net.PacketConn, req v5wire.Packet) ([]*enode.Node, error) {
 	var (
-		findnode = &v5wire.Findnode{ReqID: tc.nextReqID(), Distances: dists}
-		reqnonce = tc.write(c, findnode, nil)
+		reqnonce = tc.write(c, req, nil)
 		first    = true
 		total    uint8
 		results  []*enode.Node
@@ -155,7 +164,7 @@ func (tc *conn) findnode(c net.PacketConn, dists []uint) ([]*enode.Node, error)
 			// Handle handshake.
 			if resp.Nonce == reqnonce {
 				resp.Node = tc.remote
-				tc.write(c, findnode, resp)
+				tc.write(c, req, resp)
 			} else {
 				return nil, fmt.Errorf("unexpected WHOAREYOU (nonce %x), waiting for NODES", resp.Nonce[:])
 			}
@@ -167,7 +176,7 @@ func (tc *conn) findnode(c net.PacketConn, dists []uint) ([]*enode.Node, error)
 			}, nil)
 		case *v5wire.Nodes:
 			// Got NODES! Check request ID.
-			if !bytes.Equal(resp.ReqID, findnode.ReqID) {
+			if !bytes.Equal(resp.ReqID, req.RequestID()) {
 				return nil, fmt.Errorf("NODES response has wrong request id %x", resp.ReqID)
 			}
 			// Check total count. It should be greater than one
@@ -0,0 +1,316 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/eth/protocols/snap"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	rlpxDecodeCommand = cli.Command{
+		Name:      "decode",
+		Usage:     "Pretty-prints a p2p traffic recording",
+		ArgsUsage: "<recording.rlp>",
+		Action:    rlpxDecode,
+		Flags: []cli.Flag{
+			decodeSummaryFlag,
+			decodeProtocolFlag,
+		},
+	}
+	decodeSummaryFlag = cli.BoolFlag{
+		Name:  "summary",
+		Usage: "Print message names only, without content",
+	}
+	decodeProtocolFlag = cli.StringFlag{
+		Name:  "protocol",
+		Usage: "Only print messages of the given protocol (use 'p2p' for base protocol messages)",
+	}
+)
+
+// msgType describes a message of a known protocol.
+type msgType struct {
+	name string
+	new  func() interface{} // creates the decoding target, nil for generic decoding
+}
+
+// Message types of the devp2p base protocol.
+var baseMessages = map[uint64]msgType{
+	0x00: {"Hello", nil},
+	0x01: {"Disconnect", func() interface{} { return new([]p2p.DiscReason) }},
+	0x02: {"Ping", nil},
+	0x03: {"Pong", nil},
+}
+
+// Message types of eth/66. Older versions use the same codes but lack the
+// request IDs, their types are in ethLegacyMessages.
+var ethMessages = map[uint64]msgType{
+	eth.StatusMsg:                     {"Status", func() interface{} { return new(eth.StatusPacket) }},
+	eth.NewBlockHashesMsg:             {"NewBlockHashes", func() interface{} { return new(eth.NewBlockHashesPacket) }},
+	eth.TransactionsMsg:               {"Transactions", func() interface{} { return new(eth.TransactionsPacket) }},
+	eth.GetBlockHeadersMsg:            {"GetBlockHeaders", func() interface{} { return new(eth.GetBlockHeadersPacket66) }},
+	eth.BlockHeadersMsg:               {"BlockHeaders", func() interface{} { return new(eth.BlockHeadersPacket66) }},
+	eth.GetBlockBodiesMsg:             {"GetBlockBodies", func() interface{} { return new(eth.GetBlockBodiesPacket66) }},
+	eth.BlockBodiesMsg:                {"BlockBodies", func() interface{} { return new(eth.BlockBodiesPacket66) }},
+	eth.NewBlockMsg:                   {"NewBlock", func() interface{} { return new(newBlockPacket) }},
+	eth.NewPooledTransactionHashesMsg: {"NewPooledTransactionHashes", func() interface{} { return new(eth.NewPooledTransactionHashesPacket) }},
+	eth.GetPooledTransactionsMsg:      {"GetPooledTransactions", func() interface{} { return new(eth.GetPooledTransactionsPacket66) }},
+	eth.PooledTransactionsMsg:         {"PooledTransactions", func() interface{} { return new(eth.PooledTransactionsPacket66) }},
+	eth.GetNodeDataMsg:                {"GetNodeData", func() interface{} { return new(eth.GetNodeDataPacket66) }},
+	eth.NodeDataMsg:                   {"NodeData", func() interface{} { return new(eth.NodeDataPacket66) }},
+	eth.GetReceiptsMsg:                {"GetReceipts", func() interface{} { return new(eth.GetReceiptsPacket66) }},
+	eth.ReceiptsMsg:                   {"Receipts", func() interface{} { return new(eth.ReceiptsPacket66) }},
+}
+
+// Message types of eth/64 and eth/65 which differ from eth/66.
+var ethLegacyMessages = map[uint64]msgType{
+	eth.GetBlockHeadersMsg:       {"GetBlockHeaders", func() interface{} { return new(eth.GetBlockHeadersPacket) }},
+	eth.BlockHeadersMsg:          {"BlockHeaders", func() interface{} { return new(eth.BlockHeadersPacket) }},
+	eth.GetBlockBodiesMsg:        {"GetBlockBodies", func() interface{} { return new(eth.GetBlockBodiesPacket) }},
+	eth.BlockBodiesMsg:           {"BlockBodies", func() interface{} { return new(eth.BlockBodiesPacket) }},
+	eth.GetPooledTransactionsMsg: {"GetPooledTransactions", func() interface{} { return new(eth.GetPooledTransactionsPacket) }},
+	eth.PooledTransactionsMsg:    {"PooledTransactions", func() interface{} { return new(eth.PooledTransactionsPacket) }},
+	eth.GetNodeDataMsg:           {"GetNodeData", func() interface{} { return new(eth.GetNodeDataPacket) }},
+	eth.NodeDataMsg:              {"NodeData", func() interface{} { return new(eth.NodeDataPacket) }},
+	eth.GetReceiptsMsg:           {"GetReceipts", func() interface{} { return new(eth.GetReceiptsPacket) }},
+	eth.ReceiptsMsg:              {"Receipts", func() interface{} { return new(eth.ReceiptsPacket) }},
+}
+
+// Message types of snap/1.
+var snapMessages = map[uint64]msgType{
+	snap.GetAccountRangeMsg:  {"GetAccountRange", func() interface{} { return new(snap.GetAccountRangePacket) }},
+	snap.AccountRangeMsg:     {"AccountRange", func() interface{} { return new(snap.AccountRangePacket) }},
+	snap.GetStorageRangesMsg: {"GetStorageRanges", func() interface{} { return new(snap.GetStorageRangesPacket) }},
+	snap.StorageRangesMsg:    {"StorageRanges", func() interface{} { return new(snap.StorageRangesPacket) }},
+	snap.GetByteCodesMsg:     {"GetByteCodes", func() interface{} { return new(snap.GetByteCodesPacket) }},
+	snap.ByteCodesMsg:        {"ByteCodes", func() interface{} { return new(snap.ByteCodesPacket) }},
+	snap.GetTrieNodesMsg:     {"GetTrieNodes", func() interface{} { return new(snap.GetTrieNodesPacket) }},
+	snap.TrieNodesMsg:        {"TrieNodes", func() interface{} { return new(snap.TrieNodesPacket) }},
+}
+
+// Message names of les. The les message types are internal to its package,
+// so the content is decoded generically.
+var lesMessages = map[uint64]msgType{
+	0x00: {"Status", nil},
+	0x01: {"Announce", nil},
+	0x02: {"GetBlockHeaders", nil},
+	0x03: {"BlockHeaders", nil},
+	0x04: {"GetBlockBodies", nil},
+	0x05: {"BlockBodies", nil},
+	0x06: {"GetReceipts", nil},
+	0x07: {"Receipts", nil},
+	0x0a: {"GetCode", nil},
+	0x0b: {"Code", nil},
+	0x0f: {"GetProofsV2", nil},
+	0x10: {"ProofsV2", nil},
+	0x11: {"GetHelperTrieProofs", nil},
+	0x12: {"HelperTrieProofs", nil},
+	0x13: {"SendTxV2", nil},
+	0x14: {"GetTxStatus", nil},
+	0x15: {"TxStatus", nil},
+	0x16: {"Stop", nil},
+	0x17: {"Resume", nil},
+}
+
+// newBlockPacket mirrors eth.NewBlockPacket with the block in its RLP form,
+// because types.Block has no JSON encoding.
+type newBlockPacket struct {
+	Block struct {
+		Header       *types.Header
+		Transactions []*types.Transaction
+		Uncles       []*types.Header
+	}
+	TD *big.Int
+}
+
+// lookupMsgType returns the type of a recorded message.
+func lookupMsgType(rec *p2p.MsgRecord) (msgType, bool) {
+	var (
+		t  msgType
+		ok bool
+	)
+	switch rec.Protocol {
+	case "":
+		t, ok = baseMessages[rec.Code]
+	case eth.ProtocolName:
+		if rec.Version < eth.ETH66 {
+			if t, ok = ethLegacyMessages[rec.Code]; ok {
+				break
+			}
+		}
+		t, ok = ethMessages[rec.Code]
+	case snap.ProtocolName:
+		t, ok = snapMessages[rec.Code]
+	case "les":
+		t, ok = lesMessages[rec.Code]
+	}
+	return t, ok
+}
+
+// decodeRecord decodes the content of a recorded message.
+func decodeRecord(rec *p2p.MsgRecord) (name string, content interface{}, err error) {
+	t, ok := lookupMsgType(rec)
+	if !ok {
+		t.name = "Unknown"
+	}
+	if t.new == nil {
+		var generic interface{}
+		if len(rec.Payload) > 0 {
+			err = rlp.DecodeBytes(rec.Payload, &generic)
+		}
+		return t.name, generic, err
+	}
+	content = t.new()
+	err = rlp.DecodeBytes(rec.Payload, content)
+	return t.name, content, err
+}
+
+func rlpxDecode(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		exit("missing path to recording as command-line argument")
+	}
+	records, err := p2p.ReadRecordingFile(ctx.Args()[0])
+	if err != nil && len(records) == 0 {
+		return err
+	}
+	filter, filtered := ctx.String(decodeProtocolFlag.Name), ctx.IsSet(decodeProtocolFlag.Name)
+	for _, rec := range records {
+		if filtered && rec.Protocol != filter && !(filter == "p2p" && rec.Protocol == "") {
+			continue
+		}
+		printRecord(ctx.App.Writer, rec, ctx.Bool(decodeSummaryFlag.Name))
+	}
+	// Truncated recordings are still printed up to the point of corruption.
+	return err
+}
+
+// printRecord writes a human-readable representation of the message.
+func printRecord(w io.Writer, rec *p2p.MsgRecord, summary bool) {
+	dir, proto := "->", "p2p"
+	if rec.Inbound {
+		dir = "<-"
+	}
+	if rec.Protocol != "" {
+		proto = fmt.Sprintf("%s/%d", rec.Protocol, rec.Version)
+	}
+	name, content, err := decodeRecord(rec)
+	fmt.Fprintf(w, "%s %s %s %s (code %#02x, %d bytes)\n", rec.ReceivedAt().Format("2006-01-02 15:04:05.000000"), dir, proto, name, rec.Code, len(rec.Payload))
+	if summary {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(w, "  invalid content: %v\n  %x\n", err, rec.Payload)
+		return
+	}
+	if content == nil {
+		return
+	}
+	out, err := json.MarshalIndent(jsonValue(reflect.ValueOf(content)), "  ", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "  can't print content: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "  %s\n", out)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// jsonValue converts a decoded message for JSON output. Byte slices are shown as
+// hex instead of base64 and struct fields are kept in declaration order.
+func jsonValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return jsonValue(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return hexutil.Bytes(b)
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = jsonValue(v.Index(i))
+		}
+		return list
+	case reflect.Struct:
+		var fields jsonFields
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" {
+				fields = append(fields, jsonField{f.Name, jsonValue(v.Field(i))})
+			}
+		}
+		return fields
+	default:
+		return v.Interface()
+	}
+}
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+// jsonFields is a JSON object with ordered keys.
+type jsonFields []jsonField
+
+func (fields jsonFields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
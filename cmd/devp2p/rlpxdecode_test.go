@@ -0,0 +1,100 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/eth/protocols/snap"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestPrintRecord(t *testing.T) {
+	encode := func(v interface{}) []byte {
+		enc, err := rlp.EncodeToBytes(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}
+	tests := []struct {
+		rec  *p2p.MsgRecord
+		want []string
+	}{
+		{
+			rec: &p2p.MsgRecord{
+				Inbound:  true,
+				Protocol: "eth",
+				Version:  66,
+				Code:     eth.GetBlockHeadersMsg,
+				Payload: encode(&eth.GetBlockHeadersPacket66{
+					RequestId:             7,
+					GetBlockHeadersPacket: &eth.GetBlockHeadersPacket{Origin: eth.HashOrNumber{Number: 100}, Amount: 2},
+				}),
+			},
+			want: []string{`<- eth/66 GetBlockHeaders (code 0x03`, `"RequestId": 7`, `"Number": 100`, `"Amount": 2`},
+		},
+		{
+			rec: &p2p.MsgRecord{
+				Protocol: "eth",
+				Version:  65,
+				Code:     eth.GetBlockHeadersMsg,
+				Payload:  encode(&eth.GetBlockHeadersPacket{Origin: eth.HashOrNumber{Number: 100}, Amount: 2}),
+			},
+			want: []string{`-> eth/65 GetBlockHeaders (code 0x03`, `"Number": 100`},
+		},
+		{
+			rec: &p2p.MsgRecord{
+				Protocol: "snap",
+				Version:  1,
+				Code:     snap.GetByteCodesMsg,
+				Payload:  encode(&snap.GetByteCodesPacket{ID: 3, Hashes: []common.Hash{{0x01}}, Bytes: 1000}),
+			},
+			want: []string{`-> snap/1 GetByteCodes`, `"ID": 3`, `"0x0100000000000000000000000000000000000000000000000000000000000000"`},
+		},
+		{
+			rec:  &p2p.MsgRecord{Inbound: true, Code: 0x01, Payload: encode([]p2p.DiscReason{p2p.DiscTooManyPeers})},
+			want: []string{`<- p2p Disconnect (code 0x01`, `4`},
+		},
+		{
+			rec:  &p2p.MsgRecord{Protocol: "les", Version: 4, Code: 0x14, Payload: encode([]interface{}{uint(1), []common.Hash{{0xff}}})},
+			want: []string{`-> les/4 GetTxStatus`, `"0x01"`, `"0xff00`},
+		},
+		{
+			rec:  &p2p.MsgRecord{Protocol: "foo", Version: 1, Code: 0x01, Payload: encode([]byte{0xca, 0xfe})},
+			want: []string{`-> foo/1 Unknown`, `"0xcafe"`},
+		},
+		{
+			rec:  &p2p.MsgRecord{Protocol: "eth", Version: 66, Code: eth.StatusMsg, Payload: []byte{0xc1, 0x01}},
+			want: []string{`eth/66 Status`, `invalid content`, `c101`},
+		},
+	}
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		printRecord(&buf, tt.rec, false)
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("test %d: output doesn't contain %q:\n%s", i, want, buf.String())
+			}
+		}
+	}
+}
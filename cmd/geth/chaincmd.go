@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
@@ -36,6 +37,11 @@ import (
 )
 
 var (
+	historyKeepFlag = cli.Uint64Flag{
+		Name:  "keep",
+		Usage: "Number of recent blocks to retain the bodies and receipts for",
+		Value: 90000,
+	}
 	initCommand = cli.Command{
 		Action:    utils.MigrateFlags(initGenesis),
 		Name:      "init",
@@ -118,6 +124,62 @@ Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
 be gzipped.`,
+	}
+	exportHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportHistory),
+		Name:      "export-history",
+		Usage:     "Export blockchain history into flat-file archives",
+		ArgsUsage: "<dir> [<blockNumFirst> <blockNumLast>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The export-history command exports the headers, bodies, receipts and total
+difficulties of the canonical chain into archive files of 8192 blocks each,
+named after the network, the epoch and the accumulator root of the content.
+Optional second and third arguments control the first and last block to
+export, the first block being rounded down to an archive boundary. A
+checksums.txt file listing the accumulator roots is written alongside.`,
+	}
+	importHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(importHistory),
+		Name:      "import-history",
+		Usage:     "Import blockchain history from flat-file archives",
+		ArgsUsage: "<dir>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.TxLookupLimitFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The import-history command imports the archives of the local network found in
+the given directory. Every archive is verified against its accumulator root and
+the checksums.txt file, if present, before its headers, bodies and receipts are
+inserted into the database. State is not regenerated, the blocks are imported
+the same way as during a fast sync.`,
+	}
+	verifyHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(verifyHistory),
+		Name:      "verify-history",
+		Usage:     "Verify the integrity of flat-file history archives",
+		ArgsUsage: "<dir> [<network>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The verify-history command checks the content of every archive in the given
+directory against its header, the accumulator root and the checksums.txt file,
+and ensures that consecutive archives form a chain. The network name defaults
+to the one of the local database.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -146,6 +208,27 @@ be gzipped.`,
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 The export-preimages command export hash preimages to an RLP encoded stream`,
+	}
+	pruneHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(pruneHistory),
+		Name:      "prune-history",
+		Usage:     "Expire ancient block bodies and receipts from the database",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			historyKeepFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The prune-history command deletes the bodies and receipts of the ancient blocks
+older than the given number of most recent blocks. Headers, hashes and total
+difficulties are always retained. The transaction indices of the expired blocks
+are removed too. Data is deleted in whole ancient data files, so some blocks
+below the threshold might remain available.`,
 	}
 	dumpCommand = cli.Command{
 		Action:    utils.MigrateFlags(dump),
@@ -331,6 +414,83 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// exportHistory exports the chain history into archives in the specified
+// directory.
+func exportHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, _ := utils.MakeChain(ctx, stack, true)
+	start := time.Now()
+
+	first, last := uint64(0), chain.CurrentBlock().NumberU64()
+	if len(ctx.Args()) >= 3 {
+		var ferr, lerr error
+		first, ferr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		last, lerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+		if ferr != nil || lerr != nil {
+			utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+		}
+	}
+	network := utils.HistoryNetworkName(chain.Genesis().Hash())
+	if err := utils.ExportHistory(chain, ctx.Args().First(), network, first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+// importHistory imports the history archives from the specified directory.
+func importHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+	start := time.Now()
+
+	network := utils.HistoryNetworkName(chain.Genesis().Hash())
+	if err := utils.ImportHistory(chain, ctx.Args().First(), network); err != nil {
+		utils.Fatalf("Import error: %v\n", err)
+	}
+	chain.Stop()
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
+// verifyHistory checks the integrity of the history archives in the specified
+// directory.
+func verifyHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 || len(ctx.Args()) > 2 {
+		utils.Fatalf("This command requires one or two arguments.")
+	}
+	network := ctx.Args().Get(1)
+	if network == "" {
+		stack, _ := makeConfigNode(ctx)
+		db := utils.MakeChainDatabase(ctx, stack)
+		genesis := rawdb.ReadCanonicalHash(db, 0)
+		db.Close()
+		stack.Close()
+
+		if genesis == (common.Hash{}) {
+			utils.Fatalf("No local genesis found, specify the network name")
+		}
+		network = utils.HistoryNetworkName(genesis)
+	}
+	start := time.Now()
+	if err := utils.VerifyHistory(ctx.Args().First(), network); err != nil {
+		utils.Fatalf("Verification error: %v\n", err)
+	}
+	fmt.Printf("Verification done in %v\n", time.Since(start))
+	return nil
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
@@ -369,6 +529,46 @@ func exportPreimages(ctx *cli.Context) error {
 	return nil
 }
 
+// pruneHistory expires the bodies and receipts of old ancient blocks.
+func pruneHistory(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	head := rawdb.ReadHeadBlockHash(db)
+	if head == (common.Hash{}) {
+		utils.Fatalf("Head block is missing")
+	}
+	number := rawdb.ReadHeaderNumber(db, head)
+	if number == nil {
+		utils.Fatalf("Head block number is missing")
+	}
+	keep := ctx.Uint64(historyKeepFlag.Name)
+	if *number+1 <= keep {
+		log.Info("Chain history shorter than retention window", "head", *number, "keep", keep)
+		return nil
+	}
+	var (
+		start = time.Now()
+		tail  = *number + 1 - keep
+	)
+	// The transaction indices can't be removed after the bodies are gone
+	if txtail := rawdb.ReadTxIndexTail(db); txtail != nil && *txtail < tail {
+		rawdb.UnindexTransactions(db, *txtail, tail, nil)
+	}
+	if err := db.TruncateAncientTail(tail); err != nil {
+		utils.Fatalf("Failed to expire chain history: %v", err)
+	}
+	pruned, err := db.AncientTail()
+	if err != nil {
+		utils.Fatalf("Failed to retrieve history tail: %v", err)
+	}
+	log.Info("Expired chain history", "head", *number, "limit", tail, "tail", pruned, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
 func dump(ctx *cli.Context) error {
 	stack, _ := makeConfigNode(ctx)
 	defer stack.Close()
@@ -17,23 +17,44 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethdb/leveldb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"gopkg.in/urfave/cli.v1"
 )
 
+var (
+	freezerRepairFlag = cli.BoolFlag{
+		Name:  "repair",
+		Usage: "Repair the ancient store if corruption is found",
+	}
+	freezerSourceFlag = cli.StringFlag{
+		Name:  "source",
+		Usage: "Directory of history archives to restore damaged ancient blocks from",
+	}
+)
+
 var (
 	removedbCommand = cli.Command{
 		Action:    utils.MigrateFlags(removeDB),
@@ -59,6 +80,12 @@ Remove blockchain and state databases`,
 			dbGetCmd,
 			dbDeleteCmd,
 			dbPutCmd,
+			dbDumpTrieCmd,
+			dbFreezerIndexCmd,
+			dbCheckStateContentCmd,
+			dbVerifyFreezerCmd,
+			dbExportCmd,
+			dbImportCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -103,6 +130,114 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		Usage:     "Set the value of a database key (WARNING: may corrupt your database)",
 		ArgsUsage: "<hex-encoded key> <hex-encoded value>",
 		Description: `This command sets a given database key to the given value. 
+WARNING: This is a low-level operation which may cause database corruption!`,
+	}
+	dbDumpTrieCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbDumpTrie),
+		Name:      "dumptrie",
+		Usage:     "Show the storage key/values of a given trie",
+		ArgsUsage: "<hex-encoded state root> [<hex-encoded account hash or address>] [<hex-encoded start>] [<max elements>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Description: `This command iterates the trie with the given root directly from the
+database. If an account is given, its storage trie within the state root is dumped
+instead. The iteration can be limited to start at a given key and to yield a maximum
+number of elements.`,
+	}
+	dbFreezerIndexCmd = cli.Command{
+		Action:    utils.MigrateFlags(freezerInspect),
+		Name:      "freezer-index",
+		Usage:     "Dump out the index of a given freezer table",
+		ArgsUsage: "<table> [<start> <end>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Description: `This command prints the index entries of the given ancient table
+(headers, hashes, bodies, receipts or diffs), optionally limited to the items between
+start and end. The entire index is checked for inconsistencies with itself and the
+data files, without modifying them.`,
+	}
+	dbCheckStateContentCmd = cli.Command{
+		Action:    utils.MigrateFlags(checkStateContent),
+		Name:      "check-state-content",
+		Usage:     "Verify that state data is cryptographically correct",
+		ArgsUsage: "[<hex-encoded start>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Description: `This command iterates the database over all 32 byte keys, which are
+trie nodes and legacy contract codes, and checks that the value hashes to the key.
+The iteration can optionally start at a given key.`,
+	}
+	dbVerifyFreezerCmd = cli.Command{
+		Action:    utils.MigrateFlags(verifyFreezer),
+		Name:      "verify-freezer",
+		Usage:     "Verify the integrity of the ancient store and optionally repair it",
+		ArgsUsage: "[<start>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			freezerRepairFlag,
+			freezerSourceFlag,
+		},
+		Description: `This command checks the index files of every ancient table against their
+data files, then walks the ancient blocks from the optional start number, checking
+that headers hash to the stored canonical hashes and form a chain, that total
+difficulties accumulate correctly, and that bodies and receipts match the roots in
+their headers.
+
+With --repair, the ancient store is fixed from the first corrupted block onwards.
+If --source points to a directory of history archives (see export-history), the
+damaged range is rewritten from the verified archives. Otherwise, the chain is
+rewound to the last intact block and the rest will be synced again from the
+network.`,
+	}
+	dbExportCmd = cli.Command{
+		Action:    utils.MigrateFlags(exportKeyRange),
+		Name:      "export",
+		Usage:     "Export a key range of the database into a compressed file",
+		ArgsUsage: "<hex-encoded prefix> <dumpfile> [<hex-encoded start>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Description: `This command exports all the database entries whose key starts with
+the given prefix, optionally starting at a given key, into a gzip compressed dump.
+Use "0x" as the prefix to export the entire key-value store.`,
+	}
+	dbImportCmd = cli.Command{
+		Action:    utils.MigrateFlags(importKeyRange),
+		Name:      "import",
+		Usage:     "Import a key range dump into the database (WARNING: may corrupt your database)",
+		ArgsUsage: "<dumpfile>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Description: `This command imports the entries of a dump created by "geth db export",
+overwriting any existing values of the same keys.
 WARNING: This is a low-level operation which may cause database corruption!`,
 	}
 )
@@ -339,3 +474,305 @@ func dbPut(ctx *cli.Context) error {
 	}
 	return db.Put(key, value)
 }
+
+// dbDumpTrie shows the key-value slots of a given trie
+func dbDumpTrie(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 4 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var (
+		root  common.Hash
+		start []byte
+		max   = int64(-1)
+	)
+	if blob, err := hexutil.Decode(ctx.Args().Get(0)); err != nil || len(blob) != common.HashLength {
+		return fmt.Errorf("invalid state root %q", ctx.Args().Get(0))
+	} else {
+		root = common.BytesToHash(blob)
+	}
+	triedb := trie.NewDatabase(db)
+	if ctx.NArg() >= 2 {
+		owner, err := hexutil.Decode(ctx.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("failed to hex-decode account: %v", err)
+		}
+		switch len(owner) {
+		case common.AddressLength:
+			owner = crypto.Keccak256(owner)
+		case common.HashLength:
+		default:
+			return fmt.Errorf("invalid account %q", ctx.Args().Get(1))
+		}
+		accTrie, err := trie.New(root, triedb)
+		if err != nil {
+			return err
+		}
+		blob, err := accTrie.TryGet(owner)
+		if err != nil {
+			return err
+		}
+		if blob == nil {
+			return fmt.Errorf("account %x not found in state %x", owner, root)
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			return fmt.Errorf("invalid account %x: %v", owner, err)
+		}
+		root = acc.Root
+	}
+	if ctx.NArg() >= 3 {
+		var err error
+		if start, err = hexutil.Decode(ctx.Args().Get(2)); err != nil {
+			return fmt.Errorf("failed to hex-decode 'start': %v", err)
+		}
+	}
+	if ctx.NArg() >= 4 {
+		var err error
+		if max, err = strconv.ParseInt(ctx.Args().Get(3), 10, 64); err != nil {
+			return fmt.Errorf("invalid 'max' value %q: %v", ctx.Args().Get(3), err)
+		}
+	}
+	log.Info("Dumping trie", "root", root, "start", common.Bytes2Hex(start), "max", max)
+
+	tr, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	var count int64
+	it := trie.NewIterator(tr.NodeIterator(start))
+	for it.Next() {
+		if max > 0 && count == max {
+			fmt.Printf("Exiting after %d values\n", count)
+			break
+		}
+		fmt.Printf("  %d. key %#x: %#x\n", count, it.Key, it.Value)
+		count++
+	}
+	return it.Err
+}
+
+// freezerInspect dumps the index entries of a freezer table
+func freezerInspect(ctx *cli.Context) error {
+	if ctx.NArg() != 1 && ctx.NArg() != 3 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	var (
+		table = ctx.Args().Get(0)
+		start = uint64(0)
+		end   = uint64(math.MaxUint64)
+	)
+	if ctx.NArg() == 3 {
+		var serr, eerr error
+		start, serr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		end, eerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+		if serr != nil || eerr != nil {
+			return fmt.Errorf("invalid range: %v", ctx.Command.ArgsUsage)
+		}
+	}
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	path := ancientPath(stack, &config)
+	log.Info("Inspecting freezer", "path", path, "table", table, "start", start, "end", end)
+	return rawdb.InspectFreezerTable(path, table, start, end)
+}
+
+// ancientPath resolves the location of the ancient store of the full node.
+func ancientPath(stack *node.Node, config *gethConfig) string {
+	path := config.Eth.DatabaseFreezer
+	switch {
+	case path == "":
+		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case !filepath.IsAbs(path):
+		path = config.Node.ResolvePath(path)
+	}
+	return path
+}
+
+// verifyFreezer checks the integrity of the ancient store and repairs it if
+// requested
+func verifyFreezer(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return fmt.Errorf("max 1 argument: %v", ctx.Command.ArgsUsage)
+	}
+	var start uint64
+	if ctx.NArg() == 1 {
+		var err error
+		if start, err = strconv.ParseUint(ctx.Args().First(), 10, 64); err != nil {
+			return fmt.Errorf("invalid start block %q: %v", ctx.Args().First(), err)
+		}
+	}
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	// Check the raw index files before opening the database repairs anything
+	path := ancientPath(stack, &config)
+	log.Info("Verifying ancient indices", "path", path)
+	first, err := rawdb.VerifyFreezerIndex(path)
+	if err != nil {
+		return err
+	}
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	log.Info("Verifying ancient blocks", "start", start)
+	number, err := core.VerifyAncients(db, start, func(c *core.AncientCorruption) {
+		log.Error("Corrupted ancient block", "number", c.Number, "err", c.Err)
+	})
+	if err != nil {
+		return err
+	}
+	if number < first {
+		first = number
+	}
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	if first >= frozen {
+		log.Info("Ancient store verified", "start", start, "frozen", frozen)
+		return nil
+	}
+	if !ctx.Bool(freezerRepairFlag.Name) {
+		return fmt.Errorf("ancient store corrupted from block #%d, rerun with --%s to fix", first, freezerRepairFlag.Name)
+	}
+	if first == 0 {
+		return errors.New("ancient genesis corrupted, the database needs to be resynced")
+	}
+	// Rewrite the damaged range from history archives if available
+	if source := ctx.String(freezerSourceFlag.Name); source != "" {
+		network := utils.HistoryNetworkName(rawdb.ReadCanonicalHash(db, 0))
+		if err := utils.RefillAncients(db, source, network, first); err != nil {
+			return err
+		}
+		number, err := core.VerifyAncients(db, first, func(c *core.AncientCorruption) {
+			log.Error("Corrupted ancient block", "number", c.Number, "err", c.Err)
+		})
+		if err != nil {
+			return err
+		}
+		if number < frozen {
+			return fmt.Errorf("ancient store still corrupted from block #%d", number)
+		}
+		log.Info("Ancient store repaired", "from", first, "frozen", frozen)
+		return nil
+	}
+	// Otherwise rewind the chain to the last intact block to resync the rest
+	db.Close()
+
+	chain, chainDb := utils.MakeChain(ctx, stack, false)
+	defer chainDb.Close()
+
+	log.Warn("Rewinding chain to the last intact ancient block", "number", first-1)
+	if err := chain.SetHead(first - 1); err != nil {
+		return err
+	}
+	chain.Stop()
+	log.Info("Ancient store truncated, remaining blocks will be resynced", "head", first-1)
+	return nil
+}
+
+// checkStateContent verifies that the trie nodes and codes in the database
+// hash to their keys
+func checkStateContent(ctx *cli.Context) error {
+	var start []byte
+	if ctx.NArg() > 1 {
+		return fmt.Errorf("max 1 argument: %v", ctx.Command.ArgsUsage)
+	}
+	if ctx.NArg() > 0 {
+		d, err := hexutil.Decode(ctx.Args().First())
+		if err != nil {
+			return fmt.Errorf("failed to hex-decode 'start': %v", err)
+		}
+		start = d
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var (
+		it        = db.NewIterator(nil, start)
+		hasher    = crypto.NewKeccakState()
+		got       = make([]byte, common.HashLength)
+		errs      int
+		count     int
+		startTime = time.Now()
+		lastLog   = time.Now()
+	)
+	defer it.Release()
+
+	for it.Next() {
+		k, v := it.Key(), it.Value()
+		if len(k) != common.HashLength {
+			continue
+		}
+		count++
+		hasher.Reset()
+		hasher.Write(v)
+		hasher.Read(got)
+		if !bytes.Equal(k, got) {
+			errs++
+			fmt.Printf("Error at %#x\n", k)
+			fmt.Printf("  Hash:  %#x\n", got)
+			fmt.Printf("  Data:  %#x\n", v)
+		}
+		if time.Since(lastLog) > 8*time.Second {
+			log.Info("Iterating the database", "at", fmt.Sprintf("%#x", k), "elapsed", common.PrettyDuration(time.Since(startTime)))
+			lastLog = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	log.Info("Iterated the state content", "errors", errs, "items", count)
+	if errs > 0 {
+		return fmt.Errorf("found %d corrupted state entries", errs)
+	}
+	return nil
+}
+
+// exportKeyRange exports a key range of the database into a dump file
+func exportKeyRange(ctx *cli.Context) error {
+	if ctx.NArg() < 2 || ctx.NArg() > 3 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	prefix, err := hexutil.Decode(ctx.Args().Get(0))
+	if err != nil {
+		return fmt.Errorf("failed to hex-decode 'prefix': %v", err)
+	}
+	var start []byte
+	if ctx.NArg() == 3 {
+		if start, err = hexutil.Decode(ctx.Args().Get(2)); err != nil {
+			return fmt.Errorf("failed to hex-decode 'start': %v", err)
+		}
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	return utils.ExportKeyRange(db, ctx.Args().Get(1), prefix, start)
+}
+
+// importKeyRange imports a key range dump into the database
+func importKeyRange(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	return utils.ImportKeyRange(db, ctx.Args().First())
+}
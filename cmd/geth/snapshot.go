@@ -17,8 +17,13 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"errors"
+	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
@@ -142,6 +147,47 @@ verification. The default checking target is the HEAD state. It's basically iden
 to traverse-state, but the check granularity is smaller. 
 
 It's also usable without snapshot enabled.
+`,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export the state snapshot into a portable file",
+				ArgsUsage: "[<root>] <file>",
+				Action:    utils.MigrateFlags(exportSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot export [<state-root>] <file>
+will stream all the accounts, storage slots and contract codes of the snapshot
+with the given root into a chunked, checksummed file. The default export target
+is the HEAD state. If the file name ends with .gz, the output is gzipped.
+`,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import a state snapshot from a portable file",
+				ArgsUsage: "<file>",
+				Action:    utils.MigrateFlags(importSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot import <file>
+will read a file created by "geth snapshot export", verify the checksum of every
+chunk and rebuild both the state snapshot and the state trie from it. The import
+is aborted if the regenerated state root doesn't match the exported one. Any
+existing snapshot in the database is discarded.
 `,
 			},
 		},
@@ -428,6 +474,92 @@ func traverseRawState(ctx *cli.Context) error {
 	return nil
 }
 
+// exportSnapshot streams the snapshot at the given root into a portable file.
+func exportSnapshot(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, chaindb := utils.MakeChain(ctx, stack, true)
+	defer chaindb.Close()
+
+	if ctx.NArg() < 1 {
+		log.Error("Missing export file")
+		return errors.New("missing export file")
+	}
+	if ctx.NArg() > 2 {
+		log.Error("Too many arguments given")
+		return errors.New("too many arguments")
+	}
+	var (
+		root = chain.CurrentBlock().Root()
+		file = ctx.Args()[ctx.NArg()-1]
+		err  error
+	)
+	if ctx.NArg() == 2 {
+		root, err = parseRoot(ctx.Args()[0])
+		if err != nil {
+			log.Error("Failed to resolve state root", "error", err)
+			return err
+		}
+	}
+	snaptree, err := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, chain.CurrentBlock().Root(), false, false, false)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "error", err)
+		return err
+	}
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var writer io.Writer = out
+	if strings.HasSuffix(file, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	log.Info("Exporting state snapshot", "root", root, "file", file)
+	if err := snapshot.Export(snaptree, root, writer); err != nil {
+		log.Error("Failed to export snapshot", "error", err)
+		return err
+	}
+	return nil
+}
+
+// importSnapshot rebuilds the snapshot and the state trie from a portable file.
+func importSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		log.Error("Missing import file")
+		return errors.New("missing import file")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	file := ctx.Args()[0]
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var reader io.Reader = bufio.NewReader(in)
+	if strings.HasSuffix(file, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return err
+		}
+	}
+	root, err := snapshot.Import(chaindb, reader)
+	if err != nil {
+		log.Error("Failed to import snapshot", "error", err)
+		return err
+	}
+	log.Info("Imported the state snapshot", "root", root)
+	return nil
+}
+
 func parseRoot(input string) (common.Hash, error) {
 	var h common.Hash
 	if err := h.UnmarshalText([]byte(input)); err != nil {
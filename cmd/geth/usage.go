@@ -50,10 +50,13 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
 			utils.TxLookupLimitFlag,
+			utils.HistoryLimitFlag,
+			utils.StateHistoryFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
 			utils.WhitelistFlag,
+			utils.SyncTargetFlag,
 		},
 	},
 	{
@@ -90,6 +93,13 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.EthashDatasetsLockMmapFlag,
 		},
 	},
+	{
+		Name: "CLIQUE",
+		Flags: []cli.Flag{
+			utils.CliqueStatsWindowFlag,
+			utils.CliqueMissedTurnsFlag,
+		},
+	},
 	{
 		Name: "TRANSACTION POOL",
 		Flags: []cli.Flag{
@@ -97,6 +107,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.TxPoolNoLocalsFlag,
 			utils.TxPoolJournalFlag,
 			utils.TxPoolRejournalFlag,
+			utils.TxPoolPoolJournalFlag,
 			utils.TxPoolPriceLimitFlag,
 			utils.TxPoolPriceBumpFlag,
 			utils.TxPoolAccountSlotsFlag,
@@ -172,6 +183,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.NetrestrictFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
+			utils.NetRecordFlag,
 		},
 	},
 	{
@@ -203,6 +215,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.VMEnableDebugFlag,
 			utils.EVMInterpreterFlag,
 			utils.EWASMInterpreterFlag,
+			utils.VMParallelFlag,
 		},
 	},
 	{
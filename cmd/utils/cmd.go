@@ -18,6 +18,7 @@
 package utils
 
 import (
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -344,3 +345,141 @@ func ExportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Exported preimages", "file", fn)
 	return nil
 }
+
+// keyRangeMagic is the identifier written at the start of database key range
+// dumps, to avoid importing arbitrary files.
+const keyRangeMagic = "gethdbdump"
+
+// keyRangeHeader is the first entry of a database key range dump.
+type keyRangeHeader struct {
+	Magic   string
+	Version uint64
+	Prefix  []byte
+	Start   []byte
+	Time    uint64
+}
+
+// keyRangeEntry is a single database entry in a key range dump.
+type keyRangeEntry struct {
+	Key []byte
+	Val []byte
+}
+
+// ExportKeyRange exports all the database entries with the given key prefix,
+// starting at the given key, into the specified gzip compressed file.
+func ExportKeyRange(db ethdb.Database, fn string, prefix []byte, start []byte) error {
+	log.Info("Exporting database key range", "file", fn, "prefix", common.Bytes2Hex(prefix), "start", common.Bytes2Hex(start))
+
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	writer := gzip.NewWriter(fh)
+	defer writer.Close()
+
+	header := &keyRangeHeader{
+		Magic:   keyRangeMagic,
+		Version: 0,
+		Prefix:  prefix,
+		Start:   start,
+		Time:    uint64(time.Now().Unix()),
+	}
+	if err := rlp.Encode(writer, header); err != nil {
+		return err
+	}
+	// Iterate over the key range and export the entries
+	it := db.NewIterator(prefix, start)
+	defer it.Release()
+
+	var (
+		count  uint64
+		begin  = time.Now()
+		logged = time.Now()
+	)
+	for it.Next() {
+		if err := rlp.Encode(writer, &keyRangeEntry{Key: it.Key(), Val: it.Value()}); err != nil {
+			return err
+		}
+		count++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting database key range", "count", count, "key", common.Bytes2Hex(it.Key()), "elapsed", common.PrettyDuration(time.Since(begin)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	log.Info("Exported database key range", "file", fn, "count", count, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
+
+// ImportKeyRange imports a database key range dump created by ExportKeyRange,
+// overwriting any existing entries with the same keys.
+func ImportKeyRange(db ethdb.Database, fn string) error {
+	log.Info("Importing database key range", "file", fn)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	reader, err := gzip.NewReader(fh)
+	if err != nil {
+		return err
+	}
+	stream := rlp.NewStream(reader, 0)
+
+	var header keyRangeHeader
+	if err := stream.Decode(&header); err != nil {
+		return fmt.Errorf("invalid dump header: %v", err)
+	}
+	if header.Magic != keyRangeMagic {
+		return fmt.Errorf("invalid dump magic %q", header.Magic)
+	}
+	if header.Version != 0 {
+		return fmt.Errorf("unsupported dump version %d", header.Version)
+	}
+	log.Info("Importing database key range", "prefix", common.Bytes2Hex(header.Prefix), "start", common.Bytes2Hex(header.Start), "exported", time.Unix(int64(header.Time), 0))
+
+	// Import the entries in batches to prevent disk trashing
+	var (
+		batch  = db.NewBatch()
+		count  uint64
+		begin  = time.Now()
+		logged = time.Now()
+	)
+	for {
+		var entry keyRangeEntry
+		if err := stream.Decode(&entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("at entry %d: %v", count, err)
+		}
+		if !bytes.HasPrefix(entry.Key, header.Prefix) {
+			return fmt.Errorf("entry %d: key %x outside of prefix %x", count, entry.Key, header.Prefix)
+		}
+		if err := batch.Put(entry.Key, entry.Val); err != nil {
+			return err
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		count++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing database key range", "count", count, "elapsed", common.PrettyDuration(time.Since(begin)))
+			logged = time.Now()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Imported database key range", "file", fn, "count", count, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+// Tests that a key range of the database can be exported and imported.
+func TestKeyRangeExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyrange-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := rawdb.NewMemoryDatabase()
+	for i := 0; i < 100; i++ {
+		db.Put([]byte(fmt.Sprintf("a-%03d", i)), []byte(fmt.Sprintf("val-%d", i)))
+		db.Put([]byte(fmt.Sprintf("b-%03d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	fn := filepath.Join(dir, "dump.gz")
+	if err := ExportKeyRange(db, fn, []byte("a-"), []byte("050")); err != nil {
+		t.Fatalf("failed to export key range: %v", err)
+	}
+	imported := rawdb.NewMemoryDatabase()
+	if err := ImportKeyRange(imported, fn); err != nil {
+		t.Fatalf("failed to import key range: %v", err)
+	}
+	it := imported.NewIterator(nil, nil)
+	defer it.Release()
+
+	var count int
+	for it.Next() {
+		want := []byte(fmt.Sprintf("a-%03d", 50+count))
+		if !bytes.Equal(it.Key(), want) {
+			t.Fatalf("key %d mismatch: have %s, want %s", count, it.Key(), want)
+		}
+		if val := []byte(fmt.Sprintf("val-%d", 50+count)); !bytes.Equal(it.Value(), val) {
+			t.Fatalf("value %d mismatch: have %s, want %s", count, it.Value(), val)
+		}
+		count++
+	}
+	if count != 50 {
+		t.Fatalf("imported entry count mismatch: have %d, want %d", count, 50)
+	}
+	// Ensure arbitrary files are rejected
+	if err := ioutil.WriteFile(fn, []byte("not a dump"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportKeyRange(imported, fn); err == nil {
+		t.Fatalf("imported invalid dump")
+	}
+}
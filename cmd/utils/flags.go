@@ -36,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/fdlimit"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/bft"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
@@ -217,6 +218,16 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	HistoryLimitFlag = cli.Uint64Flag{
+		Name:  "historylimit",
+		Usage: "Number of recent blocks to retain ancient block bodies and receipts for (default = 0, entire chain)",
+		Value: ethconfig.Defaults.HistoryLimit,
+	}
+	StateHistoryFlag = cli.Uint64Flag{
+		Name:  "statehistory",
+		Usage: "Number of recent blocks to retain state diffs for, serving historical state queries (default = 0, disabled)",
+		Value: ethconfig.Defaults.StateHistory,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -225,6 +236,10 @@ var (
 		Name:  "whitelist",
 		Usage: "Comma separated block number-to-hash mappings to enforce (<number>=<hash>)",
 	}
+	SyncTargetFlag = cli.StringFlag{
+		Name:  "synctarget",
+		Usage: "Hash of a trusted block to sync to, rejecting chains which don't contain it (full sync only)",
+	}
 	BloomFilterSizeFlag = cli.Uint64Flag{
 		Name:  "bloomfilter.size",
 		Usage: "Megabytes of memory allocated to bloom-filter for pruning",
@@ -315,6 +330,17 @@ var (
 		Name:  "ethash.dagslockmmap",
 		Usage: "Lock memory maps for recent ethash mining DAGs",
 	}
+	// Clique settings
+	CliqueStatsWindowFlag = cli.Uint64Flag{
+		Name:  "clique.statswindow",
+		Usage: "Number of recent blocks to gather clique signer stats over by default",
+		Value: ethconfig.Defaults.CliqueStatsWindow,
+	}
+	CliqueMissedTurnsFlag = cli.Uint64Flag{
+		Name:  "clique.missedturns",
+		Usage: "Number of consecutive missed in-turn slots after which a clique signer is reported",
+		Value: ethconfig.Defaults.CliqueMissedTurns,
+	}
 	// Transaction pool settings
 	TxPoolLocalsFlag = cli.StringFlag{
 		Name:  "txpool.locals",
@@ -334,6 +360,10 @@ var (
 		Usage: "Time interval to regenerate the local transaction journal",
 		Value: core.DefaultTxPoolConfig.Rejournal,
 	}
+	TxPoolPoolJournalFlag = cli.StringFlag{
+		Name:  "txpool.pooljournal",
+		Usage: "Disk journal for all pooled transactions (local and remote) to survive node restarts",
+	}
 	TxPoolPriceLimitFlag = cli.Uint64Flag{
 		Name:  "txpool.pricelimit",
 		Usage: "Minimum gas price limit to enforce for acceptance into the pool",
@@ -656,6 +686,10 @@ var (
 		Name:  "discovery.dns",
 		Usage: "Sets DNS discovery entry points (use \"\" to disable DNS)",
 	}
+	NetRecordFlag = DirectoryFlag{
+		Name:  "netrecord",
+		Usage: "Directory to record the decrypted p2p traffic of all peers into (for protocol debugging)",
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = cli.StringFlag{
@@ -748,6 +782,11 @@ var (
 		Usage: "External EVM configuration (default = built-in interpreter)",
 		Value: "",
 	}
+	VMParallelFlag = cli.IntFlag{
+		Name:  "vm.parallel",
+		Usage: "Number of workers executing block transactions speculatively in parallel (0 = sequential)",
+		Value: 0,
+	}
 )
 
 // MakeDataDir retrieves the currently requested data directory, terminating
@@ -1178,6 +1217,9 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		}
 		cfg.NetRestrict = list
 	}
+	if ctx.GlobalIsSet(NetRecordFlag.Name) {
+		cfg.RecordDir = ctx.GlobalString(NetRecordFlag.Name)
+	}
 
 	if ctx.GlobalBool(DeveloperFlag.Name) {
 		// --dev mode can't use p2p networking.
@@ -1305,6 +1347,9 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolPoolJournalFlag.Name) {
+		cfg.PoolJournal = ctx.GlobalString(TxPoolPoolJournalFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolPriceLimitFlag.Name) {
 		cfg.PriceLimit = ctx.GlobalUint64(TxPoolPriceLimitFlag.Name)
 	}
@@ -1328,6 +1373,15 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	}
 }
 
+func setClique(ctx *cli.Context, cfg *ethconfig.Config) {
+	if ctx.GlobalIsSet(CliqueStatsWindowFlag.Name) {
+		cfg.CliqueStatsWindow = ctx.GlobalUint64(CliqueStatsWindowFlag.Name)
+	}
+	if ctx.GlobalIsSet(CliqueMissedTurnsFlag.Name) {
+		cfg.CliqueMissedTurns = ctx.GlobalUint64(CliqueMissedTurnsFlag.Name)
+	}
+}
+
 func setEthash(ctx *cli.Context, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(EthashCacheDirFlag.Name) {
 		cfg.Ethash.CacheDir = ctx.GlobalString(EthashCacheDirFlag.Name)
@@ -1402,6 +1456,16 @@ func setWhitelist(ctx *cli.Context, cfg *ethconfig.Config) {
 	}
 }
 
+func setSyncTarget(ctx *cli.Context, cfg *ethconfig.Config) {
+	target := ctx.GlobalString(SyncTargetFlag.Name)
+	if target == "" {
+		return
+	}
+	if err := cfg.SyncTarget.UnmarshalText([]byte(target)); err != nil {
+		Fatalf("Invalid sync target hash %s: %v", target, err)
+	}
+}
+
 // CheckExclusive verifies that only a single instance of the provided flags was
 // set by the user. Each flag might optionally be followed by a string type to
 // specialize it further.
@@ -1453,6 +1517,10 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		ctx.GlobalSet(TxLookupLimitFlag.Name, "0")
 		log.Warn("Disable transaction unindexing for archive node")
 	}
+	if ctx.GlobalString(GCModeFlag.Name) == "archive" && ctx.GlobalUint64(HistoryLimitFlag.Name) != 0 {
+		ctx.GlobalSet(HistoryLimitFlag.Name, "0")
+		log.Warn("Disable chain history expiry for archive node")
+	}
 	if ctx.GlobalIsSet(LightServeFlag.Name) && ctx.GlobalUint64(TxLookupLimitFlag.Name) != 0 {
 		log.Warn("LES server cannot serve old transaction status and cannot connect below les/4 protocol version if transaction lookup index is limited")
 	}
@@ -1464,13 +1532,18 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	setGPO(ctx, &cfg.GPO, ctx.GlobalString(SyncModeFlag.Name) == "light")
 	setTxPool(ctx, &cfg.TxPool)
 	setEthash(ctx, cfg)
+	setClique(ctx, cfg)
 	setMiner(ctx, &cfg.Miner)
 	setWhitelist(ctx, cfg)
+	setSyncTarget(ctx, cfg)
 	setLes(ctx, cfg)
 
 	if ctx.GlobalIsSet(SyncModeFlag.Name) {
 		cfg.SyncMode = *GlobalTextMarshaler(ctx, SyncModeFlag.Name).(*downloader.SyncMode)
 	}
+	if cfg.SyncTarget != (common.Hash{}) && cfg.SyncMode != downloader.FullSync {
+		Fatalf("--%s requires --%s=full", SyncTargetFlag.Name, SyncModeFlag.Name)
+	}
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
@@ -1500,6 +1573,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(HistoryLimitFlag.Name) {
+		cfg.HistoryLimit = ctx.GlobalUint64(HistoryLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateHistoryFlag.Name) {
+		cfg.StateHistory = ctx.GlobalUint64(StateHistoryFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1539,6 +1618,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(EVMInterpreterFlag.Name) {
 		cfg.EVMInterpreter = ctx.GlobalString(EVMInterpreterFlag.Name)
 	}
+	if ctx.GlobalIsSet(VMParallelFlag.Name) {
+		cfg.ParallelExecution = ctx.GlobalInt(VMParallelFlag.Name)
+	}
 	if ctx.GlobalIsSet(RPCGlobalGasCapFlag.Name) {
 		cfg.RPCGasCap = ctx.GlobalUint64(RPCGlobalGasCapFlag.Name)
 	}
@@ -1800,6 +1882,8 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readOnly bool) (chain *core.B
 	var engine consensus.Engine
 	if config.Clique != nil {
 		engine = clique.New(config.Clique, chainDb)
+	} else if config.BFT != nil {
+		engine = bft.New(config.BFT, chainDb)
 	} else {
 		engine = ethash.NewFaker()
 		if !ctx.GlobalBool(FakePoWFlag.Name) {
@@ -1840,7 +1924,10 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readOnly bool) (chain *core.B
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieDirtyLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
-	vmcfg := vm.Config{EnablePreimageRecording: ctx.GlobalBool(VMEnableDebugFlag.Name)}
+	vmcfg := vm.Config{
+		EnablePreimageRecording: ctx.GlobalBool(VMEnableDebugFlag.Name),
+		ParallelExecution:       ctx.GlobalInt(VMParallelFlag.Name),
+	}
 	var limit *uint64
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) && !readOnly {
 		l := ctx.GlobalUint64(TxLookupLimitFlag.Name)
@@ -0,0 +1,504 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// historyChecksums is the name of the file listing the accumulator roots of all
+// the history archives in a directory.
+const historyChecksums = "checksums.txt"
+
+// HistoryNetworkName returns the network name used in the history archive file
+// names of the chain with the given genesis hash.
+func HistoryNetworkName(genesis common.Hash) string {
+	switch genesis {
+	case params.MainnetGenesisHash:
+		return "mainnet"
+	case params.RopstenGenesisHash:
+		return "ropsten"
+	case params.RinkebyGenesisHash:
+		return "rinkeby"
+	case params.GoerliGenesisHash:
+		return "goerli"
+	default:
+		return fmt.Sprintf("private-%x", genesis[:4])
+	}
+}
+
+// ExportHistory exports the blocks, receipts and total difficulties of the chain
+// between first and last into history archives in the given directory. Archives
+// are aligned to era.MaxBlocks, so first is rounded down to an archive boundary.
+func ExportHistory(chain *core.BlockChain, dir string, network string, first, last uint64) error {
+	if head := chain.CurrentBlock().NumberU64(); last > head {
+		return fmt.Errorf("export range beyond chain head: %d > %d", last, head)
+	}
+	if first > last {
+		return fmt.Errorf("invalid export range: %d > %d", first, last)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	log.Info("Exporting chain history", "dir", dir, "first", first, "last", last)
+
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for epoch := first / era.MaxBlocks; epoch <= last/era.MaxBlocks; epoch++ {
+		var (
+			from = epoch * era.MaxBlocks
+			to   = from + era.MaxBlocks - 1
+		)
+		if to > last {
+			to = last
+		}
+		tmp := filepath.Join(dir, fmt.Sprintf("%s-%05d.era.tmp", network, epoch))
+		root, err := exportHistoryEpoch(chain, tmp, from, to)
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		// Drop any previous archive of the epoch, its root differs if it was partial
+		stale, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s-%05d-*.era", network, epoch)))
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		for _, file := range stale {
+			if err := os.Remove(file); err != nil {
+				os.Remove(tmp)
+				return err
+			}
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, era.Filename(network, epoch, root))); err != nil {
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting chain history", "epoch", epoch, "number", to, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := writeHistoryChecksums(dir, network); err != nil {
+		return err
+	}
+	log.Info("Exported chain history", "dir", dir, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// exportHistoryEpoch writes the blocks between from and to into a single archive
+// file, returning its accumulator root.
+func exportHistoryEpoch(chain *core.BlockChain, path string, from, to uint64) (common.Hash, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	builder, err := era.NewBuilder(w, from)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for number := from; number <= to; number++ {
+		block := chain.GetBlockByNumber(number)
+		if block == nil {
+			return common.Hash{}, fmt.Errorf("block #%d not found", number)
+		}
+		receipts := chain.GetReceiptsByHash(block.Hash())
+		if receipts == nil && len(block.Transactions()) > 0 {
+			return common.Hash{}, fmt.Errorf("receipts for block #%d not found", number)
+		}
+		td := chain.GetTd(block.Hash(), number)
+		if td == nil {
+			return common.Hash{}, fmt.Errorf("total difficulty for block #%d not found", number)
+		}
+		if err := builder.Add(block, receipts, td); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := w.Flush(); err != nil {
+		return common.Hash{}, err
+	}
+	return root, f.Sync()
+}
+
+// ImportHistory imports the history archives of the given network from a
+// directory. Every archive is fully verified before its blocks are inserted as
+// headers, bodies and receipts, without executing the state transitions.
+func ImportHistory(chain *core.BlockChain, dir string, network string) error {
+	files, err := historyFiles(dir, network)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no %s history archives found in %s", network, dir)
+	}
+	checksums, err := readHistoryChecksums(dir)
+	if err != nil {
+		return err
+	}
+	var (
+		start    = time.Now()
+		imported int
+	)
+	for _, file := range files {
+		e, err := era.Open(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		// Archives not listed in the checksum file are rejected, same as when verifying
+		if err := verifyHistoryArchive(e, file, checksums); err != nil {
+			e.Close()
+			return err
+		}
+		n, err := importHistoryArchive(chain, e)
+		e.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		imported += n
+		log.Info("Imported history archive", "file", file, "blocks", n, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	log.Info("Imported chain history", "dir", dir, "blocks", imported, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// importHistoryArchive inserts the blocks of a verified archive into the chain,
+// returning the number of new blocks.
+func importHistoryArchive(chain *core.BlockChain, e *era.Era) (int, error) {
+	var (
+		blocks   = make(types.Blocks, 0, importBatchSize)
+		receipts = make([]types.Receipts, 0, importBatchSize)
+		lastTd   *big.Int
+		imported int
+	)
+	flush := func() error {
+		if len(blocks) == 0 {
+			return nil
+		}
+		headers := make([]*types.Header, len(blocks))
+		for i, block := range blocks {
+			headers[i] = block.Header()
+		}
+		if n, err := chain.InsertHeaderChain(headers, 100); err != nil {
+			return fmt.Errorf("invalid header #%d: %v", headers[n].Number, err)
+		}
+		if n, err := chain.InsertReceiptChain(blocks, receipts, 0); err != nil {
+			return fmt.Errorf("invalid block #%d: %v", blocks[n].Number(), err)
+		}
+		last := blocks[len(blocks)-1]
+		if have := chain.GetTd(last.Hash(), last.NumberU64()); have == nil || have.Cmp(lastTd) != 0 {
+			return fmt.Errorf("total difficulty mismatch at #%d: have %v, want %v", last.Number(), have, lastTd)
+		}
+		imported += len(blocks)
+		blocks, receipts = blocks[:0], receipts[:0]
+		return nil
+	}
+	for number := e.Start(); number < e.Start()+e.Count(); number++ {
+		block, rs, td, err := e.GetBlockByNumber(number)
+		if err != nil {
+			return imported, err
+		}
+		if number == 0 {
+			if block.Hash() != chain.Genesis().Hash() {
+				return imported, fmt.Errorf("genesis mismatch: have %x, want %x", block.Hash(), chain.Genesis().Hash())
+			}
+			continue
+		}
+		if chain.HasFastBlock(block.Hash(), number) {
+			if have := chain.GetTd(block.Hash(), number); have.Cmp(td) != 0 {
+				return imported, fmt.Errorf("total difficulty mismatch at #%d: have %v, want %v", number, have, td)
+			}
+			continue
+		}
+		blocks, receipts, lastTd = append(blocks, block), append(receipts, rs), td
+		if len(blocks) == importBatchSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	return imported, flush()
+}
+
+// VerifyHistory checks the integrity of all the history archives of the given
+// network in a directory, including that consecutive archives link up and that
+// their accumulator roots match the checksum file, if present.
+func VerifyHistory(dir string, network string) error {
+	files, err := historyFiles(dir, network)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no %s history archives found in %s", network, dir)
+	}
+	checksums, err := readHistoryChecksums(dir)
+	if err != nil {
+		return err
+	}
+	var (
+		next   uint64
+		parent common.Hash
+	)
+	for i, file := range files {
+		e, err := era.Open(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		err = verifyHistoryArchive(e, file, checksums)
+		if err == nil && i > 0 {
+			if e.Start() != next {
+				err = fmt.Errorf("%s: gap in history: have start %d, want %d", file, e.Start(), next)
+			} else {
+				var first *types.Block
+				if first, _, _, err = e.GetBlockByNumber(e.Start()); err == nil && first.ParentHash() != parent {
+					err = fmt.Errorf("%s: parent hash mismatch: have %x, want %x", file, first.ParentHash(), parent)
+				}
+			}
+		}
+		if err == nil {
+			var last *types.Block
+			if last, _, _, err = e.GetBlockByNumber(e.Start() + e.Count() - 1); err == nil {
+				next, parent = last.NumberU64()+1, last.Hash()
+			}
+		}
+		e.Close()
+		if err != nil {
+			return err
+		}
+		log.Info("Verified history archive", "file", file, "start", e.Start(), "count", e.Count(), "accumulator", e.Accumulator())
+	}
+	return nil
+}
+
+// verifyHistoryArchive checks the content of a single archive against its file
+// name and the checksum list.
+func verifyHistoryArchive(e *era.Era, file string, checksums map[string]common.Hash) error {
+	if len(checksums) > 0 {
+		want, ok := checksums[file]
+		if !ok {
+			return fmt.Errorf("%s: missing from %s", file, historyChecksums)
+		}
+		if want != e.Accumulator() {
+			return fmt.Errorf("%s: accumulator mismatch: have %x, want %x", file, e.Accumulator(), want)
+		}
+	}
+	if err := e.Verify(); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	if !strings.HasSuffix(file, fmt.Sprintf("-%05d-%x.era", e.Start()/era.MaxBlocks, e.Accumulator().Bytes()[:4])) {
+		return fmt.Errorf("%s: file name does not match content", file)
+	}
+	return nil
+}
+
+// historyFiles returns the sorted names of the history archives of a network
+// in the given directory.
+func historyFiles(dir string, network string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, network+"-*.era"))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(matches))
+	for i, match := range matches {
+		files[i] = filepath.Base(match)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// writeHistoryChecksums regenerates the checksum file of a directory from the
+// accumulator roots of the archives of the given network.
+func writeHistoryChecksums(dir string, network string) error {
+	files, err := historyFiles(dir, network)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, file := range files {
+		e, err := era.Open(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%#x %s", e.Accumulator(), file))
+		e.Close()
+	}
+	return ioutil.WriteFile(filepath.Join(dir, historyChecksums), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// readHistoryChecksums loads the accumulator roots from the checksum file of a
+// directory. A missing checksum file is not an error.
+func readHistoryChecksums(dir string) (map[string]common.Hash, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, historyChecksums))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checksums := make(map[string]common.Hash)
+	for i, line := range strings.Split(string(blob), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "0x") || len(fields[0]) != 2+2*common.HashLength {
+			return nil, fmt.Errorf("%s: invalid line %d", historyChecksums, i+1)
+		}
+		checksums[fields[1]] = common.HexToHash(fields[0])
+	}
+	return checksums, nil
+}
+
+// RefillAncients replaces the ancient blocks from first onwards with the content
+// of the history archives of the given network, to repair a damaged ancient
+// store. The archives are fully verified and must link up with the intact part
+// of the ancient store as well as the key-value store before any data is
+// overwritten.
+func RefillAncients(db ethdb.Database, dir string, network string, first uint64) error {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	if first >= frozen {
+		return nil
+	}
+	files, err := historyFiles(dir, network)
+	if err != nil {
+		return err
+	}
+	checksums, err := readHistoryChecksums(dir)
+	if err != nil {
+		return err
+	}
+	// Open and verify all the archives covering the damaged range
+	var archives []*era.Era
+	defer func() {
+		for _, e := range archives {
+			e.Close()
+		}
+	}()
+	for epoch := first / era.MaxBlocks; epoch <= (frozen-1)/era.MaxBlocks; epoch++ {
+		var file string
+		for _, name := range files {
+			if strings.HasPrefix(name, fmt.Sprintf("%s-%05d-", network, epoch)) {
+				file = name
+				break
+			}
+		}
+		if file == "" {
+			return fmt.Errorf("missing %s history archive for epoch %d", network, epoch)
+		}
+		e, err := era.Open(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		archives = append(archives, e)
+		if err := verifyHistoryArchive(e, file, checksums); err != nil {
+			return err
+		}
+		if end := epoch*era.MaxBlocks + era.MaxBlocks; e.Start() != epoch*era.MaxBlocks || (e.Start()+e.Count() < end && e.Start()+e.Count() < frozen) {
+			return fmt.Errorf("%s: archive does not cover the damaged range", file)
+		}
+		log.Info("Verified history archive", "file", file)
+	}
+	read := func(number uint64) (*types.Block, types.Receipts, *big.Int, error) {
+		return archives[number/era.MaxBlocks-first/era.MaxBlocks].GetBlockByNumber(number)
+	}
+	// Ensure the archives link up with the intact parts of the database
+	block, _, _, err := read(first)
+	if err != nil {
+		return err
+	}
+	if first > 0 {
+		if hash := rawdb.ReadCanonicalHash(db, first-1); block.ParentHash() != hash {
+			return fmt.Errorf("archived block #%d does not link to ancient parent %x", first, hash)
+		}
+	}
+	last, _, _, err := read(frozen - 1)
+	if err != nil {
+		return err
+	}
+	if hash := rawdb.ReadCanonicalHash(db, frozen); hash != (common.Hash{}) {
+		if header := rawdb.ReadHeader(db, hash, frozen); header != nil && header.ParentHash != last.Hash() {
+			return fmt.Errorf("archived block #%d does not link to database block %x", frozen-1, hash)
+		}
+	}
+	for i := 1; i < len(archives); i++ {
+		start := archives[i].Start()
+		prev, _, _, err := read(start - 1)
+		if err != nil {
+			return err
+		}
+		next, _, _, err := read(start)
+		if err != nil {
+			return err
+		}
+		if next.ParentHash() != prev.Hash() {
+			return fmt.Errorf("archived block #%d does not link to its parent", start)
+		}
+	}
+	// Everything checks out, replace the damaged ancient blocks
+	log.Warn("Rewriting ancient blocks", "from", first, "to", frozen-1)
+	if err := db.TruncateAncients(first); err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := first; number < frozen; number++ {
+		block, receipts, td, err := read(number)
+		if err != nil {
+			return err
+		}
+		rawdb.WriteAncientBlock(db, block, receipts, td)
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Rewriting ancient blocks", "number", number, "frozen", frozen, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := db.Sync(); err != nil {
+		return err
+	}
+	log.Info("Rewrote ancient blocks", "from", first, "to", frozen-1, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
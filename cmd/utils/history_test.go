@@ -0,0 +1,115 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that chain history can be exported into archives, verified and then
+// imported into an empty database.
+func TestHistoryExportImport(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{address: {Balance: big.NewInt(1000000000000000000)}}}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 32, func(i int, gen *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		gen.AddTx(tx)
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "history-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Export a partial epoch first, the full export must replace it
+	network := HistoryNetworkName(genesis.Hash())
+	if err := ExportHistory(chain, dir, network, 0, 16); err != nil {
+		t.Fatalf("failed to export partial history: %v", err)
+	}
+	if err := ExportHistory(chain, dir, network, 0, chain.CurrentBlock().NumberU64()); err != nil {
+		t.Fatalf("failed to export history: %v", err)
+	}
+	if files, _ := historyFiles(dir, network); len(files) != 1 {
+		t.Fatalf("archive count mismatch: have %v, want 1", files)
+	}
+	if err := VerifyHistory(dir, network); err != nil {
+		t.Fatalf("failed to verify history: %v", err)
+	}
+	// Import the history into a fresh database
+	importdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(importdb)
+	imported, err := core.NewBlockChain(importdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Stop()
+	if err := ImportHistory(imported, dir, network); err != nil {
+		t.Fatalf("failed to import history: %v", err)
+	}
+	if head := imported.CurrentFastBlock().Hash(); head != chain.CurrentBlock().Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, chain.CurrentBlock().Hash())
+	}
+	for _, block := range blocks {
+		if !imported.HasFastBlock(block.Hash(), block.NumberU64()) {
+			t.Fatalf("block #%d missing after import", block.NumberU64())
+		}
+		if len(imported.GetReceiptsByHash(block.Hash())) != len(block.Transactions()) {
+			t.Fatalf("receipts of block #%d missing after import", block.NumberU64())
+		}
+	}
+	// Importing again should be a noop
+	if err := ImportHistory(imported, dir, network); err != nil {
+		t.Fatalf("failed to reimport history: %v", err)
+	}
+	// Tamper with the checksum file and ensure it's detected
+	if err := ioutil.WriteFile(filepath.Join(dir, historyChecksums), []byte("0x0000000000000000000000000000000000000000000000000000000000000000 x.era\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyHistory(dir, network); err == nil {
+		t.Fatalf("history with mismatching checksums verified")
+	}
+	if err := ImportHistory(imported, dir, network); err == nil {
+		t.Fatalf("history with mismatching checksums imported")
+	}
+}
@@ -80,6 +80,18 @@ func (s *Simulated) ActiveTimers() int {
 	return len(s.scheduled)
 }
 
+// NextTimer returns the time at which the next timer fires. The second return
+// value is false if there are no active timers.
+func (s *Simulated) NextTimer() (AbsTime, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.scheduled) == 0 {
+		return 0, false
+	}
+	return s.scheduled[0].at, true
+}
+
 // WaitForTimers waits until the clock has at least n scheduled timers.
 func (s *Simulated) WaitForTimers(n int) {
 	s.mu.Lock()
@@ -111,7 +123,15 @@ func (s *Simulated) NewTimer(d time.Duration) ChanTimer {
 
 	ch := make(chan AbsTime, 1)
 	var timer *simTimer
-	timer = s.schedule(d, func() { ch <- timer.at })
+	timer = s.schedule(d, func() {
+		// The send is non-blocking, like with the system clock. Otherwise
+		// a timer which is reset before its channel is drained would block
+		// the goroutine calling Run.
+		select {
+		case ch <- timer.at:
+		default:
+		}
+	})
 	timer.ch = ch
 	return timer
 }
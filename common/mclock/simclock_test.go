@@ -160,3 +160,23 @@ func TestSimulatedTimerStop(t *testing.T) {
 		t.Fatal("timer didn't fire")
 	}
 }
+
+func TestSimulatedNextTimer(t *testing.T) {
+	var c Simulated
+	if _, ok := c.NextTimer(); ok {
+		t.Fatal("NextTimer returned true without timers")
+	}
+	c.AfterFunc(2*time.Second, func() {})
+	timer := c.NewTimer(1 * time.Second)
+	if next, ok := c.NextTimer(); !ok || next != AbsTime(1*time.Second) {
+		t.Fatalf("wrong next timer %v (%t), want %v", next, ok, AbsTime(1*time.Second))
+	}
+	timer.Stop()
+	if next, ok := c.NextTimer(); !ok || next != AbsTime(2*time.Second) {
+		t.Fatalf("wrong next timer %v (%t) after Stop, want %v", next, ok, AbsTime(2*time.Second))
+	}
+	c.Run(2 * time.Second)
+	if _, ok := c.NextTimer(); ok {
+		t.Fatal("NextTimer returned true after all timers fired")
+	}
+}
@@ -0,0 +1,697 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bft implements a round-based Byzantine fault tolerant consensus engine
+// for permissioned networks.
+//
+// A fixed set of validators takes turns proposing blocks. Every block goes through
+// a preprepare, prepare and commit phase exchanged over a dedicated devp2p protocol,
+// and is only final once it carries committed seals from more than two thirds of
+// the validators. Blocks are therefore final as soon as they are imported, forks
+// are impossible as long as less than a third of the validators are faulty.
+package bft
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	checkpointInterval = 1024 // Number of blocks after which to save the vote snapshot to the database
+	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryMessages   = 4096 // Number of recent consensus messages to remember for deduplication
+)
+
+// BFT protocol constants.
+var (
+	epochLength    = uint64(30000)            // Default number of blocks after which to checkpoint and reset the pending votes
+	requestTimeout = uint64(10000)            // Default number of milliseconds to wait for the first round of a height
+	extraVanity    = 32                       // Fixed number of extra-data prefix bytes reserved for validator vanity
+	uncleHash      = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+
+	nonceAuthVote = types.BlockNonce{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff} // Magic nonce number to vote on adding a new validator
+	nonceDropVote = types.BlockNonce{}                                               // Magic nonce number to vote on removing a validator
+
+	// mixDigest is the fixed mix digest of all BFT blocks, identifying them.
+	mixDigest = common.HexToHash("0x63746963616c2062797a616e74696e65206661756c7420746f6c6572616e6365")
+
+	defaultDifficulty = big.NewInt(1) // Block difficulty, meaningless with instant finality
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a
+	// block that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errNotStarted is returned if a block is to be sealed before the engine was
+	// attached to a chain and started.
+	errNotStarted = errors.New("engine not started")
+
+	// errInvalidCheckpointBeneficiary is returned if a checkpoint/epoch transition
+	// block has a beneficiary set to non-zeroes.
+	errInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
+
+	// errInvalidVote is returned if a nonce value is something else that the two
+	// allowed constants of 0x00..0 or 0xff..f.
+	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+
+	// errInvalidCheckpointVote is returned if a checkpoint/epoch transition block
+	// has a vote nonce set to non-zeroes.
+	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
+
+	// errMissingVanity is returned if a block's extra-data section is shorter than
+	// 32 bytes, which is required to store the validator vanity.
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	// errInvalidExtra is returned if the consensus data in a block's extra-data
+	// section cannot be decoded.
+	errInvalidExtra = errors.New("invalid consensus extra-data")
+
+	// errExtraValidators is returned if non-checkpoint block contain validator data
+	// in their extra-data fields.
+	errExtraValidators = errors.New("non-checkpoint block contains extra validator list")
+
+	// errMismatchingCheckpointValidators is returned if a checkpoint block contains
+	// a list of validators different than the one the local node calculated.
+	errMismatchingCheckpointValidators = errors.New("mismatching validator list on checkpoint block")
+
+	// errInvalidMixDigest is returned if a block's mix digest is not the BFT one.
+	errInvalidMixDigest = errors.New("invalid mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errInvalidVotingChain is returned if an authorization list is attempted to
+	// be modified via out-of-range or non-contiguous headers.
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	// errUnauthorizedProposer is returned if a header is sealed by a non-validator.
+	errUnauthorizedProposer = errors.New("unauthorized proposer")
+
+	// errWrongProposer is returned if a header is sealed by a validator which was
+	// not the proposer of the round the block claims to be proposed in.
+	errWrongProposer = errors.New("wrong proposer for round")
+
+	// errInvalidCommittedSeals is returned if a header's committed seals are not
+	// signed by distinct validators over the proposal.
+	errInvalidCommittedSeals = errors.New("invalid committed seals")
+
+	// errInsufficientCommittedSeals is returned if a header doesn't carry enough
+	// committed seals to reach the validator quorum.
+	errInsufficientCommittedSeals = errors.New("insufficient committed seals")
+
+	// errInvalidMessage is returned if a consensus message is malformed.
+	errInvalidMessage = errors.New("invalid consensus message")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
+
+// Chain is the local blockchain the engine finalizes blocks into.
+type Chain interface {
+	consensus.ChainHeaderReader
+
+	// GetBlockByNumber retrieves a canonical block from the database by number.
+	GetBlockByNumber(number uint64) *types.Block
+
+	// InsertChain imports a batch of blocks into the chain.
+	InsertChain(chain types.Blocks) (int, error)
+
+	// SubscribeChainHeadEvent registers a subscription for new chain heads.
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// ecrecover extracts the Ethereum account address of the proposer of a header.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	// Retrieve the signature from the header extra-data
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sighash, err := sigRLP(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	proposer, err := recoverAddress(sighash, extra.Seal)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sigcache.Add(hash, proposer)
+	return proposer, nil
+}
+
+// BFT is the Byzantine fault tolerant consensus engine.
+type BFT struct {
+	config *params.BFTConfig // Consensus engine configuration parameters
+	db     ethdb.Database    // Database to store and retrieve snapshot checkpoints
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+
+	proposals map[common.Address]bool // Current list of proposals we are pushing
+
+	signer common.Address // Ethereum address of the signing key
+	signFn SignerFn       // Signer function to authorize hashes with
+	lock   sync.RWMutex   // Protects the signer and proposal fields
+
+	machine *machine // Consensus state machine, set once the engine is started
+	handler *handler // Consensus message exchange with the remote validators
+}
+
+// New creates a BFT consensus engine with the initial validators set to the ones
+// provided in the genesis block.
+func New(config *params.BFTConfig, db ethdb.Database) *BFT {
+	// Set any missing consensus parameters to their defaults
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = epochLength
+	}
+	if conf.RequestTimeout == 0 {
+		conf.RequestTimeout = requestTimeout
+	}
+	// Allocate the snapshot caches and create the engine
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+
+	b := &BFT{
+		config:     &conf,
+		db:         db,
+		recents:    recents,
+		signatures: signatures,
+		proposals:  make(map[common.Address]bool),
+	}
+	b.handler = newHandler(b)
+	return b
+}
+
+// Start attaches the engine to the local chain and starts taking part in the
+// consensus rounds for the blocks following its head.
+func (b *BFT) Start(chain Chain) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.machine != nil {
+		return
+	}
+	b.machine = newMachine(b, chain)
+}
+
+// Author implements consensus.Engine, returning the Ethereum address recovered
+// from the proposer seal in the header's extra-data section.
+func (b *BFT) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, b.signatures)
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules. The seals
+// of the header are only verified if requested.
+func (b *BFT) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return b.verifyHeader(chain, header, nil, seal, true)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (b *BFT) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := b.verifyHeader(chain, header, headers[:i], seals[i], true)
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database. The seals may be skipped altogether, or for
+// proposals which weren't committed yet, only the committed seals.
+func (b *BFT) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, seal, committed bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	// Checkpoint blocks need to enforce zero beneficiary and no votes
+	checkpoint := (number % b.config.Epoch) == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		return errInvalidCheckpointBeneficiary
+	}
+	if header.Nonce != nonceAuthVote && header.Nonce != nonceDropVote {
+		return errInvalidVote
+	}
+	if checkpoint && header.Nonce != nonceDropVote {
+		return errInvalidCheckpointVote
+	}
+	// Ensure that the extra-data contains a validator list on checkpoint, but none otherwise
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return err
+	}
+	if !checkpoint && len(extra.Validators) != 0 {
+		return errExtraValidators
+	}
+	// Ensure that the mix digest identifies the block as a BFT one
+	if header.MixDigest != mixDigest {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in BFT
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	// Ensure that the block's difficulty is the fixed one
+	if number > 0 && (header.Difficulty == nil || header.Difficulty.Cmp(defaultDifficulty) != 0) {
+		return errInvalidDifficulty
+	}
+	// If all checks passed, validate any special fields for hard forks
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	// All basic checks passed, verify cascading fields
+	return b.verifyCascadingFields(chain, header, extra, parents, seal, committed)
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers.
+func (b *BFT) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, extra *Extra, parents []*types.Header, seal, committed bool) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the block's timestamp isn't too close to its parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time+b.config.Period > header.Time {
+		return errInvalidTimestamp
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// If the block is a checkpoint block, verify the validator list
+	if number%b.config.Epoch == 0 {
+		validators := snap.validators()
+		if len(extra.Validators) != len(validators) {
+			return errMismatchingCheckpointValidators
+		}
+		for i, validator := range validators {
+			if extra.Validators[i] != validator {
+				return errMismatchingCheckpointValidators
+			}
+		}
+	}
+	// All basic checks passed, verify the seals if requested and return
+	if !seal {
+		return nil
+	}
+	return b.verifySeals(header, extra, snap, committed)
+}
+
+// snapshot retrieves the validator snapshot at a given point in time.
+func (b *BFT) snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Search for a snapshot in memory or on disk for checkpoints
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := b.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(b.config, b.signatures, b.db, hash); err == nil {
+				log.Trace("Loaded validator snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		// If we're at the genesis, snapshot the initial state. Alternatively if we're
+		// at a checkpoint block without a parent (light client CHT), or we have piled
+		// up more headers than allowed to be reorged (chain reinit from a freezer),
+		// consider the checkpoint trusted and snapshot it.
+		if number == 0 || (number%b.config.Epoch == 0 && (len(headers) > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
+			checkpoint := chain.GetHeaderByNumber(number)
+			if checkpoint != nil {
+				hash := checkpoint.Hash()
+
+				extra, err := ExtractExtra(checkpoint)
+				if err != nil {
+					return nil, err
+				}
+				snap = newSnapshot(b.config, b.signatures, number, hash, extra.Validators)
+				if number > 0 {
+					if snap.Proposer, err = ecrecover(checkpoint, b.signatures); err != nil {
+						return nil, err
+					}
+				}
+				if err := snap.store(b.db); err != nil {
+					return nil, err
+				}
+				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				break
+			}
+		}
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	b.recents.Add(snap.Hash, snap)
+
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+		if err = snap.store(b.db); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored validator snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (b *BFT) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// verifySeals checks whether the header was sealed by the proposer of the round
+// it was proposed in and, if requested, whether it was committed to by a quorum
+// of the validators of its parent snapshot.
+func (b *BFT) verifySeals(header *types.Header, extra *Extra, snap *Snapshot, committed bool) error {
+	// Resolve the authorization key and check against the round's proposer
+	proposer, err := ecrecover(header, b.signatures)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[proposer]; !ok {
+		return errUnauthorizedProposer
+	}
+	if proposer != snap.proposer(extra.Round) {
+		return errWrongProposer
+	}
+	if !committed {
+		return nil
+	}
+	return verifyCommittedSeals(header, extra, snap)
+}
+
+// verifyCommittedSeals checks whether the committed seals of a header were signed
+// over its proposal hash by a quorum of distinct validators.
+func verifyCommittedSeals(header *types.Header, extra *Extra, snap *Snapshot) error {
+	var (
+		data      = commitData(proposalHash(header))
+		committed = make(map[common.Address]struct{})
+	)
+	for _, seal := range extra.CommittedSeals {
+		validator, err := recoverAddress(data, seal)
+		if err != nil {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := snap.Validators[validator]; !ok {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := committed[validator]; ok {
+			return errInvalidCommittedSeals
+		}
+		committed[validator] = struct{}{}
+	}
+	if len(committed) < snap.quorum() {
+		return errInsufficientCommittedSeals
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (b *BFT) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	// If the block isn't a checkpoint, cast a random vote (good enough for now)
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+	// Assemble the voting snapshot to check which votes make sense
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if number%b.config.Epoch != 0 {
+		b.lock.RLock()
+
+		// Gather all the proposals that make sense voting on
+		addresses := make([]common.Address, 0, len(b.proposals))
+		for address, authorize := range b.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		// If there's pending proposals, cast a vote on them
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if b.proposals[header.Coinbase] {
+				header.Nonce = nonceAuthVote
+			} else {
+				header.Nonce = nonceDropVote
+			}
+		}
+		b.lock.RUnlock()
+	}
+	// Set the fixed difficulty and mix digest
+	header.Difficulty = new(big.Int).Set(defaultDifficulty)
+	header.MixDigest = mixDigest
+
+	// Ensure the extra data has all its components, leaving the seals for later
+	extra := new(Extra)
+	if number%b.config.Epoch == 0 {
+		extra.Validators = snap.validators()
+	}
+	if err := writeExtra(header, extra); err != nil {
+		return err
+	}
+	// Ensure the timestamp has the correct delay
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Time = parent.Time + b.config.Period
+	if header.Time < uint64(time.Now().Unix()) {
+		header.Time = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, ensuring no uncles are set, nor block
+// rewards given.
+func (b *BFT) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	// No block rewards in BFT, so the state remains as is and uncles are dropped
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+}
+
+// FinalizeAndAssemble implements consensus.Engine, ensuring no uncles are set,
+// nor block rewards given, and returns the final block.
+func (b *BFT) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// Finalize block
+	b.Finalize(chain, header, state, txs, uncles)
+
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil)), nil
+}
+
+// Authorize injects a private key into the consensus engine to propose and
+// validate blocks with.
+func (b *BFT) Authorize(signer common.Address, signFn SignerFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.signer = signer
+	b.signFn = signFn
+}
+
+// Seal implements consensus.Engine, handing the block over to the consensus
+// rounds. The block is proposed once the local validator becomes the proposer
+// of a round, and delivered on the results channel once committed by a quorum.
+func (b *BFT) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	header := block.Header()
+
+	// Sealing the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	b.lock.RLock()
+	signer, machine := b.signer, b.machine
+	b.lock.RUnlock()
+
+	if machine == nil {
+		return errNotStarted
+	}
+	// Bail out if we're not a validator of the block
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if _, authorized := snap.Validators[signer]; !authorized {
+		return errUnauthorizedProposer
+	}
+	machine.request(&request{block: block, results: results, stop: stop})
+	return nil
+}
+
+// sign signs the given data with the local validator key.
+func (b *BFT) sign(data []byte) (common.Address, []byte, error) {
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	if signFn == nil {
+		return common.Address{}, nil, errUnauthorizedProposer
+	}
+	sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeBFT, data)
+	return signer, sig, err
+}
+
+// validator returns the address of the local validator key, if any.
+func (b *BFT) validator() common.Address {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.signer
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. It returns the fixed
+// difficulty of all BFT blocks, as there's no fork choice to make.
+func (b *BFT) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(defaultDifficulty)
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (b *BFT) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+// Close implements consensus.Engine, terminating the consensus rounds.
+func (b *BFT) Close() error {
+	b.lock.Lock()
+	machine := b.machine
+	b.machine = nil
+	b.lock.Unlock()
+
+	if machine != nil {
+		machine.close()
+	}
+	return nil
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to allow
+// controlling the validator voting and inspecting the consensus state.
+func (b *BFT) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bft",
+		Version:   "1.0",
+		Service:   &API{chain: chain, bft: b},
+		Public:    false,
+	}}
+}
+
+// Protocols returns the devp2p protocol the validators exchange the consensus
+// messages on.
+func (b *BFT) Protocols() []p2p.Protocol {
+	return b.handler.protocols()
+}
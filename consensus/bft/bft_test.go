@@ -0,0 +1,251 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// testValidatorSet is a set of validator keys, sorted by address.
+type testValidatorSet struct {
+	keys  []*ecdsa.PrivateKey
+	addrs []common.Address
+}
+
+func newTestValidatorSet(n int) *testValidatorSet {
+	set := new(testValidatorSet)
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateKey()
+		set.keys = append(set.keys, key)
+	}
+	sort.Slice(set.keys, func(i, j int) bool {
+		a, b := crypto.PubkeyToAddress(set.keys[i].PublicKey), crypto.PubkeyToAddress(set.keys[j].PublicKey)
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	for _, key := range set.keys {
+		set.addrs = append(set.addrs, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	return set
+}
+
+// key returns the private key of a validator address.
+func (set *testValidatorSet) key(addr common.Address) *ecdsa.PrivateKey {
+	for i, a := range set.addrs {
+		if a == addr {
+			return set.keys[i]
+		}
+	}
+	return nil
+}
+
+// sealHeader creates a header on top of the snapshot proposed by the right
+// proposer of the round, and committed to by the given validators.
+func sealHeader(t *testing.T, set *testValidatorSet, snap *Snapshot, round uint64, coinbase common.Address, nonce types.BlockNonce, committers []*ecdsa.PrivateKey) *types.Header {
+	header := &types.Header{
+		ParentHash: snap.Hash,
+		Number:     new(big.Int).SetUint64(snap.Number + 1),
+		Coinbase:   coinbase,
+		Nonce:      nonce,
+		Difficulty: big.NewInt(1),
+		MixDigest:  mixDigest,
+		Extra:      make([]byte, extraVanity),
+	}
+	extra := &Extra{Round: round}
+	if err := writeExtra(header, extra); err != nil {
+		t.Fatalf("failed to write extra: %v", err)
+	}
+	sighash, err := sigRLP(header)
+	if err != nil {
+		t.Fatalf("failed to encode header: %v", err)
+	}
+	seal, err := crypto.Sign(crypto.Keccak256(sighash), set.key(snap.proposer(round)))
+	if err != nil {
+		t.Fatalf("failed to seal header: %v", err)
+	}
+	extra.Seal = seal
+	if err := writeExtra(header, extra); err != nil {
+		t.Fatalf("failed to write extra: %v", err)
+	}
+	data := commitData(proposalHash(header))
+	for _, key := range committers {
+		seal, err := crypto.Sign(crypto.Keccak256(data), key)
+		if err != nil {
+			t.Fatalf("failed to sign commitment: %v", err)
+		}
+		extra.CommittedSeals = append(extra.CommittedSeals, seal)
+	}
+	if err := writeExtra(header, extra); err != nil {
+		t.Fatalf("failed to write extra: %v", err)
+	}
+	return header
+}
+
+// Tests that the proposer and committed seals of headers are verified against
+// the validator set of the parent.
+func TestSealVerification(t *testing.T) {
+	var (
+		set         = newTestValidatorSet(4)
+		sigcache, _ = lru.NewARC(inmemorySignatures)
+		engine      = New(&params.BFTConfig{}, nil)
+		snap        = newSnapshot(engine.config, sigcache, 0, common.Hash{}, set.addrs)
+		outsider, _ = crypto.GenerateKey()
+	)
+	tests := []struct {
+		round      uint64
+		committers []*ecdsa.PrivateKey
+		err        error
+	}{
+		{0, set.keys[:3], nil},
+		{2, set.keys, nil},
+		{0, set.keys[:2], errInsufficientCommittedSeals},
+		{0, []*ecdsa.PrivateKey{set.keys[0], set.keys[0], set.keys[1]}, errInvalidCommittedSeals},
+		{0, []*ecdsa.PrivateKey{set.keys[0], set.keys[1], outsider}, errInvalidCommittedSeals},
+	}
+	for i, tt := range tests {
+		header := sealHeader(t, set, snap, tt.round, common.Address{}, nonceDropVote, tt.committers)
+		extra, err := ExtractExtra(header)
+		if err != nil {
+			t.Fatalf("test %d: failed to extract extra: %v", i, err)
+		}
+		if err := engine.verifySeals(header, extra, snap, true); err != tt.err {
+			t.Errorf("test %d: verification error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		// Committed seals must not influence the proposal being sealed
+		if err := engine.verifySeals(header, extra, snap, false); err != nil {
+			t.Errorf("test %d: proposal verification failed: %v", i, err)
+		}
+	}
+	// Proposals sealed by a validator which isn't the proposer of the round must fail
+	header := sealHeader(t, set, snap, 0, common.Address{}, nonceDropVote, nil)
+	extra, _ := ExtractExtra(header)
+	sighash, _ := sigRLP(header)
+	extra.Seal, _ = crypto.Sign(crypto.Keccak256(sighash), set.key(snap.proposer(1)))
+	writeExtra(header, extra)
+	if err := engine.verifySeals(header, extra, snap, false); err != errWrongProposer {
+		t.Errorf("wrong round proposer error mismatch: have %v, want %v", err, errWrongProposer)
+	}
+}
+
+// Tests that headers with undecodable extra-data are rejected instead of crashing
+// the hashing methods.
+func TestMalformedExtra(t *testing.T) {
+	engine := New(&params.BFTConfig{}, nil)
+
+	header := &types.Header{
+		Number: big.NewInt(1),
+		Extra:  append(make([]byte, extraVanity), 0xff),
+	}
+	if hash := engine.SealHash(header); hash != header.Hash() {
+		t.Errorf("seal hash mismatch: have %x, want %x", hash, header.Hash())
+	}
+	if _, err := sigRLP(header); err != errInvalidExtra {
+		t.Errorf("signing data error mismatch: have %v, want %v", err, errInvalidExtra)
+	}
+	if _, err := engine.Author(header); err != errInvalidExtra {
+		t.Errorf("author error mismatch: have %v, want %v", err, errInvalidExtra)
+	}
+}
+
+// Tests that proposers rotate round robin after the proposer of the parent, and
+// that validators get added and removed by majority vote.
+func TestSnapshotVoting(t *testing.T) {
+	var (
+		set         = newTestValidatorSet(4)
+		sigcache, _ = lru.NewARC(inmemorySignatures)
+		config      = &params.BFTConfig{Epoch: 30000}
+		candidate   = common.HexToAddress("0xdeadbeef")
+		snap        = newSnapshot(config, sigcache, 0, common.Hash{}, set.addrs)
+	)
+	// Genesis has no proposer, the first validator proposes first
+	for round := uint64(0); round < 8; round++ {
+		if have, want := snap.proposer(round), set.addrs[round%4]; have != want {
+			t.Fatalf("round %d: proposer mismatch: have %x, want %x", round, have, want)
+		}
+	}
+	if q := snap.quorum(); q != 3 {
+		t.Fatalf("quorum mismatch: have %d, want 3", q)
+	}
+	// Three votes out of four are needed to add the candidate
+	for i := 0; i < 3; i++ {
+		header := sealHeader(t, set, snap, 0, candidate, nonceAuthVote, nil)
+		next, err := snap.apply([]*types.Header{header})
+		if err != nil {
+			t.Fatalf("vote %d: failed to apply: %v", i, err)
+		}
+		if next.Proposer != snap.proposer(0) {
+			t.Fatalf("vote %d: proposer not tracked", i)
+		}
+		_, added := next.Validators[candidate]
+		if added != (i == 2) {
+			t.Fatalf("vote %d: candidate authorization mismatch: have %v", i, added)
+		}
+		snap = next
+	}
+	if len(snap.Validators) != 5 || len(snap.Votes) != 0 || len(snap.Tally) != 0 {
+		t.Fatalf("stale voting state: validators %d, votes %d, tally %d", len(snap.Validators), len(snap.Votes), len(snap.Tally))
+	}
+	if q := snap.quorum(); q != 4 {
+		t.Fatalf("quorum mismatch: have %d, want 4", q)
+	}
+}
+
+// Tests that future messages are only buffered from members of the validator
+// set, and that no single sender may take up more than its share of the backlog.
+func TestBacklogLimits(t *testing.T) {
+	var (
+		validator = common.Address{0x01}
+		outsider  = common.Address{0x02}
+	)
+	c := &machine{
+		height:   1,
+		snap:     &Snapshot{Validators: map[common.Address]struct{}{validator: {}}},
+		backlogs: make(map[common.Address]int),
+	}
+	future := func(sender common.Address, height uint64) *inbound {
+		return &inbound{msg: &message{Code: msgPrepare, Height: height, sender: sender}}
+	}
+	c.storeBacklog(future(outsider, 2))
+	if len(c.backlog) != 0 {
+		t.Fatalf("backlog size mismatch after non-validator message: have %d, want 0", len(c.backlog))
+	}
+	for i := 0; i < 2*maxBacklogSender; i++ {
+		c.storeBacklog(future(validator, 2+uint64(i%2)))
+	}
+	if len(c.backlog) != maxBacklogSender {
+		t.Fatalf("backlog size mismatch after flooding: have %d, want %d", len(c.backlog), maxBacklogSender)
+	}
+	// Moving past the buffered heights must release the sender's quota
+	c.height = 4
+	c.replayBacklog()
+	if len(c.backlog) != 0 || c.backlogs[validator] != 0 {
+		t.Fatalf("backlog not released: size %d, sender count %d", len(c.backlog), c.backlogs[validator])
+	}
+	c.storeBacklog(future(validator, 5))
+	if len(c.backlog) != 1 {
+		t.Fatalf("backlog size mismatch after release: have %d, want 1", len(c.backlog))
+	}
+}
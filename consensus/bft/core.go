@@ -0,0 +1,684 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	maxBacklogHeights = 16   // Maximum number of future heights to buffer messages for
+	maxBacklogSize    = 1024 // Maximum number of future messages to buffer in total
+	maxBacklogSender  = 64   // Maximum number of future messages to buffer per sender
+	maxTimeoutShift   = 8    // Maximum exponent of the round timeout backoff
+)
+
+// roundState is the phase of the consensus round the local validator is in.
+type roundState int
+
+const (
+	stateAcceptRequest roundState = iota // Waiting for the proposal of the round
+	statePreprepared                     // Proposal accepted, collecting prepares
+	statePrepared                        // Quorum of prepares seen, collecting commits
+	stateCommitted                       // Quorum of commits seen, waiting for the final block
+)
+
+// String implements fmt.Stringer.
+func (s roundState) String() string {
+	switch s {
+	case stateAcceptRequest:
+		return "AcceptRequest"
+	case statePreprepared:
+		return "Preprepared"
+	case statePrepared:
+		return "Prepared"
+	case stateCommitted:
+		return "Committed"
+	default:
+		return "Unknown"
+	}
+}
+
+// request is a block handed over by the miner to be proposed by the local
+// validator and delivered back once committed.
+type request struct {
+	block   *types.Block
+	results chan<- *types.Block
+	stop    <-chan struct{}
+}
+
+// inbound is a consensus message received from a remote peer, or from the local
+// validator itself if peer is nil.
+type inbound struct {
+	msg  *message
+	peer *peer
+}
+
+// Status is the consensus state of the local validator.
+type Status struct {
+	Height   uint64         `json:"height"`   // Block number being agreed upon
+	Round    uint64         `json:"round"`    // Current consensus round
+	State    string         `json:"state"`    // Phase within the current round
+	Proposer common.Address `json:"proposer"` // Proposer of the current round
+	Locked   *common.Hash   `json:"locked"`   // Proposal the validator is locked on, if any
+	Peers    int            `json:"peers"`    // Number of connected consensus peers
+}
+
+// machine is the consensus state machine driving the rounds of the heights on
+// top of the local chain head. All the state is only ever touched by the loop.
+type machine struct {
+	bft   *BFT
+	chain Chain
+
+	height uint64        // Block number being agreed upon
+	round  uint64        // Current consensus round
+	state  roundState    // Phase within the current round
+	parent *types.Header // Parent of the block being agreed upon
+	snap   *Snapshot     // Validator snapshot at the parent
+
+	current  *request     // Latest block handed over by the miner for the height
+	proposed bool         // Whether the local validator already proposed in this round
+	proposal *types.Block // Proposal accepted in the current round
+	locked   *types.Block // Proposal prepared by a quorum, the only acceptable one from now on
+
+	prepares     map[common.Address]common.Hash         // Prepared proposals per validator in the current round
+	commits      map[common.Address]*message            // Commit messages per validator in the current round
+	roundChanges map[uint64]map[common.Address]struct{} // Validators asking for each future round
+
+	backlog     []*inbound             // Messages for future heights or rounds
+	backlogs    map[common.Address]int // Number of buffered messages per sender
+	roundTimer  *time.Timer
+	proposeTime *time.Timer
+
+	requestCh chan *request
+	messageCh chan *inbound
+	quit      chan struct{}
+	wg        sync.WaitGroup
+
+	status     Status // Snapshot of the state for the API, updated by the loop
+	statusLock sync.RWMutex
+}
+
+// newMachine creates the consensus state machine for the given chain and starts
+// running it on top of the current head.
+func newMachine(bft *BFT, chain Chain) *machine {
+	c := &machine{
+		bft:       bft,
+		chain:     chain,
+		backlogs:  make(map[common.Address]int),
+		requestCh: make(chan *request),
+		messageCh: make(chan *inbound, 256),
+		quit:      make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.loop()
+	return c
+}
+
+// close terminates the state machine.
+func (c *machine) close() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// request hands a block from the miner over to the state machine.
+func (c *machine) request(req *request) {
+	select {
+	case c.requestCh <- req:
+	case <-c.quit:
+	}
+}
+
+// deliver hands a consensus message from a remote peer over to the state machine.
+func (c *machine) deliver(msg *message, p *peer) {
+	select {
+	case c.messageCh <- &inbound{msg: msg, peer: p}:
+	case <-c.quit:
+	}
+}
+
+// loop is the state machine's main event loop.
+func (c *machine) loop() {
+	defer c.wg.Done()
+
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := c.chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	c.roundTimer, c.proposeTime = newStoppedTimer(), newStoppedTimer()
+	defer c.roundTimer.Stop()
+	defer c.proposeTime.Stop()
+
+	c.startHeight(c.chain.CurrentHeader())
+	for {
+		select {
+		case ev := <-heads:
+			if head := ev.Block.Header(); head.Number.Uint64() >= c.height {
+				c.startHeight(head)
+			}
+		case req := <-c.requestCh:
+			if c.parent != nil && req.block.NumberU64() == c.height && req.block.ParentHash() == c.parent.Hash() {
+				c.current = req
+				c.propose()
+			}
+		case in := <-c.messageCh:
+			c.handle(in)
+		case <-c.roundTimer.C:
+			c.timeout()
+		case <-c.proposeTime.C:
+			c.propose()
+		case <-sub.Err():
+			return
+		case <-c.quit:
+			return
+		}
+		c.updateStatus()
+	}
+}
+
+// startHeight resets the state machine to agree on the block following head.
+func (c *machine) startHeight(head *types.Header) {
+	snap, err := c.bft.snapshot(c.chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		log.Error("Failed to retrieve validator snapshot", "number", head.Number, "hash", head.Hash(), "err", err)
+		return
+	}
+	c.height, c.parent, c.snap = head.Number.Uint64()+1, head, snap
+	c.locked = nil
+	c.roundChanges = make(map[uint64]map[common.Address]struct{})
+	if c.current != nil && c.current.block.NumberU64() != c.height {
+		c.current = nil
+	}
+	log.Debug("Starting new consensus height", "number", c.height, "validators", len(snap.Validators))
+	c.startRound(0)
+}
+
+// startRound resets the state machine to the beginning of the given round of the
+// current height.
+func (c *machine) startRound(round uint64) {
+	c.round, c.state = round, stateAcceptRequest
+	c.proposed, c.proposal = false, nil
+	c.prepares = make(map[common.Address]common.Hash)
+	c.commits = make(map[common.Address]*message)
+	for r := range c.roundChanges {
+		if r <= round {
+			delete(c.roundChanges, r)
+		}
+	}
+	// Give the first round the block period on top of the timeout, then back off
+	shift := round
+	if shift > maxTimeoutShift {
+		shift = maxTimeoutShift
+	}
+	timeout := time.Duration(c.bft.config.RequestTimeout) * time.Millisecond << shift
+	if round == 0 {
+		if wait := time.Until(time.Unix(int64(c.parent.Time+c.bft.config.Period), 0)); wait > 0 {
+			timeout += wait
+		}
+	}
+	resetTimer(c.roundTimer, timeout)
+
+	c.propose()
+	c.replayBacklog()
+}
+
+// timeout moves on to the next round if the current one failed to complete.
+func (c *machine) timeout() {
+	if c.snap == nil {
+		return
+	}
+	log.Debug("Consensus round timed out", "number", c.height, "round", c.round)
+	c.startRound(c.round + 1)
+	c.broadcast(msgRoundChange, common.Hash{}, nil)
+}
+
+// isValidator returns whether the local key is a validator of the current height.
+func (c *machine) isValidator() bool {
+	_, ok := c.snap.Validators[c.bft.validator()]
+	return ok
+}
+
+// propose sends the proposal of the current round if the local validator is its
+// proposer and has something to propose.
+func (c *machine) propose() {
+	if c.snap == nil || c.proposed || c.state != stateAcceptRequest || !c.isValidator() {
+		return
+	}
+	if c.snap.proposer(c.round) != c.bft.validator() {
+		return
+	}
+	// Locked validators may only ever re-propose the prepared block
+	block := c.locked
+	if block == nil {
+		if c.current == nil {
+			return
+		}
+		// Wait until the block's time slot arrives
+		header := c.current.block.Header()
+		if delay := time.Until(time.Unix(int64(header.Time), 0)); delay > 0 {
+			resetTimer(c.proposeTime, delay)
+			return
+		}
+		extra, err := ExtractExtra(header)
+		if err != nil {
+			log.Error("Invalid block requested for sealing", "err", err)
+			return
+		}
+		extra.Round, extra.Seal = c.round, nil
+		if err := writeExtra(header, extra); err != nil {
+			return
+		}
+		sighash, err := sigRLP(header)
+		if err != nil {
+			log.Error("Failed to encode proposal", "err", err)
+			return
+		}
+		_, seal, err := c.bft.sign(sighash)
+		if err != nil {
+			log.Error("Failed to seal proposal", "err", err)
+			return
+		}
+		extra.Seal = seal
+		if err := writeExtra(header, extra); err != nil {
+			return
+		}
+		block = c.current.block.WithSeal(header)
+	}
+	payload, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return
+	}
+	c.proposed = true
+	log.Debug("Proposing block", "number", c.height, "round", c.round, "hash", proposalHash(block.Header()))
+	c.broadcast(msgPreprepare, proposalHash(block.Header()), payload)
+}
+
+// broadcast signs a consensus message, sends it to all the remote validators and
+// handles it locally too.
+func (c *machine) broadcast(code uint64, digest common.Hash, payload []byte) {
+	if !c.isValidator() {
+		return
+	}
+	msg := &message{Code: code, Height: c.height, Round: c.round, Digest: digest, Payload: payload}
+	sender, sig, err := c.bft.sign(msg.sigData())
+	if err != nil {
+		log.Error("Failed to sign consensus message", "err", err)
+		return
+	}
+	msg.Signature, msg.sender = sig, sender
+	blob, err := msg.encode()
+	if err != nil {
+		return
+	}
+	msg.hash, msg.raw = c.bft.handler.markSeen(blob), blob
+	c.bft.handler.broadcast(msg.hash, blob, nil)
+
+	c.handle(&inbound{msg: msg})
+}
+
+// handle processes a consensus message, either remote or local.
+func (c *machine) handle(in *inbound) {
+	msg := in.msg
+
+	// Final blocks are accepted for any height above the local head
+	if msg.Code == msgCommitted {
+		c.handleCommitted(in)
+		return
+	}
+	if c.snap == nil || msg.Height > c.height {
+		c.storeBacklog(in)
+		return
+	}
+	if msg.Height < c.height {
+		// Help lagging validators stuck in old rounds catch up
+		if msg.Code == msgRoundChange && in.peer != nil {
+			c.sendCommitted(in.peer, msg.Height)
+		}
+		return
+	}
+	if _, ok := c.snap.Validators[msg.sender]; !ok {
+		log.Trace("Dropping message from non-validator", "sender", msg.sender)
+		return
+	}
+	if in.peer != nil {
+		c.bft.handler.broadcast(msg.hash, msg.raw, in.peer)
+	}
+	if msg.Code == msgRoundChange {
+		c.handleRoundChange(msg)
+		return
+	}
+	switch {
+	case msg.Round > c.round:
+		c.storeBacklog(in)
+		return
+	case msg.Round < c.round:
+		return
+	}
+	switch msg.Code {
+	case msgPreprepare:
+		c.handlePreprepare(msg)
+	case msgPrepare:
+		c.prepares[msg.sender] = msg.Digest
+		c.checkPrepared()
+	case msgCommit:
+		c.handleCommit(msg)
+	}
+}
+
+// handlePreprepare verifies the proposal of the round and prepares it if valid.
+func (c *machine) handlePreprepare(msg *message) {
+	if c.state != stateAcceptRequest || msg.sender != c.snap.proposer(c.round) {
+		return
+	}
+	block, err := msg.block()
+	if err != nil {
+		log.Debug("Invalid proposal", "err", err)
+		return
+	}
+	header := block.Header()
+	if block.ParentHash() != c.parent.Hash() {
+		return
+	}
+	if err := c.bft.verifyHeader(c.chain, header, nil, true, false); err != nil {
+		log.Debug("Invalid proposal", "number", c.height, "round", c.round, "err", err)
+		return
+	}
+	digest := proposalHash(header)
+	if digest != msg.Digest {
+		return
+	}
+	extra, _ := ExtractExtra(header)
+	if extra.Round > c.round {
+		return
+	}
+	if c.locked != nil && proposalHash(c.locked.Header()) != digest {
+		log.Debug("Rejecting proposal conflicting with lock", "number", c.height, "round", c.round)
+		return
+	}
+	c.proposal, c.state = block, statePreprepared
+	c.broadcast(msgPrepare, digest, nil)
+	c.checkPrepared()
+	c.checkCommitted()
+}
+
+// handleCommit records the committed seal of a validator.
+func (c *machine) handleCommit(msg *message) {
+	signer, err := recoverAddress(commitData(msg.Digest), msg.Payload)
+	if err != nil || signer != msg.sender {
+		log.Debug("Invalid committed seal", "sender", msg.sender)
+		return
+	}
+	c.commits[msg.sender] = msg
+	c.checkPrepared()
+	c.checkCommitted()
+}
+
+// checkPrepared locks onto the accepted proposal once a quorum of validators
+// prepared or committed it, committing to it locally.
+func (c *machine) checkPrepared() {
+	if c.state != statePreprepared {
+		return
+	}
+	digest := proposalHash(c.proposal.Header())
+	votes := make(map[common.Address]struct{})
+	for validator, hash := range c.prepares {
+		if hash == digest {
+			votes[validator] = struct{}{}
+		}
+	}
+	for validator, msg := range c.commits {
+		if msg.Digest == digest {
+			votes[validator] = struct{}{}
+		}
+	}
+	if len(votes) < c.snap.quorum() {
+		return
+	}
+	c.state, c.locked = statePrepared, c.proposal
+
+	_, seal, err := c.bft.sign(commitData(digest))
+	if err != nil {
+		log.Error("Failed to sign commitment", "err", err)
+		return
+	}
+	c.broadcast(msgCommit, digest, seal)
+}
+
+// checkCommitted finalizes the accepted proposal once a quorum of validators
+// committed to it. Only the proposer of the round assembles the final block, so
+// all nodes end up with the same set of committed seals.
+func (c *machine) checkCommitted() {
+	if c.proposal == nil || c.state == stateCommitted {
+		return
+	}
+	digest := proposalHash(c.proposal.Header())
+
+	var seals []*message
+	for _, msg := range c.commits {
+		if msg.Digest == digest {
+			seals = append(seals, msg)
+		}
+	}
+	if len(seals) < c.snap.quorum() {
+		return
+	}
+	c.state = stateCommitted
+	if c.snap.proposer(c.round) != c.bft.validator() {
+		return
+	}
+	// Order the seals deterministically and assemble the final block
+	sort.Slice(seals, func(i, j int) bool {
+		return bytes.Compare(seals[i].sender[:], seals[j].sender[:]) < 0
+	})
+	header := c.proposal.Header()
+	extra, _ := ExtractExtra(header)
+	for _, msg := range seals {
+		extra.CommittedSeals = append(extra.CommittedSeals, msg.Payload)
+	}
+	if err := writeExtra(header, extra); err != nil {
+		return
+	}
+	block := c.proposal.WithSeal(header)
+	log.Info("Committed new block", "number", block.Number(), "hash", block.Hash(), "round", c.round, "seals", len(seals))
+
+	c.commit(block)
+	if payload, err := rlp.EncodeToBytes(block); err == nil {
+		c.broadcast(msgCommitted, block.Hash(), payload)
+	}
+}
+
+// commit delivers a final block to the miner if it was built from its request,
+// or imports it directly into the chain otherwise.
+func (c *machine) commit(block *types.Block) {
+	if req := c.current; req != nil && SealHash(req.block.Header()) == SealHash(block.Header()) {
+		select {
+		case <-req.stop:
+		case req.results <- block:
+			return
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(block.Header()))
+		}
+	}
+	if _, err := c.chain.InsertChain(types.Blocks{block}); err != nil {
+		log.Warn("Failed to import committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+	}
+}
+
+// handleCommitted imports a final block received from the network.
+func (c *machine) handleCommitted(in *inbound) {
+	block, err := in.msg.block()
+	if err != nil {
+		return
+	}
+	if block.NumberU64() <= c.chain.CurrentHeader().Number.Uint64() {
+		return
+	}
+	if err := c.bft.VerifyHeader(c.chain, block.Header(), true); err != nil {
+		log.Debug("Invalid committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return
+	}
+	if in.peer != nil {
+		c.bft.handler.broadcast(in.msg.hash, in.msg.raw, in.peer)
+	}
+	if _, err := c.chain.InsertChain(types.Blocks{block}); err != nil {
+		log.Warn("Failed to import committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+	}
+}
+
+// sendCommitted sends the local canonical block at the given height to a peer.
+func (c *machine) sendCommitted(p *peer, number uint64) {
+	block := c.chain.GetBlockByNumber(number)
+	if block == nil || !p.markCatchup(number) {
+		return
+	}
+	payload, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return
+	}
+	msg := &message{Code: msgCommitted, Height: number, Digest: block.Hash(), Payload: payload}
+	_, sig, err := c.bft.sign(msg.sigData())
+	if err != nil {
+		return
+	}
+	msg.Signature = sig
+	if blob, err := msg.encode(); err == nil {
+		p.send(blob)
+	}
+}
+
+// handleRoundChange records a validator's wish to move to a new round, joining
+// a round once enough validators asked for it that at least one of them is honest.
+func (c *machine) handleRoundChange(msg *message) {
+	if msg.Round <= c.round {
+		return
+	}
+	if c.roundChanges[msg.Round] == nil {
+		c.roundChanges[msg.Round] = make(map[common.Address]struct{})
+	}
+	c.roundChanges[msg.Round][msg.sender] = struct{}{}
+
+	if len(c.roundChanges[msg.Round]) > c.snap.faulty() {
+		log.Debug("Catching up with consensus round", "number", c.height, "round", msg.Round)
+		c.startRound(msg.Round)
+		c.broadcast(msgRoundChange, common.Hash{}, nil)
+	}
+}
+
+// storeBacklog buffers a message for a future height or round. Messages from
+// senders outside the current validator set are dropped, and every sender gets
+// only a share of the backlog so a single one cannot crowd out the others.
+func (c *machine) storeBacklog(in *inbound) {
+	if in.msg.Height > c.height+maxBacklogHeights || len(c.backlog) >= maxBacklogSize {
+		return
+	}
+	sender := in.msg.sender
+	if c.snap != nil {
+		if _, ok := c.snap.Validators[sender]; !ok {
+			log.Trace("Dropping future message from non-validator", "sender", sender)
+			return
+		}
+	}
+	if c.backlogs[sender] >= maxBacklogSender {
+		log.Trace("Dropping future message over sender quota", "sender", sender)
+		return
+	}
+	c.backlog = append(c.backlog, in)
+	c.backlogs[sender]++
+}
+
+// replayBacklog processes the buffered messages which became current, dropping
+// the ones which became stale.
+func (c *machine) replayBacklog() {
+	var (
+		ready []*inbound
+		keep  = c.backlog[:0]
+	)
+	for _, in := range c.backlog {
+		switch {
+		case in.msg.Height > c.height || (in.msg.Height == c.height && in.msg.Round > c.round):
+			keep = append(keep, in)
+			continue
+		case in.msg.Height == c.height && (in.msg.Round == c.round || in.msg.Code == msgRoundChange):
+			ready = append(ready, in)
+		}
+		if c.backlogs[in.msg.sender]--; c.backlogs[in.msg.sender] <= 0 {
+			delete(c.backlogs, in.msg.sender)
+		}
+	}
+	for i := len(keep); i < len(c.backlog); i++ {
+		c.backlog[i] = nil
+	}
+	c.backlog = keep
+	for _, in := range ready {
+		c.handle(in)
+	}
+}
+
+// updateStatus refreshes the consensus status reported over the API.
+func (c *machine) updateStatus() {
+	status := Status{
+		Height: c.height,
+		Round:  c.round,
+		State:  c.state.String(),
+		Peers:  c.bft.handler.peerCount(),
+	}
+	if c.snap != nil {
+		status.Proposer = c.snap.proposer(c.round)
+	}
+	if c.locked != nil {
+		hash := proposalHash(c.locked.Header())
+		status.Locked = &hash
+	}
+	c.statusLock.Lock()
+	c.status = status
+	c.statusLock.Unlock()
+}
+
+// currentStatus returns the latest consensus status of the state machine.
+func (c *machine) currentStatus() Status {
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+
+	return c.status
+}
+
+// newStoppedTimer creates a timer which doesn't fire until reset.
+func newStoppedTimer() *time.Timer {
+	t := time.NewTimer(0)
+	<-t.C
+	return t
+}
+
+// resetTimer stops a timer, drains it if needed and rearms it.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Extra is the consensus data stored RLP encoded in the header extra-data
+// section, following the fixed size vanity prefix.
+type Extra struct {
+	Validators     []common.Address // Validator set, only present on checkpoint blocks
+	Round          uint64           // Consensus round the block was proposed in
+	Seal           []byte           // Proposer signature over the header without seals
+	CommittedSeals [][]byte         // Validator signatures over the proposal hash
+}
+
+// ExtractExtra decodes the consensus data from the extra-data section of a header.
+func ExtractExtra(header *types.Header) (*Extra, error) {
+	if len(header.Extra) < extraVanity {
+		return nil, errMissingVanity
+	}
+	extra := new(Extra)
+	if err := rlp.DecodeBytes(header.Extra[extraVanity:], extra); err != nil {
+		return nil, errInvalidExtra
+	}
+	return extra, nil
+}
+
+// GenesisExtra returns the extra-data of a genesis block with the given vanity,
+// assigning the initial set of validators.
+func GenesisExtra(vanity []byte, validators []common.Address) ([]byte, error) {
+	sorted := make([]common.Address, len(validators))
+	copy(sorted, validators)
+	sort.Sort(validatorsAscending(sorted))
+
+	header := &types.Header{Extra: vanity}
+	if err := writeExtra(header, &Extra{Validators: sorted}); err != nil {
+		return nil, err
+	}
+	return header.Extra, nil
+}
+
+// writeExtra encodes the consensus data into the extra-data section of a header,
+// retaining any vanity prefix already present.
+func writeExtra(header *types.Header, extra *Extra) error {
+	payload, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		return err
+	}
+	vanity := make([]byte, extraVanity)
+	copy(vanity, header.Extra)
+
+	header.Extra = append(vanity, payload...)
+	return nil
+}
+
+// filteredHeader returns a copy of the header with the proposer seal, committed
+// seals and optionally the round stripped from the extra-data.
+func filteredHeader(header *types.Header, keepRound, keepSeal bool) (*types.Header, error) {
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	filtered := &Extra{Validators: extra.Validators}
+	if keepRound {
+		filtered.Round = extra.Round
+	}
+	if keepSeal {
+		filtered.Seal = extra.Seal
+	}
+	cpy := types.CopyHeader(header)
+	if err := writeExtra(cpy, filtered); err != nil {
+		return nil, err
+	}
+	return cpy, nil
+}
+
+// SealHash returns the hash of a block prior to it being proposed in any round.
+// It's the identifier the miner tracks its sealing tasks by.
+//
+// If the extra-data can't be decoded, there are no seals to strip and the hash
+// of the entire header is returned. Such headers never pass verification.
+func SealHash(header *types.Header) common.Hash {
+	filtered, err := filteredHeader(header, false, false)
+	if err != nil {
+		return header.Hash()
+	}
+	return filtered.Hash()
+}
+
+// sigRLP returns the RLP bytes the proposer of a block signs, covering the round
+// the block was proposed in but none of the seals.
+func sigRLP(header *types.Header) ([]byte, error) {
+	filtered, err := filteredHeader(header, true, false)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(filtered)
+}
+
+// proposalHash returns the hash of a proposed block which the validators commit
+// to, covering everything except the committed seals themselves.
+//
+// If the extra-data can't be decoded, the hash of the entire header is returned,
+// which no quorum of validators could have committed to.
+func proposalHash(header *types.Header) common.Hash {
+	filtered, err := filteredHeader(header, true, true)
+	if err != nil {
+		return header.Hash()
+	}
+	return filtered.Hash()
+}
+
+// commitData returns the data a validator signs to commit to a proposal.
+func commitData(proposal common.Hash) []byte {
+	return append(proposal.Bytes(), byte(msgCommit))
+}
+
+// recoverAddress extracts the address of the account that signed the Keccak256
+// hash of the given data.
+func recoverAddress(data []byte, sig []byte) (common.Address, error) {
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(data), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
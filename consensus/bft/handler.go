@@ -0,0 +1,225 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	protocolName    = "bft"
+	protocolVersion = 1
+	protocolLength  = 1 // Number of message codes used by the protocol
+
+	consensusMsg   = 0x00     // Message code of all the signed consensus messages
+	maxMessageSize = 10 << 20 // Maximum cap on the size of a consensus message
+
+	maxKnownMessages = 1024 // Maximum message hashes to keep in the known list per peer
+	maxKnownCatchups = 64   // Maximum heights a peer was helped to catch up on to remember
+	maxQueuedSends   = 256  // Maximum number of messages queued for sending per peer
+)
+
+// peer is a remote node speaking the consensus protocol.
+type peer struct {
+	*p2p.Peer
+	rw p2p.MsgReadWriter
+
+	known    *lru.Cache // Hashes of messages known to the peer
+	catchups *lru.Cache // Heights the peer was already sent the final block of
+	queue    chan []byte
+	term     chan struct{}
+}
+
+// newPeer wraps a devp2p peer for consensus message exchange.
+func newPeer(p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
+	known, _ := lru.New(maxKnownMessages)
+	catchups, _ := lru.New(maxKnownCatchups)
+
+	return &peer{
+		Peer:     p,
+		rw:       rw,
+		known:    known,
+		catchups: catchups,
+		queue:    make(chan []byte, maxQueuedSends),
+		term:     make(chan struct{}),
+	}
+}
+
+// markCatchup marks a height as sent to the peer, returning whether it wasn't
+// sent already.
+func (p *peer) markCatchup(number uint64) bool {
+	if p.catchups.Contains(number) {
+		return false
+	}
+	p.catchups.Add(number, struct{}{})
+	return true
+}
+
+// send queues an encoded message for sending, dropping it if the peer can't
+// keep up.
+func (p *peer) send(blob []byte) {
+	select {
+	case p.queue <- blob:
+	default:
+		p.Log().Debug("Dropping consensus message, send queue full")
+	}
+}
+
+// sendLoop writes the queued messages to the peer.
+func (p *peer) sendLoop() {
+	for {
+		select {
+		case blob := <-p.queue:
+			if err := p2p.Send(p.rw, consensusMsg, rlp.RawValue(blob)); err != nil {
+				return
+			}
+		case <-p.term:
+			return
+		}
+	}
+}
+
+// handler exchanges consensus messages with the remote peers.
+type handler struct {
+	bft   *BFT
+	seen  *lru.ARCCache // Hashes of recently processed messages
+	peers map[enode.ID]*peer
+	lock  sync.RWMutex
+}
+
+// newHandler creates the consensus message exchange of an engine.
+func newHandler(bft *BFT) *handler {
+	seen, _ := lru.NewARC(inmemoryMessages)
+	return &handler{
+		bft:   bft,
+		seen:  seen,
+		peers: make(map[enode.ID]*peer),
+	}
+}
+
+// protocols returns the devp2p protocol the consensus messages are exchanged on.
+func (h *handler) protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    protocolName,
+		Version: protocolVersion,
+		Length:  protocolLength,
+		Run:     h.runPeer,
+	}}
+}
+
+// runPeer registers a remote peer and processes its messages until it disconnects.
+func (h *handler) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	peer := newPeer(p, rw)
+
+	h.lock.Lock()
+	h.peers[p.ID()] = peer
+	h.lock.Unlock()
+
+	defer func() {
+		h.lock.Lock()
+		delete(h.peers, p.ID())
+		h.lock.Unlock()
+		close(peer.term)
+	}()
+	go peer.sendLoop()
+
+	for {
+		if err := h.handleMsg(peer); err != nil {
+			peer.Log().Debug("Consensus message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMsg reads and processes the next message from a remote peer.
+func (h *handler) handleMsg(p *peer) error {
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+
+	if msg.Size > maxMessageSize {
+		return fmt.Errorf("message too large: %v > %v", msg.Size, maxMessageSize)
+	}
+	if msg.Code != consensusMsg {
+		return fmt.Errorf("invalid message code %d", msg.Code)
+	}
+	var blob rlp.RawValue
+	if err := msg.Decode(&blob); err != nil {
+		return err
+	}
+	hash := crypto.Keccak256Hash(blob)
+	p.known.Add(hash, struct{}{})
+	if h.seen.Contains(hash) {
+		return nil
+	}
+	h.seen.Add(hash, struct{}{})
+
+	m, err := decodeMessage(blob)
+	if err != nil {
+		return err
+	}
+	h.bft.lock.RLock()
+	machine := h.bft.machine
+	h.bft.lock.RUnlock()
+
+	if machine != nil {
+		machine.deliver(m, p)
+	}
+	return nil
+}
+
+// markSeen records a locally created message as processed, returning its hash.
+func (h *handler) markSeen(blob []byte) common.Hash {
+	hash := crypto.Keccak256Hash(blob)
+	h.seen.Add(hash, struct{}{})
+	return hash
+}
+
+// broadcast sends an encoded message to all the peers not yet knowing about it,
+// except for the one it originated from.
+func (h *handler) broadcast(hash common.Hash, blob []byte, origin *peer) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for _, p := range h.peers {
+		if p == origin || p.known.Contains(hash) {
+			continue
+		}
+		p.known.Add(hash, struct{}{})
+		p.send(blob)
+	}
+	log.Trace("Broadcast consensus message", "hash", hash, "peers", len(h.peers))
+}
+
+// peerCount returns the number of connected consensus peers.
+func (h *handler) peerCount() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return len(h.peers)
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Consensus message codes exchanged between the validators.
+const (
+	msgPreprepare  = iota // Proposal of a block for a round, sent by the proposer
+	msgPrepare            // Acknowledgement of a valid proposal
+	msgCommit             // Commitment to a proposal, carrying a committed seal
+	msgRoundChange        // Request to move on to a new round
+	msgCommitted          // Final block including a quorum of committed seals
+)
+
+// message is a signed consensus message gossiped between the validators.
+type message struct {
+	Code      uint64
+	Height    uint64      // Block number the message is about
+	Round     uint64      // Consensus round the message is about
+	Digest    common.Hash // Proposal hash the message is about, if any
+	Payload   []byte      // RLP encoded block or committed seal, depending on the code
+	Signature []byte      // Signature of the sender over all the above
+
+	raw    []byte         // Encoded message as received, for relaying
+	hash   common.Hash    // Cached hash of the full message for deduplication
+	sender common.Address // Recovered sender of the message
+}
+
+// sigData returns the data the sender of a message signs.
+func (m *message) sigData() []byte {
+	blob, err := rlp.EncodeToBytes([]interface{}{m.Code, m.Height, m.Round, m.Digest, m.Payload})
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return blob
+}
+
+// encode serializes a signed message for sending over the wire.
+func (m *message) encode() ([]byte, error) {
+	return rlp.EncodeToBytes([]interface{}{m.Code, m.Height, m.Round, m.Digest, m.Payload, m.Signature})
+}
+
+// decodeMessage deserializes a message received over the wire and recovers the
+// account that signed it.
+func decodeMessage(blob []byte) (*message, error) {
+	msg := new(message)
+	if err := rlp.DecodeBytes(blob, msg); err != nil {
+		return nil, err
+	}
+	if msg.Code > msgCommitted {
+		return nil, fmt.Errorf("%w: unknown code %d", errInvalidMessage, msg.Code)
+	}
+	sender, err := recoverAddress(msg.sigData(), msg.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidMessage, err)
+	}
+	msg.raw, msg.hash, msg.sender = blob, crypto.Keccak256Hash(blob), sender
+	return msg, nil
+}
+
+// block decodes the block carried by preprepare and committed messages.
+func (m *message) block() (*types.Block, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(m.Payload, block); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidMessage, err)
+	}
+	if block.NumberU64() != m.Height {
+		return nil, fmt.Errorf("%w: block number %d, height %d", errInvalidMessage, block.NumberU64(), m.Height)
+	}
+	return block, nil
+}
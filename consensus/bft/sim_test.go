@@ -0,0 +1,268 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testValidator is a simulated node running a BFT validator on top of an
+// in-memory chain, sealing empty blocks in place of a full miner.
+type testValidator struct {
+	key    *ecdsa.PrivateKey
+	engine *BFT
+	chain  *core.BlockChain
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newTestValidator(key *ecdsa.PrivateKey, genesis *core.Genesis) (*testValidator, error) {
+	db := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(genesis.Config.BFT, db)
+	engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), func(signer accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &testValidator{key: key, engine: engine, chain: chain, quit: make(chan struct{})}, nil
+}
+
+// Start implements node.Lifecycle, starting the consensus rounds and the sealer.
+func (v *testValidator) Start() error {
+	v.engine.Start(v.chain)
+
+	v.wg.Add(1)
+	go v.seal()
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the consensus rounds and the sealer.
+func (v *testValidator) Stop() error {
+	close(v.quit)
+	v.wg.Wait()
+
+	v.engine.Close()
+	v.chain.Stop()
+	return nil
+}
+
+// seal keeps handing empty blocks on top of the current head to the engine,
+// importing the ones the local validator managed to get committed.
+func (v *testValidator) seal() {
+	defer v.wg.Done()
+
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := v.chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	for {
+		parent := v.chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+		}
+		if err := v.engine.Prepare(v.chain, header); err != nil {
+			return
+		}
+		statedb, err := v.chain.StateAt(parent.Root())
+		if err != nil {
+			return
+		}
+		block, err := v.engine.FinalizeAndAssemble(v.chain, header, statedb, nil, nil, nil)
+		if err != nil {
+			return
+		}
+		var (
+			results = make(chan *types.Block, 1)
+			stop    = make(chan struct{})
+		)
+		if err := v.engine.Seal(v.chain, block, results, stop); err != nil {
+			return
+		}
+		select {
+		case block := <-results:
+			v.chain.InsertChain(types.Blocks{block})
+		case <-heads:
+		case <-v.quit:
+			close(stop)
+			return
+		}
+		close(stop)
+	}
+}
+
+// Tests that a network of validators connected over the consensus protocol
+// agrees on the same chain of committed blocks, and keeps doing so after one
+// of them goes offline.
+func TestSimulatedValidators(t *testing.T) {
+	const validators = 4
+
+	// Create the node configs up front, using the node keys as validator keys
+	var (
+		configs = make([]*adapters.NodeConfig, validators)
+		addrs   = make([]common.Address, validators)
+	)
+	for i := range configs {
+		configs[i] = adapters.RandomNodeConfig()
+		configs[i].Lifecycles = []string{"bft"}
+		addrs[i] = crypto.PubkeyToAddress(configs[i].PrivateKey.PublicKey)
+	}
+	extra, err := GenesisExtra(nil, addrs)
+	if err != nil {
+		t.Fatalf("failed to create genesis extra: %v", err)
+	}
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.BFT = &params.BFTConfig{Epoch: 30000, RequestTimeout: 500}
+
+	genesis := &core.Genesis{
+		Config:     &config,
+		ExtraData:  extra,
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: big.NewInt(1),
+		Mixhash:    mixDigest,
+	}
+	// Start a simulated network of validators, fully meshed
+	var (
+		lock  sync.Mutex
+		nodes = make(map[enode.ID]*testValidator)
+	)
+	adapter := adapters.NewSimAdapter(adapters.LifecycleConstructors{
+		"bft": func(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+			v, err := newTestValidator(ctx.Config.PrivateKey, genesis)
+			if err != nil {
+				return nil, err
+			}
+			stack.RegisterProtocols(v.engine.Protocols())
+			stack.RegisterLifecycle(v)
+
+			lock.Lock()
+			nodes[ctx.Config.ID] = v
+			lock.Unlock()
+			return v, nil
+		},
+	})
+	net := simulations.NewNetwork(adapter, &simulations.NetworkConfig{DefaultService: "bft"})
+	defer net.Shutdown()
+
+	ids := make([]enode.ID, validators)
+	for i, config := range configs {
+		node, err := net.NewNodeWithConfig(config)
+		if err != nil {
+			t.Fatalf("failed to create node %d: %v", i, err)
+		}
+		ids[i] = node.ID()
+		if err := net.Start(ids[i]); err != nil {
+			t.Fatalf("failed to start node %d: %v", i, err)
+		}
+	}
+	for i := 0; i < validators; i++ {
+		for j := i + 1; j < validators; j++ {
+			if err := net.Connect(ids[i], ids[j]); err != nil {
+				t.Fatalf("failed to connect node %d to %d: %v", i, j, err)
+			}
+		}
+	}
+	// Wait for all the validators to commit a few blocks and ensure they agree
+	live := make([]*testValidator, 0, validators)
+	for _, id := range ids {
+		live = append(live, nodes[id])
+	}
+	waitHeight(t, live, 5)
+	checkAgreement(t, live, 5)
+
+	// Take down a validator, the remaining ones should still reach a quorum
+	if err := net.Stop(ids[0]); err != nil {
+		t.Fatalf("failed to stop node: %v", err)
+	}
+	live = live[1:]
+
+	head := live[0].chain.CurrentBlock().NumberU64()
+	waitHeight(t, live, head+validators+1)
+	checkAgreement(t, live, head+validators+1)
+}
+
+// waitHeight waits until all the validators imported the block at the given height.
+func waitHeight(t *testing.T, validators []*testValidator, number uint64) {
+	t.Helper()
+
+	timeout := time.After(30 * time.Second)
+	for {
+		done := true
+		for _, v := range validators {
+			if v.chain.CurrentBlock().NumberU64() < number {
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+		select {
+		case <-timeout:
+			for i, v := range validators {
+				t.Logf("validator %d: head %d", i, v.chain.CurrentBlock().NumberU64())
+			}
+			t.Fatalf("timeout waiting for block %d", number)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// checkAgreement ensures all the validators have the same canonical chain up to
+// the given height, with every block carrying a quorum of committed seals.
+func checkAgreement(t *testing.T, validators []*testValidator, number uint64) {
+	t.Helper()
+
+	for n := uint64(1); n <= number; n++ {
+		want := validators[0].chain.GetBlockByNumber(n)
+		for i, v := range validators[1:] {
+			if have := v.chain.GetBlockByNumber(n); have == nil || have.Hash() != want.Hash() {
+				t.Fatalf("validator %d: block %d mismatch", i+1, n)
+			}
+		}
+		extra, err := ExtractExtra(want.Header())
+		if err != nil {
+			t.Fatalf("block %d: failed to extract extra: %v", n, err)
+		}
+		if len(extra.CommittedSeals) < 3 {
+			t.Fatalf("block %d: committed seals mismatch: have %d, want >= 3", n, len(extra.CommittedSeals))
+		}
+	}
+}
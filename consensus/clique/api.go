@@ -18,8 +18,10 @@ package clique
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -175,3 +177,81 @@ func (api *API) Status() (*status, error) {
 		NumBlocks:     numBlocks,
 	}, nil
 }
+
+// GetSignerStats returns the sealing activity of the signers over the given
+// number of recent blocks, defaulting to the configured stats window.
+func (api *API) GetSignerStats(blocks *hexutil.Uint64) (*SignerStatsResult, error) {
+	window := api.clique.liveness.statsWindow()
+	if blocks != nil {
+		window = uint64(*blocks)
+	}
+	if window == 0 || window > maxStatsWindow {
+		return nil, fmt.Errorf("invalid stats range %d, must be within [1, %d]", window, maxStatsWindow)
+	}
+	var (
+		header = api.chain.CurrentHeader()
+		end    = header.Number.Uint64()
+		start  = uint64(1)
+	)
+	if end == 0 {
+		return nil, errUnknownBlock
+	}
+	if end > window {
+		start = end - window + 1
+	}
+	parent := api.chain.GetHeaderByNumber(start - 1)
+	if parent == nil {
+		return nil, fmt.Errorf("missing block %d", start-1)
+	}
+	snap, err := api.clique.snapshot(api.chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[common.Address]*SignerStats)
+	lookup := func(signer common.Address) *SignerStats {
+		if stats[signer] == nil {
+			missed, seen := api.clique.liveness.signerStats(signer)
+			stats[signer] = &SignerStats{MissedTurns: missed, LastSeen: seen}
+		}
+		return stats[signer]
+	}
+	delays := make(map[common.Address]time.Duration)
+	for n := start; n <= end; n++ {
+		h := api.chain.GetHeaderByNumber(n)
+		if h == nil {
+			return nil, fmt.Errorf("missing block %d", n)
+		}
+		sealer, err := api.clique.Author(h)
+		if err != nil {
+			return nil, err
+		}
+		signers := snap.signers()
+		inturn := signers[n%uint64(len(signers))]
+
+		lookup(inturn).InturnSlots++
+		if sealer == inturn {
+			lookup(sealer).Inturn++
+		} else {
+			lookup(inturn).MissedInturn++
+		}
+		stat := lookup(sealer)
+		if stat.LastSeen == nil || *stat.LastSeen < n {
+			number := n
+			stat.LastSeen = &number
+		}
+		stat.Sealed++
+		delays[sealer] += api.clique.slotDelay(parent, h)
+
+		if snap, err = snap.apply([]*types.Header{h}); err != nil {
+			return nil, err
+		}
+		parent = h
+	}
+	for _, signer := range snap.signers() {
+		lookup(signer)
+	}
+	for signer, delay := range delays {
+		stats[signer].AverageDelay = delay.Seconds() / float64(stats[signer].Sealed)
+	}
+	return &SignerStatsResult{From: start, To: end, Signers: stats}, nil
+}
@@ -176,6 +176,7 @@ type Clique struct {
 	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
 
 	proposals map[common.Address]bool // Current list of proposals we are pushing
+	liveness  *livenessTracker        // Tracker for the signers missing their turns
 
 	signer common.Address // Ethereum address of the signing key
 	signFn SignerFn       // Signer function to authorize hashes with
@@ -203,6 +204,7 @@ func New(config *params.CliqueConfig, db ethdb.Database) *Clique {
 		recents:    recents,
 		signatures: signatures,
 		proposals:  make(map[common.Address]bool),
+		liveness:   newLivenessTracker(),
 	}
 }
 
@@ -264,6 +266,10 @@ func (c *Clique) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
 		return errInvalidCheckpointVote
 	}
+	// Votes are meaningless if the signers are managed by a governance contract
+	if c.config.SignerContract != nil && (header.Coinbase != (common.Address{}) || !bytes.Equal(header.Nonce[:], nonceDropVote)) {
+		return errContractVote
+	}
 	// Check that the extra-data contains both the vanity and signature
 	if len(header.Extra) < extraVanity {
 		return errMissingVanity
@@ -329,14 +335,10 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	if err != nil {
 		return err
 	}
-	// If the block is a checkpoint block, verify the signer list
-	if number%c.config.Epoch == 0 {
-		signers := make([]byte, len(snap.Signers)*common.AddressLength)
-		for i, signer := range snap.signers() {
-			copy(signers[i*common.AddressLength:], signer[:])
-		}
-		extraSuffix := len(header.Extra) - extraSeal
-		if !bytes.Equal(header.Extra[extraVanity:extraSuffix], signers) {
+	// If the block is a checkpoint block, verify the signer list. Contract managed
+	// signers are verified against the contract state when building snapshots.
+	if number%c.config.Epoch == 0 && c.config.SignerContract == nil {
+		if !bytes.Equal(checkpointSigners(header), flattenSigners(snap.signers())) {
 			return errMismatchingCheckpointSigners
 		}
 	}
@@ -349,6 +351,7 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	// Search for a snapshot in memory or on disk for checkpoints
 	var (
 		headers []*types.Header
+		pending int // Number of headers not yet part of the local chain
 		snap    *Snapshot
 	)
 	for snap == nil {
@@ -358,7 +361,7 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 			break
 		}
 		// If an on-disk checkpoint snapshot can be found, use that
-		if number%checkpointInterval == 0 {
+		if number%checkpointInterval == 0 || (c.config.SignerContract != nil && number%c.config.Epoch == 0) {
 			if s, err := loadSnapshot(c.config, c.signatures, c.db, hash); err == nil {
 				log.Trace("Loaded voting snapshot from disk", "number", number, "hash", hash)
 				snap = s
@@ -395,6 +398,7 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 				return nil, consensus.ErrUnknownAncestor
 			}
 			parents = parents[:len(parents)-1]
+			pending++
 		} else {
 			// No explicit parents (or no more left), reach out to the database
 			header = chain.GetHeader(hash, number)
@@ -409,7 +413,12 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	for i := 0; i < len(headers)/2; i++ {
 		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
 	}
-	snap, err := snap.apply(headers)
+	var err error
+	if c.config.SignerContract != nil {
+		snap, err = c.applyContractHeaders(chain, snap, headers, pending)
+	} else {
+		snap, err = snap.apply(headers)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -476,6 +485,7 @@ func (c *Clique) verifySeal(chain consensus.ChainHeaderReader, header *types.Hea
 			return errWrongDifficulty
 		}
 	}
+	c.trackLiveness(chain, header, parents, snap, signer)
 	return nil
 }
 
@@ -492,7 +502,7 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	if err != nil {
 		return err
 	}
-	if number%c.config.Epoch != 0 {
+	if number%c.config.Epoch != 0 && c.config.SignerContract == nil {
 		c.lock.RLock()
 
 		// Gather all the proposals that make sense voting on
@@ -558,6 +568,18 @@ func (c *Clique) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *
 	// Finalize block
 	c.Finalize(chain, header, state, txs, uncles)
 
+	// If the signers are managed by a governance contract, checkpoint its state
+	if c.config.SignerContract != nil && header.Number.Uint64()%c.config.Epoch == 0 {
+		signers, err := contractSigners(state, *c.config.SignerContract)
+		if err != nil {
+			return nil, err
+		}
+		extra := make([]byte, extraVanity)
+		copy(extra, header.Extra)
+		extra = append(extra, flattenSigners(signers)...)
+		header.Extra = append(extra, make([]byte, extraSeal)...)
+	}
+
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil)), nil
 }
@@ -636,6 +658,7 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 
 		select {
 		case results <- block.WithSeal(header):
+			c.trackLiveness(chain, header, nil, snap, signer)
 		default:
 			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header))
 		}
@@ -17,10 +17,14 @@
 package clique
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"math/big"
+	"sort"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -111,3 +115,236 @@ func TestReimportMirroredState(t *testing.T) {
 		t.Fatalf("chain head mismatch: have %d, want %d", head, 3)
 	}
 }
+
+// Tests that signers managed by a governance contract are taken over from the
+// contract state at epoch checkpoints, and that checkpoints not matching the
+// contract or blocks casting votes are rejected.
+func TestContractSigners(t *testing.T) {
+	var (
+		keyA, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		keyB, _  = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		addrA    = crypto.PubkeyToAddress(keyA.PublicKey)
+		addrB    = crypto.PubkeyToAddress(keyB.PublicKey)
+		contract = common.HexToAddress("0x0000000000000000000000000000000000c1c0e0")
+		base     = crypto.Keccak256Hash(common.Hash{}.Bytes()).Big()
+	)
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = &params.CliqueConfig{Period: 0, Epoch: 3, SignerContract: &contract}
+
+	// Start with signer A only, while the contract authorizes both A and B
+	genspec := &core.Genesis{
+		Config:    &config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: map[common.Address]core.GenesisAccount{
+			contract: {
+				Balance: big.NewInt(0),
+				Code:    []byte{0x00},
+				Storage: map[common.Hash]common.Hash{
+					{}:                     common.BigToHash(big.NewInt(2)),
+					common.BigToHash(base): common.BytesToHash(addrA[:]),
+					common.BigToHash(new(big.Int).Add(base, common.Big1)): common.BytesToHash(addrB[:]),
+				},
+			},
+		},
+	}
+	copy(genspec.ExtraData[extraVanity:], addrA[:])
+
+	db := rawdb.NewMemoryDatabase()
+	genesis := genspec.MustCommit(db)
+
+	engine := New(config.Clique, db)
+	engine.fakeDiff = true
+
+	blocks, _ := core.GenerateChain(&config, genesis, engine, db, 4, func(i int, block *core.BlockGen) {
+		block.SetDifficulty(diffNoTurn)
+	})
+	// Sign the first three blocks with A, the fourth with the newly added B
+	resign := func(blocks []*types.Block, tamper func(i int, header *types.Header)) []*types.Block {
+		signed := make([]*types.Block, len(blocks))
+		for i, block := range blocks {
+			header := block.Header()
+			if i > 0 {
+				header.ParentHash = signed[i-1].Hash()
+			}
+			if header.Number.Uint64()%config.Clique.Epoch != 0 {
+				header.Extra = make([]byte, extraVanity+extraSeal)
+			}
+			if tamper != nil {
+				tamper(i, header)
+			}
+			key := keyA
+			if i == 3 {
+				key = keyB
+			}
+			sig, _ := crypto.Sign(SealHash(header).Bytes(), key)
+			copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+			signed[i] = block.WithSeal(header)
+		}
+		return signed
+	}
+	// The checkpoint must embed the contract signers and authorize B afterwards
+	valid := resign(blocks, nil)
+
+	signers := []common.Address{addrA, addrB}
+	sort.Sort(signersAscending(signers))
+	if have, want := checkpointSigners(valid[2].Header()), flattenSigners(signers); !bytes.Equal(have, want) {
+		t.Fatalf("checkpoint signers mismatch: have %x, want %x", have, want)
+	}
+	chain, _ := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(valid); err != nil {
+		t.Fatalf("failed to insert contract managed chain: %v", err)
+	}
+	// The verified checkpoint must be snapshotted, not needing its state again
+	if _, err := loadSnapshot(engine.config, engine.signatures, db, valid[2].Hash()); err != nil {
+		t.Fatalf("verified checkpoint snapshot missing: %v", err)
+	}
+	// Header only imports lack the contract state, the checkpoint signers must be
+	// accepted provisionally without storing the checkpoint snapshot
+	db = rawdb.NewMemoryDatabase()
+	genspec.MustCommit(db)
+	engine = New(config.Clique, db)
+	engine.fakeDiff = true
+
+	chain, _ = core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	headers := make([]*types.Header, len(valid))
+	for i, block := range valid {
+		headers[i] = block.Header()
+	}
+	if _, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert contract managed header chain: %v", err)
+	}
+	if _, err := loadSnapshot(engine.config, engine.signatures, db, valid[2].Hash()); err == nil {
+		t.Fatalf("provisional checkpoint snapshot stored")
+	}
+	// A checkpoint deviating from the contract must be rejected
+	db = rawdb.NewMemoryDatabase()
+	genspec.MustCommit(db)
+	engine = New(config.Clique, db)
+	engine.fakeDiff = true
+
+	chain, _ = core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	tampered := resign(blocks, func(i int, header *types.Header) {
+		if i == 2 {
+			header.Extra = make([]byte, extraVanity+common.AddressLength+extraSeal)
+			copy(header.Extra[extraVanity:], addrA[:])
+		}
+	})
+	if _, err := chain.InsertChain(tampered); err != errMismatchingCheckpointSigners {
+		t.Fatalf("tampered checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+	// Votes must be rejected as the contract is the only source of signers
+	voting := resign(blocks[:1], func(i int, header *types.Header) {
+		header.Coinbase = addrB
+		copy(header.Nonce[:], nonceAuthVote)
+	})
+	if _, err := chain.InsertChain(voting); err != errContractVote {
+		t.Fatalf("vote error mismatch: have %v, want %v", err, errContractVote)
+	}
+}
+
+// Tests that the sealing activity of the signers is tracked across in-turn and
+// out-of-turn blocks, and reported over the requested range of recent blocks.
+func TestSignerStats(t *testing.T) {
+	// Create three signers sorted by address, the last of which never seals
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := crypto.PubkeyToAddress(keys[i].PublicKey), crypto.PubkeyToAddress(keys[j].PublicKey)
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	addrs := make([]common.Address, len(keys))
+	for i, key := range keys {
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	genspec := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+len(addrs)*common.AddressLength+extraSeal),
+	}
+	copy(genspec.ExtraData[extraVanity:], flattenSigners(addrs))
+
+	db := rawdb.NewMemoryDatabase()
+	genesis := genspec.MustCommit(db)
+
+	engine := New(params.AllCliqueProtocolChanges.Clique, db)
+	engine.SetLiveness(0, 2)
+
+	// Alternate the first two signers, sealing in turn only at blocks 1 and 6
+	sealers := []int{1, 0, 1, 0, 1, 0}
+	blocks, _ := core.GenerateChain(params.AllCliqueProtocolChanges, genesis, engine, db, len(sealers), func(i int, block *core.BlockGen) {
+		block.SetDifficulty(diffNoTurn)
+	})
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		header.Extra = make([]byte, extraVanity+extraSeal)
+		header.Difficulty = diffNoTurn
+		if uint64(i+1)%uint64(len(keys)) == uint64(sealers[i]) {
+			header.Difficulty = diffInTurn
+		}
+		sig, _ := crypto.Sign(SealHash(header).Bytes(), keys[sealers[i]])
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+		blocks[i] = block.WithSeal(header)
+	}
+	chain, _ := core.NewBlockChain(db, nil, params.AllCliqueProtocolChanges, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	// Ensure the liveness tracker follows the consecutive missed turns
+	for i, want := range []uint64{0, 1, 2} {
+		if have, _ := engine.liveness.signerStats(addrs[i]); have != want {
+			t.Errorf("signer %d: missed turns mismatch: have %d, want %d", i, have, want)
+		}
+	}
+	// Ensure the stats over the entire chain and a partial range are correct
+	api := &API{chain: chain, clique: engine}
+
+	stats, err := api.GetSignerStats(nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve signer stats: %v", err)
+	}
+	if stats.From != 1 || stats.To != 6 {
+		t.Fatalf("range mismatch: have [%d, %d], want [1, 6]", stats.From, stats.To)
+	}
+	wants := []SignerStats{
+		{Sealed: 3, Inturn: 1, InturnSlots: 2, MissedInturn: 1, AverageDelay: 10, MissedTurns: 0},
+		{Sealed: 3, Inturn: 1, InturnSlots: 2, MissedInturn: 1, AverageDelay: 10, MissedTurns: 1},
+		{Sealed: 0, Inturn: 0, InturnSlots: 2, MissedInturn: 2, AverageDelay: 0, MissedTurns: 2},
+	}
+	seen := []*uint64{new(uint64), new(uint64), nil}
+	*seen[0], *seen[1] = 6, 5
+
+	for i, want := range wants {
+		have := stats.Signers[addrs[i]]
+		if have == nil {
+			t.Fatalf("signer %d: missing stats", i)
+		}
+		if (have.LastSeen == nil) != (seen[i] == nil) || (have.LastSeen != nil && *have.LastSeen != *seen[i]) {
+			t.Errorf("signer %d: last seen mismatch: have %v, want %v", i, have.LastSeen, seen[i])
+		}
+		have.LastSeen = nil
+		if *have != want {
+			t.Errorf("signer %d: stats mismatch: have %+v, want %+v", i, *have, want)
+		}
+	}
+	blocksRange := hexutil.Uint64(2)
+	if stats, err = api.GetSignerStats(&blocksRange); err != nil {
+		t.Fatalf("failed to retrieve partial signer stats: %v", err)
+	}
+	if stats.From != 5 || stats.To != 6 {
+		t.Fatalf("partial range mismatch: have [%d, %d], want [5, 6]", stats.From, stats.To)
+	}
+	if have := stats.Signers[addrs[2]].MissedInturn; have != 1 {
+		t.Errorf("partial missed in-turn mismatch: have %d, want 1", have)
+	}
+}
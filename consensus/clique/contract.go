@@ -0,0 +1,180 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// maxContractSigners is the maximum number of signers accepted from the signer
+// governance contract, protecting against bogus lengths in its storage.
+const maxContractSigners = 1024
+
+var (
+	// errContractVote is returned if a block casts a vote while the signers are
+	// managed by a governance contract.
+	errContractVote = errors.New("vote cast with contract managed signers")
+
+	// errInvalidContractSigners is returned if the signer governance contract
+	// holds no signers, or more than allowed.
+	errInvalidContractSigners = errors.New("invalid signer list in contract")
+)
+
+// stateReader is implemented by chains able to provide the state of their blocks,
+// needed to verify checkpoints against the signer governance contract.
+type stateReader interface {
+	StateAt(root common.Hash) (*state.StateDB, error)
+}
+
+// contractSigners reads the authorized signers from the governance contract in
+// the given state. The contract is expected to keep them in an `address[]`
+// at storage slot zero, the returned list is sorted and deduplicated.
+func contractSigners(statedb *state.StateDB, contract common.Address) ([]common.Address, error) {
+	length := statedb.GetState(contract, common.Hash{}).Big()
+	if length.Sign() == 0 || length.Cmp(big.NewInt(maxContractSigners)) > 0 {
+		return nil, fmt.Errorf("%w: %v signers", errInvalidContractSigners, length)
+	}
+	var (
+		base  = crypto.Keccak256Hash(common.Hash{}.Bytes()).Big()
+		seen  = make(map[common.Address]struct{})
+		slots = int(length.Int64())
+	)
+	signers := make([]common.Address, 0, slots)
+	for i := 0; i < slots; i++ {
+		slot := common.BigToHash(new(big.Int).Add(base, big.NewInt(int64(i))))
+		signer := common.BytesToAddress(statedb.GetState(contract, slot).Bytes())
+		if _, ok := seen[signer]; ok {
+			continue
+		}
+		seen[signer] = struct{}{}
+		signers = append(signers, signer)
+	}
+	sort.Sort(signersAscending(signers))
+	return signers, nil
+}
+
+// VerifyState implements consensus.StateVerifier, checking that the signer list
+// of epoch checkpoints matches the governance contract, if one is configured.
+//
+// This covers the checkpoints accepted provisionally while building snapshots, as
+// their states weren't available yet, e.g. full blocks imported in a batch. Their
+// snapshots are stored once verified, the states not being needed afterwards.
+func (c *Clique) VerifyState(chain consensus.ChainHeaderReader, header *types.Header, statedb *state.StateDB) error {
+	number := header.Number.Uint64()
+	if c.config.SignerContract == nil || number%c.config.Epoch != 0 {
+		return nil
+	}
+	if err := c.verifyContractSigners(header, statedb); err != nil {
+		return err
+	}
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if snap, err = snap.apply([]*types.Header{header}); err != nil {
+		return err
+	}
+	return snap.store(c.db)
+}
+
+// verifyContractSigners checks that the signer list of a checkpoint matches the
+// governance contract in the given state.
+func (c *Clique) verifyContractSigners(header *types.Header, statedb *state.StateDB) error {
+	signers, err := contractSigners(statedb, *c.config.SignerContract)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(checkpointSigners(header), flattenSigners(signers)) {
+		return errMismatchingCheckpointSigners
+	}
+	return nil
+}
+
+// applyContractHeaders applies a batch of headers on top of a snapshot if the
+// signers are managed by a governance contract. The signer list of a checkpoint
+// is verified against the contract state if that's available locally, and the
+// snapshot is stored, so the state, which might get pruned, is not needed again
+// when reapplying the headers later.
+//
+// Otherwise the signer list in the checkpoint header is accepted provisionally.
+// This is the case for header chains without state (fast, snap and light sync)
+// and for the last pending headers, which are not yet part of the local chain.
+// Full blocks get their checkpoints verified via VerifyState after processing.
+func (c *Clique) applyContractHeaders(chain consensus.ChainHeaderReader, snap *Snapshot, headers []*types.Header, pending int) (*Snapshot, error) {
+	reader, _ := chain.(stateReader)
+	for len(headers) > 0 {
+		// Find the next checkpoint, applying all headers if there's none left
+		n := 0
+		for n < len(headers) && headers[n].Number.Uint64()%c.config.Epoch != 0 {
+			n++
+		}
+		if n == len(headers) {
+			return snap.apply(headers)
+		}
+		checkpoint := headers[n]
+
+		var verified bool
+		if reader != nil && n < len(headers)-pending {
+			if statedb, err := reader.StateAt(checkpoint.Root); err == nil {
+				if err := c.verifyContractSigners(checkpoint, statedb); err != nil {
+					return nil, err
+				}
+				verified = true
+			}
+		}
+		if !verified {
+			log.Debug("Accepted contract checkpoint signers provisionally", "number", checkpoint.Number, "hash", checkpoint.Hash())
+		}
+		var err error
+		if snap, err = snap.apply(headers[:n+1]); err != nil {
+			return nil, err
+		}
+		if verified {
+			if err := snap.store(c.db); err != nil {
+				return nil, err
+			}
+			log.Trace("Stored contract checkpoint snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+		}
+		headers = headers[n+1:]
+	}
+	return snap, nil
+}
+
+// checkpointSigners returns the raw signer list embedded in a checkpoint header.
+func checkpointSigners(header *types.Header) []byte {
+	return header.Extra[extraVanity : len(header.Extra)-extraSeal]
+}
+
+// flattenSigners concatenates a list of signers as embedded in checkpoint headers.
+func flattenSigners(signers []common.Address) []byte {
+	blob := make([]byte, 0, len(signers)*common.AddressLength)
+	for _, signer := range signers {
+		blob = append(blob, signer[:]...)
+	}
+	return blob
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	defaultStatsWindow = 64 // Default number of recent blocks to gather signer stats over
+	defaultMissedTurns = 3  // Default number of consecutive missed turns to warn about a signer
+
+	maxStatsWindow = 8192 // Maximum number of recent blocks to gather signer stats over
+)
+
+var (
+	inturnMeter  = metrics.NewRegisteredMeter("clique/blocks/inturn", nil)
+	noturnMeter  = metrics.NewRegisteredMeter("clique/blocks/noturn", nil)
+	delayTimer   = metrics.NewRegisteredTimer("clique/blocks/delay", nil)
+	missedPrefix = "clique/signers/missed/"
+)
+
+// livenessTracker follows the signers sealing the newly verified headers, to
+// detect signers consistently missing their in-turn slots.
+type livenessTracker struct {
+	window uint64 // Default number of recent blocks to gather signer stats over
+	warnAt uint64 // Number of consecutive missed turns to warn about a signer
+
+	head     uint64                    // Highest block number tracked
+	missed   map[common.Address]uint64 // Consecutive in-turn slots missed per signer
+	lastSeen map[common.Address]uint64 // Last block number sealed per signer
+	lock     sync.Mutex
+}
+
+// newLivenessTracker creates a liveness tracker with the default settings.
+func newLivenessTracker() *livenessTracker {
+	return &livenessTracker{
+		window:   defaultStatsWindow,
+		warnAt:   defaultMissedTurns,
+		missed:   make(map[common.Address]uint64),
+		lastSeen: make(map[common.Address]uint64),
+	}
+}
+
+// track records the signer of a freshly verified header, given the signer whose
+// turn it was. Headers at or below the highest tracked one are ignored, so
+// reverifications and side chains don't skew the counters.
+func (t *livenessTracker) track(header *types.Header, signer, inturn common.Address, delay time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	number := header.Number.Uint64()
+	if number <= t.head {
+		return
+	}
+	t.head = number
+	t.lastSeen[signer] = number
+	delayTimer.Update(delay)
+
+	if signer == inturn {
+		inturnMeter.Mark(1)
+		t.missed[signer] = 0
+		metrics.GetOrRegisterGauge(missedPrefix+signer.Hex(), nil).Update(0)
+		return
+	}
+	noturnMeter.Mark(1)
+	t.missed[inturn]++
+
+	missed := t.missed[inturn]
+	metrics.GetOrRegisterGauge(missedPrefix+inturn.Hex(), nil).Update(int64(missed))
+	if t.warnAt > 0 && missed%t.warnAt == 0 {
+		log.Warn("Clique signer missing its turns", "signer", inturn, "missed", missed, "lastseen", t.lastSeen[inturn], "number", number)
+	}
+}
+
+// statsWindow returns the default number of recent blocks to gather stats over.
+func (t *livenessTracker) statsWindow() uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.window
+}
+
+// signerStats returns the number of consecutive in-turn slots a signer missed
+// and the last block it was seen sealing, if any.
+func (t *livenessTracker) signerStats(signer common.Address) (uint64, *uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if seen, ok := t.lastSeen[signer]; ok {
+		return t.missed[signer], &seen
+	}
+	return t.missed[signer], nil
+}
+
+// trackLiveness feeds a sealed header into the liveness tracker, given the
+// snapshot of its parent and the signer that sealed it.
+func (c *Clique) trackLiveness(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, snap *Snapshot, signer common.Address) {
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	if parent == nil {
+		return
+	}
+	signers := snap.signers()
+	inturn := signers[header.Number.Uint64()%uint64(len(signers))]
+
+	c.liveness.track(header, signer, inturn, c.slotDelay(parent, header))
+}
+
+// slotDelay returns how late a header was sealed compared to the earliest time
+// permitted by the block period.
+func (c *Clique) slotDelay(parent, header *types.Header) time.Duration {
+	slot := parent.Time + c.config.Period
+	if header.Time <= slot {
+		return 0
+	}
+	return time.Duration(header.Time-slot) * time.Second
+}
+
+// SetLiveness configures the default number of recent blocks to gather signer
+// stats over, and the number of consecutive missed in-turn slots after which a
+// signer is reported as failing. Zero values leave the current settings intact.
+func (c *Clique) SetLiveness(window uint64, missedTurns uint64) {
+	c.liveness.lock.Lock()
+	defer c.liveness.lock.Unlock()
+
+	if window > 0 {
+		c.liveness.window = window
+	}
+	if missedTurns > 0 {
+		c.liveness.warnAt = missedTurns
+	}
+}
+
+// SignerStats is the sealing activity of a signer over a range of blocks.
+type SignerStats struct {
+	Sealed       uint64  `json:"sealed"`       // Number of blocks sealed
+	Inturn       uint64  `json:"inturn"`       // Number of blocks sealed in turn
+	InturnSlots  uint64  `json:"inturnSlots"`  // Number of blocks the signer was in turn for
+	MissedInturn uint64  `json:"missedInturn"` // Number of in-turn slots sealed by another signer
+	AverageDelay float64 `json:"averageDelay"` // Average seconds past the block period of the sealed blocks
+	LastSeen     *uint64 `json:"lastSeen"`     // Last block sealed by the signer, if known
+	MissedTurns  uint64  `json:"missedTurns"`  // Consecutive in-turn slots missed up to the head
+}
+
+// SignerStatsResult is the sealing activity of all signers over a range of blocks.
+type SignerStatsResult struct {
+	From    uint64                          `json:"from"`
+	To      uint64                          `json:"to"`
+	Signers map[common.Address]*SignerStats `json:"signers"`
+}
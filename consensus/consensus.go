@@ -125,3 +125,13 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// StateVerifier is a consensus engine with rules depending on the state produced
+// by the blocks, which cannot be checked by looking at the headers alone.
+type StateVerifier interface {
+	Engine
+
+	// VerifyState checks whether a header conforms to the consensus rules of the
+	// engine, given the state resulting from processing its block.
+	VerifyState(chain ChainHeaderReader, header *types.Header, state *state.StateDB) error
+}
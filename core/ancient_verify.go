@@ -0,0 +1,157 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// AncientCorruption describes an ancient block failing integrity verification.
+type AncientCorruption struct {
+	Number uint64 // Number of the corrupted block
+	Err    error  // Description of the corruption
+}
+
+// VerifyAncients checks the integrity of the ancient blocks starting at the
+// given number: every item must be retrievable from its table, headers must
+// hash to the stored canonical hashes and link to their parents, difficulties
+// must accumulate correctly, and the bodies and receipts, unless expired, must
+// match the roots in their headers. The last ancient block is also checked to
+// link up with the first block in the key-value store.
+//
+// Each corrupted block is passed to the report callback. The number of the
+// first corrupted block is returned, or the number of ancient items if all of
+// them are intact.
+func VerifyAncients(db ethdb.Database, start uint64, report func(*AncientCorruption)) (uint64, error) {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		first   = frozen
+		parent  common.Hash
+		parentT *big.Int
+		begin   = time.Now()
+		logged  = time.Now()
+	)
+	fail := func(number uint64, err error) {
+		if number < first {
+			first = number
+		}
+		report(&AncientCorruption{Number: number, Err: err})
+	}
+	// Load the parent of the first block to verify, if it's sane
+	if start > 0 && start <= frozen {
+		if header, td, err := verifyAncientBlock(db, start-1); err == nil {
+			parent, parentT = header.Hash(), td
+		}
+	}
+	for number := start; number < frozen; number++ {
+		header, td, err := verifyAncientBlock(db, number)
+		switch {
+		case err != nil:
+			fail(number, err)
+		case parentT != nil && header.ParentHash != parent:
+			fail(number, fmt.Errorf("parent hash mismatch: have %x, want %x", header.ParentHash, parent))
+		case parentT != nil && td.Cmp(new(big.Int).Add(parentT, header.Difficulty)) != 0:
+			fail(number, fmt.Errorf("total difficulty mismatch: have %v, want %v", td, new(big.Int).Add(parentT, header.Difficulty)))
+		}
+		if err != nil {
+			parent, parentT = common.Hash{}, nil
+		} else {
+			parent, parentT = header.Hash(), td
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying ancient blocks", "number", number, "frozen", frozen, "first", first, "elapsed", common.PrettyDuration(time.Since(begin)))
+			logged = time.Now()
+		}
+	}
+	// Ensure the key-value store continues where the ancient store left off
+	if parentT != nil {
+		if hash := rawdb.ReadCanonicalHash(db, frozen); hash != (common.Hash{}) {
+			if header := rawdb.ReadHeader(db, hash, frozen); header != nil && header.ParentHash != parent {
+				fail(frozen-1, fmt.Errorf("ancient chain does not link to block #%d [%x…]", frozen, hash[:4]))
+			}
+		}
+	}
+	return first, nil
+}
+
+// verifyAncientBlock checks the content of a single ancient block against its
+// header and canonical hash, returning the decoded header and total difficulty.
+func verifyAncientBlock(db ethdb.AncientReader, number uint64) (*types.Header, *big.Int, error) {
+	blob, err := rawdb.ReadAncientBlockRLP(db, number)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(blob.Hash) != common.HashLength {
+		return nil, nil, fmt.Errorf("invalid canonical hash length %d", len(blob.Hash))
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(blob.Header, header); err != nil {
+		return nil, nil, fmt.Errorf("invalid header: %v", err)
+	}
+	if hash := header.Hash(); hash != common.BytesToHash(blob.Hash) {
+		return nil, nil, fmt.Errorf("header hash mismatch: have %x, want %x", hash, blob.Hash)
+	}
+	if header.Number.Uint64() != number {
+		return nil, nil, fmt.Errorf("header number mismatch: have %d", header.Number)
+	}
+	td := new(big.Int)
+	if err := rlp.DecodeBytes(blob.Td, td); err != nil {
+		return nil, nil, fmt.Errorf("invalid total difficulty: %v", err)
+	}
+	if blob.Body == nil {
+		return header, td, nil // Body and receipts expired
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(blob.Body, body); err != nil {
+		return nil, nil, fmt.Errorf("invalid body: %v", err)
+	}
+	if hash := types.DeriveSha(types.Transactions(body.Transactions), trie.NewStackTrie(nil)); hash != header.TxHash {
+		return nil, nil, fmt.Errorf("transaction root mismatch: have %x, want %x", hash, header.TxHash)
+	}
+	if hash := types.CalcUncleHash(body.Uncles); hash != header.UncleHash {
+		return nil, nil, fmt.Errorf("uncle hash mismatch: have %x, want %x", hash, header.UncleHash)
+	}
+	var stored []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(blob.Receipts, &stored); err != nil {
+		return nil, nil, fmt.Errorf("invalid receipts: %v", err)
+	}
+	if len(stored) != len(body.Transactions) {
+		return nil, nil, fmt.Errorf("receipt count mismatch: have %d, want %d", len(stored), len(body.Transactions))
+	}
+	receipts := make(types.Receipts, len(stored))
+	for i, receipt := range stored {
+		receipts[i] = (*types.Receipt)(receipt)
+		receipts[i].Type = body.Transactions[i].Type() // Not stored, needed for the consensus encoding
+	}
+	if hash := types.DeriveSha(receipts, trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+		return nil, nil, fmt.Errorf("receipt root mismatch: have %x, want %x", hash, header.ReceiptHash)
+	}
+	return header, td, nil
+}
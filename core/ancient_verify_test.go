@@ -0,0 +1,126 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the ancient store verifier accepts healthy ancient chains and
+// pinpoints corrupted items.
+func TestVerifyAncients(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000000000000000)}}}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 16, func(i int, gen *BlockGen) {
+		// Mix legacy and typed transactions to exercise the receipt encodings
+		var tx *types.Transaction
+		if i%2 == 0 {
+			tx, _ = types.SignTx(types.NewTransaction(gen.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		} else {
+			tx, _ = types.SignNewTx(key, signer, &types.AccessListTx{
+				ChainID:  gspec.Config.ChainID,
+				Nonce:    gen.TxNonce(address),
+				To:       &common.Address{0x01},
+				Gas:      params.TxGas,
+				GasPrice: big.NewInt(1),
+			})
+		}
+		gen.AddTx(tx)
+	})
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	defer db.Close()
+	gspec.MustCommit(db)
+
+	chain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts, 10); err != nil {
+		t.Fatalf("failed to insert receipt %d: %v", n, err)
+	}
+	frozen, _ := db.Ancients()
+	if frozen != 11 {
+		t.Fatalf("ancient count mismatch: have %d, want %d", frozen, 11)
+	}
+	var reports []*AncientCorruption
+	report := func(c *AncientCorruption) { reports = append(reports, c) }
+
+	first, err := VerifyAncients(db, 0, report)
+	if err != nil {
+		t.Fatalf("failed to verify ancients: %v", err)
+	}
+	if first != frozen || len(reports) != 0 {
+		t.Fatalf("healthy ancients reported corrupted: first %d, reports %v", first, reports)
+	}
+	// Corrupt the canonical hash of block #5 and ensure it's detected
+	path := filepath.Join(frdir, "hashes.0000.rdat")
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob[5*common.HashLength] ^= 0xff
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if first, err = VerifyAncients(db, 0, report); err != nil {
+		t.Fatalf("failed to verify ancients: %v", err)
+	}
+	if first != 5 || len(reports) != 1 || reports[0].Number != 5 {
+		t.Fatalf("corruption mismatch: first %d, reports %v", first, reports)
+	}
+	// Starting past the corruption should report a healthy store
+	reports = nil
+	if first, err = VerifyAncients(db, 6, report); err != nil {
+		t.Fatalf("failed to verify ancients: %v", err)
+	}
+	if first != frozen || len(reports) != 0 {
+		t.Fatalf("healthy range reported corrupted: first %d, reports %v", first, reports)
+	}
+}
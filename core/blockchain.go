@@ -129,6 +129,8 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whether to store preimage of trie key to the disk
+	HistoryLimit        uint64        // Number of recent blocks to retain ancient bodies and receipts for (0 = all)
+	StateHistory        uint64        // Number of recent blocks to retain state reverse diffs for (0 = disabled)
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -374,14 +376,26 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		}
 		bc.snaps, _ = snapshot.New(bc.db, bc.stateCache.TrieDB(), bc.cacheConfig.SnapshotLimit, head.Root(), !bc.cacheConfig.SnapshotWait, true, recover)
 	}
+	if bc.cacheConfig.StateHistory > 0 && bc.snaps == nil {
+		log.Warn("State history requires snapshots, disabling")
+	}
 	// Take ownership of this particular state
 	go bc.update()
 	if txLookupLimit != nil {
-		bc.txLookupLimit = *txLookupLimit
+		bc.SetTxLookupLimit(*txLookupLimit)
 
 		bc.wg.Add(1)
 		go bc.maintainTxIndex(txIndexBlock)
 	}
+	// If old chain history is to be expired, spin up the pruner
+	if bc.cacheConfig.HistoryLimit > 0 {
+		if _, err := bc.db.AncientTail(); err != nil {
+			log.Warn("Chain history expiry unsupported", "err", err)
+		} else {
+			bc.wg.Add(1)
+			go bc.maintainHistory()
+		}
+	}
 	// If periodic cache journal is required, spin it up.
 	if bc.cacheConfig.TrieCleanRejournal > 0 {
 		if bc.cacheConfig.TrieCleanRejournal < time.Minute {
@@ -691,6 +705,24 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache, bc.snaps)
 }
 
+// HistoricState returns a read-only state for the given block, reconstructed from
+// the current snapshot and the persisted state history. It allows accessing the
+// states of recent blocks whose tries were already garbage collected.
+func (bc *BlockChain) HistoricState(header *types.Header) (*state.StateDB, error) {
+	if bc.snaps == nil || bc.cacheConfig.StateHistory == 0 {
+		return nil, errors.New("state history disabled")
+	}
+	head := bc.CurrentBlock().Header()
+	if number := header.Number.Uint64(); number > head.Number.Uint64() || head.Number.Uint64()-number > bc.cacheConfig.StateHistory {
+		return nil, snapshot.ErrHistoryUnavailable
+	}
+	snap, err := bc.snaps.History(head, header.Number.Uint64(), header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return state.NewFromSnapshot(header.Root, bc.stateCache, snap)
+}
+
 // StateCache returns the caching database underpinning the blockchain instance.
 func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
@@ -1447,9 +1479,22 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 // SetTxLookupLimit is responsible for updating the txlookup limit to the
 // original one stored in db if the new mismatches with the old one.
 func (bc *BlockChain) SetTxLookupLimit(limit uint64) {
+	// Transactions can't be indexed (or unindexed) without their block bodies,
+	// so the indices can't outlive the retained chain history.
+	if history := bc.cacheConfig.HistoryLimit; history > 0 && (limit == 0 || limit > history) {
+		log.Info("Capping transaction index to chain history", "txlookuplimit", limit, "historylimit", history)
+		limit = history
+	}
 	bc.txLookupLimit = limit
 }
 
+// HistoryTail retrieves the number of the first block whose body and receipts
+// are still retained in the database.
+func (bc *BlockChain) HistoryTail() uint64 {
+	tail, _ := bc.db.AncientTail()
+	return tail
+}
+
 // TxLookupLimit retrieves the txlookup limit used by blockchain to prune
 // stale transaction indices.
 func (bc *BlockChain) TxLookupLimit() uint64 {
@@ -1498,6 +1543,18 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	return bc.writeBlockWithState(block, receipts, logs, state, emitHeadEvent)
 }
 
+// pruneStateHistory deletes the reverse state diffs of all the known blocks at
+// the given height.
+func (bc *BlockChain) pruneStateHistory(number uint64) {
+	hashes := rawdb.ReadAllHashes(bc.db, number)
+	if hash := rawdb.ReadCanonicalHash(bc.db, number); hash != (common.Hash{}) {
+		hashes = append(hashes, hash) // Might be in the ancient store
+	}
+	for _, hash := range hashes {
+		rawdb.DeleteStateHistory(bc.db, number, hash)
+	}
+}
+
 // writeBlockWithState writes the block and all associated state to the database,
 // but is expects the chain mutex to be held.
 func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
@@ -1531,6 +1588,18 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	if err != nil {
 		return NonStatTy, err
 	}
+	// Persist the state history of the block and drop the one that fell out of
+	// the retention window
+	if limit := bc.cacheConfig.StateHistory; limit > 0 && bc.snaps != nil {
+		if parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1); parent != nil {
+			if err := bc.snaps.WriteHistory(block.Header(), parent.Root); err != nil {
+				log.Warn("Failed to write state history", "number", block.Number(), "hash", block.Hash(), "err", err)
+			}
+		}
+		if block.NumberU64() > limit {
+			bc.pruneStateHistory(block.NumberU64() - limit)
+		}
+	}
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
@@ -2325,6 +2394,10 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 		if bc.txLookupLimit != 0 && ancients > bc.txLookupLimit {
 			from = ancients - bc.txLookupLimit
 		}
+		// Expired block bodies can't be indexed anymore
+		if tail := bc.HistoryTail(); from < tail {
+			from = tail
+		}
 		rawdb.IndexTransactions(bc.db, from, ancients, bc.quit)
 	}
 	// indexBlocks reindexes or unindexes transactions depending on user configuration
@@ -2389,6 +2462,58 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 	}
 }
 
+// maintainHistory is responsible for expiring the bodies and receipts of the
+// ancient blocks which fall out of the configured history window.
+//
+// The transaction indices of the expired blocks need their bodies to be deleted,
+// so the history is never expired past the transaction index tail.
+func (bc *BlockChain) maintainHistory() {
+	defer bc.wg.Done()
+
+	var (
+		done   chan struct{}                  // Non-nil if background pruning routine is active.
+		headCh = make(chan ChainHeadEvent, 1) // Buffered to avoid locking up the event feed
+	)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	prune := func(head uint64, done chan struct{}) {
+		defer func() { done <- struct{}{} }()
+
+		limit := bc.cacheConfig.HistoryLimit
+		if head+1 <= limit {
+			return
+		}
+		tail := head + 1 - limit
+		if txtail := rawdb.ReadTxIndexTail(bc.db); txtail != nil && *txtail < tail {
+			tail = *txtail
+		}
+		if err := bc.db.TruncateAncientTail(tail); err != nil {
+			log.Error("Failed to expire chain history", "tail", tail, "err", err)
+		}
+	}
+	for {
+		select {
+		case head := <-headCh:
+			if done == nil {
+				done = make(chan struct{})
+				go prune(head.Block.NumberU64(), done)
+			}
+		case <-done:
+			done = nil
+		case <-bc.quit:
+			if done != nil {
+				log.Info("Waiting background history pruner to exit")
+				<-done
+			}
+			return
+		}
+	}
+}
+
 // reportBlock logs a bad block error.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
 	rawdb.WriteBadBlock(bc.db, block)
@@ -3108,3 +3108,84 @@ func TestEIP2718Transition(t *testing.T) {
 
 	}
 }
+
+// Tests that the states of recent blocks can be reconstructed from the state
+// history, and that the history outside of the retention window is pruned.
+func TestHistoricState(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		counter = common.Address{0xc1}
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(params.Ether)},
+				counter: {Balance: common.Big0, Code: common.FromHex("0x6001600054016000554360015500")}, // Increment slot 0, store number in 1
+			},
+		}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 8, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(address), counter, big.NewInt(1), 100000, big.NewInt(1), nil), signer, key)
+		gen.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(gen.TxNonce(address), common.Address{0xee, byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		gen.AddTx(tx)
+	})
+	cacheConfig := *defaultCacheConfig
+	cacheConfig.StateHistory = 4
+
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+	chain, err := NewBlockChain(diskdb, &cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	for _, block := range blocks {
+		historic, err := chain.HistoricState(block.Header())
+		if block.NumberU64() < 4 {
+			if err == nil {
+				t.Errorf("block %d: state reconstructed outside of retention window", block.NumberU64())
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("block %d: failed to reconstruct state: %v", block.NumberU64(), err)
+		}
+		statedb, _ := chain.StateAt(block.Root())
+		for _, addr := range []common.Address{address, counter, block.Coinbase(), {0xee, byte(block.NumberU64() - 1)}, {0xee, byte(block.NumberU64())}} {
+			if have, want := historic.GetBalance(addr), statedb.GetBalance(addr); have.Cmp(want) != 0 {
+				t.Errorf("block %d: balance mismatch for %x: have %v, want %v", block.NumberU64(), addr, have, want)
+			}
+			if have, want := historic.GetNonce(addr), statedb.GetNonce(addr); have != want {
+				t.Errorf("block %d: nonce mismatch for %x: have %v, want %v", block.NumberU64(), addr, have, want)
+			}
+			if have, want := historic.Exist(addr), statedb.Exist(addr); have != want {
+				t.Errorf("block %d: existence mismatch for %x: have %v, want %v", block.NumberU64(), addr, have, want)
+			}
+		}
+		for _, slot := range []common.Hash{{}, common.BytesToHash([]byte{1})} {
+			if have, want := historic.GetState(counter, slot), statedb.GetState(counter, slot); have != want {
+				t.Errorf("block %d: slot %x mismatch: have %x, want %x", block.NumberU64(), slot, have, want)
+			}
+		}
+		if err := historic.Error(); err != nil {
+			t.Fatalf("block %d: historic state failed: %v", block.NumberU64(), err)
+		}
+		// Proofs cannot be served without the tries
+		if _, err := historic.GetProof(address); err == nil {
+			t.Errorf("block %d: account proof served without tries", block.NumberU64())
+		}
+		if _, err := historic.GetStorageProof(counter, common.Hash{}); err == nil {
+			t.Errorf("block %d: storage proof served without tries", block.NumberU64())
+		}
+	}
+	if blob := rawdb.ReadStateHistory(diskdb, blocks[3].NumberU64(), blocks[3].Hash()); len(blob) != 0 {
+		t.Errorf("state history outside of retention window not pruned")
+	}
+}
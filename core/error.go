@@ -31,6 +31,10 @@ var (
 
 	// ErrNoGenesis is returned when there is no Genesis Block.
 	ErrNoGenesis = errors.New("genesis not found in chain")
+
+	// ErrPrunedHistory is returned when the requested block body or receipts
+	// were already expired from the local chain history.
+	ErrPrunedHistory = errors.New("pruned history unavailable")
 )
 
 // List of evm-call-message pre-checking errors. All state transition messages will
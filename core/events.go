@@ -41,3 +41,39 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// TxPoolEventType is the kind of lifecycle transition a pooled transaction went
+// through.
+type TxPoolEventType string
+
+const (
+	TxPoolEventAdded    TxPoolEventType = "added"    // Transaction entered the pool
+	TxPoolEventPromoted TxPoolEventType = "promoted" // Transaction became executable
+	TxPoolEventDemoted  TxPoolEventType = "demoted"  // Transaction became non-executable
+	TxPoolEventReplaced TxPoolEventType = "replaced" // Transaction was replaced by another with the same nonce
+	TxPoolEventDropped  TxPoolEventType = "dropped"  // Transaction was removed from the pool
+)
+
+// TxPoolEventReason explains why a transaction was replaced, demoted or dropped.
+type TxPoolEventReason string
+
+const (
+	TxPoolReasonPriceBump         TxPoolEventReason = "priceBump"         // Replaced by a transaction paying a higher fee
+	TxPoolReasonUnderpriced       TxPoolEventReason = "underpriced"       // Evicted to make room for better paying transactions
+	TxPoolReasonNonceTooLow       TxPoolEventReason = "nonceTooLow"       // Nonce used up by an imported block
+	TxPoolReasonInsufficientFunds TxPoolEventReason = "insufficientFunds" // Account can no longer pay for it (or gas limit too high)
+	TxPoolReasonNonceGap          TxPoolEventReason = "nonceGap"          // A preceding transaction was removed
+	TxPoolReasonLifetime          TxPoolEventReason = "lifetime"          // Queued for longer than the allowed lifetime
+	TxPoolReasonQueueOverflow     TxPoolEventReason = "queueOverflow"     // Queue exceeded its account or global limits
+	TxPoolReasonPendingOverflow   TxPoolEventReason = "pendingOverflow"   // Pending set exceeded its global limit
+	TxPoolReasonConditions        TxPoolEventReason = "conditions"        // Transaction conditions can no longer hold
+)
+
+// TxPoolEvent is posted when a transaction goes through a lifecycle transition
+// in the transaction pool.
+type TxPoolEvent struct {
+	Hash       common.Hash       `json:"hash"`
+	Type       TxPoolEventType   `json:"type"`
+	Reason     TxPoolEventReason `json:"reason,omitempty"`
+	ReplacedBy *common.Hash      `json:"replacedBy,omitempty"`
+}
@@ -19,6 +19,7 @@ package rawdb
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math/big"
 	"sort"
 
@@ -686,6 +687,47 @@ func WriteAncientBlock(db ethdb.AncientWriter, block *types.Block, receipts type
 	return len(headerBlob) + len(bodyBlob) + len(receiptBlob) + len(tdBlob) + common.HashLength
 }
 
+// AncientBlockRLP is the raw content of a block in each of the ancient tables.
+type AncientBlockRLP struct {
+	Hash     []byte
+	Header   rlp.RawValue
+	Body     rlp.RawValue // Nil if expired from the ancient store
+	Receipts rlp.RawValue // Nil if expired from the ancient store
+	Td       rlp.RawValue
+}
+
+// ReadAncientBlockRLP retrieves the raw content of a block directly from the
+// ancient tables, without falling back to the key-value store. The body and
+// receipts of blocks below the ancient tail are not retrieved.
+func ReadAncientBlockRLP(db ethdb.AncientReader, number uint64) (*AncientBlockRLP, error) {
+	var (
+		blob AncientBlockRLP
+		err  error
+	)
+	if blob.Hash, err = db.Ancient(freezerHashTable, number); err != nil {
+		return nil, fmt.Errorf("%s: %v", freezerHashTable, err)
+	}
+	if blob.Header, err = db.Ancient(freezerHeaderTable, number); err != nil {
+		return nil, fmt.Errorf("%s: %v", freezerHeaderTable, err)
+	}
+	if blob.Td, err = db.Ancient(freezerDifficultyTable, number); err != nil {
+		return nil, fmt.Errorf("%s: %v", freezerDifficultyTable, err)
+	}
+	tail, err := db.AncientTail()
+	if err != nil {
+		return nil, err
+	}
+	if number >= tail {
+		if blob.Body, err = db.Ancient(freezerBodiesTable, number); err != nil {
+			return nil, fmt.Errorf("%s: %v", freezerBodiesTable, err)
+		}
+		if blob.Receipts, err = db.Ancient(freezerReceiptTable, number); err != nil {
+			return nil, fmt.Errorf("%s: %v", freezerReceiptTable, err)
+		}
+	}
+	return &blob, nil
+}
+
 // DeleteBlock removes all block data associated with a hash.
 func DeleteBlock(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	DeleteReceipts(db, hash, number)
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
@@ -138,3 +139,83 @@ func PopUncleanShutdownMarker(db ethdb.KeyValueStore) {
 		log.Warn("Failed to clear unclean-shutdown marker", "err", err)
 	}
 }
+
+// ReadPeerSyncStats retrieves the download statistics of a remote peer.
+func ReadPeerSyncStats(db ethdb.KeyValueReader, id string) []byte {
+	data, _ := db.Get(peerSyncStatsKey(id))
+	return data
+}
+
+// ReadAllPeerSyncStats retrieves the download statistics of all remote peers,
+// keyed by peer id.
+func ReadAllPeerSyncStats(db ethdb.Iteratee) map[string][]byte {
+	it := db.NewIterator(peerSyncStatsPrefix, nil)
+	defer it.Release()
+
+	stats := make(map[string][]byte)
+	for it.Next() {
+		id := string(it.Key()[len(peerSyncStatsPrefix):])
+		stats[id] = common.CopyBytes(it.Value())
+	}
+	return stats
+}
+
+// WritePeerSyncStats stores the download statistics of a remote peer.
+func WritePeerSyncStats(db ethdb.KeyValueWriter, id string, stats []byte) {
+	if err := db.Put(peerSyncStatsKey(id), stats); err != nil {
+		log.Crit("Failed to store peer sync statistics", "err", err)
+	}
+}
+
+// DeletePeerSyncStats removes the download statistics of a remote peer.
+func DeletePeerSyncStats(db ethdb.KeyValueWriter, id string) {
+	if err := db.Delete(peerSyncStatsKey(id)); err != nil {
+		log.Crit("Failed to delete peer sync statistics", "err", err)
+	}
+}
+
+// ReadSyncTargetHeader retrieves the header with the given number on the chain
+// of the sync target, as retrieved by the downloader.
+func ReadSyncTargetHeader(db ethdb.KeyValueReader, number uint64) *types.Header {
+	data, _ := db.Get(syncTargetHeaderKey(number))
+	if len(data) == 0 {
+		return nil
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		log.Error("Invalid sync target header RLP", "number", number, "err", err)
+		return nil
+	}
+	return header
+}
+
+// WriteSyncTargetHeader stores a header on the chain of the sync target.
+func WriteSyncTargetHeader(db ethdb.KeyValueWriter, header *types.Header) {
+	data, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		log.Crit("Failed to RLP encode sync target header", "err", err)
+	}
+	if err := db.Put(syncTargetHeaderKey(header.Number.Uint64()), data); err != nil {
+		log.Crit("Failed to store sync target header", "err", err)
+	}
+}
+
+// DeleteSyncTargetHeaders removes all headers on the chain of the sync target.
+func DeleteSyncTargetHeaders(db ethdb.KeyValueStore) {
+	it := db.NewIterator(syncTargetHeaderPrefix, nil)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		batch.Delete(it.Key())
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to delete sync target headers", "err", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to delete sync target headers", "err", err)
+	}
+}
@@ -196,3 +196,25 @@ func DeleteSnapshotSyncStatus(db ethdb.KeyValueWriter) {
 		log.Crit("Failed to remove snapshot sync status", "err", err)
 	}
 }
+
+// ReadStateHistory retrieves the reverse diff reverting the state of the given
+// block to the state of its parent.
+func ReadStateHistory(db ethdb.KeyValueReader, number uint64, hash common.Hash) []byte {
+	data, _ := db.Get(stateHistoryKey(number, hash))
+	return data
+}
+
+// WriteStateHistory stores the reverse diff reverting the state of the given
+// block to the state of its parent.
+func WriteStateHistory(db ethdb.KeyValueWriter, number uint64, hash common.Hash, diff []byte) {
+	if err := db.Put(stateHistoryKey(number, hash), diff); err != nil {
+		log.Crit("Failed to store state history", "err", err)
+	}
+}
+
+// DeleteStateHistory removes the reverse diff of the given block.
+func DeleteStateHistory(db ethdb.KeyValueWriter, number uint64, hash common.Hash) {
+	if err := db.Delete(stateHistoryKey(number, hash)); err != nil {
+		log.Crit("Failed to delete state history", "err", err)
+	}
+}
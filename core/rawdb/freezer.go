@@ -19,6 +19,7 @@ package rawdb
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
@@ -176,6 +177,18 @@ func (f *freezer) Ancients() (uint64, error) {
 	return atomic.LoadUint64(&f.frozen), nil
 }
 
+// AncientTail returns the number of the first ancient block whose body and
+// receipts are still available in the freezer.
+func (f *freezer) AncientTail() (uint64, error) {
+	var tail uint64
+	for _, kind := range freezerPrunableTables {
+		if t := f.tables[kind].tail(); t > tail {
+			tail = t
+		}
+	}
+	return tail, nil
+}
+
 // AncientSize returns the ancient size of the specified category.
 func (f *freezer) AncientSize(kind string) (uint64, error) {
 	if table := f.tables[kind]; table != nil {
@@ -245,6 +258,22 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateAncientTail discards the bodies and receipts of the ancient blocks
+// below the provided threshold number. Headers, hashes and total difficulties
+// are retained. Data is deleted in whole data files, so some blocks below the
+// threshold might still remain available.
+func (f *freezer) TruncateAncientTail(tail uint64) error {
+	if frozen := atomic.LoadUint64(&f.frozen); tail > frozen {
+		tail = frozen
+	}
+	for _, kind := range freezerPrunableTables {
+		if err := f.tables[kind].truncateTail(tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -470,3 +499,42 @@ func (f *freezer) repair() error {
 	atomic.StoreUint64(&f.frozen, min)
 	return nil
 }
+
+// InspectFreezerTable prints the index entries of the given ancient table
+// between start and end, checking the entire index for corruption. The table
+// is opened read only and is not repaired.
+func InspectFreezerTable(ancient string, table string, start, end uint64) error {
+	noSnappy, ok := freezerNoSnappy[table]
+	if !ok {
+		return fmt.Errorf("unknown ancient table %q", table)
+	}
+	corrupted, _, err := dumpIndex(os.Stdout, ancient, table, noSnappy, start, end)
+	if err != nil {
+		return err
+	}
+	if corrupted > 0 {
+		return fmt.Errorf("found %d corrupted index entries", corrupted)
+	}
+	return nil
+}
+
+// VerifyFreezerIndex checks the index files of all the ancient tables for
+// consistency with themselves and their data files. The number of the first
+// item with a corrupted index entry across all tables is returned, or
+// math.MaxUint64 if all the indices are healthy.
+func VerifyFreezerIndex(ancient string) (uint64, error) {
+	first := uint64(math.MaxUint64)
+	for table, noSnappy := range freezerNoSnappy {
+		corrupted, number, err := dumpIndex(ioutil.Discard, ancient, table, noSnappy, 0, 0)
+		if err != nil {
+			return 0, fmt.Errorf("table %s: %v", table, err)
+		}
+		if corrupted > 0 {
+			log.Error("Corrupted ancient index", "table", table, "entries", corrupted, "first", number)
+			if number < first {
+				first = number
+			}
+		}
+	}
+	return first, nil
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
@@ -251,8 +252,12 @@ func (t *freezerTable) repair() error {
 	}
 	contentSize = stat.Size()
 
-	// Keep truncating both files until they come in sync
+	// Keep truncating both files until they come in sync. If the index only
+	// contains the tail marker, the head file is expected to be empty.
 	contentExp = int64(lastIndex.offset)
+	if offsetsSize == indexEntrySize {
+		contentExp = 0
+	}
 
 	for contentExp != contentSize {
 		// Truncate the head file to the last offset pointer
@@ -273,6 +278,10 @@ func (t *freezerTable) repair() error {
 			t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 			var newLastIndex indexEntry
 			newLastIndex.unmarshalBinary(buffer)
+			if offsetsSize == indexEntrySize {
+				// Only the tail marker is left, the head file starts empty
+				newLastIndex.offset = 0
+			}
 			// We might have slipped back into an earlier head-file here
 			if newLastIndex.filenum != lastIndex.filenum {
 				// Release earlier opened file
@@ -350,16 +359,32 @@ func (t *freezerTable) truncate(items uint64) error {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
-		return err
+
+	// If the table is truncated below its tail, move the tail marker down too,
+	// everything still stored is discarded anyway.
+	if offset := uint64(t.itemOffset); items < offset {
+		marker := indexEntry{filenum: t.tailId, offset: uint32(items)}
+		if _, err := t.index.WriteAt(marker.marshallBinary(), 0); err != nil {
+			return err
+		}
+		atomic.StoreUint32(&t.itemOffset, uint32(items))
 	}
-	// Calculate the new expected size of the data file and truncate it
-	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	relative := items - uint64(t.itemOffset)
+	if err := truncateFreezerFile(t.index, int64(relative+1)*indexEntrySize); err != nil {
 		return err
 	}
+	// Calculate the new expected size of the data file and truncate it
 	var expected indexEntry
-	expected.unmarshalBinary(buffer)
+	if relative == 0 {
+		// Only the tail marker is left, truncate the tail file completely
+		expected = indexEntry{filenum: t.tailId}
+	} else {
+		buffer := make([]byte, indexEntrySize)
+		if _, err := t.index.ReadAt(buffer, int64(relative*indexEntrySize)); err != nil {
+			return err
+		}
+		expected.unmarshalBinary(buffer)
+	}
 
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
@@ -393,6 +418,130 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards all the data files which only contain items below the
+// provided tail number. Since data is deleted with file granularity, the tail
+// of the table might end up lower than the requested one.
+func (t *freezerTable) truncateTail(tail uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Ensure the table is still accessible
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	offset := uint64(t.itemOffset)
+	if items := atomic.LoadUint64(&t.items); tail > items {
+		tail = items
+	}
+	if tail <= offset {
+		return nil
+	}
+	// Find the data file holding the first item to retain. If all the items are
+	// to be deleted, the head file is the one to retain.
+	buffer := make([]byte, indexEntrySize)
+	readEntry := func(n uint64) (indexEntry, error) {
+		var entry indexEntry
+		if _, err := t.index.ReadAt(buffer, int64(n*indexEntrySize)); err != nil {
+			return entry, err
+		}
+		entry.unmarshalBinary(buffer)
+		return entry, nil
+	}
+	target := t.headId
+	if tail < atomic.LoadUint64(&t.items) {
+		entry, err := readEntry(tail - offset + 1)
+		if err != nil {
+			return err
+		}
+		target = entry.filenum
+	}
+	if target == t.tailId {
+		return nil
+	}
+	// Locate the first item stored in the target file. The item 'n' (relative
+	// to the current offset) resides in the file referenced by index entry n+1.
+	lo, hi := uint64(0), tail-offset
+	for lo < hi {
+		mid := (lo + hi) / 2
+		entry, err := readEntry(mid + 1)
+		if err != nil {
+			return err
+		}
+		if entry.filenum >= target {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	first := lo
+
+	// We need to delete files, save the old size for metrics tracking
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.logger.Info("Truncating freezer table tail", "items", atomic.LoadUint64(&t.items), "tail", offset+first, "limit", tail)
+
+	// Assemble the new index file: the tail marker followed by all the entries
+	// of the retained items, and atomically replace the old one.
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	entries := make([]byte, stat.Size()-int64((first+1)*indexEntrySize))
+	if _, err := t.index.ReadAt(entries, int64((first+1)*indexEntrySize)); err != nil {
+		return err
+	}
+	marker := indexEntry{filenum: target, offset: uint32(offset + first)}
+
+	name := t.index.Name()
+	tmp, err := openFreezerFileTruncated(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(marker.marshallBinary(), entries...)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	if err := t.index.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	if t.index, err = openFreezerFileForAppend(name); err != nil {
+		return err
+	}
+	// The index references the target file as the first one, drop the others
+	for num := t.tailId; num < target; num++ {
+		t.releaseFile(num)
+		if err := os.Remove(filepath.Join(t.path, t.fileName(num))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	t.tailId = target
+	atomic.StoreUint32(&t.itemOffset, marker.offset)
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return nil
+}
+
+// tail returns the number of the first item available in the table.
+func (t *freezerTable) tail() uint64 {
+	return uint64(atomic.LoadUint32(&t.itemOffset))
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -421,13 +570,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
-		f, err = opener(filepath.Join(t.path, name))
+		f, err = opener(filepath.Join(t.path, t.fileName(num)))
 		if err != nil {
 			return nil, err
 		}
@@ -436,6 +579,14 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	return f, err
 }
 
+// fileName returns the name of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	if t.noCompression {
+		return fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	return fmt.Sprintf("%s.%04d.cdat", t.name, num)
+}
+
 // releaseFile closes a file, and removes it from the open file cache.
 // Assumes that the caller holds the write lock
 func (t *freezerTable) releaseFile(num uint32) {
@@ -573,7 +724,7 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 		return nil, errOutOfBounds
 	}
 	// Ensure the item was not deleted from the tail either
-	if uint64(t.itemOffset) > item {
+	if uint64(atomic.LoadUint32(&t.itemOffset)) > item {
 		t.lock.RUnlock()
 		return nil, errOutOfBounds
 	}
@@ -605,7 +756,7 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	return atomic.LoadUint64(&t.items) > number && uint64(atomic.LoadUint32(&t.itemOffset)) <= number
 }
 
 // size returns the total data size in the freezer table.
@@ -658,3 +809,98 @@ func (t *freezerTable) printIndex() {
 	}
 	fmt.Printf("|-----------------|\n")
 }
+
+// dumpIndex prints the index entries of a freezer table between start and end
+// into w, cross checking them against each other and the sizes of the data
+// files. The table files are opened read only, so no repair is attempted. The
+// number of corrupted entries found in the entire index is returned, along with
+// the number of the first corrupted item (or math.MaxUint64 if none).
+//
+// A partially written entry at the end of the index is not counted as corruption,
+// it is reported as truncatable, as opening the table repairs it.
+func dumpIndex(w io.Writer, path string, name string, noCompression bool, start, end uint64) (int, uint64, error) {
+	t := &freezerTable{name: name, path: path, noCompression: noCompression}
+
+	idxName := fmt.Sprintf("%s.cidx", name)
+	if noCompression {
+		idxName = fmt.Sprintf("%s.ridx", name)
+	}
+	index, err := openFreezerFileForReadOnly(filepath.Join(path, idxName))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer index.Close()
+
+	stat, err := index.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	var (
+		corrupted int
+		first     = uint64(math.MaxUint64)
+	)
+	if stat.Size() == 0 {
+		return 0, 0, errors.New("empty index file")
+	}
+	// Read the tail marker and collect the sizes of all the data files
+	var (
+		buf   = make([]byte, indexEntrySize)
+		count = uint64(stat.Size()/indexEntrySize) - 1
+		tail  indexEntry
+		sizes = make(map[uint32]int64)
+	)
+	if _, err := index.ReadAt(buf, 0); err != nil {
+		return 0, 0, err
+	}
+	tail.unmarshalBinary(buf)
+	size := func(num uint32) int64 {
+		if size, ok := sizes[num]; ok {
+			return size
+		}
+		sizes[num] = -1
+		if stat, err := os.Stat(filepath.Join(path, t.fileName(num))); err == nil {
+			sizes[num] = stat.Size()
+		}
+		return sizes[num]
+	}
+	fmt.Fprintf(w, "Table: %s, tail file: %d, deleted items: %d, items: %d\n", name, tail.filenum, tail.offset, uint64(tail.offset)+count)
+	if overflow := stat.Size() % indexEntrySize; overflow != 0 {
+		fmt.Fprintf(w, "Index file has %d dangling bytes at item %d, truncatable\n", overflow, uint64(tail.offset)+count)
+	}
+	fmt.Fprintf(w, "| number | fileno | offset | status\n")
+
+	prev := indexEntry{filenum: tail.filenum}
+	for i := uint64(1); i <= count; i++ {
+		if _, err := index.ReadAt(buf, int64(i*indexEntrySize)); err != nil {
+			return corrupted, first, err
+		}
+		var entry indexEntry
+		entry.unmarshalBinary(buf)
+
+		status := "ok"
+		switch {
+		case entry.filenum < prev.filenum:
+			status = "file number decreasing"
+		case entry.filenum > prev.filenum+1:
+			status = "file number gap"
+		case entry.filenum == prev.filenum && entry.offset < prev.offset:
+			status = "offset decreasing"
+		case size(entry.filenum) < 0:
+			status = "data file missing"
+		case int64(entry.offset) > size(entry.filenum):
+			status = "offset beyond data file"
+		}
+		number := uint64(tail.offset) + i - 1
+		if status != "ok" {
+			if first == math.MaxUint64 {
+				first = number
+			}
+			corrupted++
+		}
+		if number >= start && number < end {
+			fmt.Fprintf(w, "| %6d | %6d | %6d | %s\n", number, entry.filenum, entry.offset, status)
+		}
+		prev = entry
+	}
+	return corrupted, first, nil
+}
@@ -19,9 +19,12 @@ package rawdb
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -640,3 +643,155 @@ func TestOffset(t *testing.T) {
 // However, all 'normal' failure modes arising due to failing to sync() or save a file should be
 // handled already, and the case described above can only (?) happen if an external process/user
 // deletes files from the filesystem.
+
+// TestFreezerTruncateTail tests that old items can be discarded from the tail of
+// the table with file granularity, and that the moved tail survives a restart.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate_tail-%d", rand.Uint64())
+
+	// Write 10 x 20 bytes, splitting out into five files
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 10; x++ {
+		f.Append(uint64(x), getChunk(20, x))
+	}
+	checkRetrieve := func(f *freezerTable, from, to uint64) {
+		t.Helper()
+		for i := uint64(0); i < f.items; i++ {
+			got, err := f.Retrieve(i)
+			if i < from || i >= to {
+				if err == nil {
+					t.Fatalf("item %d: expected error, got %x", i, got)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("item %d: %v", i, err)
+			}
+			if exp := getChunk(20, int(i)); !bytes.Equal(got, exp) {
+				t.Fatalf("item %d: expected %x got %x", i, exp, got)
+			}
+		}
+	}
+	// Item 3 resides in the second file, so only the first one can be dropped
+	if err := f.truncateTail(3); err != nil {
+		t.Fatal(err)
+	}
+	if tail := f.tail(); tail != 2 {
+		t.Fatalf("tail mismatch: have %d, want %d", tail, 2)
+	}
+	checkRetrieve(f, 2, 10)
+	if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0000.rdat", fname))); !os.IsNotExist(err) {
+		t.Fatalf("expected first data file to be removed: %v", err)
+	}
+	f.Close()
+
+	// Reopen the table and ensure the tail is retained
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.items != 10 || f.tail() != 2 {
+		t.Fatalf("reopened table mismatch: items %d tail %d", f.items, f.tail())
+	}
+	checkRetrieve(f, 2, 10)
+
+	// Truncating everything should retain the head file only
+	if err := f.truncateTail(10); err != nil {
+		t.Fatal(err)
+	}
+	if tail := f.tail(); tail != 8 {
+		t.Fatalf("tail mismatch: have %d, want %d", tail, 8)
+	}
+	checkRetrieve(f, 8, 10)
+
+	// Truncating the head below the tail should empty the table
+	if err := f.truncate(5); err != nil {
+		t.Fatal(err)
+	}
+	if f.items != 5 || f.tail() != 5 {
+		t.Fatalf("truncated table mismatch: items %d tail %d", f.items, f.tail())
+	}
+	if err := f.Append(5, getChunk(20, 5)); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(f, 5, 6)
+	f.Close()
+
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.items != 6 || f.tail() != 5 {
+		t.Fatalf("reopened table mismatch: items %d tail %d", f.items, f.tail())
+	}
+	checkRetrieve(f, 5, 6)
+}
+
+// TestFreezerDumpIndex tests that the index dumper reports truncated data files
+// and pruned tails correctly.
+func TestFreezerDumpIndex(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("dumpindex-%d", rand.Uint64())
+
+	// Write 10 x 20 bytes, splitting out into five files
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 10; x++ {
+		f.Append(uint64(x), getChunk(20, x))
+	}
+	if err := f.truncateTail(4); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	buf := new(bytes.Buffer)
+	corrupted, first, err := dumpIndex(buf, os.TempDir(), fname, true, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corrupted != 0 || first != math.MaxUint64 {
+		t.Fatalf("healthy table reported corrupted:\n%s", buf)
+	}
+	if lines := strings.Count(buf.String(), "| ok"); lines != 6 {
+		t.Fatalf("dumped entry count mismatch: have %d, want %d\n%s", lines, 6, buf)
+	}
+	// Chop off the end of a non-head data file
+	if err := os.Truncate(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0002.rdat", fname)), 30); err != nil {
+		t.Fatal(err)
+	}
+	corrupted, first, err = dumpIndex(ioutil.Discard, os.TempDir(), fname, true, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corrupted != 1 || first != 5 {
+		t.Fatalf("corruption mismatch: have %d from %d, want %d from %d", corrupted, first, 1, 5)
+	}
+	// Append a partial index entry, which must not be reported as corruption
+	idx, err := os.OpenFile(filepath.Join(os.TempDir(), fmt.Sprintf("%s.ridx", fname)), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Write([]byte{0x00, 0x00, 0x01})
+	idx.Close()
+
+	buf.Reset()
+	corrupted, first, err = dumpIndex(buf, os.TempDir(), fname, true, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corrupted != 1 || first != 5 {
+		t.Fatalf("corruption mismatch: have %d from %d, want %d from %d", corrupted, first, 1, 5)
+	}
+	if !strings.Contains(buf.String(), "dangling bytes at item 10, truncatable") {
+		t.Fatalf("dangling index bytes not reported:\n%s", buf)
+	}
+}
@@ -86,10 +86,14 @@ var (
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
+	stateHistoryPrefix    = []byte("R") // stateHistoryPrefix + num (uint64 big endian) + hash -> reverse state diff
 
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
+	peerSyncStatsPrefix    = []byte("peer-sync-stats-")    // peerSyncStatsPrefix + peer id -> download statistics
+	syncTargetHeaderPrefix = []byte("sync-target-header-") // syncTargetHeaderPrefix + num (uint64 big endian) -> header
+
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
 
@@ -124,6 +128,11 @@ var freezerNoSnappy = map[string]bool{
 	freezerDifficultyTable: true,
 }
 
+// freezerPrunableTables lists the ancient-tables whose old items can be deleted
+// from the tail to expire chain history. Hashes, headers and difficulties are
+// always retained to keep the chain verifiable.
+var freezerPrunableTables = []string{freezerBodiesTable, freezerReceiptTable}
+
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
 // fields.
 type LegacyTxLookupEntry struct {
@@ -184,6 +193,21 @@ func accountSnapshotKey(hash common.Hash) []byte {
 	return append(SnapshotAccountPrefix, hash.Bytes()...)
 }
 
+// stateHistoryKey = stateHistoryPrefix + num (uint64 big endian) + hash
+func stateHistoryKey(number uint64, hash common.Hash) []byte {
+	return append(append(stateHistoryPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// peerSyncStatsKey = peerSyncStatsPrefix + peer id
+func peerSyncStatsKey(id string) []byte {
+	return append(append([]byte{}, peerSyncStatsPrefix...), id...)
+}
+
+// syncTargetHeaderKey = syncTargetHeaderPrefix + num (uint64 big endian)
+func syncTargetHeaderKey(number uint64) []byte {
+	return append(append([]byte{}, syncTargetHeaderPrefix...), encodeBlockNumber(number)...)
+}
+
 // storageSnapshotKey = SnapshotStoragePrefix + account hash + storage hash
 func storageSnapshotKey(accountHash, storageHash common.Hash) []byte {
 	return append(append(SnapshotStoragePrefix, accountHash.Bytes()...), storageHash.Bytes()...)
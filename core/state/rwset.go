@@ -0,0 +1,245 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ReadWriteSet tracks the accounts and storage slots accessed through a state
+// database while executing transactions. It is used to detect whether a
+// transaction executed speculatively on a stale state observed anything that
+// was modified in the meantime.
+//
+// Balance increases (and zero-value touches) are tracked separately from other
+// account modifications since they commute with each other: they only conflict
+// with transactions observing or overwriting the account.
+type ReadWriteSet struct {
+	accountReads  map[common.Address]struct{}
+	storageReads  map[common.Address]map[common.Hash]struct{}
+	accountWrites map[common.Address]struct{} // Nonce, code, balance decrease, creation or destruction
+	balanceAdds   map[common.Address]struct{} // Balance increases and touches
+	resets        map[common.Address]struct{} // Accounts with storage cleared by creation or destruction
+	storageWrites map[common.Address]map[common.Hash]struct{}
+}
+
+// NewReadWriteSet creates an empty read/write set.
+func NewReadWriteSet() *ReadWriteSet {
+	return &ReadWriteSet{
+		accountReads:  make(map[common.Address]struct{}),
+		storageReads:  make(map[common.Address]map[common.Hash]struct{}),
+		accountWrites: make(map[common.Address]struct{}),
+		balanceAdds:   make(map[common.Address]struct{}),
+		resets:        make(map[common.Address]struct{}),
+		storageWrites: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// readAccount marks an account as observed. The set may be nil, in which case
+// the access is not tracked.
+func (set *ReadWriteSet) readAccount(addr common.Address) {
+	if set != nil {
+		set.accountReads[addr] = struct{}{}
+	}
+}
+
+// readSlot marks a storage slot as observed.
+func (set *ReadWriteSet) readSlot(addr common.Address, slot common.Hash) {
+	if set != nil {
+		addSlot(set.storageReads, addr, slot)
+	}
+}
+
+// writeAccount marks an account as modified, optionally also dropping all of
+// its storage.
+func (set *ReadWriteSet) writeAccount(addr common.Address, reset bool) {
+	if set != nil {
+		set.accountWrites[addr] = struct{}{}
+		if reset {
+			set.resets[addr] = struct{}{}
+		}
+	}
+}
+
+// writeBalance marks a balance change of an account. Decreases are treated as
+// regular account modifications, increases and touches as commutative ones.
+func (set *ReadWriteSet) writeBalance(addr common.Address, amount *big.Int, increase bool) {
+	if set != nil {
+		if increase || amount.Sign() == 0 {
+			set.balanceAdds[addr] = struct{}{}
+		} else {
+			set.accountWrites[addr] = struct{}{}
+		}
+	}
+}
+
+// writeSlot marks a storage slot as modified.
+func (set *ReadWriteSet) writeSlot(addr common.Address, slot common.Hash) {
+	if set != nil {
+		addSlot(set.storageWrites, addr, slot)
+	}
+}
+
+// addSlot inserts a storage slot into a nested slot set.
+func addSlot(slots map[common.Address]map[common.Hash]struct{}, addr common.Address, slot common.Hash) {
+	if slots[addr] == nil {
+		slots[addr] = make(map[common.Hash]struct{})
+	}
+	slots[addr][slot] = struct{}{}
+}
+
+// written reports whether any field of the account was modified. Storage
+// modifications are not included as account reads don't observe them.
+func (set *ReadWriteSet) written(addr common.Address) bool {
+	if _, ok := set.accountWrites[addr]; ok {
+		return true
+	}
+	_, ok := set.balanceAdds[addr]
+	return ok
+}
+
+// Conflicts reports whether the accesses tracked by this set depend on any of
+// the modifications tracked by the given set, i.e. whether executing on a
+// state without the writes of prior yields a different result than executing
+// on top of them.
+func (set *ReadWriteSet) Conflicts(prior *ReadWriteSet) bool {
+	for addr := range set.accountReads {
+		if prior.written(addr) {
+			return true
+		}
+	}
+	for addr, slots := range set.storageReads {
+		if _, ok := prior.resets[addr]; ok {
+			return true
+		}
+		for slot := range slots {
+			if _, ok := prior.storageWrites[addr][slot]; ok {
+				return true
+			}
+		}
+	}
+	// Modifications are normally preceded by reads, but don't rely on it
+	for addr := range set.accountWrites {
+		if prior.written(addr) {
+			return true
+		}
+	}
+	for addr := range set.balanceAdds {
+		if _, ok := prior.accountWrites[addr]; ok {
+			return true
+		}
+	}
+	for addr := range set.resets {
+		if _, ok := prior.storageWrites[addr]; ok {
+			return true
+		}
+	}
+	for addr := range set.storageWrites {
+		if _, ok := prior.resets[addr]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge adds all the accesses tracked by the given set to this one.
+func (set *ReadWriteSet) Merge(other *ReadWriteSet) {
+	for addr := range other.accountReads {
+		set.accountReads[addr] = struct{}{}
+	}
+	for addr, slots := range other.storageReads {
+		for slot := range slots {
+			addSlot(set.storageReads, addr, slot)
+		}
+	}
+	for addr := range other.accountWrites {
+		set.accountWrites[addr] = struct{}{}
+	}
+	for addr := range other.balanceAdds {
+		set.balanceAdds[addr] = struct{}{}
+	}
+	for addr := range other.resets {
+		set.resets[addr] = struct{}{}
+	}
+	for addr, slots := range other.storageWrites {
+		for slot := range slots {
+			addSlot(set.storageWrites, addr, slot)
+		}
+	}
+}
+
+// TrackAccesses starts recording all account and storage accesses into the
+// given set. Passing nil stops tracking. The set is not carried over to copies
+// of the state.
+func (s *StateDB) TrackAccesses(set *ReadWriteSet) {
+	s.rwset = set
+}
+
+// ApplyWrites replays the modifications tracked in set, made by executing a
+// transaction on src (a finalised copy of base), on top of this state. The
+// set must not conflict with the modifications made to this state since base.
+//
+// Balance touches that didn't have any effect (e.g. zero value calls into
+// non-empty accounts) are dropped from the set, so that they don't conflict
+// with subsequent transactions.
+func (s *StateDB) ApplyWrites(src, base *StateDB, set *ReadWriteSet) {
+	for addr := range set.accountWrites {
+		if !src.Exist(addr) {
+			// Account destroyed (or created and destroyed) by the transaction
+			if s.Exist(addr) {
+				s.Suicide(addr)
+			}
+			continue
+		}
+		// If the account was recreated, its storage needs to be dropped too
+		if _, ok := set.resets[addr]; ok {
+			if obj := base.getStateObject(addr); obj != nil && obj.data.Root != src.getStateObject(addr).data.Root {
+				s.CreateAccount(addr)
+			}
+		}
+		s.SetBalance(addr, src.GetBalance(addr))
+		s.SetNonce(addr, src.GetNonce(addr))
+		if hash := src.GetCodeHash(addr); hash != s.GetCodeHash(addr) {
+			s.SetCode(addr, src.GetCode(addr))
+		}
+	}
+	for addr := range set.balanceAdds {
+		if _, ok := set.accountWrites[addr]; ok {
+			continue
+		}
+		// Increases commute, so apply the difference to the current balance
+		diff := new(big.Int).Sub(src.GetBalance(addr), base.GetBalance(addr))
+		switch {
+		case diff.Sign() != 0:
+			s.AddBalance(addr, diff)
+		case base.Exist(addr) && !src.Exist(addr):
+			s.AddBalance(addr, diff) // Touched empty account, let finalisation decide
+		default:
+			delete(set.balanceAdds, addr)
+		}
+	}
+	for addr, slots := range set.storageWrites {
+		if !src.Exist(addr) {
+			continue
+		}
+		for slot := range slots {
+			s.SetState(addr, slot, src.GetState(addr, slot))
+		}
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// exportVersion is the version number of the snapshot export format.
+	exportVersion uint64 = 0
+
+	// exportChunkSize is the soft limit of the payload size of a single chunk
+	// in the exported file.
+	exportChunkSize = 4 * 1024 * 1024
+)
+
+// Item types contained in the export chunks.
+const (
+	exportAccountItem uint8 = iota // Slim RLP encoded account
+	exportStorageItem              // RLP encoded storage slot of the last account
+	exportCodeItem                 // Contract code of the last account
+)
+
+var (
+	// exportMagic is the prefix of every exported snapshot file.
+	exportMagic = []byte("geth-snapshot")
+
+	// errExportTruncated is returned if the export stream ends without the
+	// terminating empty chunk.
+	errExportTruncated = errors.New("snapshot export truncated")
+)
+
+// exportHeader is the first entry in a snapshot export, identifying the
+// format and the state root of the contained snapshot.
+type exportHeader struct {
+	Magic   []byte
+	Version uint64
+	Root    common.Hash
+}
+
+// exportChunk is the checksummed envelope of a batch of export items. The
+// payload is the RLP encoding of an exportPayload.
+type exportChunk struct {
+	Payload  []byte
+	Checksum common.Hash
+}
+
+// exportPayload is a batch of consecutive export items.
+type exportPayload struct {
+	Index uint64
+	Items []exportItem
+}
+
+// exportItem is a single snapshot entry. For accounts the key is the account
+// hash, for storage slots the slot hash and for contract code the code hash.
+// Storage and code items always belong to the last preceding account.
+type exportItem struct {
+	Type  uint8
+	Key   common.Hash
+	Value []byte
+}
+
+// exportWriter accumulates export items and flushes them as checksummed chunks.
+type exportWriter struct {
+	w     io.Writer
+	items []exportItem
+	size  int
+	index uint64
+}
+
+// add appends an item to the pending chunk, flushing it if it grew too large.
+func (ew *exportWriter) add(typ uint8, key common.Hash, value []byte) error {
+	ew.items = append(ew.items, exportItem{Type: typ, Key: key, Value: common.CopyBytes(value)})
+	ew.size += common.HashLength + len(value)
+	if ew.size >= exportChunkSize {
+		return ew.flush()
+	}
+	return nil
+}
+
+// flush writes out the pending items as a single chunk. Flushing an empty
+// chunk marks the end of the stream.
+func (ew *exportWriter) flush() error {
+	payload, err := rlp.EncodeToBytes(&exportPayload{Index: ew.index, Items: ew.items})
+	if err != nil {
+		return err
+	}
+	if err := rlp.Encode(ew.w, &exportChunk{Payload: payload, Checksum: crypto.Keccak256Hash(payload)}); err != nil {
+		return err
+	}
+	ew.items, ew.size = ew.items[:0], 0
+	ew.index++
+	return nil
+}
+
+// Export streams all the accounts, storage slots and contract codes of the
+// snapshot with the given root into w. The output is a sequence of checksummed
+// chunks which can be turned back into a snapshot and the state trie via Import.
+func Export(snaptree *Tree, root common.Hash, w io.Writer) error {
+	if err := rlp.Encode(w, &exportHeader{Magic: exportMagic, Version: exportVersion, Root: root}); err != nil {
+		return err
+	}
+	acctIt, err := snaptree.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err // The required snapshot might not exist.
+	}
+	defer acctIt.Release()
+
+	var (
+		ew    = &exportWriter{w: w}
+		codes = make(map[common.Hash]struct{})
+
+		accounts, slots int
+		start           = time.Now()
+		logged          = time.Now()
+	)
+	for acctIt.Next() {
+		hash := acctIt.Hash()
+		if err := ew.add(exportAccountItem, hash, acctIt.Account()); err != nil {
+			return err
+		}
+		accounts++
+
+		account, err := FullAccount(acctIt.Account())
+		if err != nil {
+			return err
+		}
+		// Export the contract code once, the first time it's referenced
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode {
+			if _, ok := codes[codeHash]; !ok {
+				code := rawdb.ReadCode(snaptree.diskdb, codeHash)
+				if len(code) == 0 {
+					return fmt.Errorf("missing code %x for account %x", codeHash, hash)
+				}
+				if err := ew.add(exportCodeItem, codeHash, code); err != nil {
+					return err
+				}
+				codes[codeHash] = struct{}{}
+			}
+		}
+		if common.BytesToHash(account.Root) != emptyRoot {
+			storageIt, err := snaptree.StorageIterator(root, hash, common.Hash{})
+			if err != nil {
+				return err
+			}
+			for storageIt.Next() {
+				if err := ew.add(exportStorageItem, storageIt.Hash(), storageIt.Slot()); err != nil {
+					storageIt.Release()
+					return err
+				}
+				slots++
+			}
+			err = storageIt.Error()
+			storageIt.Release()
+			if err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state snapshot", "at", hash, "accounts", accounts, "slots", slots, "codes", len(codes), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := acctIt.Error(); err != nil {
+		return err
+	}
+	// Flush the last items and terminate the stream with an empty chunk
+	if len(ew.items) > 0 {
+		if err := ew.flush(); err != nil {
+			return err
+		}
+	}
+	if err := ew.flush(); err != nil {
+		return err
+	}
+	log.Info("Exported state snapshot", "root", root, "accounts", accounts, "slots", slots, "codes", len(codes), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// importer rebuilds the snapshot and the state trie from a stream of export
+// items. Since the items are sorted by hash, both the account and the storage
+// tries can be regenerated on the fly with stack tries.
+type importer struct {
+	batch ethdb.Batch
+
+	accountTrie *trie.StackTrie
+	storageTrie *trie.StackTrie
+
+	account    *Account                 // Account currently being imported, nil if none yet
+	accountKey common.Hash              // Hash of the account currently being imported
+	lastSlot   *common.Hash             // Last storage slot imported for the current account
+	codes      map[common.Hash]struct{} // Contract codes imported so far
+
+	accounts, slots int
+}
+
+// flushBatch writes out the batch if it has grown large enough.
+func (imp *importer) flushBatch(force bool) error {
+	if !force && imp.batch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	if err := imp.batch.Write(); err != nil {
+		return err
+	}
+	imp.batch.Reset()
+	return nil
+}
+
+// finishAccount verifies the storage root of the current account and inserts
+// the account into the account trie.
+func (imp *importer) finishAccount() error {
+	if imp.account == nil {
+		return nil
+	}
+	root := emptyRoot
+	if imp.lastSlot != nil {
+		hash, err := imp.storageTrie.Commit()
+		if err != nil {
+			return err
+		}
+		root = hash
+		imp.storageTrie = trie.NewStackTrie(imp.batch)
+	}
+	if want := common.BytesToHash(imp.account.Root); root != want {
+		return fmt.Errorf("storage root mismatch for account %x: have %x, want %x", imp.accountKey, root, want)
+	}
+	if codeHash := common.BytesToHash(imp.account.CodeHash); codeHash != emptyCode {
+		if _, ok := imp.codes[codeHash]; !ok {
+			return fmt.Errorf("missing code %x for account %x", codeHash, imp.accountKey)
+		}
+	}
+	blob, err := rlp.EncodeToBytes(imp.account)
+	if err != nil {
+		return err
+	}
+	if err := imp.accountTrie.TryUpdate(imp.accountKey[:], blob); err != nil {
+		return err
+	}
+	imp.account, imp.lastSlot = nil, nil
+	return nil
+}
+
+// process imports a single export item.
+func (imp *importer) process(item exportItem) error {
+	switch item.Type {
+	case exportAccountItem:
+		if imp.account != nil && bytes.Compare(item.Key[:], imp.accountKey[:]) <= 0 {
+			return fmt.Errorf("unordered account %x after %x", item.Key, imp.accountKey)
+		}
+		if err := imp.finishAccount(); err != nil {
+			return err
+		}
+		account, err := FullAccount(item.Value)
+		if err != nil {
+			return err
+		}
+		imp.account, imp.accountKey = &account, item.Key
+		rawdb.WriteAccountSnapshot(imp.batch, item.Key, item.Value)
+		imp.accounts++
+
+	case exportStorageItem:
+		if imp.account == nil {
+			return errors.New("storage slot without account")
+		}
+		if imp.lastSlot != nil && bytes.Compare(item.Key[:], imp.lastSlot[:]) <= 0 {
+			return fmt.Errorf("unordered storage slot %x after %x in account %x", item.Key, *imp.lastSlot, imp.accountKey)
+		}
+		if err := imp.storageTrie.TryUpdate(item.Key[:], item.Value); err != nil {
+			return err
+		}
+		slot := item.Key
+		imp.lastSlot = &slot
+		rawdb.WriteStorageSnapshot(imp.batch, imp.accountKey, item.Key, item.Value)
+		imp.slots++
+
+	case exportCodeItem:
+		if hash := crypto.Keccak256Hash(item.Value); hash != item.Key {
+			return fmt.Errorf("code hash mismatch: have %x, want %x", hash, item.Key)
+		}
+		rawdb.WriteCode(imp.batch, item.Key, item.Value)
+		imp.codes[item.Key] = struct{}{}
+
+	default:
+		return fmt.Errorf("unknown export item type %d", item.Type)
+	}
+	return imp.flushBatch(false)
+}
+
+// Import reads a snapshot export produced by Export, verifies the checksum of
+// every chunk and writes the contained snapshot as well as the regenerated
+// state trie into db. Any previous snapshot in the database is wiped. The root
+// of the imported state is returned if it matches the one in the export header.
+func Import(db ethdb.KeyValueStore, r io.Reader) (common.Hash, error) {
+	stream := rlp.NewStream(r, 0)
+
+	var header exportHeader
+	if err := stream.Decode(&header); err != nil {
+		return common.Hash{}, fmt.Errorf("invalid snapshot export header: %v", err)
+	}
+	if !bytes.Equal(header.Magic, exportMagic) {
+		return common.Hash{}, errors.New("not a snapshot export")
+	}
+	if header.Version != exportVersion {
+		return common.Hash{}, fmt.Errorf("unsupported snapshot export version %d", header.Version)
+	}
+	// Drop any previous snapshot, the imported one replaces it entirely
+	rawdb.DeleteSnapshotRoot(db)
+	rawdb.DeleteSnapshotJournal(db)
+	rawdb.DeleteSnapshotGenerator(db)
+	if err := wipeContent(db); err != nil {
+		return common.Hash{}, err
+	}
+	batch := db.NewBatch()
+	imp := &importer{
+		batch:       batch,
+		accountTrie: trie.NewStackTrie(batch),
+		storageTrie: trie.NewStackTrie(batch),
+		codes:       make(map[common.Hash]struct{}),
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for index := uint64(0); ; index++ {
+		var chunk exportChunk
+		if err := stream.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return common.Hash{}, errExportTruncated
+			}
+			return common.Hash{}, fmt.Errorf("invalid chunk %d: %v", index, err)
+		}
+		if hash := crypto.Keccak256Hash(chunk.Payload); hash != chunk.Checksum {
+			return common.Hash{}, fmt.Errorf("checksum mismatch in chunk %d: have %x, want %x", index, hash, chunk.Checksum)
+		}
+		var payload exportPayload
+		if err := rlp.DecodeBytes(chunk.Payload, &payload); err != nil {
+			return common.Hash{}, fmt.Errorf("invalid chunk %d payload: %v", index, err)
+		}
+		if payload.Index != index {
+			return common.Hash{}, fmt.Errorf("unexpected chunk index: have %d, want %d", payload.Index, index)
+		}
+		if len(payload.Items) == 0 {
+			break
+		}
+		for _, item := range payload.Items {
+			if err := imp.process(item); err != nil {
+				return common.Hash{}, err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing state snapshot", "at", imp.accountKey, "accounts", imp.accounts, "slots", imp.slots, "codes", len(imp.codes), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := imp.finishAccount(); err != nil {
+		return common.Hash{}, err
+	}
+	root := emptyRoot
+	if imp.accounts > 0 {
+		hash, err := imp.accountTrie.Commit()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		root = hash
+	}
+	if root != header.Root {
+		return common.Hash{}, fmt.Errorf("state root mismatch: have %x, want %x", root, header.Root)
+	}
+	// The state is complete, mark the snapshot as fully generated
+	journalProgress(batch, nil, nil)
+	rawdb.WriteSnapshotRoot(batch, root)
+	if err := imp.flushBatch(true); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Imported state snapshot", "root", root, "accounts", imp.accounts, "slots", imp.slots, "codes", len(imp.codes), "elapsed", common.PrettyDuration(time.Since(start)))
+	return root, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeExportState creates a small state with a few plain accounts and a few
+// contracts sharing code and storage, and generates the snapshot for it.
+func makeExportState(t *testing.T) (*Tree, common.Hash) {
+	var (
+		diskdb = memorydb.New()
+		triedb = trie.NewDatabase(diskdb)
+	)
+	stTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+	for i := 0; i < 100; i++ {
+		stTrie.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	stRoot, _ := stTrie.Commit(nil)
+
+	code := []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+	codeHash := crypto.Keccak256Hash(code)
+	rawdb.WriteCode(diskdb, codeHash, code)
+
+	accTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+	for i := 0; i < 50; i++ {
+		acc := &Account{Balance: big.NewInt(int64(i)), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()}
+		if i%10 == 0 {
+			acc.Root, acc.CodeHash = stRoot.Bytes(), codeHash.Bytes()
+		}
+		val, _ := rlp.EncodeToBytes(acc)
+		accTrie.Update([]byte(fmt.Sprintf("acc-%d", i)), val)
+	}
+	root, _ := accTrie.Commit(func(path []byte, leaf []byte, parent common.Hash) error {
+		var acc Account
+		if err := rlp.DecodeBytes(leaf, &acc); err != nil {
+			return err
+		}
+		if storage := common.BytesToHash(acc.Root); storage != emptyRoot {
+			triedb.Reference(storage, parent)
+		}
+		return nil
+	})
+	triedb.Commit(root, false, nil)
+
+	snaps, err := New(diskdb, triedb, 16, root, false, true, false)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	return snaps, root
+}
+
+// Tests that a snapshot can be exported and imported into an empty database,
+// recreating both the snapshot and the state trie.
+func TestExportImport(t *testing.T) {
+	snaps, root := makeExportState(t)
+
+	buf := new(bytes.Buffer)
+	if err := Export(snaps, root, buf); err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+	db := memorydb.New()
+	got, err := Import(db, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import snapshot: %v", err)
+	}
+	if got != root {
+		t.Fatalf("root mismatch: have %x, want %x", got, root)
+	}
+	// Ensure the imported snapshot loads and verifies
+	imported, err := New(db, trie.NewDatabase(db), 16, root, false, false, false)
+	if err != nil {
+		t.Fatalf("failed to load imported snapshot: %v", err)
+	}
+	if err := imported.Verify(root); err != nil {
+		t.Fatalf("imported snapshot failed verification: %v", err)
+	}
+	// Ensure the state trie was regenerated with all the storage and code
+	accTrie, err := trie.NewSecure(root, trie.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open imported trie: %v", err)
+	}
+	var accounts, slots int
+	it := trie.NewIterator(accTrie.NodeIterator(nil))
+	for it.Next() {
+		accounts++
+		var acc Account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			t.Fatalf("failed to decode account: %v", err)
+		}
+		if !bytes.Equal(acc.CodeHash, emptyCode.Bytes()) && len(rawdb.ReadCode(db, common.BytesToHash(acc.CodeHash))) == 0 {
+			t.Errorf("missing code for account %x", it.Key)
+		}
+		if storage := common.BytesToHash(acc.Root); storage != emptyRoot {
+			stTrie, err := trie.NewSecure(storage, trie.NewDatabase(db))
+			if err != nil {
+				t.Fatalf("failed to open imported storage trie: %v", err)
+			}
+			stIt := trie.NewIterator(stTrie.NodeIterator(nil))
+			for stIt.Next() {
+				slots++
+			}
+			if stIt.Err != nil {
+				t.Fatalf("failed to iterate storage trie: %v", stIt.Err)
+			}
+		}
+	}
+	if it.Err != nil {
+		t.Fatalf("failed to iterate account trie: %v", it.Err)
+	}
+	if accounts != 50 || slots != 500 {
+		t.Errorf("imported state mismatch: have %d accounts %d slots, want %d accounts %d slots", accounts, slots, 50, 500)
+	}
+}
+
+// Tests that corrupted or truncated exports are rejected.
+func TestImportCorrupted(t *testing.T) {
+	snaps, root := makeExportState(t)
+
+	buf := new(bytes.Buffer)
+	if err := Export(snaps, root, buf); err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+	blob := buf.Bytes()
+
+	// Flip a byte in the middle of the payload
+	corrupt := common.CopyBytes(blob)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if _, err := Import(memorydb.New(), bytes.NewReader(corrupt)); err == nil {
+		t.Errorf("corrupted export imported")
+	}
+	// Drop the terminating chunk
+	end, _ := rlp.EncodeToBytes(&exportChunk{Payload: mustEncodePayload(t, 1), Checksum: crypto.Keccak256Hash(mustEncodePayload(t, 1))})
+	if _, err := Import(memorydb.New(), bytes.NewReader(blob[:len(blob)-len(end)])); err != errExportTruncated {
+		t.Errorf("truncated export error mismatch: have %v, want %v", err, errExportTruncated)
+	}
+}
+
+func mustEncodePayload(t *testing.T, index uint64) []byte {
+	blob, err := rlp.EncodeToBytes(&exportPayload{Index: index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
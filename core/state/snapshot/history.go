@@ -0,0 +1,253 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrHistoryUnavailable is returned if the state history needed to reconstruct
+// an old state has not been recorded or was already pruned.
+var ErrHistoryUnavailable = errors.New("state history unavailable")
+
+// reverseDiff contains the original values of all the accounts and storage
+// slots modified by a block, allowing the post-state to be rolled back to the
+// pre-state. Missing accounts and slots are denoted by empty blobs.
+//
+// The diffs are keyed by block number and hash instead of state root, as the
+// same root may be produced by multiple blocks (e.g. ones not touching the state).
+type reverseDiff struct {
+	ParentHash common.Hash      // Hash of the block the diff reverts to
+	ParentRoot common.Hash      // Root of the state the diff reverts to
+	Accounts   []journalAccount // Original slim accounts, sorted by hash
+	Storage    []journalStorage // Original storage slots, sorted by account hash
+}
+
+// WriteHistory persists the reverse diff of the given block, which allows the
+// reconstruction of its parent's state later via History. It needs to be called
+// right after the block's state was committed, while the snapshot layer created
+// for it is still live. The diffs are never deleted by the tree, it is up to the
+// caller to prune them.
+func (t *Tree) WriteHistory(header *types.Header, parentRoot common.Hash) error {
+	diff := &reverseDiff{ParentHash: header.ParentHash, ParentRoot: parentRoot}
+
+	// Blocks not modifying the state have no layer of their own, only a marker
+	if header.Root != parentRoot {
+		layer, ok := t.Snapshot(header.Root).(*diffLayer)
+		if !ok {
+			return fmt.Errorf("snapshot [%#x] not a diff layer", header.Root)
+		}
+		parent := layer.Parent()
+		if parent.Root() != parentRoot {
+			return fmt.Errorf("snapshot [%#x] parent mismatch: have %#x, want %#x", header.Root, parent.Root(), parentRoot)
+		}
+		if err := t.gatherHistory(diff, parent, layer.destructSet, layer.accountData, layer.storageData); err != nil {
+			return err
+		}
+	}
+	blob, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteStateHistory(t.diskdb, header.Number.Uint64(), header.Hash(), blob)
+	return nil
+}
+
+// gatherHistory collects the original values of the data modified by a layer
+// from its parent into the reverse diff.
+func (t *Tree) gatherHistory(diff *reverseDiff, parent snapshot, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	var (
+		accountSet = make(map[common.Hash]struct{})
+		storageSet = make(map[common.Hash]map[common.Hash][]byte)
+	)
+	for hash := range destructs {
+		accountSet[hash] = struct{}{}
+	}
+	for hash := range accounts {
+		accountSet[hash] = struct{}{}
+	}
+	for hash := range accountSet {
+		blob, err := parent.AccountRLP(hash)
+		if err != nil {
+			return err
+		}
+		diff.Accounts = append(diff.Accounts, journalAccount{Hash: hash, Blob: blob})
+
+		// Destructed accounts lose all their storage, retrieve everything
+		if _, ok := destructs[hash]; !ok || len(blob) == 0 {
+			continue
+		}
+		it, err := newFastStorageIterator(t, parent.Root(), hash, common.Hash{})
+		if err != nil {
+			return err
+		}
+		slots := make(map[common.Hash][]byte)
+		for it.Next() {
+			slots[it.Hash()] = common.CopyBytes(it.Slot())
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+		storageSet[hash] = slots
+	}
+	for hash, written := range storage {
+		slots := storageSet[hash]
+		if slots == nil {
+			slots = make(map[common.Hash][]byte)
+			storageSet[hash] = slots
+		}
+		for slot := range written {
+			if _, ok := slots[slot]; ok {
+				continue
+			}
+			blob, err := parent.Storage(hash, slot)
+			if err != nil {
+				return err
+			}
+			slots[slot] = blob
+		}
+	}
+	for hash, slots := range storageSet {
+		entry := journalStorage{Hash: hash}
+		for slot := range slots {
+			entry.Keys = append(entry.Keys, slot)
+		}
+		sort.Slice(entry.Keys, func(i, j int) bool { return bytes.Compare(entry.Keys[i][:], entry.Keys[j][:]) < 0 })
+		for _, slot := range entry.Keys {
+			entry.Vals = append(entry.Vals, slots[slot])
+		}
+		diff.Storage = append(diff.Storage, entry)
+	}
+	sort.Slice(diff.Accounts, func(i, j int) bool {
+		return bytes.Compare(diff.Accounts[i].Hash[:], diff.Accounts[j].Hash[:]) < 0
+	})
+	sort.Slice(diff.Storage, func(i, j int) bool {
+		return bytes.Compare(diff.Storage[i].Hash[:], diff.Storage[j].Hash[:]) < 0
+	})
+	return nil
+}
+
+// historicLayer is a read-only snapshot of an old state, reconstructed by rolling
+// back the reverse diffs of all the blocks between it and a live snapshot layer.
+type historicLayer struct {
+	root     common.Hash                            // Root of the reconstructed state
+	base     Snapshot                               // Live layer the diffs are applied on
+	accounts map[common.Hash][]byte                 // Original accounts, empty if missing
+	storage  map[common.Hash]map[common.Hash][]byte // Original slots, empty if missing
+}
+
+// History reconstructs the state of the block with the given number and hash by
+// rolling back the reverse diffs of all the blocks above it, starting from the
+// live snapshot layer of base. The block needs to be an ancestor of base.
+func (t *Tree) History(base *types.Header, number uint64, hash common.Hash) (Snapshot, error) {
+	snap := t.Snapshot(base.Root)
+	if snap == nil {
+		return nil, fmt.Errorf("snapshot [%#x] missing", base.Root)
+	}
+	layer := &historicLayer{
+		root:     base.Root,
+		base:     snap,
+		accounts: make(map[common.Hash][]byte),
+		storage:  make(map[common.Hash]map[common.Hash][]byte),
+	}
+	// Iterate the diffs from newest to oldest, the oldest value of each item is
+	// the one present in the requested state
+	for current, currentHash := base.Number.Uint64(), base.Hash(); current != number || currentHash != hash; current-- {
+		if current <= number {
+			return nil, ErrHistoryUnavailable // Not an ancestor of base
+		}
+		blob := rawdb.ReadStateHistory(t.diskdb, current, currentHash)
+		if len(blob) == 0 {
+			return nil, ErrHistoryUnavailable
+		}
+		diff := new(reverseDiff)
+		if err := rlp.DecodeBytes(blob, diff); err != nil {
+			return nil, fmt.Errorf("invalid state history of #%d [%#x]: %v", current, currentHash, err)
+		}
+		for _, entry := range diff.Accounts {
+			layer.accounts[entry.Hash] = entry.Blob
+		}
+		for _, entry := range diff.Storage {
+			if len(entry.Keys) != len(entry.Vals) {
+				return nil, fmt.Errorf("invalid state history of #%d [%#x]: slot count mismatch", current, currentHash)
+			}
+			slots := layer.storage[entry.Hash]
+			if slots == nil {
+				slots = make(map[common.Hash][]byte)
+				layer.storage[entry.Hash] = slots
+			}
+			for i, slot := range entry.Keys {
+				slots[slot] = entry.Vals[i]
+			}
+		}
+		currentHash, layer.root = diff.ParentHash, diff.ParentRoot
+	}
+	return layer, nil
+}
+
+// Root returns the root hash of the reconstructed state.
+func (hl *historicLayer) Root() common.Hash {
+	return hl.root
+}
+
+// Account directly retrieves the account associated with a particular hash in
+// the snapshot slim data format.
+func (hl *historicLayer) Account(hash common.Hash) (*Account, error) {
+	data, err := hl.AccountRLP(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 { // can be both nil and []byte{}
+		return nil, nil
+	}
+	account := new(Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		panic(err)
+	}
+	return account, nil
+}
+
+// AccountRLP directly retrieves the account RLP associated with a particular
+// hash in the snapshot slim data format.
+func (hl *historicLayer) AccountRLP(hash common.Hash) ([]byte, error) {
+	if data, ok := hl.accounts[hash]; ok {
+		return data, nil
+	}
+	return hl.base.AccountRLP(hash)
+}
+
+// Storage directly retrieves the storage data associated with a particular hash,
+// within a particular account.
+func (hl *historicLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	if data, ok := hl.storage[accountHash][storageHash]; ok {
+		return data, nil
+	}
+	// Accounts missing from the old state cannot have storage
+	if data, ok := hl.accounts[accountHash]; ok && len(data) == 0 {
+		return nil, nil
+	}
+	return hl.base.Storage(accountHash, storageHash)
+}
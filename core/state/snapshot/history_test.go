@@ -0,0 +1,146 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that old states can be reconstructed from the persisted reverse diffs,
+// even after the diff layers were flattened into the disk layer.
+func TestStateHistory(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		acc1  = common.HexToHash("0xa1")
+		acc2  = common.HexToHash("0xa2")
+		acc3  = common.HexToHash("0xa3")
+		slot1 = common.HexToHash("0xb1")
+		slot2 = common.HexToHash("0xb2")
+		slot3 = common.HexToHash("0xb3")
+	)
+	rawdb.WriteAccountSnapshot(db, acc1, randomAccount())
+	rawdb.WriteAccountSnapshot(db, acc2, randomAccount())
+	rawdb.WriteStorageSnapshot(db, acc1, slot1, randomHash().Bytes())
+	rawdb.WriteStorageSnapshot(db, acc1, slot2, randomHash().Bytes())
+
+	base := &diskLayer{
+		diskdb: db,
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		diskdb: db,
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	headers := []*types.Header{{Number: big.NewInt(0), Root: base.root}}
+	update := func(root common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) {
+		parent := headers[len(headers)-1]
+		if root != parent.Root {
+			if err := snaps.Update(root, parent.Root, destructs, accounts, storage); err != nil {
+				t.Fatalf("failed to create a diff layer: %v", err)
+			}
+		}
+		header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(int64(len(headers))), Root: root}
+		if err := snaps.WriteHistory(header, parent.Root); err != nil {
+			t.Fatalf("failed to write state history: %v", err)
+		}
+		headers = append(headers, header)
+	}
+	// Modify an account with its storage and create a new one
+	update(common.HexToHash("0x02"), make(map[common.Hash]struct{}),
+		randomAccountSet("0xa1", "0xa3"), randomStorageSet([]string{"0xa1"}, [][]string{{"0xb1", "0xb3"}}, nil))
+
+	// Destruct the modified account and update another one
+	update(common.HexToHash("0x03"), map[common.Hash]struct{}{acc1: {}}, randomAccountSet("0xa2"), nil)
+
+	// Leave the state untouched, reusing the parent's root
+	update(common.HexToHash("0x03"), nil, nil, nil)
+
+	// Resurrect the destructed account with fresh storage
+	update(common.HexToHash("0x04"), make(map[common.Hash]struct{}),
+		randomAccountSet("0xa1"), randomStorageSet([]string{"0xa1"}, [][]string{{"0xb2"}}, nil))
+	// Gather the expected content of every state while the diff layers are live
+	type item struct {
+		account common.Hash
+		slot    *common.Hash
+	}
+	items := []item{{acc1, nil}, {acc2, nil}, {acc3, nil}, {acc1, &slot1}, {acc1, &slot2}, {acc1, &slot3}}
+
+	read := func(snap Snapshot, it item) []byte {
+		var (
+			blob []byte
+			err  error
+		)
+		if it.slot == nil {
+			blob, err = snap.AccountRLP(it.account)
+		} else {
+			blob, err = snap.Storage(it.account, *it.slot)
+		}
+		if err != nil {
+			t.Fatalf("failed to read %x/%v from %x: %v", it.account, it.slot, snap.Root(), err)
+		}
+		return blob
+	}
+	want := make([][][]byte, len(headers))
+	for i, header := range headers {
+		for _, it := range items {
+			want[i] = append(want[i], read(snaps.Snapshot(header.Root), it))
+		}
+	}
+	head := headers[len(headers)-1]
+	check := func() {
+		for i, header := range headers {
+			snap, err := snaps.History(head, header.Number.Uint64(), header.Hash())
+			if err != nil {
+				t.Fatalf("failed to reconstruct state #%d: %v", i, err)
+			}
+			if snap.Root() != header.Root {
+				t.Errorf("state #%d: root mismatch: have %x, want %x", i, snap.Root(), header.Root)
+			}
+			for j, it := range items {
+				if have := read(snap, it); !bytes.Equal(have, want[i][j]) {
+					t.Errorf("state #%d, item %d: have %x, want %x", i, j, have, want[i][j])
+				}
+			}
+		}
+		// Blocks not on the chain of the base must be rejected, even if their
+		// state root is known
+		sibling := &types.Header{ParentHash: headers[1].Hash(), Number: big.NewInt(2), Root: headers[2].Root, Extra: []byte{0x01}}
+		if _, err := snaps.History(head, 2, sibling.Hash()); err != ErrHistoryUnavailable {
+			t.Errorf("sibling block: reconstructed unknown state: %v", err)
+		}
+	}
+	check()
+
+	// Flatten all the diff layers and ensure the history is still usable
+	if err := snaps.Cap(head.Root, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot tree: %v", err)
+	}
+	if snaps.Snapshot(common.HexToHash("0x01")) != nil {
+		t.Fatalf("stale layer still accessible")
+	}
+	check()
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	parallelTxMeter    = metrics.NewRegisteredMeter("chain/parallel/txs", nil)
+	parallelRerunMeter = metrics.NewRegisteredMeter("chain/parallel/reruns", nil)
+)
+
+// speculativeTx is the outcome of executing a transaction on top of the state
+// at the beginning of the block.
+type speculativeTx struct {
+	state  *state.StateDB      // Copy of the pre-block state the transaction was executed on
+	rwset  *state.ReadWriteSet // Accounts and slots accessed during execution
+	result *ExecutionResult    // Execution result if successful
+	err    error               // Execution error if the transaction was rejected
+	done   chan struct{}       // Closed when the execution finished
+}
+
+// parallel reports whether the block should be processed speculatively. Only
+// post-Byzantium blocks are eligible since receipts of earlier ones contain
+// intermediate state roots, and tracing needs to see transactions in order.
+func (p *StateProcessor) parallel(block *types.Block, cfg vm.Config) bool {
+	return cfg.ParallelExecution > 1 && !cfg.Debug && block.Transactions().Len() > 1 &&
+		p.config.IsByzantium(block.Number()) && p.config.IsEIP158(block.Number())
+}
+
+// processParallel is the speculative version of Process. All the transactions
+// are executed concurrently on individual copies of the pre-block state while
+// tracking the accounts and slots they access. The results are then committed
+// in order: a transaction that didn't observe anything modified by the ones
+// before it has its writes replayed onto the block state, otherwise it gets
+// re-executed on top of the block state. The outcome is exactly the same as if
+// all transactions were applied sequentially.
+func (p *StateProcessor) processParallel(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	var (
+		receipts types.Receipts
+		usedGas  = new(uint64)
+		header   = block.Header()
+		allLogs  []*types.Log
+		gp       = new(GasPool).AddGas(block.GasLimit())
+		txs      = block.Transactions()
+		signer   = types.MakeSigner(p.config, header.Number)
+		msgs     = make([]types.Message, len(txs))
+	)
+	for i, tx := range txs {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		msgs[i] = msg
+	}
+	// Create the state copies upfront, the workers must not touch the base state
+	base := statedb.Copy()
+	specs := make([]*speculativeTx, len(txs))
+	for i := range specs {
+		specs[i] = &speculativeTx{state: base.Copy(), rwset: state.NewReadWriteSet(), done: make(chan struct{})}
+	}
+	tasks := make(chan int, len(txs))
+	for i := range txs {
+		tasks <- i
+	}
+	close(tasks)
+
+	workers := cfg.ParallelExecution
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			blockContext := NewEVMBlockContext(header, p.bc, nil)
+			for i := range tasks {
+				spec := specs[i]
+				spec.state.Prepare(txs[i].Hash(), block.Hash(), i)
+				spec.state.TrackAccesses(spec.rwset)
+
+				vmenv := vm.NewEVM(blockContext, NewEVMTxContext(msgs[i]), spec.state, p.config, cfg)
+				spec.result, spec.err = ApplyMessage(vmenv, msgs[i], new(GasPool).AddGas(block.GasLimit()))
+				if spec.err == nil {
+					spec.state.Finalise(true)
+				}
+				spec.state.TrackAccesses(nil)
+				close(spec.done)
+			}
+		}()
+	}
+	// Commit the transaction results in order, re-executing conflicting ones
+	var (
+		written = state.NewReadWriteSet()
+		vmenv   = vm.NewEVM(NewEVMBlockContext(header, p.bc, nil), vm.TxContext{}, statedb, p.config, cfg)
+	)
+	for i, tx := range txs {
+		spec := specs[i]
+		<-spec.done
+
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		if spec.rwset.Conflicts(written) {
+			parallelRerunMeter.Mark(1)
+
+			rwset := state.NewReadWriteSet()
+			statedb.TrackAccesses(rwset)
+			receipt, err := applyTransaction(msgs[i], p.config, p.bc, nil, gp, statedb, header, tx, usedGas, vmenv)
+			statedb.TrackAccesses(nil)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+			}
+			written.Merge(rwset)
+			receipts = append(receipts, receipt)
+			allLogs = append(allLogs, receipt.Logs...)
+			continue
+		}
+		// The speculative execution is valid, make sure it fits into the block
+		if spec.err == nil {
+			spec.err = gp.SubGas(msgs[i].Gas())
+		}
+		if spec.err != nil {
+			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), spec.err)
+		}
+		gp.AddGas(msgs[i].Gas() - spec.result.UsedGas)
+
+		statedb.ApplyWrites(spec.state, base, spec.rwset)
+		for _, log := range spec.state.GetLogs(tx.Hash()) {
+			statedb.AddLog(log)
+		}
+		for hash, preimage := range spec.state.Preimages() {
+			statedb.AddPreimage(hash, preimage)
+		}
+		statedb.Finalise(true)
+		written.Merge(spec.rwset)
+
+		*usedGas += spec.result.UsedGas
+		receipt := &types.Receipt{Type: tx.Type(), CumulativeGasUsed: *usedGas}
+		if spec.result.Failed() {
+			receipt.Status = types.ReceiptStatusFailed
+		} else {
+			receipt.Status = types.ReceiptStatusSuccessful
+		}
+		receipt.TxHash = tx.Hash()
+		receipt.GasUsed = spec.result.UsedGas
+		if msgs[i].To() == nil {
+			receipt.ContractAddress = crypto.CreateAddress(msgs[i].From(), tx.Nonce())
+		}
+		receipt.Logs = statedb.GetLogs(tx.Hash())
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipt.BlockHash = statedb.BlockHash()
+		receipt.BlockNumber = header.Number
+		receipt.TransactionIndex = uint(i)
+
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	parallelTxMeter.Mark(int64(len(txs)))
+
+	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
+
+	return receipts, allLogs, *usedGas, nil
+}
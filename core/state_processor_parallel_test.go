@@ -0,0 +1,171 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that processing blocks with speculative parallel execution yields the
+// exact same receipts, logs and state as sequential processing, with blocks
+// mixing independent and conflicting transactions.
+func TestParallelStateProcessor(t *testing.T) {
+	var (
+		counter   = common.Address{0xc1} // Increments slot 0 and logs the new value
+		slots     = common.Address{0xc2} // Stores the block number at the caller's slot
+		coinbaser = common.Address{0xc3} // Stores the balance of the coinbase
+		destruct  = common.Address{0xc4} // Self destructs to the caller
+		reverter  = common.Address{0xc5} // Always reverts
+		forwarder = common.Address{0xc6} // Calls the counter with zero value
+
+		keys  = make([]*ecdsa.PrivateKey, 20)
+		addrs = make([]common.Address, len(keys))
+		alloc = GenesisAlloc{
+			counter:   {Balance: common.Big0, Code: common.FromHex("0x6000546001018060005560005260aa60206000a100")},
+			slots:     {Balance: common.Big0, Code: common.FromHex("0x43335500")},
+			coinbaser: {Balance: common.Big0, Code: common.FromHex("0x413160005500")},
+			destruct:  {Code: common.FromHex("0x33ff"), Balance: big.NewInt(1000), Storage: map[common.Hash]common.Hash{{}: {0x01}}},
+			reverter:  {Balance: common.Big0, Code: common.FromHex("0x60006000fd")},
+			forwarder: {Balance: common.Big0, Code: append(append(common.FromHex("0x6000600060006000600073"), counter[:]...), common.FromHex("0x5af15000")...)},
+		}
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+		alloc[addrs[i]] = GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	var (
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: alloc, GasLimit: 10000000}
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 8, func(i int, gen *BlockGen) {
+		if i%2 == 0 {
+			gen.SetCoinbase(addrs[18])
+		} else {
+			gen.SetCoinbase(common.Address{0xcb, byte(i)})
+		}
+		send := func(key *ecdsa.PrivateKey, to *common.Address, value int64, gas uint64, price int64, data []byte) {
+			tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+				Nonce:    gen.TxNonce(crypto.PubkeyToAddress(key.PublicKey)),
+				To:       to,
+				Value:    big.NewInt(value),
+				Gas:      gas,
+				GasPrice: big.NewInt(price),
+				Data:     data,
+			}), signer, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen.AddTx(tx)
+		}
+		for j := 0; j < 10; j++ {
+			switch {
+			case j == 0 && i%2 == 0:
+				send(keys[j], nil, 0, 100000, 1, common.FromHex("0x600160005500")) // Contract creation
+			case j == 1 && i%2 == 1:
+				send(keys[j], &reverter, 0, 50000, 1, nil)
+			default:
+				send(keys[j], &common.Address{0xee, byte(i), byte(j)}, 1, params.TxGas, 1, nil)
+			}
+			// Interleave dependent transactions with the independent ones
+			switch j {
+			case 1, 4, 7:
+				send(keys[10], &addrs[j], 1000, params.TxGas, 1, nil)
+			case 2:
+				send(keys[11], &counter, 0, 100000, 1, nil)
+				send(keys[14], &slots, 0, 100000, 1, nil)
+			case 3:
+				send(keys[12], &counter, 0, 100000, 1, nil)
+				send(keys[15], &slots, 0, 100000, 1, nil)
+				send(keys[17], &coinbaser, 0, 100000, 1, nil)
+			case 5:
+				send(keys[13], &counter, 0, 100000, 1, nil)
+				send(keys[19], &forwarder, 0, 100000, 1, nil)
+			case 6:
+				send(keys[18], &addrs[0], 1, params.TxGas, 1, nil)
+				send(keys[16], &slots, 0, 100000, 0, nil)
+			case 8:
+				if i == 3 {
+					send(keys[19], &destruct, 0, 100000, 1, nil)
+				}
+				send(keys[1], &destruct, 1, 100000, 1, nil)
+			}
+		}
+	})
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert sequential chain: %v", err)
+	}
+	// Process every block both ways and compare the results
+	processor := NewStateProcessor(gspec.Config, chain, chain.Engine())
+	for _, block := range blocks {
+		parent := chain.GetBlockByHash(block.ParentHash())
+
+		seqstate, _ := chain.StateAt(parent.Root())
+		seqReceipts, seqLogs, seqGas, err := processor.Process(block, seqstate, vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: sequential processing failed: %v", block.NumberU64(), err)
+		}
+		parstate, _ := chain.StateAt(parent.Root())
+		parReceipts, parLogs, parGas, err := processor.Process(block, parstate, vm.Config{ParallelExecution: 4})
+		if err != nil {
+			t.Fatalf("block %d: parallel processing failed: %v", block.NumberU64(), err)
+		}
+		if seqGas != parGas {
+			t.Errorf("block %d: gas mismatch: sequential %d, parallel %d", block.NumberU64(), seqGas, parGas)
+		}
+		if !reflect.DeepEqual(seqReceipts, parReceipts) {
+			t.Errorf("block %d: receipt mismatch", block.NumberU64())
+		}
+		if !reflect.DeepEqual(seqLogs, parLogs) {
+			t.Errorf("block %d: log mismatch", block.NumberU64())
+		}
+		seqRoot, parRoot := seqstate.IntermediateRoot(true), parstate.IntermediateRoot(true)
+		if seqRoot != parRoot || seqRoot != block.Root() {
+			t.Errorf("block %d: root mismatch: sequential %x, parallel %x, want %x", block.NumberU64(), seqRoot, parRoot, block.Root())
+		}
+	}
+	// Ensure a chain validating blocks in parallel accepts them too
+	pardb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(pardb)
+
+	parchain, err := NewBlockChain(pardb, nil, gspec.Config, ethash.NewFaker(), vm.Config{ParallelExecution: 4}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parchain.Stop()
+	if _, err := parchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert parallel chain: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// maxConditionSlots is the maximum number of storage slots the preconditions of a
+// transaction may refer to, as all of them are checked for every block.
+const maxConditionSlots = 256
+
+var (
+	// ErrConditionsInvalid is returned if the preconditions of a transaction
+	// contradict each other.
+	ErrConditionsInvalid = errors.New("invalid transaction conditions")
+
+	// ErrConditionsExpired is returned if the block range or timestamp window of
+	// a conditional transaction was already passed.
+	ErrConditionsExpired = errors.New("transaction conditions expired")
+
+	// ErrConditionsUnmet is returned if the storage preconditions of a conditional
+	// transaction don't hold.
+	ErrConditionsUnmet = errors.New("transaction conditions not met")
+)
+
+// TxConditions are the preconditions under which a transaction may be included.
+// All the set fields must hold for the transaction to be included in a block.
+type TxConditions struct {
+	BlockNumberMin *uint64 // Minimum block number to include the transaction in
+	BlockNumberMax *uint64 // Maximum block number to include the transaction in
+	TimestampMin   *uint64 // Minimum block timestamp to include the transaction in
+	TimestampMax   *uint64 // Maximum block timestamp to include the transaction in
+
+	KnownAccounts map[common.Address]map[common.Hash]common.Hash // Expected storage slot values
+}
+
+// Validate checks that the conditions don't contradict each other and don't refer
+// to too many storage slots.
+func (c *TxConditions) Validate() error {
+	if c.BlockNumberMin != nil && c.BlockNumberMax != nil && *c.BlockNumberMin > *c.BlockNumberMax {
+		return fmt.Errorf("%w: block number minimum %d above maximum %d", ErrConditionsInvalid, *c.BlockNumberMin, *c.BlockNumberMax)
+	}
+	if c.TimestampMin != nil && c.TimestampMax != nil && *c.TimestampMin > *c.TimestampMax {
+		return fmt.Errorf("%w: timestamp minimum %d above maximum %d", ErrConditionsInvalid, *c.TimestampMin, *c.TimestampMax)
+	}
+	var slots int
+	for _, account := range c.KnownAccounts {
+		slots += len(account)
+	}
+	if slots > maxConditionSlots {
+		return fmt.Errorf("%w: %d storage slots, limit %d", ErrConditionsInvalid, slots, maxConditionSlots)
+	}
+	return nil
+}
+
+// Expired returns whether the block range or timestamp window can no longer be
+// met by any block built on top of the given head.
+func (c *TxConditions) Expired(head *types.Header) bool {
+	if c.BlockNumberMax != nil && head.Number.Uint64() >= *c.BlockNumberMax {
+		return true
+	}
+	// Child blocks must have a strictly higher timestamp than their parent
+	if c.TimestampMax != nil && head.Time >= *c.TimestampMax {
+		return true
+	}
+	return false
+}
+
+// Eligible returns whether the block range and timestamp window allow inclusion
+// in the block with the given header.
+func (c *TxConditions) Eligible(header *types.Header) bool {
+	number := header.Number.Uint64()
+	if c.BlockNumberMin != nil && number < *c.BlockNumberMin {
+		return false
+	}
+	if c.BlockNumberMax != nil && number > *c.BlockNumberMax {
+		return false
+	}
+	if c.TimestampMin != nil && header.Time < *c.TimestampMin {
+		return false
+	}
+	if c.TimestampMax != nil && header.Time > *c.TimestampMax {
+		return false
+	}
+	return true
+}
+
+// CheckState verifies the storage preconditions against the given state.
+func (c *TxConditions) CheckState(statedb *state.StateDB) error {
+	for addr, slots := range c.KnownAccounts {
+		for slot, want := range slots {
+			if have := statedb.GetState(addr, slot); have != want {
+				return fmt.Errorf("%w: storage slot %x of %x is %x, want %x", ErrConditionsUnmet, slot, addr, have, want)
+			}
+		}
+	}
+	return nil
+}
@@ -115,8 +115,45 @@ var (
 	queuedGauge  = metrics.NewRegisteredGauge("txpool/queued", nil)
 	localGauge   = metrics.NewRegisteredGauge("txpool/local", nil)
 	slotsGauge   = metrics.NewRegisteredGauge("txpool/slots", nil)
+
+	// Metrics for the transaction lifecycle events, per type and per type and reason
+	txEventMeters = map[TxPoolEventType]metrics.Meter{
+		TxPoolEventAdded:    metrics.NewRegisteredMeter("txpool/events/added", nil),
+		TxPoolEventPromoted: metrics.NewRegisteredMeter("txpool/events/promoted", nil),
+		TxPoolEventDemoted:  metrics.NewRegisteredMeter("txpool/events/demoted", nil),
+		TxPoolEventReplaced: metrics.NewRegisteredMeter("txpool/events/replaced", nil),
+		TxPoolEventDropped:  metrics.NewRegisteredMeter("txpool/events/dropped", nil),
+	}
+	txEventReasonMeters = map[TxPoolEventType]map[TxPoolEventReason]metrics.Meter{
+		TxPoolEventDemoted: {
+			TxPoolReasonNonceGap: metrics.NewRegisteredMeter("txpool/events/demoted/nonceGap", nil),
+		},
+		TxPoolEventReplaced: {
+			TxPoolReasonPriceBump: metrics.NewRegisteredMeter("txpool/events/replaced/priceBump", nil),
+		},
+		TxPoolEventDropped: {
+			TxPoolReasonUnderpriced:       metrics.NewRegisteredMeter("txpool/events/dropped/underpriced", nil),
+			TxPoolReasonNonceTooLow:       metrics.NewRegisteredMeter("txpool/events/dropped/nonceTooLow", nil),
+			TxPoolReasonInsufficientFunds: metrics.NewRegisteredMeter("txpool/events/dropped/insufficientFunds", nil),
+			TxPoolReasonLifetime:          metrics.NewRegisteredMeter("txpool/events/dropped/lifetime", nil),
+			TxPoolReasonQueueOverflow:     metrics.NewRegisteredMeter("txpool/events/dropped/queueOverflow", nil),
+			TxPoolReasonPendingOverflow:   metrics.NewRegisteredMeter("txpool/events/dropped/pendingOverflow", nil),
+			TxPoolReasonConditions:        metrics.NewRegisteredMeter("txpool/events/dropped/conditions", nil),
+		},
+	}
 )
 
+// markTxPoolEvent counts a transaction lifecycle event in the pool metrics, both
+// per event type and, if available, per type and reason.
+func markTxPoolEvent(typ TxPoolEventType, reason TxPoolEventReason) {
+	if meter := txEventMeters[typ]; meter != nil {
+		meter.Mark(1)
+	}
+	if meter := txEventReasonMeters[typ][reason]; meter != nil {
+		meter.Mark(1)
+	}
+}
+
 // TxStatus is the current status of a transaction as seen by the pool.
 type TxStatus uint
 
@@ -144,6 +181,8 @@ type TxPoolConfig struct {
 	Journal   string           // Journal of local transactions to survive node restarts
 	Rejournal time.Duration    // Time interval to regenerate the local transaction journal
 
+	PoolJournal string // Journal of all pooled transactions, remote ones too, to survive node restarts
+
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
 
@@ -224,10 +263,14 @@ type TxPool struct {
 	chain       blockChain
 	gasPrice    *big.Int
 	txFeed      event.Feed
+	eventFeed   event.Feed
 	scope       event.SubscriptionScope
 	signer      types.Signer
 	mu          sync.RWMutex
 
+	events   []TxPoolEvent // Lifecycle events waiting to be sent once the lock is released
+	eventsMu sync.Mutex    // Mutex serializing lifecycle event delivery
+
 	istanbul bool // Fork indicator whether we are in the istanbul stage.
 	eip2718  bool // Fork indicator whether we are using EIP-2718 type transactions.
 
@@ -237,12 +280,16 @@ type TxPool struct {
 
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
+	store   *txStore    // Store of all pooled transactions to back up to disk
 
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
+	private *txPrivatePool               // Transactions only included by the local miner
+
+	conditions map[common.Hash]*TxConditions // Preconditions of the conditional transactions
 
 	chainHeadCh     chan ChainHeadEvent
 	chainHeadSub    event.Subscription
@@ -274,6 +321,8 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:           make(map[common.Address]*txList),
 		beats:           make(map[common.Address]time.Time),
 		all:             newTxLookup(),
+		private:         newTxPrivatePool(),
+		conditions:      make(map[common.Hash]*TxConditions),
 		chainHeadCh:     make(chan ChainHeadEvent, chainHeadChanSize),
 		reqResetCh:      make(chan *txpoolResetRequest),
 		reqPromoteCh:    make(chan *accountSet),
@@ -305,7 +354,30 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If the full pool store is enabled, restore the previous pool contents
+	if config.PoolJournal != "" {
+		pool.store = newTxStore(config.PoolJournal)
 
+		arrivals := make(map[common.Address]time.Time)
+		add := func(txs []*types.Transaction, local bool) []error {
+			for _, tx := range txs {
+				if from, err := types.Sender(pool.signer, tx); err == nil && tx.Time().After(arrivals[from]) {
+					arrivals[from] = tx.Time()
+				}
+			}
+			return pool.addTxs(txs, local && !config.NoLocals, true)
+		}
+		if err := pool.store.load(add); err != nil {
+			log.Warn("Failed to load transaction pool store", "err", err)
+		}
+		pool.mu.Lock()
+		pool.restoreBeats(arrivals)
+		err := pool.store.rotate(pool.stored())
+		pool.mu.Unlock()
+		if err != nil {
+			log.Warn("Failed to compact transaction pool store", "err", err)
+		}
+	}
 	// Subscribe events from blockchain and start the main event loop.
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 	pool.wg.Add(1)
@@ -372,11 +444,13 @@ func (pool *TxPool) loop() {
 					list := pool.queue[addr].Flatten()
 					for _, tx := range list {
 						pool.removeTx(tx.Hash(), true)
+						pool.queueEvent(tx.Hash(), TxPoolEventDropped, TxPoolReasonLifetime)
 					}
 					queuedEvictionMeter.Mark(int64(len(list)))
 				}
 			}
 			pool.mu.Unlock()
+			pool.sendEvents()
 
 		// Handle local transaction journal rotation
 		case <-journal.C:
@@ -387,6 +461,13 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+			if pool.store != nil {
+				pool.mu.Lock()
+				if err := pool.store.rotate(pool.stored()); err != nil {
+					log.Warn("Failed to compact tx pool store", "err", err)
+				}
+				pool.mu.Unlock()
+			}
 		}
 	}
 }
@@ -403,6 +484,9 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.store != nil {
+		pool.store.close()
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -412,6 +496,12 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeTxPoolEvent registers a subscription of TxPoolEvent and starts sending
+// the lifecycle events of all pooled transactions to the given channel.
+func (pool *TxPool) SubscribeTxPoolEvent(ch chan<- TxPoolEvent) event.Subscription {
+	return pool.scope.Track(pool.eventFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -424,12 +514,15 @@ func (pool *TxPool) GasPrice() *big.Int {
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
 
 	pool.gasPrice = price
 	for _, tx := range pool.priced.Cap(price) {
 		pool.removeTx(tx.Hash(), false)
+		pool.queueEvent(tx.Hash(), TxPoolEventDropped, TxPoolReasonUnderpriced)
 	}
+	pool.mu.Unlock()
+	pool.sendEvents()
+
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
@@ -482,6 +575,23 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// ContentFrom retrieves the data content of the transaction pool, returning the
+// pending as well as queued transactions of this address, grouped by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var pending types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Flatten()
+	}
+	var queued types.Transactions
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
 // Pending retrieves all currently processable transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -511,15 +621,58 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	txs := make(map[common.Address]types.Transactions)
 	for addr := range pool.locals.accounts {
 		if pending := pool.pending[addr]; pending != nil {
-			txs[addr] = append(txs[addr], pending.Flatten()...)
+			txs[addr] = append(txs[addr], pool.unconditional(pending.Flatten())...)
 		}
 		if queued := pool.queue[addr]; queued != nil {
-			txs[addr] = append(txs[addr], queued.Flatten()...)
+			txs[addr] = append(txs[addr], pool.unconditional(queued.Flatten())...)
 		}
 	}
 	return txs
 }
 
+// unconditional filters out the conditional transactions from a list. Their
+// conditions aren't persisted, so they must not be reloaded from disk either.
+func (pool *TxPool) unconditional(txs types.Transactions) types.Transactions {
+	if len(pool.conditions) == 0 {
+		return txs
+	}
+	filtered := txs[:0]
+	for _, tx := range txs {
+		if pool.conditions[tx.Hash()] == nil {
+			filtered = append(filtered, tx)
+		}
+	}
+	return filtered
+}
+
+// stored retrieves all currently known transactions, along with the metadata
+// needed to persist them into the pool store.
+func (pool *TxPool) stored() []*txStoreEntry {
+	var entries []*txStoreEntry
+	for _, lists := range []map[common.Address]*txList{pool.pending, pool.queue} {
+		for addr, list := range lists {
+			local := pool.locals.contains(addr)
+			for _, tx := range pool.unconditional(list.Flatten()) {
+				entries = append(entries, &txStoreEntry{Tx: tx, Time: uint64(tx.Time().UnixNano()), Local: local})
+			}
+		}
+	}
+	return entries
+}
+
+// restoreBeats rewinds the heartbeats of the given accounts to the arrival time
+// of their latest restored transaction, so that reloaded transactions don't get
+// a fresh lifetime.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) restoreBeats(arrivals map[common.Address]time.Time) {
+	for addr, arrival := range arrivals {
+		if beat, ok := pool.beats[addr]; ok && arrival.Before(beat) {
+			pool.beats[addr] = arrival
+		}
+	}
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -618,6 +771,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
 			underpricedTxMeter.Mark(1)
 			pool.removeTx(tx.Hash(), false)
+			pool.queueEvent(tx.Hash(), TxPoolEventDropped, TxPoolReasonUnderpriced)
 		}
 	}
 	// Try to replace an existing transaction in the pending pool
@@ -634,11 +788,14 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
+			pool.queueReplaceEvent(old.Hash(), hash)
 		}
 		pool.all.Add(tx, isLocal)
 		pool.priced.Put(tx, isLocal)
 		pool.journalTx(from, tx)
 		pool.queueTxEvent(tx)
+		pool.queueEvent(hash, TxPoolEventAdded, "")
+		pool.queueEvent(hash, TxPoolEventPromoted, "")
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 
 		// Successful promotion, bump the heartbeat
@@ -660,6 +817,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		localGauge.Inc(1)
 	}
 	pool.journalTx(from, tx)
+	pool.queueEvent(hash, TxPoolEventAdded, "")
 
 	log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replaced, nil
@@ -685,6 +843,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
+		pool.queueReplaceEvent(old.Hash(), hash)
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
@@ -705,9 +864,19 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 	return old != nil, nil
 }
 
-// journalTx adds the specified transaction to the local disk journal if it is
-// deemed to have been sent from a local account.
+// journalTx adds the specified transaction to the pool store if enabled, and to
+// the local disk journal if it is deemed to have been sent from a local account.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
+	// Conditional transactions are not persisted, as they'd be reloaded without
+	// their conditions
+	if pool.conditions[tx.Hash()] != nil {
+		return
+	}
+	if pool.store != nil {
+		if err := pool.store.insert(tx, pool.locals.contains(from)); err != nil {
+			log.Warn("Failed to store pooled transaction", "err", err)
+		}
+	}
 	// Only journal if it's enabled and the transaction is local
 	if pool.journal == nil || !pool.locals.contains(from) {
 		return
@@ -734,6 +903,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(hash)
 		pool.priced.Removed(1)
 		pendingDiscardMeter.Mark(1)
+		pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonUnderpriced)
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -741,12 +911,14 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		pendingReplaceMeter.Mark(1)
+		pool.queueReplaceEvent(old.Hash(), hash)
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
 	}
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
 	pool.pendingNonces.set(addr, tx.Nonce()+1)
+	pool.queueEvent(hash, TxPoolEventPromoted, "")
 
 	// Successful promotion, bump the heartbeat
 	pool.beats[addr] = time.Now()
@@ -769,6 +941,133 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 	return errs[0]
 }
 
+// AddPrivate adds a single transaction into the private pool if it is valid. Private
+// transactions are only included by the local miner and never announced to the
+// network. If not included within maxBlocks blocks (at most MaxPrivateTxBlocks),
+// the transaction is dropped, or added to the pool as a remote one if public is set.
+//
+// Private transactions are typically submitted by third parties over RPC, so they
+// don't get any of the exemptions of local transactions.
+func (pool *TxPool) AddPrivate(tx *types.Transaction, maxBlocks uint64, public bool) error {
+	if maxBlocks == 0 {
+		return ErrPrivateNoExpiry
+	}
+	if maxBlocks > MaxPrivateTxBlocks {
+		return ErrPrivateExpiryTooFar
+	}
+	from, err := types.Sender(pool.signer, tx)
+	if err != nil {
+		return ErrInvalidSender
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	hash := tx.Hash()
+	if pool.all.Get(hash) != nil || pool.private.get(hash) != nil {
+		knownTxMeter.Mark(1)
+		return ErrAlreadyKnown
+	}
+	if err := pool.validateTx(tx, false); err != nil {
+		invalidTxMeter.Mark(1)
+		return err
+	}
+	expiry := pool.chain.CurrentBlock().NumberU64() + maxBlocks
+	if err := pool.private.add(tx, from, expiry, public); err != nil {
+		return err
+	}
+	log.Trace("Pooled new private transaction", "hash", hash, "from", from, "to", tx.To(), "expiry", expiry)
+	return nil
+}
+
+// AddConditional enqueues a single transaction into the pool if it is valid, to
+// be included only in blocks meeting the given conditions. The transaction is
+// dropped as soon as its conditions can no longer hold. It's treated as remote,
+// so the sender doesn't get the exemptions of local accounts, and it's neither
+// journaled nor stored, its conditions not surviving a restart.
+//
+// Note, the conditions are only enforced by the local miner. The transaction is
+// announced to the network like any other one, and remote miners may include it
+// regardless of its conditions.
+func (pool *TxPool) AddConditional(tx *types.Transaction, conds *TxConditions) error {
+	if err := conds.Validate(); err != nil {
+		return err
+	}
+	pool.mu.Lock()
+	hash := tx.Hash()
+	if pool.all.Get(hash) != nil {
+		pool.mu.Unlock()
+		knownTxMeter.Mark(1)
+		return ErrAlreadyKnown
+	}
+	if conds.Expired(pool.chain.CurrentBlock().Header()) {
+		pool.mu.Unlock()
+		return ErrConditionsExpired
+	}
+	if err := conds.CheckState(pool.currentState); err != nil {
+		pool.mu.Unlock()
+		return err
+	}
+	pool.conditions[hash] = conds
+	pool.mu.Unlock()
+
+	if err := pool.addTxs([]*types.Transaction{tx}, false, true)[0]; err != nil {
+		pool.mu.Lock()
+		delete(pool.conditions, hash)
+		pool.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Conditions returns the conditions a pooled transaction may be included under,
+// or nil if it isn't a conditional transaction.
+func (pool *TxPool) Conditions(hash common.Hash) *TxConditions {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.conditions[hash]
+}
+
+// AllConditions returns the conditions of all the pooled conditional transactions,
+// keyed by transaction hash.
+func (pool *TxPool) AllConditions() map[common.Hash]*TxConditions {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	conditions := make(map[common.Hash]*TxConditions, len(pool.conditions))
+	for hash, conds := range pool.conditions {
+		conditions[hash] = conds
+	}
+	return conditions
+}
+
+// DropConditional removes the given conditional transactions from the pool, as
+// their storage preconditions were found not to hold in the pending state by the
+// local miner.
+func (pool *TxPool) DropConditional(hashes []common.Hash) {
+	pool.mu.Lock()
+	for _, hash := range hashes {
+		if pool.conditions[hash] == nil {
+			continue
+		}
+		log.Trace("Removed conditional transaction", "hash", hash)
+		delete(pool.conditions, hash)
+		pool.removeTx(hash, true)
+		pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonConditions)
+	}
+	pool.mu.Unlock()
+	pool.sendEvents()
+}
+
+// Private retrieves all the private transactions, grouped by origin account and
+// sorted by nonce. They are meant to be included by the local miner only.
+func (pool *TxPool) Private() map[common.Address]types.Transactions {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.private.flatten()
+}
+
 // AddRemotes enqueues a batch of transactions into the pool if they are valid. If the
 // senders are not among the locally tracked ones, full pricing constraints will apply.
 //
@@ -832,6 +1131,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	pool.mu.Lock()
 	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
 	pool.mu.Unlock()
+	pool.sendEvents()
 
 	var nilSlot = 0
 	for _, err := range newErrs {
@@ -928,6 +1228,7 @@ func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
 			for _, tx := range invalids {
 				// Internal shuffle shouldn't touch the lookup set.
 				pool.enqueueTx(tx.Hash(), tx, false, false)
+				pool.queueEvent(tx.Hash(), TxPoolEventDemoted, TxPoolReasonNonceGap)
 			}
 			// Update the account nonce if needed
 			pool.pendingNonces.setIfLower(addr, tx.Nonce())
@@ -979,6 +1280,40 @@ func (pool *TxPool) queueTxEvent(tx *types.Transaction) {
 	}
 }
 
+// queueEvent enqueues a lifecycle event to be sent out once the pool lock is
+// released, and counts it in the pool metrics.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) queueEvent(hash common.Hash, typ TxPoolEventType, reason TxPoolEventReason) {
+	pool.events = append(pool.events, TxPoolEvent{Hash: hash, Type: typ, Reason: reason})
+	markTxPoolEvent(typ, reason)
+}
+
+// queueReplaceEvent enqueues a lifecycle event for a transaction being replaced
+// by another one with the same nonce but a higher fee.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) queueReplaceEvent(old common.Hash, replacement common.Hash) {
+	pool.events = append(pool.events, TxPoolEvent{Hash: old, Type: TxPoolEventReplaced, Reason: TxPoolReasonPriceBump, ReplacedBy: &replacement})
+	markTxPoolEvent(TxPoolEventReplaced, TxPoolReasonPriceBump)
+}
+
+// sendEvents delivers all the lifecycle events queued up while the pool lock was
+// held to the subscribers. It must be called without holding the pool lock.
+func (pool *TxPool) sendEvents() {
+	pool.eventsMu.Lock()
+	defer pool.eventsMu.Unlock()
+
+	pool.mu.Lock()
+	events := pool.events
+	pool.events = nil
+	pool.mu.Unlock()
+
+	for _, ev := range events {
+		pool.eventFeed.Send(ev)
+	}
+}
+
 // scheduleReorgLoop schedules runs of reset and promoteExecutables. Code above should not
 // call those methods directly, but request them being run using requestReset and
 // requestPromoteExecutables instead.
@@ -1099,6 +1434,7 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		pool.pendingNonces.set(addr, highestPending.Nonce()+1)
 	}
 	pool.mu.Unlock()
+	pool.sendEvents()
 
 	// Notify subsystems for newly added transactions
 	for _, tx := range promoted {
@@ -1196,7 +1532,8 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.pendingNonces = newTxNoncer(statedb)
 	pool.currentMaxGas = newHead.GasLimit
 
-	// Inject any transactions discarded due to reorgs
+	// Inject any transactions discarded due to reorgs, keeping private ones private
+	reinject = pool.private.restore(reinject)
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
 	senderCacher.recover(pool.signer, reinject)
 	pool.addTxsLocked(reinject, false)
@@ -1205,6 +1542,35 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	next := new(big.Int).Add(newHead.Number, big.NewInt(1))
 	pool.istanbul = pool.chainconfig.IsIstanbul(next)
 	pool.eip2718 = pool.chainconfig.IsBerlin(next)
+
+	// Drop the private transactions which got included or expired, publishing
+	// the expired ones if requested
+	if publics := pool.private.prune(newHead.Number.Uint64(), pool.currentState); len(publics) > 0 {
+		pool.addTxsLocked(publics, false)
+	}
+	// Drop the conditional transactions whose conditions can no longer hold
+	pool.pruneConditions(newHead)
+}
+
+// pruneConditions removes the conditional transactions whose block range or time
+// window was passed, along with the conditions of transactions no longer in the
+// pool. The storage preconditions depend on the pending state, so they are checked
+// by the miner instead, see DropConditional.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) pruneConditions(head *types.Header) {
+	for hash, conds := range pool.conditions {
+		if pool.all.Get(hash) == nil {
+			delete(pool.conditions, hash)
+			continue
+		}
+		if conds.Expired(head) {
+			log.Trace("Removed conditional transaction", "hash", hash)
+			delete(pool.conditions, hash)
+			pool.removeTx(hash, true)
+			pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonConditions)
+		}
+	}
 }
 
 // promoteExecutables moves transactions that have become processable from the
@@ -1225,6 +1591,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range forwards {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonNonceTooLow)
 		}
 		log.Trace("Removed old queued transactions", "count", len(forwards))
 		// Drop all transactions that are too costly (low balance or out of gas)
@@ -1232,6 +1599,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range drops {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonInsufficientFunds)
 		}
 		log.Trace("Removed unpayable queued transactions", "count", len(drops))
 		queuedNofundsMeter.Mark(int64(len(drops)))
@@ -1254,6 +1622,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
+				pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonQueueOverflow)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 			queuedRateLimitMeter.Mark(int64(len(caps)))
@@ -1316,6 +1685,7 @@ func (pool *TxPool) truncatePending() {
 						// Drop the transaction from the global pools too
 						hash := tx.Hash()
 						pool.all.Remove(hash)
+						pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonPendingOverflow)
 
 						// Update the account nonce to the dropped transaction
 						pool.pendingNonces.setIfLower(offenders[i], tx.Nonce())
@@ -1343,6 +1713,7 @@ func (pool *TxPool) truncatePending() {
 					// Drop the transaction from the global pools too
 					hash := tx.Hash()
 					pool.all.Remove(hash)
+					pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonPendingOverflow)
 
 					// Update the account nonce to the dropped transaction
 					pool.pendingNonces.setIfLower(addr, tx.Nonce())
@@ -1390,6 +1761,7 @@ func (pool *TxPool) truncateQueue() {
 		if size := uint64(list.Len()); size <= drop {
 			for _, tx := range list.Flatten() {
 				pool.removeTx(tx.Hash(), true)
+				pool.queueEvent(tx.Hash(), TxPoolEventDropped, TxPoolReasonQueueOverflow)
 			}
 			drop -= size
 			queuedRateLimitMeter.Mark(int64(size))
@@ -1399,6 +1771,7 @@ func (pool *TxPool) truncateQueue() {
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
 			pool.removeTx(txs[i].Hash(), true)
+			pool.queueEvent(txs[i].Hash(), TxPoolEventDropped, TxPoolReasonQueueOverflow)
 			drop--
 			queuedRateLimitMeter.Mark(1)
 		}
@@ -1418,6 +1791,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		for _, tx := range olds {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonNonceTooLow)
 			log.Trace("Removed old pending transaction", "hash", hash)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
@@ -1426,6 +1800,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
 			pool.all.Remove(hash)
+			pool.queueEvent(hash, TxPoolEventDropped, TxPoolReasonInsufficientFunds)
 		}
 		pool.priced.Removed(len(olds) + len(drops))
 		pendingNofundsMeter.Mark(int64(len(drops)))
@@ -1436,6 +1811,7 @@ func (pool *TxPool) demoteUnexecutables() {
 
 			// Internal shuffle shouldn't touch the lookup set.
 			pool.enqueueTx(hash, tx, false, false)
+			pool.queueEvent(hash, TxPoolEventDemoted, TxPoolReasonNonceGap)
 		}
 		pendingGauge.Dec(int64(len(olds) + len(drops) + len(invalids)))
 		if pool.locals.contains(addr) {
@@ -1450,6 +1826,7 @@ func (pool *TxPool) demoteUnexecutables() {
 
 				// Internal shuffle shouldn't touch the lookup set.
 				pool.enqueueTx(hash, tx, false, false)
+				pool.queueEvent(hash, TxPoolEventDemoted, TxPoolReasonNonceGap)
 			}
 			pendingGauge.Dec(int64(len(gapped)))
 			// This might happen in a reorg, so log it to the metering
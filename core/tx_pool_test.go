@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"math/rand"
 	"os"
@@ -1859,6 +1860,413 @@ func testTransactionJournaling(t *testing.T, nolocals bool) {
 	pool.Stop()
 }
 
+// Tests that the full pool store persists remote transactions too, both pending
+// and queued ones, and that stale entries are dropped on restart.
+func TestTransactionPoolStore(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary file for the store
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary store: %v", err)
+	}
+	store := file.Name()
+	defer os.Remove(store)
+
+	// Clean up the temporary file, we only need the path for now
+	file.Close()
+	os.Remove(store)
+
+	// Create the original pool to inject transaction into the store
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.PoolJournal = store
+	config.Rejournal = time.Second
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+
+	// Add a local, two pending remotes and a queued remote transaction
+	if err := pool.AddLocal(pricedTransaction(0, 100000, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(pricedTransaction(1, 100000, big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	queuedTx := pricedTransaction(3, 100000, big.NewInt(1), remote)
+	if err := pool.addRemoteSync(queuedTx); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	pending, queued := pool.Stats()
+	if pending != 3 || queued != 1 {
+		t.Fatalf("pool contents mismatched: have %d/%d, want %d/%d", pending, queued, 3, 1)
+	}
+	// Terminate the old pool, bump the remote nonce, create a new pool and ensure
+	// everything but the mined transaction survives
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(remote.PublicKey), 1)
+	blockchain = &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	pending, queued = pool.Stats()
+	if pending != 2 || queued != 1 {
+		t.Fatalf("pool contents mismatched: have %d/%d, want %d/%d", pending, queued, 2, 1)
+	}
+	if !pool.locals.contains(crypto.PubkeyToAddress(local.PublicKey)) {
+		t.Fatalf("local account not restored as local")
+	}
+	if restored := pool.Get(queuedTx.Hash()); restored == nil || !restored.Time().Equal(queuedTx.Time()) {
+		t.Fatalf("queued transaction arrival time not restored")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the pool emits lifecycle events with the correct reasons when
+// transactions are added, replaced and dropped.
+func TestTransactionPoolEvents(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	events := make(chan TxPoolEvent, 32)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	// Add a transaction, replace it and ensure the events are emitted
+	tx := pricedTransaction(0, 100000, big.NewInt(1), key)
+	if err := pool.addRemoteSync(tx); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := validateLifecycleEvents(events, tx.Hash(), TxPoolEventAdded, TxPoolEventPromoted); err != nil {
+		t.Fatalf("original event firing failed: %v", err)
+	}
+	replacement := pricedTransaction(0, 100000, big.NewInt(2), key)
+	if err := pool.addRemoteSync(replacement); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Hash != tx.Hash() || ev.Type != TxPoolEventReplaced || ev.Reason != TxPoolReasonPriceBump {
+			t.Fatalf("replace event mismatch: %+v", ev)
+		}
+		if ev.ReplacedBy == nil || *ev.ReplacedBy != replacement.Hash() {
+			t.Fatalf("replacement hash mismatch: have %v, want %x", ev.ReplacedBy, replacement.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("replace event not fired")
+	}
+	if err := validateLifecycleEvents(events, replacement.Hash(), TxPoolEventAdded, TxPoolEventPromoted); err != nil {
+		t.Fatalf("replacement event firing failed: %v", err)
+	}
+	// Raise the price limit and ensure the drop is reported as underpriced
+	pool.SetGasPrice(big.NewInt(3))
+	select {
+	case ev := <-events:
+		if ev.Hash != replacement.Hash() || ev.Type != TxPoolEventDropped || ev.Reason != TxPoolReasonUnderpriced {
+			t.Fatalf("drop event mismatch: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("drop event not fired")
+	}
+}
+
+// Tests that the pool reports the transactions left behind an unpayable one as
+// demoted due to a nonce gap, and discarded same-nonce transactions as dropped.
+func TestTransactionPoolDemotionEvents(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	events := make(chan TxPoolEvent, 32)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000))
+
+	tx0 := pricedTransaction(0, 100000, big.NewInt(2), key)
+	tx1 := pricedTransaction(1, 100000, big.NewInt(1), key)
+	for _, tx := range []*types.Transaction{tx0, tx1} {
+		if err := pool.addRemoteSync(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+		if err := validateLifecycleEvents(events, tx.Hash(), TxPoolEventAdded, TxPoolEventPromoted); err != nil {
+			t.Fatalf("event firing failed: %v", err)
+		}
+	}
+	// Make the first transaction unpayable and ensure the second one is demoted
+	pool.currentState.SetBalance(from, big.NewInt(150000))
+	<-pool.requestReset(nil, nil)
+
+	for _, want := range []TxPoolEvent{
+		{Hash: tx0.Hash(), Type: TxPoolEventDropped, Reason: TxPoolReasonInsufficientFunds},
+		{Hash: tx1.Hash(), Type: TxPoolEventDemoted, Reason: TxPoolReasonNonceGap},
+	} {
+		select {
+		case ev := <-events:
+			if ev.Hash != want.Hash || ev.Type != want.Type || ev.Reason != want.Reason {
+				t.Fatalf("event mismatch: have %x/%s/%s, want %x/%s/%s", ev.Hash, ev.Type, ev.Reason, want.Hash, want.Type, want.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %s not fired", want.Type)
+		}
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// validateLifecycleEvents checks that the next lifecycle events fired by the
+// pool are the given types for the given transaction.
+func validateLifecycleEvents(events chan TxPoolEvent, hash common.Hash, types ...TxPoolEventType) error {
+	for _, typ := range types {
+		select {
+		case ev := <-events:
+			if ev.Hash != hash || ev.Type != typ {
+				return fmt.Errorf("event mismatch: have %x/%s, want %x/%s", ev.Hash, ev.Type, hash, typ)
+			}
+		case <-time.After(time.Second):
+			return fmt.Errorf("event %s not fired", typ)
+		}
+	}
+	return nil
+}
+
+// Tests that private transactions are kept out of the public pool, announced to
+// nobody, and dropped or published once they expire.
+func TestTransactionPrivatePool(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+
+	events := make(chan NewTxsEvent, 32)
+	sub := pool.txFeed.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	// Add a private transaction expiring and one publishing after a block
+	dropped := transaction(0, 100000, key)
+	published := transaction(1, 100000, key)
+	if err := pool.AddPrivate(dropped, 1, false); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(published, 2, true); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(published, 2, true); err != ErrAlreadyKnown {
+		t.Fatalf("duplicate private transaction error mismatch: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if err := pool.AddPrivate(transaction(2, 100000, key), 0, false); err != ErrPrivateNoExpiry {
+		t.Fatalf("non-expiring private transaction error mismatch: have %v, want %v", err, ErrPrivateNoExpiry)
+	}
+	if err := pool.AddPrivate(transaction(2, 100000, key), MaxPrivateTxBlocks+1, false); err != ErrPrivateExpiryTooFar {
+		t.Fatalf("far expiring private transaction error mismatch: have %v, want %v", err, ErrPrivateExpiryTooFar)
+	}
+	if err := pool.AddPrivate(transaction(2, 100000, key), math.MaxUint64, false); err != ErrPrivateExpiryTooFar {
+		t.Fatalf("overflowing private transaction error mismatch: have %v, want %v", err, ErrPrivateExpiryTooFar)
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Fatalf("private transactions leaked into the pool: pending %d, queued %d", pending, queued)
+	}
+	if pool.Get(dropped.Hash()) != nil {
+		t.Fatalf("private transaction retrievable from the public pool")
+	}
+	if private := pool.Private(); len(private[from]) != 2 {
+		t.Fatalf("private transaction count mismatch: have %d, want %d", len(private[from]), 2)
+	}
+	// Expire the first one and ensure it's dropped without being announced
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(1), GasLimit: 1000000})
+	if private := pool.Private(); len(private[from]) != 1 || private[from][0].Hash() != published.Hash() {
+		t.Fatalf("private transactions mismatch after first expiry: %v", private[from])
+	}
+	if err := validateEvents(events, 0); err != nil {
+		t.Fatalf("private transaction announced: %v", err)
+	}
+	// Expire the second one and ensure it's published (queued due to the gap)
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(2), GasLimit: 1000000})
+	if private := pool.Private(); len(private) != 0 {
+		t.Fatalf("private transactions left after second expiry: %v", private)
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 1 {
+		t.Fatalf("published transaction mismatch: pending %d, queued %d, want %d, %d", pending, queued, 0, 1)
+	}
+	if pool.Get(published.Hash()) == nil {
+		t.Fatalf("published transaction missing from the public pool")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the number of private transactions of a single account is limited.
+func TestTransactionPrivateAccountLimit(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	for i := 0; i < maxPrivateAccountTxs; i++ {
+		if err := pool.AddPrivate(transaction(uint64(i), 100000, key), 1, false); err != nil {
+			t.Fatalf("failed to add private transaction %d: %v", i, err)
+		}
+	}
+	if err := pool.AddPrivate(transaction(maxPrivateAccountTxs, 100000, key), 1, false); err != ErrPrivateAccountLimit {
+		t.Fatalf("private transaction limit error mismatch: have %v, want %v", err, ErrPrivateAccountLimit)
+	}
+}
+
+// Tests that included private transactions are kept private if reorged out,
+// instead of being reinjected into the public pool.
+func TestTransactionPrivateReorg(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	private := newTxPrivatePool()
+	tx := transaction(0, 100000, key)
+	if err := private.add(tx, from, 10, true); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	// Include the transaction and reorg it out again
+	statedb.SetNonce(from, 1)
+	if publics := private.prune(1, statedb); len(publics) != 0 {
+		t.Fatalf("included private transaction published")
+	}
+	if private.get(tx.Hash()) != nil {
+		t.Fatalf("included private transaction not pruned")
+	}
+	public := transaction(1, 100000, key)
+	if remains := private.restore(types.Transactions{tx, public}); len(remains) != 1 || remains[0] != public {
+		t.Fatalf("reorged transactions mismatch: have %v, want %v", remains, types.Transactions{public})
+	}
+	if private.get(tx.Hash()) == nil {
+		t.Fatalf("reorged private transaction not restored")
+	}
+	// Private transactions included deeper than any reorg are forgotten
+	private.prune(1, statedb)
+	private.prune(2+privateReorgDepth, statedb)
+	if remains := private.restore(types.Transactions{tx}); len(remains) != 1 {
+		t.Fatalf("deeply included private transaction still tracked")
+	}
+}
+
+// Tests that conditional transactions are rejected if their conditions don't hold
+// on submission, and dropped once they expire or the miner reports them unmet.
+func TestTransactionConditional(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	key2, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key2.PublicKey), big.NewInt(1000000000))
+
+	var (
+		contract       = common.HexToAddress("0xc0ffee")
+		slot           = common.HexToHash("0x01")
+		value          = common.HexToHash("0x02")
+		zero, one, two = uint64(0), uint64(1), uint64(2)
+
+		met   = map[common.Address]map[common.Hash]common.Hash{contract: {slot: value}}
+		unmet = map[common.Address]map[common.Hash]common.Hash{contract: {slot: common.HexToHash("0x03")}}
+
+		bounded = transaction(0, 100000, key)
+		set     = transaction(0, 100000, key2)
+	)
+	pool.currentState.SetState(contract, slot, value)
+
+	// Ensure contradicting, expired and unmet conditions are rejected
+	if err := pool.AddConditional(bounded, &TxConditions{BlockNumberMin: &two, BlockNumberMax: &one}); !errors.Is(err, ErrConditionsInvalid) {
+		t.Fatalf("invalid conditions error mismatch: have %v, want %v", err, ErrConditionsInvalid)
+	}
+	if err := pool.AddConditional(bounded, &TxConditions{BlockNumberMax: &zero}); !errors.Is(err, ErrConditionsExpired) {
+		t.Fatalf("expired conditions error mismatch: have %v, want %v", err, ErrConditionsExpired)
+	}
+	huge := map[common.Address]map[common.Hash]common.Hash{contract: make(map[common.Hash]common.Hash)}
+	for i := 0; i <= maxConditionSlots; i++ {
+		huge[contract][common.BigToHash(big.NewInt(int64(i)))] = common.Hash{}
+	}
+	if err := pool.AddConditional(set, &TxConditions{KnownAccounts: huge}); !errors.Is(err, ErrConditionsInvalid) {
+		t.Fatalf("oversized conditions error mismatch: have %v, want %v", err, ErrConditionsInvalid)
+	}
+	if err := pool.AddConditional(set, &TxConditions{KnownAccounts: unmet}); !errors.Is(err, ErrConditionsUnmet) {
+		t.Fatalf("unmet conditions error mismatch: have %v, want %v", err, ErrConditionsUnmet)
+	}
+	if pending, _ := pool.Stats(); pending != 0 {
+		t.Fatalf("rejected transactions pooled: %d", pending)
+	}
+	// Add one transaction bound by block number and one bound by storage
+	if err := pool.AddConditional(bounded, &TxConditions{BlockNumberMax: &two}); err != nil {
+		t.Fatalf("failed to add block bound transaction: %v", err)
+	}
+	if err := pool.AddConditional(set, &TxConditions{KnownAccounts: met}); err != nil {
+		t.Fatalf("failed to add storage bound transaction: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 2 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 2)
+	}
+	if pool.Conditions(bounded.Hash()) == nil || pool.Conditions(set.Hash()) == nil {
+		t.Fatalf("transaction conditions not tracked")
+	}
+	if pool.locals.contains(crypto.PubkeyToAddress(key.PublicKey)) || pool.locals.contains(crypto.PubkeyToAddress(key2.PublicKey)) {
+		t.Fatalf("conditional transaction senders marked local")
+	}
+	if stored := pool.stored(); len(stored) != 0 {
+		t.Fatalf("conditional transactions persisted: %d", len(stored))
+	}
+	// Pass the block range and ensure only the block bound transaction is dropped
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(2), GasLimit: 1000000})
+	if pool.Get(bounded.Hash()) != nil || pool.Conditions(bounded.Hash()) != nil {
+		t.Fatalf("block bound transaction not dropped")
+	}
+	if pool.Get(set.Hash()) == nil {
+		t.Fatalf("storage bound transaction dropped")
+	}
+	if conds := pool.AllConditions(); len(conds) != 1 || conds[set.Hash()] == nil {
+		t.Fatalf("condition snapshot mismatch: have %v", conds)
+	}
+	// Storage is checked by the miner against the pending state, ensure resets
+	// keep the transaction and only an explicit drop removes it
+	pool.currentState.SetState(contract, slot, common.HexToHash("0x03"))
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(2), GasLimit: 1000000})
+	if pool.Get(set.Hash()) == nil {
+		t.Fatalf("storage bound transaction dropped on reset")
+	}
+	pool.DropConditional([]common.Hash{set.Hash(), bounded.Hash()})
+	if pool.Get(set.Hash()) != nil || pool.Conditions(set.Hash()) != nil {
+		t.Fatalf("storage bound transaction not dropped")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 // TestTransactionStatusCheck tests that the pool can correctly retrieve the
 // pending status of individual transactions.
 func TestTransactionStatusCheck(t *testing.T) {
@@ -0,0 +1,194 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// maxPrivateTxs is the maximum number of private transactions tracked at once.
+	maxPrivateTxs = 1024
+
+	// maxPrivateAccountTxs is the maximum number of private transactions tracked
+	// at once from a single account.
+	maxPrivateAccountTxs = 16
+
+	// MaxPrivateTxBlocks is the maximum number of blocks a private transaction may
+	// wait for inclusion before expiring.
+	MaxPrivateTxBlocks = 256
+
+	// privateReorgDepth is the number of blocks included private transactions are
+	// remembered for, to keep them private if reorged out. It matches the deepest
+	// reorg the pool reinjects transactions from.
+	privateReorgDepth = 64
+)
+
+var (
+	// ErrPrivatePoolFull is returned if a private transaction is submitted while
+	// the private pool already tracks the maximum allowed number of them.
+	ErrPrivatePoolFull = errors.New("private transaction pool is full")
+
+	// ErrPrivateAccountLimit is returned if a private transaction is submitted while
+	// the private pool already tracks the maximum allowed number of them from the
+	// same account.
+	ErrPrivateAccountLimit = errors.New("private transaction limit of account reached")
+
+	// ErrPrivateNoExpiry is returned if a private transaction is submitted without
+	// allowing it to wait for any blocks.
+	ErrPrivateNoExpiry = errors.New("private transaction must wait for at least one block")
+
+	// ErrPrivateExpiryTooFar is returned if a private transaction is submitted with
+	// a waiting period longer than the maximum allowed.
+	ErrPrivateExpiryTooFar = errors.New("private transaction waiting period too long")
+)
+
+// privateTx is a transaction submitted for inclusion by the local miner only,
+// which is never announced to the network while private.
+type privateTx struct {
+	tx     *types.Transaction
+	from   common.Address
+	expiry uint64 // Last block number the transaction may be included privately in
+	public bool   // Whether to add the transaction to the public pool once expired
+	mined  uint64 // Block number the transaction was seen included at (if done)
+}
+
+// txPrivatePool is the set of private transactions, kept apart from the pending
+// and queued ones so that none of the broadcast, announcement or retrieval paths
+// of the public pool ever get to see them.
+type txPrivatePool struct {
+	txs      map[common.Hash]*privateTx
+	accounts map[common.Address]int     // Number of private transactions per sender
+	mined    map[common.Hash]*privateTx // Recently included private transactions
+}
+
+// newTxPrivatePool creates a new empty private transaction set.
+func newTxPrivatePool() *txPrivatePool {
+	return &txPrivatePool{
+		txs:      make(map[common.Hash]*privateTx),
+		accounts: make(map[common.Address]int),
+		mined:    make(map[common.Hash]*privateTx),
+	}
+}
+
+// get returns a private transaction if it exists in the set, or nil if not.
+func (p *txPrivatePool) get(hash common.Hash) *types.Transaction {
+	if ptx := p.txs[hash]; ptx != nil {
+		return ptx.tx
+	}
+	return nil
+}
+
+// add inserts a new private transaction into the set.
+func (p *txPrivatePool) add(tx *types.Transaction, from common.Address, expiry uint64, public bool) error {
+	if len(p.txs) >= maxPrivateTxs {
+		return ErrPrivatePoolFull
+	}
+	if p.accounts[from] >= maxPrivateAccountTxs {
+		return ErrPrivateAccountLimit
+	}
+	p.insert(&privateTx{tx: tx, from: from, expiry: expiry, public: public})
+	return nil
+}
+
+// insert adds a private transaction to the set, without any limit checks.
+func (p *txPrivatePool) insert(ptx *privateTx) {
+	p.txs[ptx.tx.Hash()] = ptx
+	p.accounts[ptx.from]++
+}
+
+// remove deletes a private transaction from the set.
+func (p *txPrivatePool) remove(hash common.Hash) {
+	ptx := p.txs[hash]
+	delete(p.txs, hash)
+
+	if p.accounts[ptx.from]--; p.accounts[ptx.from] == 0 {
+		delete(p.accounts, ptx.from)
+	}
+}
+
+// flatten returns the private transactions grouped by sender and sorted by nonce.
+func (p *txPrivatePool) flatten() map[common.Address]types.Transactions {
+	txs := make(map[common.Address]types.Transactions)
+	for _, ptx := range p.txs {
+		txs[ptx.from] = append(txs[ptx.from], ptx.tx)
+	}
+	for _, list := range txs {
+		sort.Sort(types.TxByNonce(list))
+	}
+	return txs
+}
+
+// prune drops all the private transactions made stale by a new head block: the
+// ones with a nonce already used up and the ones which weren't included before
+// their expiry. The expired transactions that should become public are returned.
+//
+// The transactions with a used up nonce are remembered for a while, as they were
+// likely included and must not become public if that block is reorged out.
+func (p *txPrivatePool) prune(number uint64, statedb *state.StateDB) types.Transactions {
+	for hash, ptx := range p.mined {
+		if ptx.mined+privateReorgDepth < number {
+			delete(p.mined, hash)
+		}
+	}
+	var publics types.Transactions
+	for hash, ptx := range p.txs {
+		if ptx.tx.Nonce() < statedb.GetNonce(ptx.from) {
+			p.remove(hash)
+			ptx.mined, p.mined[hash] = number, ptx
+			continue
+		}
+		if number >= ptx.expiry {
+			p.remove(hash)
+			if ptx.public {
+				log.Debug("Publishing expired private transaction", "hash", hash)
+				publics = append(publics, ptx.tx)
+			} else {
+				log.Debug("Dropping expired private transaction", "hash", hash)
+			}
+		}
+	}
+	return publics
+}
+
+// restore filters the private transactions out of a set of transactions reorged
+// out of the chain, adding them back to the private set instead.
+func (p *txPrivatePool) restore(txs types.Transactions) types.Transactions {
+	if len(p.mined) == 0 {
+		return txs
+	}
+	var remains types.Transactions
+	for _, tx := range txs {
+		hash := tx.Hash()
+		if ptx := p.mined[hash]; ptx != nil {
+			delete(p.mined, hash)
+			if p.txs[hash] == nil {
+				log.Debug("Restoring reorged private transaction", "hash", hash)
+				p.insert(ptx)
+			}
+			continue
+		}
+		remains = append(remains, tx)
+	}
+	return remains
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// txStoreEntry is a transaction persisted in the pool store, along with the
+// metadata needed to restore it.
+type txStoreEntry struct {
+	Tx    *types.Transaction
+	Time  uint64 // Time the transaction was first seen, in unix nanoseconds
+	Local bool   // Whether the transaction was submitted locally
+}
+
+// txStore is a rotating log of all the transactions in the pool, both remote
+// and local ones, pending and queued, to allow them to survive node restarts.
+// Unlike the local journal, removals aren't tracked: the log is periodically
+// compacted and stale entries are filtered out by revalidation when loading.
+type txStore struct {
+	path   string         // Filesystem path to store the transactions at
+	writer io.WriteCloser // Output stream to write new transactions into
+}
+
+// newTxStore creates a new pool transaction store.
+func newTxStore(path string) *txStore {
+	return &txStore{
+		path: path,
+	}
+}
+
+// load parses a transaction store dump from disk, loading its contents into
+// the pool via the specified callback, in batches. The transactions have their
+// original arrival time restored.
+func (store *txStore) load(add func(txs []*types.Transaction, local bool) []error) error {
+	// Skip the parsing if the store file doesn't exist at all
+	if _, err := os.Stat(store.path); os.IsNotExist(err) {
+		return nil
+	}
+	input, err := os.Open(store.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// Temporarily discard any store additions (don't double add on load)
+	store.writer = new(devNull)
+	defer func() { store.writer = nil }()
+
+	var (
+		stream  = rlp.NewStream(input, 0)
+		total   int
+		dropped int
+		failure error
+		locals  types.Transactions
+		remotes types.Transactions
+	)
+	loadBatch := func(txs types.Transactions, local bool) {
+		for _, err := range add(txs, local) {
+			if err != nil {
+				log.Debug("Failed to add stored transaction", "err", err)
+				dropped++
+			}
+		}
+	}
+	for {
+		entry := new(txStoreEntry)
+		if err = stream.Decode(entry); err != nil {
+			if err != io.EOF {
+				failure = err
+			}
+			break
+		}
+		total++
+		entry.Tx.SetTime(time.Unix(0, int64(entry.Time)))
+
+		// Keep the locals and remotes apart, they are subject to different rules
+		if entry.Local {
+			if locals = append(locals, entry.Tx); locals.Len() > 1024 {
+				loadBatch(locals, true)
+				locals = locals[:0]
+			}
+		} else {
+			if remotes = append(remotes, entry.Tx); remotes.Len() > 1024 {
+				loadBatch(remotes, false)
+				remotes = remotes[:0]
+			}
+		}
+	}
+	if locals.Len() > 0 {
+		loadBatch(locals, true)
+	}
+	if remotes.Len() > 0 {
+		loadBatch(remotes, false)
+	}
+	log.Info("Loaded transaction pool store", "transactions", total, "dropped", dropped)
+
+	return failure
+}
+
+// insert adds the specified transaction to the store.
+func (store *txStore) insert(tx *types.Transaction, local bool) error {
+	if store.writer == nil {
+		return errNoActiveJournal
+	}
+	return rlp.Encode(store.writer, &txStoreEntry{Tx: tx, Time: uint64(tx.Time().UnixNano()), Local: local})
+}
+
+// rotate compacts the transaction store, regenerating it from the current
+// contents of the transaction pool.
+func (store *txStore) rotate(entries []*txStoreEntry) error {
+	// Close the current store (if any is open)
+	if store.writer != nil {
+		if err := store.writer.Close(); err != nil {
+			return err
+		}
+		store.writer = nil
+	}
+	// Generate a new store with the contents of the current pool
+	replacement, err := os.OpenFile(store.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err = rlp.Encode(replacement, entry); err != nil {
+			replacement.Close()
+			return err
+		}
+	}
+	replacement.Close()
+
+	// Replace the live store with the newly generated one
+	if err = os.Rename(store.path+".new", store.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		return err
+	}
+	store.writer = sink
+	log.Info("Compacted transaction pool store", "transactions", len(entries))
+
+	return nil
+}
+
+// close flushes the transaction store contents to disk and closes the file.
+func (store *txStore) close() error {
+	var err error
+
+	if store.writer != nil {
+		err = store.writer.Close()
+		store.writer = nil
+	}
+	return err
+}
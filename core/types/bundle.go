@@ -0,0 +1,56 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Bundle is an ordered list of transactions that must be included in a block
+// atomically: either all of them are executed successfully, in order and back
+// to back, or none of them are included.
+type Bundle struct {
+	Txs          Transactions // Transactions to include, in order
+	BlockNumber  uint64       // Number of the block the bundle is valid for
+	MinTimestamp uint64       // Minimum block timestamp, zero if unbounded
+	MaxTimestamp uint64       // Maximum block timestamp, zero if unbounded
+}
+
+// Hash returns the identifier of the bundle, the hash of its transaction hashes.
+func (b *Bundle) Hash() common.Hash {
+	hashes := make([][]byte, len(b.Txs))
+	for i, tx := range b.Txs {
+		hashes[i] = tx.Hash().Bytes()
+	}
+	return crypto.Keccak256Hash(hashes...)
+}
+
+// Eligible reports whether the bundle may be included in a block with the given
+// number and timestamp.
+func (b *Bundle) Eligible(number uint64, time uint64) bool {
+	if b.BlockNumber != number {
+		return false
+	}
+	if b.MinTimestamp != 0 && time < b.MinTimestamp {
+		return false
+	}
+	if b.MaxTimestamp != 0 && time > b.MaxTimestamp {
+		return false
+	}
+	return true
+}
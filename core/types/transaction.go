@@ -301,6 +301,18 @@ func (tx *Transaction) GasPriceIntCmp(other *big.Int) int {
 	return tx.inner.gasPrice().Cmp(other)
 }
 
+// Time returns the time when the transaction was first seen locally. It is used
+// as a heuristic to prefer older transactions if everything else is equal.
+func (tx *Transaction) Time() time.Time {
+	return tx.time
+}
+
+// SetTime overrides the time the transaction was first seen locally, used when
+// restoring transactions persisted to disk.
+func (tx *Transaction) SetTime(t time.Time) {
+	tx.time = t
+}
+
 // Hash returns the transaction hash.
 func (tx *Transaction) Hash() common.Hash {
 	if hash := tx.hash.Load(); hash != nil {
@@ -38,6 +38,8 @@ type Config struct {
 	EVMInterpreter   string // External EVM interpreter options
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	ParallelExecution int // Number of workers executing block transactions speculatively (0 = sequential)
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -91,6 +92,7 @@ var (
 	errNoSyncActive            = errors.New("no sync active")
 	errTooOld                  = errors.New("peer's protocol version too old")
 	errNoAncestorFound         = errors.New("no common ancestor found")
+	errTargetSyncMode          = errors.New("sync target requires full sync")
 )
 
 type Downloader struct {
@@ -104,19 +106,25 @@ type Downloader struct {
 	mode uint32         // Synchronisation mode defining the strategy used (per sync cycle), use d.getMode() to get the SyncMode
 	mux  *event.TypeMux // Event multiplexer to announce sync operation events
 
-	checkpoint uint64   // Checkpoint block number to enforce head against (e.g. fast sync)
-	genesis    uint64   // Genesis block number to limit sync to (e.g. light client CHT)
-	queue      *queue   // Scheduler for selecting the hashes to download
-	peers      *peerSet // Set of active peers from which download can proceed
+	checkpoint uint64      // Checkpoint block number to enforce head against (e.g. fast sync)
+	genesis    uint64      // Genesis block number to limit sync to (e.g. light client CHT)
+	target     common.Hash // Trusted block to sync to, rejecting chains without it
+	queue      *queue      // Scheduler for selecting the hashes to download
+	peers      *peerSet    // Set of active peers from which download can proceed
 
 	stateDB    ethdb.Database  // Database to state sync into (and deduplicate via)
 	stateBloom *trie.SyncBloom // Bloom filter for fast trie node and contract code existence checks
 
 	// Statistics
-	syncStatsChainOrigin uint64 // Origin block number where syncing started at
-	syncStatsChainHeight uint64 // Highest block number known when syncing started
-	syncStatsState       stateSyncStats
-	syncStatsLock        sync.RWMutex // Lock protecting the sync stats fields
+	syncStatsChainOrigin   uint64 // Origin block number where syncing started at
+	syncStatsChainHeight   uint64 // Highest block number known when syncing started
+	syncStatsState         stateSyncStats
+	syncStatsTarget        uint64       // Block number of the sync target
+	syncStatsTargetHeaders uint64       // Number of headers retrieved backwards from the sync target
+	syncStatsLock          sync.RWMutex // Lock protecting the sync stats fields
+
+	peerStatsCount int        // Number of peers with persisted download statistics
+	peerStatsLock  sync.Mutex // Lock protecting the persisted peer statistics
 
 	lightchain LightChain
 	blockchain BlockChain
@@ -139,6 +147,9 @@ type Downloader struct {
 	receiptWakeCh chan bool            // Channel to signal the receipt fetcher of new tasks
 	headerProcCh  chan []*types.Header // Channel to feed the header processor new tasks
 
+	// Sync target
+	targetChain *targetChain // Chain segment of the sync target, set while syncing to it
+
 	// State sync
 	pivotHeader *types.Header // Pivot block header to dynamically push the syncing state root
 	pivotLock   sync.RWMutex  // Lock protecting pivot header reads from updates
@@ -247,6 +258,8 @@ func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom,
 		},
 		trackStateReq: make(chan *stateReq),
 	}
+	dl.prunePeerStats()
+
 	go dl.qosTuner()
 	go dl.stateFetcher()
 	return dl
@@ -282,6 +295,8 @@ func (d *Downloader) Progress() ethereum.SyncProgress {
 		HighestBlock:  d.syncStatsChainHeight,
 		PulledStates:  d.syncStatsState.processed,
 		KnownStates:   d.syncStatsState.processed + d.syncStatsState.pending,
+		TargetBlock:   d.syncStatsTarget,
+		TargetHeaders: d.syncStatsTargetHeaders,
 	}
 }
 
@@ -301,7 +316,9 @@ func (d *Downloader) RegisterPeer(id string, version uint, peer Peer) error {
 		logger = log.New("peer", id[:8])
 	}
 	logger.Trace("Registering sync peer")
-	if err := d.peers.Register(newPeerConnection(id, version, peer, logger)); err != nil {
+	conn := newPeerConnection(id, version, peer, logger)
+	conn.stats = d.loadPeerStats(id)
+	if err := d.peers.Register(conn); err != nil {
 		logger.Error("Failed to register sync peer", "err", err)
 		return err
 	}
@@ -328,11 +345,13 @@ func (d *Downloader) UnregisterPeer(id string) error {
 		logger = log.New("peer", id[:8])
 	}
 	logger.Trace("Unregistering sync peer")
+	p := d.peers.Peer(id)
 	if err := d.peers.Unregister(id); err != nil {
 		logger.Error("Failed to unregister sync peer", "err", err)
 		return err
 	}
 	d.queue.Revoke(id)
+	d.storePeerStats(p)
 
 	return nil
 }
@@ -355,7 +374,7 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 			// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
 			log.Warn("Downloader wants to drop peer, but peerdrop-function is not set", "peer", id)
 		} else {
-			d.dropPeer(id)
+			d.dropPeer(id, dropPenalty(err))
 		}
 		return err
 	}
@@ -363,6 +382,23 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 	return err
 }
 
+// dropPenalty returns the penalty to charge a peer dropped for the given sync
+// failure. Peers merely lacking the data needed aren't at fault, so they are
+// dropped without penalty.
+func dropPenalty(err error) p2p.Penalty {
+	switch {
+	case errors.Is(err, errInvalidChain), errors.Is(err, errInvalidAncestor):
+		return p2p.PenaltyInvalidBlock
+	case errors.Is(err, errTimeout), errors.Is(err, errStallingPeer):
+		return p2p.PenaltyTimeout
+	case errors.Is(err, errBadPeer), errors.Is(err, errEmptyHeaderSet):
+		return p2p.PenaltyUselessResponse
+	default:
+		// errUnsyncedPeer, errPeersUnavailable and errTooOld
+		return 0
+	}
+}
+
 // synchronise will select the peer and use it for synchronising. If an empty string is given
 // it will use the best peer possible and synchronize if its TD is higher than our own. If any of the
 // checks fail an error will be returned. This method is synchronous
@@ -469,10 +505,33 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		log.Debug("Synchronisation terminated", "elapsed", common.PrettyDuration(time.Since(start)))
 	}(time.Now())
 
-	// Look up the sync boundaries: the common ancestor and the target block
-	latest, pivot, err := d.fetchHead(p)
-	if err != nil {
-		return err
+	// Look up the sync boundaries: the common ancestor and the target block. If
+	// a trusted sync target is configured but not yet imported, the boundaries
+	// are given by its chain instead of the peer's head.
+	var (
+		latest, pivot *types.Header
+		origin        uint64
+	)
+	if _, reached := d.targetReached(mode); d.target != (common.Hash{}) && !reached {
+		chain, err := d.fetchTarget(p)
+		if err != nil {
+			return err
+		}
+		latest, origin = chain.header, chain.origin
+
+		// The sync deliberately stops below the head of the peer, so its TD
+		// promise can't be checked. Its chain up to the target was retrieved
+		// and verified instead.
+		td = nil
+		d.targetChain = chain
+		defer func() { d.targetChain = nil }()
+	} else {
+		if latest, pivot, err = d.fetchHead(p); err != nil {
+			return err
+		}
+		if origin, err = d.findAncestor(p, latest); err != nil {
+			return err
+		}
 	}
 	if mode == FastSync && pivot == nil {
 		// If no pivot block was returned, the head is below the min full block
@@ -483,10 +542,6 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	}
 	height := latest.Number.Uint64()
 
-	origin, err := d.findAncestor(p, latest)
-	if err != nil {
-		return err
-	}
 	d.syncStatsLock.Lock()
 	if d.syncStatsChainHeight <= origin || d.syncStatsChainOrigin > origin {
 		d.syncStatsChainOrigin = origin
@@ -562,6 +617,10 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		func() error { return d.fetchReceipts(origin + 1) }, // Receipts are retrieved during fast sync
 		func() error { return d.processHeaders(origin+1, td) },
 	}
+	if d.targetChain != nil {
+		// The chain of the sync target was already retrieved, don't do it again
+		fetchers[0] = func() error { return d.deliverTargetHeaders(origin + 1) }
+	}
 	if mode == FastSync {
 		d.pivotLock.Lock()
 		d.pivotHeader = pivot
@@ -571,7 +630,15 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	} else if mode == FullSync {
 		fetchers = append(fetchers, d.processFullSyncContent)
 	}
-	return d.spawnSync(fetchers)
+	if err := d.spawnSync(fetchers); err != nil {
+		return err
+	}
+	if d.targetChain != nil {
+		// The target was reached, its stored chain is not needed any more
+		rawdb.DeleteSyncTargetHeaders(d.stateDB)
+		log.Info("Synchronised to sync target", "number", height, "hash", latest.Hash())
+	}
+	return nil
 }
 
 // spawnSync runs d.process and all given fetcher functions to completion in
@@ -643,6 +710,11 @@ func (d *Downloader) Terminate() {
 
 	// Cancel any pending download requests
 	d.Cancel()
+
+	// Persist the statistics of the peers still connected
+	for _, p := range d.peers.AllPeers() {
+		d.storePeerStats(p)
+	}
 }
 
 // fetchHead retrieves the head header and prior pivot block (if available) from
@@ -813,10 +885,15 @@ func (d *Downloader) findAncestor(p *peerConnection, remoteHeader *types.Header)
 			floor = int64(d.genesis) - 1
 		}
 	}
-
 	ancestor, err := d.findAncestorSpanSearch(p, mode, remoteHeight, localHeight, floor)
 	if err == nil {
-		return ancestor, nil
+		// If a sync target was imported, only accept chains extending it. The span
+		// search may skip over the target, so check ancestors below it again.
+		target, reached := d.targetReached(mode)
+		if !reached || ancestor >= target.Number.Uint64() {
+			return ancestor, nil
+		}
+		err = errNoAncestorFound
 	}
 	// The returned error was not nil.
 	// If the error returned does not reflect that a common ancestor was not found, return it.
@@ -826,6 +903,9 @@ func (d *Downloader) findAncestor(p *peerConnection, remoteHeader *types.Header)
 		return 0, err
 	}
 
+	if target, reached := d.targetReached(mode); reached && floor < int64(target.Number.Uint64())-1 {
+		floor = int64(target.Number.Uint64()) - 1
+	}
 	ancestor, err = d.findAncestorBinarySearch(p, mode, remoteHeight, floor)
 	if err != nil {
 		return 0, err
@@ -1215,7 +1295,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 			// Header retrieval timed out, consider the peer bad and drop
 			p.log.Debug("Header request timed out", "elapsed", ttl)
 			headerTimeoutMeter.Mark(1)
-			d.dropPeer(p.id)
+			d.dropPeer(p.id, p2p.PenaltyTimeout)
 
 			// Finish the sync gracefully instead of dumping the gathered data though
 			for _, ch := range []chan bool{d.bodyWakeCh, d.receiptWakeCh} {
@@ -1440,7 +1520,7 @@ func (d *Downloader) fetchParts(deliveryCh chan dataPack, deliver func(dataPack)
 							// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
 							peer.log.Warn("Downloader wants to drop peer, but peerdrop-function is not set", "peer", pid)
 						} else {
-							d.dropPeer(pid)
+							d.dropPeer(pid, p2p.PenaltyTimeout)
 
 							// If this peer was the master peer, abort sync immediately
 							d.cancelLock.RLock()
@@ -1581,7 +1661,9 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 				// L: Sync begins, and finds common ancestor at 11
 				// L: Request new headers up from 11 (R's TD was higher, it must have something)
 				// R: Nothing to give
-				if mode != LightSync {
+				//
+				// When syncing to a target, there is no TD to check.
+				if mode != LightSync && td != nil {
 					head := d.blockchain.CurrentBlock()
 					if !gotHeaders && td.Cmp(d.blockchain.GetTd(head.Hash(), head.NumberU64())) > 0 {
 						return errStallingPeer
@@ -1594,7 +1676,7 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 				// This check cannot be executed "as is" for full imports, since blocks may still be
 				// queued for processing when the header download completes. However, as long as the
 				// peer gave us something useful, we're already happy/progressed (above check).
-				if mode == FastSync || mode == LightSync {
+				if (mode == FastSync || mode == LightSync) && td != nil {
 					head := d.lightchain.CurrentHeader()
 					if td.Cmp(d.lightchain.GetTd(head.Hash(), head.Number.Uint64())) > 0 {
 						return errStallingPeer
@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -52,6 +53,8 @@ type downloadTester struct {
 	peerDb  ethdb.Database // Database of the peers containing all data
 	peers   map[string]*downloadTesterPeer
 
+	penalties map[string]p2p.Penalty // Penalties charged to the dropped peers
+
 	ownHashes   []common.Hash                  // Hash chain belonging to the tester
 	ownHeaders  map[common.Hash]*types.Header  // Headers belonging to the tester
 	ownBlocks   map[common.Hash]*types.Block   // Blocks belonging to the tester
@@ -72,6 +75,7 @@ func newTester() *downloadTester {
 		genesis:     testGenesis,
 		peerDb:      testDB,
 		peers:       make(map[string]*downloadTesterPeer),
+		penalties:   make(map[string]p2p.Penalty),
 		ownHashes:   []common.Hash{testGenesis.Hash()},
 		ownHeaders:  map[common.Hash]*types.Header{testGenesis.Hash(): testGenesis.Header()},
 		ownBlocks:   map[common.Hash]*types.Block{testGenesis.Hash(): testGenesis},
@@ -400,10 +404,11 @@ func (dl *downloadTester) newPeer(id string, version uint, chain *testChain) err
 }
 
 // dropPeer simulates a hard peer removal from the connection pool.
-func (dl *downloadTester) dropPeer(id string) {
+func (dl *downloadTester) dropPeer(id string, penalty p2p.Penalty) {
 	dl.lock.Lock()
 	defer dl.lock.Unlock()
 
+	dl.penalties[id] += penalty
 	delete(dl.peers, id)
 	dl.downloader.UnregisterPeer(id)
 }
@@ -1168,24 +1173,26 @@ func testBlockHeaderAttackerDropping(t *testing.T, protocol uint) {
 
 	// Define the disconnection requirement for individual hash fetch errors
 	tests := []struct {
-		result error
-		drop   bool
+		result  error
+		drop    bool
+		penalty p2p.Penalty
 	}{
-		{nil, false},                        // Sync succeeded, all is well
-		{errBusy, false},                    // Sync is already in progress, no problem
-		{errUnknownPeer, false},             // Peer is unknown, was already dropped, don't double drop
-		{errBadPeer, true},                  // Peer was deemed bad for some reason, drop it
-		{errStallingPeer, true},             // Peer was detected to be stalling, drop it
-		{errUnsyncedPeer, true},             // Peer was detected to be unsynced, drop it
-		{errNoPeers, false},                 // No peers to download from, soft race, no issue
-		{errTimeout, true},                  // No hashes received in due time, drop the peer
-		{errEmptyHeaderSet, true},           // No headers were returned as a response, drop as it's a dead end
-		{errPeersUnavailable, true},         // Nobody had the advertised blocks, drop the advertiser
-		{errInvalidAncestor, true},          // Agreed upon ancestor is not acceptable, drop the chain rewriter
-		{errInvalidChain, true},             // Hash chain was detected as invalid, definitely drop
-		{errInvalidBody, false},             // A bad peer was detected, but not the sync origin
-		{errInvalidReceipt, false},          // A bad peer was detected, but not the sync origin
-		{errCancelContentProcessing, false}, // Synchronisation was canceled, origin may be innocent, don't drop
+		{nil, false, 0},                                       // Sync succeeded, all is well
+		{errBusy, false, 0},                                   // Sync is already in progress, no problem
+		{errUnknownPeer, false, 0},                            // Peer is unknown, was already dropped, don't double drop
+		{errBadPeer, true, p2p.PenaltyUselessResponse},        // Peer was deemed bad for some reason, drop it
+		{errStallingPeer, true, p2p.PenaltyTimeout},           // Peer was detected to be stalling, drop it
+		{errUnsyncedPeer, true, 0},                            // Peer was detected to be unsynced, drop it, but it's not at fault
+		{errNoPeers, false, 0},                                // No peers to download from, soft race, no issue
+		{errTimeout, true, p2p.PenaltyTimeout},                // No hashes received in due time, drop the peer
+		{errEmptyHeaderSet, true, p2p.PenaltyUselessResponse}, // No headers were returned as a response, drop as it's a dead end
+		{errPeersUnavailable, true, 0},                        // Nobody had the advertised blocks, drop the advertiser, but it's not at fault
+		{errTooOld, true, 0},                                  // Peer is on an obsolete protocol, drop it, but it's not at fault
+		{errInvalidAncestor, true, p2p.PenaltyInvalidBlock},   // Agreed upon ancestor is not acceptable, drop the chain rewriter
+		{errInvalidChain, true, p2p.PenaltyInvalidBlock},      // Hash chain was detected as invalid, definitely drop
+		{errInvalidBody, false, 0},                            // A bad peer was detected, but not the sync origin
+		{errInvalidReceipt, false, 0},                         // A bad peer was detected, but not the sync origin
+		{errCancelContentProcessing, false, 0},                // Synchronisation was canceled, origin may be innocent, don't drop
 	}
 	// Run the tests and check disconnection status
 	tester := newTester()
@@ -1208,6 +1215,9 @@ func testBlockHeaderAttackerDropping(t *testing.T, protocol uint) {
 		if _, ok := tester.peers[id]; !ok != tt.drop {
 			t.Errorf("test %d: peer drop mismatch for %v: have %v, want %v", i, tt.result, !ok, tt.drop)
 		}
+		if penalty := tester.penalties[id]; penalty != tt.penalty {
+			t.Errorf("test %d: peer penalty mismatch for %v: have %d, want %d", i, tt.result, penalty, tt.penalty)
+		}
 	}
 }
 
@@ -1736,3 +1746,108 @@ func testCheckpointEnforcement(t *testing.T, protocol uint, mode SyncMode) {
 		assertOwnChain(t, tester, chain.len())
 	}
 }
+
+// Tests that a downloader with a trusted sync target only syncs up to the target,
+// rejects chains not containing it and doesn't reorg below it afterwards.
+func TestSyncTarget65Full(t *testing.T) { testSyncTarget(t, 65, FullSync) }
+func TestSyncTarget66Full(t *testing.T) { testSyncTarget(t, 66, FullSync) }
+
+func testSyncTarget(t *testing.T, protocol uint, mode SyncMode) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Pick a target on the light fork, some way past the fork point
+	chainA := testChainForkLightA.shorten(testChainBase.len() + 200)
+	target := testChainBase.len() + 100
+	tester.downloader.SetTarget(chainA.chain[target])
+
+	// Peers on a different fork don't have the target and must be refused
+	tester.newPeer("fork B", protocol, testChainForkLightB)
+	if err := tester.sync("fork B", nil, mode); !errors.Is(err, errUnsyncedPeer) {
+		t.Fatalf("sync failure mismatch: have %v, want %v", err, errUnsyncedPeer)
+	}
+	assertOwnChain(t, tester, 1)
+
+	// Synchronise with the peer having the target and make sure the sync stops there
+	tester.newPeer("fork A", protocol, chainA)
+	if err := tester.sync("fork A", nil, mode); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, target+1)
+	if progress := tester.downloader.Progress(); progress.TargetBlock != uint64(target) || progress.TargetHeaders != uint64(target) {
+		t.Fatalf("target progress mismatch: have %d/%d, want %d/%d", progress.TargetBlock, progress.TargetHeaders, target, target)
+	}
+	if header := rawdb.ReadSyncTargetHeader(tester.stateDb, uint64(target)); header != nil {
+		t.Fatalf("sync target chain not cleaned up")
+	}
+	// Synchronising past the target works, reorgs below the target are rejected
+	if err := tester.sync("fork A", nil, mode); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, chainA.len())
+
+	tester.newPeer("heavy", protocol, testChainForkHeavy)
+	if err := tester.sync("heavy", nil, mode); err != errInvalidAncestor {
+		t.Fatalf("sync failure mismatch: have %v, want %v", err, errInvalidAncestor)
+	}
+}
+
+// Tests that syncing to a trusted target is refused outside of full sync, as the
+// sync stops at the target and a pivot below it may be too old to sync the state.
+func TestSyncTargetMode(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []SyncMode{FastSync, LightSync} {
+		tester := newTester()
+
+		chain := testChainBase.shorten(200)
+		tester.downloader.SetTarget(chain.chain[100])
+
+		tester.newPeer("peer", 66, chain)
+		if err := tester.sync("peer", nil, mode); err != errTargetSyncMode {
+			t.Errorf("%v: sync failure mismatch: have %v, want %v", mode, err, errTargetSyncMode)
+		}
+		assertOwnChain(t, tester, 1)
+		tester.terminate()
+	}
+}
+
+// Tests that the retrieval of the sync target chain resumes from the headers stored
+// by an interrupted run, instead of retrieving them again.
+func TestSyncTargetResume(t *testing.T) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	chain := testChainBase.shorten(300)
+	target := 250
+	tester.downloader.SetTarget(chain.chain[target])
+
+	// The first peer can't serve the target chain below 80 headers, leaving them
+	// stored after the failed sync
+	partial := chain.shorten(chain.len())
+	for i := 0; i < target-80; i++ {
+		delete(partial.headerm, partial.chain[i])
+	}
+	tester.newPeer("partial", 66, partial)
+	if err := tester.sync("partial", nil, FullSync); !errors.Is(err, errBadPeer) {
+		t.Fatalf("sync failure mismatch: have %v, want %v", err, errBadPeer)
+	}
+	if header := rawdb.ReadSyncTargetHeader(tester.stateDb, uint64(target-80)); header == nil {
+		t.Fatalf("sync target chain not stored")
+	}
+	// The second peer lacks the headers just below the target, which can only be
+	// taken from the first run
+	gapped := chain.shorten(chain.len())
+	for i := target - 50; i < target; i++ {
+		delete(gapped.headerm, gapped.chain[i])
+	}
+	tester.newPeer("gapped", 66, gapped)
+	if err := tester.sync("gapped", nil, FullSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, target+1)
+}
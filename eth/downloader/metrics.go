@@ -42,4 +42,7 @@ var (
 	stateDropMeter = metrics.NewRegisteredMeter("eth/downloader/states/drop", nil)
 
 	throttleCounter = metrics.NewRegisteredCounter("eth/downloader/throttle", nil)
+
+	peerStatsGauge      = metrics.NewRegisteredGauge("eth/downloader/peerstats/tracked", nil)
+	peerStatsKnownMeter = metrics.NewRegisteredMeter("eth/downloader/peerstats/known", nil)
 )
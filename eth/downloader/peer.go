@@ -67,6 +67,7 @@ type peerConnection struct {
 	stateStarted   time.Time // Time instance when the last node data fetch was started
 
 	lacking map[common.Hash]struct{} // Set of hashes not to request (didn't have previously)
+	stats   PeerStats                // Download statistics, persisted across connections
 
 	peer Peer
 
@@ -212,39 +213,42 @@ func (p *peerConnection) FetchNodeData(hashes []common.Hash) error {
 // requests. Its estimated header retrieval throughput is updated with that measured
 // just now.
 func (p *peerConnection) SetHeadersIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.headerStarted), delivered, &p.headerThroughput, &p.headerIdle)
+	p.setIdle(deliveryTime.Sub(p.headerStarted), delivered, &p.headerThroughput, &p.stats.Headers, &p.headerIdle)
 }
 
 // SetBodiesIdle sets the peer to idle, allowing it to execute block body retrieval
 // requests. Its estimated body retrieval throughput is updated with that measured
 // just now.
 func (p *peerConnection) SetBodiesIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.blockStarted), delivered, &p.blockThroughput, &p.blockIdle)
+	p.setIdle(deliveryTime.Sub(p.blockStarted), delivered, &p.blockThroughput, &p.stats.Bodies, &p.blockIdle)
 }
 
 // SetReceiptsIdle sets the peer to idle, allowing it to execute new receipt
 // retrieval requests. Its estimated receipt retrieval throughput is updated
 // with that measured just now.
 func (p *peerConnection) SetReceiptsIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.receiptStarted), delivered, &p.receiptThroughput, &p.receiptIdle)
+	p.setIdle(deliveryTime.Sub(p.receiptStarted), delivered, &p.receiptThroughput, &p.stats.Receipts, &p.receiptIdle)
 }
 
 // SetNodeDataIdle sets the peer to idle, allowing it to execute new state trie
 // data retrieval requests. Its estimated state retrieval throughput is updated
 // with that measured just now.
 func (p *peerConnection) SetNodeDataIdle(delivered int, deliveryTime time.Time) {
-	p.setIdle(deliveryTime.Sub(p.stateStarted), delivered, &p.stateThroughput, &p.stateIdle)
+	p.setIdle(deliveryTime.Sub(p.stateStarted), delivered, &p.stateThroughput, &p.stats.States, &p.stateIdle)
 }
 
 // setIdle sets the peer to idle, allowing it to execute new retrieval requests.
-// Its estimated retrieval throughput is updated with that measured just now.
-func (p *peerConnection) setIdle(elapsed time.Duration, delivered int, throughput *float64, idle *int32) {
+// Its estimated retrieval throughput and long term statistics are updated with
+// that measured just now.
+func (p *peerConnection) setIdle(elapsed time.Duration, delivered int, throughput *float64, stats *RequestStats, idle *int32) {
 	// Irrelevant of the scaling, make sure the peer ends up idle
 	defer atomic.StoreInt32(idle, 0)
 
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
+	stats.update(elapsed, delivered)
+
 	// If nothing was delivered (hard timeout / unavailable data), reduce throughput to minimum
 	if delivered == 0 {
 		*throughput = 0
@@ -396,6 +400,19 @@ func (ps *peerSet) Register(p *peerConnection) error {
 		p.receiptThroughput /= float64(len(ps.peers))
 		p.stateThroughput /= float64(len(ps.peers))
 	}
+	// Peers seen before start off with their historical throughput instead
+	if p.stats.Headers.Items > 0 {
+		p.headerThroughput = p.stats.Headers.Throughput
+	}
+	if p.stats.Bodies.Items > 0 {
+		p.blockThroughput = p.stats.Bodies.Throughput
+	}
+	if p.stats.Receipts.Items > 0 {
+		p.receiptThroughput = p.stats.Receipts.Throughput
+	}
+	if p.stats.States.Items > 0 {
+		p.stateThroughput = p.stats.States.Throughput
+	}
 	ps.peers[p.id] = p
 	ps.lock.Unlock()
 
@@ -448,7 +465,8 @@ func (ps *peerSet) AllPeers() []*peerConnection {
 }
 
 // HeaderIdlePeers retrieves a flat list of all the currently header-idle peers
-// within the active peer set, ordered by their reputation.
+// within the active peer set, ordered by their reputation (throughput weighted
+// by the fraction of requests answered).
 func (ps *peerSet) HeaderIdlePeers() ([]*peerConnection, int) {
 	idle := func(p *peerConnection) bool {
 		return atomic.LoadInt32(&p.headerIdle) == 0
@@ -456,7 +474,7 @@ func (ps *peerSet) HeaderIdlePeers() ([]*peerConnection, int) {
 	throughput := func(p *peerConnection) float64 {
 		p.lock.RLock()
 		defer p.lock.RUnlock()
-		return p.headerThroughput
+		return p.headerThroughput * p.stats.Headers.reliability()
 	}
 	return ps.idlePeers(eth.ETH64, eth.ETH66, idle, throughput)
 }
@@ -470,7 +488,7 @@ func (ps *peerSet) BodyIdlePeers() ([]*peerConnection, int) {
 	throughput := func(p *peerConnection) float64 {
 		p.lock.RLock()
 		defer p.lock.RUnlock()
-		return p.blockThroughput
+		return p.blockThroughput * p.stats.Bodies.reliability()
 	}
 	return ps.idlePeers(eth.ETH64, eth.ETH66, idle, throughput)
 }
@@ -484,7 +502,7 @@ func (ps *peerSet) ReceiptIdlePeers() ([]*peerConnection, int) {
 	throughput := func(p *peerConnection) float64 {
 		p.lock.RLock()
 		defer p.lock.RUnlock()
-		return p.receiptThroughput
+		return p.receiptThroughput * p.stats.Receipts.reliability()
 	}
 	return ps.idlePeers(eth.ETH64, eth.ETH66, idle, throughput)
 }
@@ -498,7 +516,7 @@ func (ps *peerSet) NodeDataIdlePeers() ([]*peerConnection, int) {
 	throughput := func(p *peerConnection) float64 {
 		p.lock.RLock()
 		defer p.lock.RUnlock()
-		return p.stateThroughput
+		return p.stateThroughput * p.stats.States.reliability()
 	}
 	return ps.idlePeers(eth.ETH64, eth.ETH66, idle, throughput)
 }
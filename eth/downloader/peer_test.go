@@ -17,8 +17,14 @@
 package downloader
 
 import (
+	"encoding/json"
+	"fmt"
 	"sort"
 	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 )
 
 func TestPeerThroughputSorting(t *testing.T) {
@@ -51,3 +57,97 @@ func TestPeerThroughputSorting(t *testing.T) {
 	}
 
 }
+
+// Tests that the download statistics of a peer are persisted when it disconnects
+// and restored when it connects again.
+func TestPeerStatsPersistence(t *testing.T) {
+	tester := newTester()
+	defer tester.terminate()
+
+	tester.newPeer("peer", eth.ETH66, testChainBase)
+	p := tester.downloader.peers.Peer("peer")
+	p.headerStarted = time.Now()
+	p.SetHeadersIdle(100, p.headerStarted.Add(time.Second))
+	p.blockStarted = time.Now()
+	p.SetBodiesIdle(0, p.blockStarted.Add(time.Second))
+
+	tester.dropPeer("peer", 0)
+	if blob := rawdb.ReadPeerSyncStats(tester.stateDb, "peer"); len(blob) == 0 {
+		t.Fatalf("peer statistics not persisted")
+	}
+	// Connect the peer again, it should be starting off with its history
+	tester.newPeer("other", eth.ETH66, testChainBase)
+	tester.newPeer("peer", eth.ETH66, testChainBase)
+
+	stats := tester.downloader.PeerStats("peer")
+	if stats.Headers.Requests != 1 || stats.Headers.Items != 100 || stats.Headers.Throughput != 100 {
+		t.Errorf("header statistics mismatch: have %+v", stats.Headers)
+	}
+	if stats.Bodies.Requests != 1 || stats.Bodies.Failures != 1 {
+		t.Errorf("body statistics mismatch: have %+v", stats.Bodies)
+	}
+	if p := tester.downloader.peers.Peer("peer"); p.headerThroughput != 100 {
+		t.Errorf("header throughput not restored: have %v, want %v", p.headerThroughput, 100)
+	}
+}
+
+// Tests that the statistics of peers not seen for a long time are dropped.
+func TestPeerStatsExpiry(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+
+	fresh, _ := json.Marshal(&PeerStats{LastSeen: uint64(time.Now().Unix())})
+	stale, _ := json.Marshal(&PeerStats{LastSeen: uint64(time.Now().Add(-peerStatsExpiry - time.Hour).Unix())})
+	rawdb.WritePeerSyncStats(db, "fresh", fresh)
+	rawdb.WritePeerSyncStats(db, "stale", stale)
+
+	New(0, db, nil, nil, nil, nil, nil).Terminate()
+
+	if blob := rawdb.ReadPeerSyncStats(db, "fresh"); len(blob) == 0 {
+		t.Errorf("recent peer statistics dropped")
+	}
+	if blob := rawdb.ReadPeerSyncStats(db, "stale"); len(blob) != 0 {
+		t.Errorf("expired peer statistics kept")
+	}
+}
+
+// Tests that the number of persisted peer statistics is capped, evicting the
+// lowest ranked peers first.
+func TestPeerStatsEviction(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	for i := 0; i <= maxPeerStats; i++ {
+		blob, _ := json.Marshal(&PeerStats{
+			Headers:  RequestStats{Requests: 1, Items: 1, Throughput: float64(i)},
+			LastSeen: uint64(time.Now().Unix()),
+		})
+		rawdb.WritePeerSyncStats(db, fmt.Sprintf("peer %d", i), blob)
+	}
+	d := New(0, db, nil, nil, nil, nil, nil)
+	defer d.Terminate()
+
+	if stored := len(rawdb.ReadAllPeerSyncStats(db)); stored != d.peerStatsCount || stored > maxPeerStats {
+		t.Fatalf("stored peer statistics mismatch: have %d, tracked %d, limit %d", stored, d.peerStatsCount, maxPeerStats)
+	}
+	if blob := rawdb.ReadPeerSyncStats(db, "peer 0"); len(blob) != 0 {
+		t.Errorf("lowest ranked peer statistics kept")
+	}
+	if blob := rawdb.ReadPeerSyncStats(db, fmt.Sprintf("peer %d", maxPeerStats)); len(blob) == 0 {
+		t.Errorf("highest ranked peer statistics evicted")
+	}
+}
+
+// Tests that idle peers are ranked by their throughput, weighted by how many of
+// the requests they answered.
+func TestPeerReliabilityRanking(t *testing.T) {
+	ps := newPeerSet()
+	for _, id := range []string{"reliable", "unreliable"} {
+		p := newPeerConnection(id, eth.ETH66, nil, nil)
+		p.stats.Headers = RequestStats{Requests: 10, Items: 1000, Throughput: 100}
+		ps.Register(p)
+	}
+	ps.Peer("unreliable").stats.Headers.Failures = 5
+
+	idle, _ := ps.HeaderIdlePeers()
+	if len(idle) != 2 || idle[0].id != "reliable" {
+		t.Fatalf("ranking mismatch: have %v first, want %v", idle[0].id, "reliable")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// peerStatsExpiry is the time after which the statistics of peers not seen any
+	// more are dropped from the database.
+	peerStatsExpiry = 30 * 24 * time.Hour
+
+	// maxPeerStats is the maximum number of peers whose statistics are persisted.
+	// Beyond it, the lowest ranked peers are evicted, down to 90% of the limit.
+	maxPeerStats = 4096
+)
+
+// RequestStats is the download performance record of a peer for a single type
+// of retrieval request.
+type RequestStats struct {
+	Requests   uint64        `json:"requests"`   // Number of requests completed
+	Failures   uint64        `json:"failures"`   // Number of requests timed out or answered empty
+	Items      uint64        `json:"items"`      // Number of items delivered
+	Throughput float64       `json:"throughput"` // Moving average of items delivered per second
+	Latency    time.Duration `json:"latency"`    // Moving average of the request round trip time
+}
+
+// update records the outcome of a completed request.
+func (s *RequestStats) update(elapsed time.Duration, delivered int) {
+	s.Requests++
+	if delivered == 0 {
+		s.Failures++
+		return
+	}
+	s.Items += uint64(delivered)
+
+	if elapsed <= 0 {
+		elapsed = 1 // +1 (ns) to ensure non-zero divisor
+	}
+	measured := float64(delivered) / (float64(elapsed) / float64(time.Second))
+
+	// The first successful request seeds the averages
+	if s.Requests-s.Failures == 1 {
+		s.Throughput, s.Latency = measured, elapsed
+		return
+	}
+	s.Throughput = (1-measurementImpact)*s.Throughput + measurementImpact*measured
+	s.Latency = time.Duration((1-measurementImpact)*float64(s.Latency) + measurementImpact*float64(elapsed))
+}
+
+// reliability returns the fraction of requests the peer answered, smoothed so
+// peers without any history are considered reliable.
+func (s *RequestStats) reliability() float64 {
+	return float64(s.Requests-s.Failures+1) / float64(s.Requests+1)
+}
+
+// PeerStats is the download performance record of a remote peer, aggregated
+// over all connections to it and persisted across restarts.
+type PeerStats struct {
+	Headers  RequestStats `json:"headers"`
+	Bodies   RequestStats `json:"bodies"`
+	Receipts RequestStats `json:"receipts"`
+	States   RequestStats `json:"states"`
+	LastSeen uint64       `json:"lastSeen"` // Unix time of the last disconnect
+}
+
+// rank returns a score of how well suited the peer was to drive the chain sync.
+func (s *PeerStats) rank() float64 {
+	return s.Headers.Throughput * s.Headers.reliability()
+}
+
+// PeerStats retrieves the download statistics of a connected peer, or nil if
+// the peer is not known.
+func (d *Downloader) PeerStats(id string) *PeerStats {
+	p := d.peers.Peer(id)
+	if p == nil {
+		return nil
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	stats := p.stats
+	return &stats
+}
+
+// PeerRank returns a score of how well suited a connected peer is to drive the
+// chain sync, based on its header throughput and how reliably it answers.
+func (d *Downloader) PeerRank(id string) float64 {
+	p := d.peers.Peer(id)
+	if p == nil {
+		return 0
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.headerThroughput * p.stats.Headers.reliability()
+}
+
+// loadPeerStats retrieves the persisted download statistics of a peer.
+func (d *Downloader) loadPeerStats(id string) PeerStats {
+	var stats PeerStats
+	blob := rawdb.ReadPeerSyncStats(d.stateDB, id)
+	if len(blob) == 0 {
+		return stats
+	}
+	if err := json.Unmarshal(blob, &stats); err != nil {
+		log.Warn("Failed to decode peer sync statistics", "peer", id, "err", err)
+		return PeerStats{}
+	}
+	peerStatsKnownMeter.Mark(1)
+	return stats
+}
+
+// storePeerStats persists the download statistics of a peer, pruning the stored
+// statistics if there are too many.
+func (d *Downloader) storePeerStats(p *peerConnection) {
+	p.lock.Lock()
+	p.stats.LastSeen = uint64(time.Now().Unix())
+	blob, err := json.Marshal(&p.stats)
+	p.lock.Unlock()
+
+	if err != nil {
+		log.Error("Failed to encode peer sync statistics", "peer", p.id, "err", err)
+		return
+	}
+	d.peerStatsLock.Lock()
+	defer d.peerStatsLock.Unlock()
+
+	if len(rawdb.ReadPeerSyncStats(d.stateDB, p.id)) == 0 {
+		d.peerStatsCount++
+	}
+	rawdb.WritePeerSyncStats(d.stateDB, p.id, blob)
+
+	if d.peerStatsCount > maxPeerStats {
+		d.prunePeerStats()
+	}
+	peerStatsGauge.Update(int64(d.peerStatsCount))
+}
+
+// prunePeerStats deletes the statistics of all peers not seen for a long time.
+// If too many are left, the lowest ranked ones are evicted.
+//
+// The method must be called with peerStatsLock held (or during construction).
+func (d *Downloader) prunePeerStats() {
+	type entry struct {
+		id   string
+		rank float64
+	}
+	var (
+		cutoff = time.Now().Add(-peerStatsExpiry).Unix()
+		kept   []entry
+	)
+	for id, blob := range rawdb.ReadAllPeerSyncStats(d.stateDB) {
+		var stats PeerStats
+		if err := json.Unmarshal(blob, &stats); err != nil || stats.LastSeen < uint64(cutoff) {
+			rawdb.DeletePeerSyncStats(d.stateDB, id)
+			continue
+		}
+		kept = append(kept, entry{id: id, rank: stats.rank()})
+	}
+	if len(kept) > maxPeerStats {
+		sort.Slice(kept, func(i, j int) bool { return kept[i].rank > kept[j].rank })
+		for _, evicted := range kept[maxPeerStats*9/10:] {
+			rawdb.DeletePeerSyncStats(d.stateDB, evicted.id)
+		}
+		log.Debug("Evicted peer sync statistics", "count", len(kept)-maxPeerStats*9/10)
+		kept = kept[:maxPeerStats*9/10]
+	}
+	d.peerStatsCount = len(kept)
+	peerStatsGauge.Update(int64(d.peerStatsCount))
+}
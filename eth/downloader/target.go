@@ -0,0 +1,248 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// targetChain is the chain segment from the common ancestor up to the trusted sync
+// target. It is retrieved backwards from the target before the forward sync starts,
+// which verifies it by construction, and persisted into the database. The forward
+// sync then feeds the stored headers to the header processor instead of retrieving
+// them again.
+//
+// Syncing to a target is only supported in full sync. The sync stops at the target,
+// so a fast or snap sync pivot would have to be below it, with its state likely
+// long pruned by the peers if the target is old.
+type targetChain struct {
+	header *types.Header // Trusted sync target
+	origin uint64        // Number of the common ancestor with the local chain
+}
+
+// height returns the block number of the sync target.
+func (c *targetChain) height() uint64 {
+	return c.header.Number.Uint64()
+}
+
+// SetTarget configures a trusted block to synchronise to. Until the block has been
+// imported, the downloader only syncs chains containing it and stops the sync at
+// the target. Afterwards, chains forking off below the target are rejected.
+//
+// The target must be set before the first sync cycle starts.
+func (d *Downloader) SetTarget(hash common.Hash) {
+	d.target = hash
+}
+
+// targetReached reports whether the sync target has been imported and returns
+// its header if so.
+func (d *Downloader) targetReached(mode SyncMode) (*types.Header, bool) {
+	header := d.lightchain.GetHeaderByHash(d.target)
+	if header == nil {
+		return nil, false
+	}
+	return header, d.isKnown(mode, header.Hash(), header.Number.Uint64())
+}
+
+// isKnown reports whether a block is present in the local chain, to the extent
+// required by the sync mode.
+func (d *Downloader) isKnown(mode SyncMode, hash common.Hash, number uint64) bool {
+	switch mode {
+	case FullSync:
+		return d.blockchain.HasBlock(hash, number)
+	case FastSync:
+		return d.blockchain.HasFastBlock(hash, number)
+	default:
+		return d.lightchain.HasHeader(hash, number)
+	}
+}
+
+// fetchTarget retrieves the sync target header from a peer, followed by its
+// ancestors in reverse order until they link up with the local chain. The headers
+// are stored into the database as they arrive, and the ones stored by previous,
+// interrupted runs are reused instead of being retrieved again.
+func (d *Downloader) fetchTarget(p *peerConnection) (*targetChain, error) {
+	p.log.Debug("Retrieving sync target", "hash", d.target)
+	mode := d.getMode()
+	if mode != FullSync {
+		return nil, errTargetSyncMode
+	}
+	headers, err := d.fetchTargetHeaders(p, d.target, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("%w: sync target %x not available", errUnsyncedPeer, d.target)
+	}
+	if hash := headers[0].Hash(); hash != d.target {
+		return nil, fmt.Errorf("%w: returned header %x != requested %x", errBadPeer, hash, d.target)
+	}
+	chain := &targetChain{header: headers[0]}
+	height := chain.height()
+
+	rawdb.WriteSyncTargetHeader(d.stateDB, chain.header)
+
+	// Resume from the lowest header linking up with the target, which was stored
+	// by a previous run
+	var (
+		lowest = chain.header
+		stored = uint64(1)
+		logged = time.Now()
+	)
+	for lowest.Number.Uint64() > 0 {
+		header := rawdb.ReadSyncTargetHeader(d.stateDB, lowest.Number.Uint64()-1)
+		if header == nil || header.Hash() != lowest.ParentHash {
+			break
+		}
+		if number := header.Number.Uint64(); d.isKnown(mode, lowest.ParentHash, number) {
+			chain.origin = number
+			d.syncStatsLock.Lock()
+			d.syncStatsChainHeight = height
+			d.syncStatsTarget, d.syncStatsTargetHeaders = height, stored
+			d.syncStatsLock.Unlock()
+
+			p.log.Debug("Found common ancestor of stored sync target chain", "number", chain.origin, "target", height)
+			return chain, nil
+		}
+		lowest = header
+		stored++
+	}
+	if stored > 1 {
+		p.log.Debug("Resuming sync target retrieval", "target", height, "stored", stored, "number", lowest.Number)
+	}
+	d.syncStatsLock.Lock()
+	d.syncStatsChainHeight = height
+	d.syncStatsTarget, d.syncStatsTargetHeaders = height, stored
+	d.syncStatsLock.Unlock()
+
+	for {
+		headers, err := d.fetchTargetHeaders(p, lowest.ParentHash, MaxHeaderFetch)
+		if err != nil {
+			return nil, err
+		}
+		if len(headers) == 0 {
+			return nil, fmt.Errorf("%w: empty ancestor set of sync target", errBadPeer)
+		}
+		batch := d.stateDB.NewBatch()
+		for _, header := range headers {
+			hash, number := header.Hash(), header.Number.Uint64()
+			if hash != lowest.ParentHash || number+1 != lowest.Number.Uint64() {
+				return nil, fmt.Errorf("%w: ancestors of sync target broke chain ordering", errInvalidChain)
+			}
+			if d.isKnown(mode, hash, number) {
+				// Found the common ancestor, flush the last headers
+				if err := batch.Write(); err != nil {
+					return nil, err
+				}
+				chain.origin = number
+
+				d.syncStatsLock.Lock()
+				d.syncStatsTargetHeaders = stored
+				d.syncStatsLock.Unlock()
+
+				p.log.Debug("Found common ancestor of sync target", "number", number, "hash", hash, "target", height)
+				return chain, nil
+			}
+			if number == 0 {
+				// The genesis is always known, so this is a peer on another network.
+				return nil, fmt.Errorf("%w: sync target not on the local chain", errInvalidChain)
+			}
+			rawdb.WriteSyncTargetHeader(batch, header)
+			stored++
+			lowest = header
+		}
+		if err := batch.Write(); err != nil {
+			return nil, err
+		}
+		d.syncStatsLock.Lock()
+		d.syncStatsTargetHeaders = stored
+		d.syncStatsLock.Unlock()
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Retrieving sync target ancestors", "target", height, "count", stored, "number", lowest.Number)
+			logged = time.Now()
+		}
+	}
+}
+
+// fetchTargetHeaders requests headers in reverse order, starting at the given hash,
+// and waits for the response.
+func (d *Downloader) fetchTargetHeaders(p *peerConnection, origin common.Hash, amount int) ([]*types.Header, error) {
+	go p.peer.RequestHeadersByHash(origin, amount, 0, true)
+
+	ttl := d.requestTTL()
+	timeout := time.After(ttl)
+	for {
+		select {
+		case <-d.cancelCh:
+			return nil, errCanceled
+
+		case packet := <-d.headerCh:
+			// Discard anything not from the origin peer
+			if packet.PeerId() != p.id {
+				log.Debug("Received headers from incorrect peer", "peer", packet.PeerId())
+				break
+			}
+			headers := packet.(*headerPack).headers
+			if len(headers) > amount {
+				return nil, fmt.Errorf("%w: returned headers %d > requested %d", errBadPeer, len(headers), amount)
+			}
+			return headers, nil
+
+		case <-timeout:
+			p.log.Debug("Waiting for sync target headers timed out", "elapsed", ttl)
+			return nil, errTimeout
+
+		case <-d.bodyCh:
+		case <-d.receiptCh:
+			// Out of bounds delivery, ignore
+		}
+	}
+}
+
+// deliverTargetHeaders feeds the headers of the sync target chain stored by
+// fetchTarget to the header processor, taking the place of fetchHeaders.
+func (d *Downloader) deliverTargetHeaders(from uint64) error {
+	height := d.targetChain.height()
+	for from <= height {
+		headers := make([]*types.Header, 0, MaxHeaderFetch)
+		for ; from <= height && len(headers) < MaxHeaderFetch; from++ {
+			header := rawdb.ReadSyncTargetHeader(d.stateDB, from)
+			if header == nil {
+				return fmt.Errorf("sync target chain header #%d missing", from)
+			}
+			headers = append(headers, header)
+		}
+		select {
+		case d.headerProcCh <- headers:
+		case <-d.cancelCh:
+			return errCanceled
+		}
+	}
+	select {
+	case d.headerProcCh <- nil:
+		return nil
+	case <-d.cancelCh:
+		return errCanceled
+	}
+}
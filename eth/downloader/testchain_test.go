@@ -172,7 +172,10 @@ func (tc *testChain) td(hash common.Hash) *big.Int {
 
 // headersByHash returns headers in order from the given hash.
 func (tc *testChain) headersByHash(origin common.Hash, amount int, skip int, reverse bool) []*types.Header {
-	num, _ := tc.hashToNumber(origin)
+	num, ok := tc.hashToNumber(origin)
+	if !ok {
+		return nil
+	}
 	return tc.headersByNumber(num, amount, skip, reverse)
 }
 
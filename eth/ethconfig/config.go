@@ -27,11 +27,13 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/bft"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/eth/protocols/snap"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/miner"
@@ -76,16 +78,19 @@ var Defaults = Config{
 	TrieDirtyCache:          256,
 	TrieTimeout:             60 * time.Minute,
 	SnapshotCache:           102,
+	SnapServe:               snap.DefaultServeConfig,
 	Miner: miner.Config{
 		GasFloor: 8000000,
 		GasCeil:  8000000,
 		GasPrice: big.NewInt(params.GWei),
 		Recommit: 3 * time.Second,
 	},
-	TxPool:      core.DefaultTxPoolConfig,
-	RPCGasCap:   25000000,
-	GPO:         FullNodeGPO,
-	RPCTxFeeCap: 1, // 1 ether
+	CliqueStatsWindow: 64,
+	CliqueMissedTurns: 3,
+	TxPool:            core.DefaultTxPoolConfig,
+	RPCGasCap:         25000000,
+	GPO:               FullNodeGPO,
+	RPCTxFeeCap:       1, // 1 ether
 }
 
 func init() {
@@ -126,14 +131,22 @@ type Config struct {
 	EthDiscoveryURLs  []string
 	SnapDiscoveryURLs []string
 
+	// Budgets for serving snap sync data to remote peers
+	SnapServe snap.ServeConfig
+
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	HistoryLimit  uint64 `toml:",omitempty"` // The maximum number of blocks from head whose ancient bodies and receipts are reserved.
+	StateHistory  uint64 `toml:",omitempty"` // The maximum number of blocks from head whose state reverse diffs are reserved.
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
+	// Trusted block to sync to, chains not containing it are rejected
+	SyncTarget common.Hash `toml:",omitempty"`
+
 	// Light client options
 	LightServ          int  `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightIngress       int  `toml:",omitempty"` // Incoming bandwidth limit for light servers
@@ -168,6 +181,10 @@ type Config struct {
 	// Ethash options
 	Ethash ethash.Config
 
+	// Clique options
+	CliqueStatsWindow uint64 // Default number of recent blocks to gather signer stats over
+	CliqueMissedTurns uint64 // Number of consecutive missed in-turn slots to warn about a signer
+
 	// Transaction pool options
 	TxPool core.TxPoolConfig
 
@@ -186,6 +203,9 @@ type Config struct {
 	// Type of the EVM interpreter ("" for default)
 	EVMInterpreter string
 
+	// Number of workers executing block transactions in parallel (0 = sequential)
+	ParallelExecution int `toml:",omitempty"`
+
 	// RPCGasCap is the global gas cap for eth-call variants.
 	RPCGasCap uint64 `toml:",omitempty"`
 
@@ -209,6 +229,10 @@ func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, co
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
 	}
+	// If Byzantine fault tolerance is requested, set it up
+	if chainConfig.BFT != nil {
+		return bft.New(chainConfig.BFT, db)
+	}
 	// Otherwise assume proof-of-work
 	switch config.PowMode {
 	case ethash.ModeFake:
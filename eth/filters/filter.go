@@ -42,6 +42,7 @@ type Backend interface {
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 	SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription
+	SubscribeTxPoolEvent(ch chan<- core.TxPoolEvent) event.Subscription
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
@@ -282,6 +283,37 @@ func includes(addresses []common.Address, a common.Address) bool {
 	return false
 }
 
+// filterTransactions creates a slice of transactions sent from any of the given
+// senders and to any of the given recipients. Empty address lists match all.
+func filterTransactions(txs []*types.Transaction, senders []common.Address, recipients []common.Address) []*types.Transaction {
+	if len(senders) == 0 && len(recipients) == 0 {
+		return txs
+	}
+	var ret []*types.Transaction
+	for _, tx := range txs {
+		if len(senders) > 0 {
+			from, err := types.Sender(transactionSigner(tx), tx)
+			if err != nil || !includes(senders, from) {
+				continue
+			}
+		}
+		if len(recipients) > 0 && (tx.To() == nil || !includes(recipients, *tx.To())) {
+			continue
+		}
+		ret = append(ret, tx)
+	}
+	return ret
+}
+
+// transactionSigner returns a signer able to recover the sender of the given
+// transaction, without needing to know the chain configuration.
+func transactionSigner(tx *types.Transaction) types.Signer {
+	if tx.Protected() {
+		return types.LatestSignerForChainID(tx.ChainId())
+	}
+	return types.HomesteadSigner{}
+}
+
 // filterLogs creates a slice of logs matching the given criteria.
 func filterLogs(logs []*types.Log, fromBlock, toBlock *big.Int, addresses []common.Address, topics [][]common.Hash) []*types.Log {
 	var ret []*types.Log
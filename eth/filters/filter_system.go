@@ -47,11 +47,13 @@ const (
 	PendingLogsSubscription
 	// MinedAndPendingLogsSubscription queries for logs in mined and pending blocks.
 	MinedAndPendingLogsSubscription
-	// PendingTransactionsSubscription queries tx hashes for pending
-	// transactions entering the pending state
+	// PendingTransactionsSubscription queries pending transactions
+	// entering the pending state
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// TxPoolEventsSubscription queries lifecycle events of pooled transactions
+	TxPoolEventsSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -66,6 +68,8 @@ const (
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// txPoolEvChanSize is the size of channel listening to TxPoolEvent.
+	txPoolEvChanSize = 4096
 )
 
 type subscription struct {
@@ -74,8 +78,10 @@ type subscription struct {
 	created   time.Time
 	logsCrit  ethereum.FilterQuery
 	logs      chan []*types.Log
-	hashes    chan []common.Hash
+	txsCrit   PendingTxFilterCriteria
+	txs       chan []*types.Transaction
 	headers   chan *types.Header
+	txEvents  chan core.TxPoolEvent
 	installed chan struct{} // closed when the filter is installed
 	err       chan error    // closed when the filter is uninstalled
 }
@@ -93,6 +99,7 @@ type EventSystem struct {
 	rmLogsSub      event.Subscription // Subscription for removed log event
 	pendingLogsSub event.Subscription // Subscription for pending log event
 	chainSub       event.Subscription // Subscription for new chain event
+	txPoolSub      event.Subscription // Subscription for transaction lifecycle event
 
 	// Channels
 	install       chan *subscription         // install filter for event notification
@@ -102,6 +109,7 @@ type EventSystem struct {
 	pendingLogsCh chan []*types.Log          // Channel to receive new log event
 	rmLogsCh      chan core.RemovedLogsEvent // Channel to receive removed log event
 	chainCh       chan core.ChainEvent       // Channel to receive new chain event
+	txPoolCh      chan core.TxPoolEvent      // Channel to receive transaction lifecycle event
 }
 
 // NewEventSystem creates a new manager that listens for event on the given mux,
@@ -121,6 +129,7 @@ func NewEventSystem(backend Backend, lightMode bool) *EventSystem {
 		rmLogsCh:      make(chan core.RemovedLogsEvent, rmLogsChanSize),
 		pendingLogsCh: make(chan []*types.Log, logsChanSize),
 		chainCh:       make(chan core.ChainEvent, chainEvChanSize),
+		txPoolCh:      make(chan core.TxPoolEvent, txPoolEvChanSize),
 	}
 
 	// Subscribe events
@@ -129,9 +138,10 @@ func NewEventSystem(backend Backend, lightMode bool) *EventSystem {
 	m.rmLogsSub = m.backend.SubscribeRemovedLogsEvent(m.rmLogsCh)
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
 	m.pendingLogsSub = m.backend.SubscribePendingLogsEvent(m.pendingLogsCh)
+	m.txPoolSub = m.backend.SubscribeTxPoolEvent(m.txPoolCh)
 
 	// Make sure none of the subscriptions are empty
-	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil {
+	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil || m.txPoolSub == nil {
 		log.Crit("Subscribe for event system failed")
 	}
 
@@ -165,8 +175,9 @@ func (sub *Subscription) Unsubscribe() {
 			case sub.es.uninstall <- sub.f:
 				break uninstallLoop
 			case <-sub.f.logs:
-			case <-sub.f.hashes:
+			case <-sub.f.txs:
 			case <-sub.f.headers:
+			case <-sub.f.txEvents:
 			}
 		}
 
@@ -232,8 +243,9 @@ func (es *EventSystem) subscribeMinedPendingLogs(crit ethereum.FilterQuery, logs
 		logsCrit:  crit,
 		created:   time.Now(),
 		logs:      logs,
-		hashes:    make(chan []common.Hash),
+		txs:       make(chan []*types.Transaction),
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -249,8 +261,9 @@ func (es *EventSystem) subscribeLogs(crit ethereum.FilterQuery, logs chan []*typ
 		logsCrit:  crit,
 		created:   time.Now(),
 		logs:      logs,
-		hashes:    make(chan []common.Hash),
+		txs:       make(chan []*types.Transaction),
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -266,8 +279,9 @@ func (es *EventSystem) subscribePendingLogs(crit ethereum.FilterQuery, logs chan
 		logsCrit:  crit,
 		created:   time.Now(),
 		logs:      logs,
-		hashes:    make(chan []common.Hash),
+		txs:       make(chan []*types.Transaction),
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -282,24 +296,44 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 		typ:       BlocksSubscription,
 		created:   time.Now(),
 		logs:      make(chan []*types.Log),
-		hashes:    make(chan []common.Hash),
+		txs:       make(chan []*types.Transaction),
 		headers:   headers,
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
 	return es.subscribe(sub)
 }
 
-// SubscribePendingTxs creates a subscription that writes transaction hashes for
-// transactions that enter the transaction pool.
-func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscription {
+// SubscribePendingTxs creates a subscription that writes the transactions that
+// enter the transaction pool and match the given criteria.
+func (es *EventSystem) SubscribePendingTxs(crit PendingTxFilterCriteria, txs chan []*types.Transaction) *Subscription {
 	sub := &subscription{
 		id:        rpc.NewID(),
 		typ:       PendingTransactionsSubscription,
 		created:   time.Now(),
 		logs:      make(chan []*types.Log),
-		hashes:    hashes,
+		txsCrit:   crit,
+		txs:       txs,
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeTxPoolEvents creates a subscription that writes the lifecycle events
+// of transactions in the transaction pool.
+func (es *EventSystem) SubscribeTxPoolEvents(events chan core.TxPoolEvent) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       TxPoolEventsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		txs:       make(chan []*types.Transaction),
+		headers:   make(chan *types.Header),
+		txEvents:  events,
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -342,12 +376,16 @@ func (es *EventSystem) handleRemovedLogs(filters filterIndex, ev core.RemovedLog
 }
 
 func (es *EventSystem) handleTxsEvent(filters filterIndex, ev core.NewTxsEvent) {
-	hashes := make([]common.Hash, 0, len(ev.Txs))
-	for _, tx := range ev.Txs {
-		hashes = append(hashes, tx.Hash())
-	}
 	for _, f := range filters[PendingTransactionsSubscription] {
-		f.hashes <- hashes
+		if txs := filterTransactions(ev.Txs, f.txsCrit.From, f.txsCrit.To); len(txs) > 0 {
+			f.txs <- txs
+		}
+	}
+}
+
+func (es *EventSystem) handleTxPoolEvent(filters filterIndex, ev core.TxPoolEvent) {
+	for _, f := range filters[TxPoolEventsSubscription] {
+		f.txEvents <- ev
 	}
 }
 
@@ -448,6 +486,7 @@ func (es *EventSystem) eventLoop() {
 		es.rmLogsSub.Unsubscribe()
 		es.pendingLogsSub.Unsubscribe()
 		es.chainSub.Unsubscribe()
+		es.txPoolSub.Unsubscribe()
 	}()
 
 	index := make(filterIndex)
@@ -467,6 +506,8 @@ func (es *EventSystem) eventLoop() {
 			es.handlePendingLogs(index, ev)
 		case ev := <-es.chainCh:
 			es.handleChainEvent(index, ev)
+		case ev := <-es.txPoolCh:
+			es.handleTxPoolEvent(index, ev)
 
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
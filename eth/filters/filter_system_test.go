@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
@@ -52,6 +53,7 @@ type testBackend struct {
 	rmLogsFeed      event.Feed
 	pendingLogsFeed event.Feed
 	chainFeed       event.Feed
+	txPoolFeed      event.Feed
 }
 
 func (b *testBackend) ChainDb() ethdb.Database {
@@ -122,6 +124,10 @@ func (b *testBackend) SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Su
 	return b.pendingLogsFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeTxPoolEvent(ch chan<- core.TxPoolEvent) event.Subscription {
+	return b.txPoolFeed.Subscribe(ch)
+}
+
 func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return b.chainFeed.Subscribe(ch)
 }
@@ -269,6 +275,99 @@ func TestPendingTxFilter(t *testing.T) {
 	}
 }
 
+// TestPendingTxSubscriptionCriteria tests that pending transaction subscriptions
+// only deliver the transactions matching their sender and recipient criteria.
+func TestPendingTxSubscriptionCriteria(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, false, deadline)
+
+		key1, _ = crypto.GenerateKey()
+		key2, _ = crypto.GenerateKey()
+		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+		target  = common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268")
+		signer  = types.HomesteadSigner{}
+
+		tx1, _ = types.SignTx(types.NewTransaction(0, target, new(big.Int), 21000, new(big.Int), nil), signer, key1)
+		tx2, _ = types.SignTx(types.NewTransaction(0, target, new(big.Int), 21000, new(big.Int), nil), signer, key2)
+		tx3, _ = types.SignTx(types.NewTransaction(1, common.Address{}, new(big.Int), 21000, new(big.Int), nil), signer, key1)
+	)
+	tests := []struct {
+		crit PendingTxFilterCriteria
+		want []*types.Transaction
+	}{
+		{PendingTxFilterCriteria{}, []*types.Transaction{tx1, tx2, tx3}},
+		{PendingTxFilterCriteria{From: []common.Address{addr1}}, []*types.Transaction{tx1, tx3}},
+		{PendingTxFilterCriteria{To: []common.Address{target}}, []*types.Transaction{tx1, tx2}},
+		{PendingTxFilterCriteria{From: []common.Address{addr1}, To: []common.Address{target}}, []*types.Transaction{tx1}},
+	}
+	var (
+		chans = make([]chan []*types.Transaction, len(tests))
+		subs  = make([]*Subscription, len(tests))
+	)
+	for i, tt := range tests {
+		chans[i] = make(chan []*types.Transaction, 1)
+		subs[i] = api.events.SubscribePendingTxs(tt.crit, chans[i])
+		defer subs[i].Unsubscribe()
+	}
+	backend.txFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx1, tx2, tx3}})
+
+	for i, tt := range tests {
+		select {
+		case have := <-chans[i]:
+			if len(have) != len(tt.want) {
+				t.Fatalf("test %d: transaction count mismatch: have %d, want %d", i, len(have), len(tt.want))
+			}
+			for j := range have {
+				if have[j].Hash() != tt.want[j].Hash() {
+					t.Errorf("test %d: transaction %d mismatch: have %x, want %x", i, j, have[j].Hash(), tt.want[j].Hash())
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: transactions not delivered", i)
+		}
+	}
+}
+
+// TestTxPoolEventsSubscription tests that transaction lifecycle events are
+// forwarded to subscribers.
+func TestTxPoolEventsSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, false, deadline)
+
+		events = []core.TxPoolEvent{
+			{Hash: common.HexToHash("0x01"), Type: core.TxPoolEventAdded},
+			{Hash: common.HexToHash("0x01"), Type: core.TxPoolEventDropped, Reason: core.TxPoolReasonLifetime},
+		}
+	)
+	ch := make(chan core.TxPoolEvent)
+	sub := api.events.SubscribeTxPoolEvents(ch)
+	defer sub.Unsubscribe()
+
+	go func() {
+		for _, ev := range events {
+			backend.txPoolFeed.Send(ev)
+		}
+	}()
+	for i, want := range events {
+		select {
+		case have := <-ch:
+			if have.Hash != want.Hash || have.Type != want.Type || have.Reason != want.Reason {
+				t.Fatalf("event %d mismatch: have %+v, want %+v", i, have, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+}
+
 // TestLogFilterCreation test whether a given filter criteria makes sense.
 // If not it must return an error.
 func TestLogFilterCreation(t *testing.T) {
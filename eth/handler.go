@@ -85,6 +85,7 @@ type handlerConfig struct {
 	EventMux   *event.TypeMux            // Legacy event mux, deprecate for `feed`
 	Checkpoint *params.TrustedCheckpoint // Hard coded checkpoint for sync challenges
 	Whitelist  map[uint64]common.Hash    // Hard coded whitelist for sync challenged
+	SyncTarget common.Hash               // Trusted block to sync to (optional)
 }
 
 type handler struct {
@@ -180,7 +181,10 @@ func newHandler(config *handlerConfig) (*handler, error) {
 	if atomic.LoadUint32(&h.fastSync) == 1 {
 		h.stateBloom = trie.NewSyncBloom(config.BloomCache, config.Database)
 	}
-	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.stateBloom, h.eventMux, h.chain, nil, h.removePeer)
+	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.stateBloom, h.eventMux, h.chain, nil, h.penalizePeer)
+	if config.SyncTarget != (common.Hash{}) {
+		h.downloader.SetTarget(config.SyncTarget)
+	}
 
 	// Construct the fetcher (short sync)
 	validator := func(header *types.Header) error {
@@ -215,7 +219,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		}
 		return n, err
 	}
-	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.removePeer)
+	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.penalizePeer)
 
 	fetchTx := func(peer string, hashes []common.Hash) error {
 		p := h.peers.peer(peer)
@@ -315,6 +319,7 @@ func (h *handler) runEthPeer(peer *eth.Peer, handler eth.Handler) error {
 		// Start a timer to disconnect if the peer doesn't reply in time
 		p.syncDrop = time.AfterFunc(syncChallengeTimeout, func() {
 			peer.Log().Warn("Checkpoint challenge timed out, dropping", "addr", peer.RemoteAddr(), "type", peer.Name())
+			peer.Penalize(p2p.PenaltyTimeout)
 			h.removePeer(peer.ID())
 		})
 		// Make sure it's cleaned up if the peer dies off
@@ -384,6 +389,16 @@ func (h *handler) removePeer(id string) {
 	peer.Peer.Disconnect(p2p.DiscUselessPeer)
 }
 
+// penalizePeer is a callback for the sync subsystems to remove misbehaving peers,
+// charging them with the given penalty first. Repeat offenders get banned by the
+// networking layer.
+func (h *handler) penalizePeer(id string, penalty p2p.Penalty) {
+	if peer := h.peers.peer(id); peer != nil && penalty > 0 {
+		peer.Penalize(penalty)
+	}
+	h.removePeer(id)
+}
+
 func (h *handler) Start(maxPeers int) {
 	h.maxPeers = maxPeers
 
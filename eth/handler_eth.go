@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -48,7 +49,9 @@ func (h *ethHandler) RunPeer(peer *eth.Peer, hand eth.Handler) error {
 // PeerInfo retrieves all known `eth` information about a peer.
 func (h *ethHandler) PeerInfo(id enode.ID) interface{} {
 	if p := h.peers.peer(id.String()); p != nil {
-		return p.info()
+		info := p.info()
+		info.Sync = h.downloader.PeerStats(id.String())
+		return info
 	}
 	return nil
 }
@@ -136,6 +139,7 @@ func (h *ethHandler) handleHeaders(peer *eth.Peer, headers []*types.Header) erro
 
 			// Validate the header and either drop the peer or continue
 			if headers[0].Hash() != h.checkpointHash {
+				peer.Penalize(p2p.PenaltyUselessResponse)
 				return errors.New("checkpoint hash mismatch")
 			}
 			return nil
@@ -144,6 +148,7 @@ func (h *ethHandler) handleHeaders(peer *eth.Peer, headers []*types.Header) erro
 		if want, ok := h.whitelist[headers[0].Number.Uint64()]; ok {
 			if hash := headers[0].Hash(); want != hash {
 				peer.Log().Info("Whitelist mismatch, dropping peer", "number", headers[0].Number.Uint64(), "hash", hash, "want", want)
+				peer.Penalize(p2p.PenaltyUselessResponse)
 				return errors.New("whitelist block mismatch")
 			}
 			peer.Log().Debug("Whitelist block verified", "number", headers[0].Number.Uint64(), "hash", want)
@@ -21,6 +21,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/eth/protocols/snap"
 )
@@ -31,6 +32,8 @@ type ethPeerInfo struct {
 	Version    uint     `json:"version"`    // Ethereum protocol version negotiated
 	Difficulty *big.Int `json:"difficulty"` // Total difficulty of the peer's blockchain
 	Head       string   `json:"head"`       // Hex hash of the peer's best owned block
+
+	Sync *downloader.PeerStats `json:"sync,omitempty"` // Download statistics of the peer
 }
 
 // ethPeer is a wrapper around eth.Peer to maintain a few extra metadata.
@@ -57,7 +60,8 @@ func (p *ethPeer) info() *ethPeerInfo {
 // snapPeerInfo represents a short summary of the `snap` sub-protocol metadata known
 // about a connected peer.
 type snapPeerInfo struct {
-	Version uint `json:"version"` // Snapshot protocol version negotiated
+	Version uint             `json:"version"` // Snapshot protocol version negotiated
+	Served  *snap.ServeStats `json:"served"`  // Data served to the peer
 }
 
 // snapPeer is a wrapper around snap.Peer to maintain a few extra metadata.
@@ -69,5 +73,6 @@ type snapPeer struct {
 func (p *snapPeer) info() *snapPeerInfo {
 	return &snapPeerInfo{
 		Version: p.Version(),
+		Served:  p.ServeStats(),
 	}
 }
@@ -247,6 +247,32 @@ func (ps *peerSet) peerWithHighestTD() *eth.Peer {
 	return bestPeer
 }
 
+// peerForSync retrieves the known peer with the currently highest total difficulty.
+// Among peers with the same difficulty, the one ranked highest by the given
+// function is picked.
+func (ps *peerSet) peerForSync(rank func(id string) float64) *eth.Peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	var (
+		bestPeer *eth.Peer
+		bestTd   *big.Int
+		bestRank float64
+	)
+	for _, p := range ps.peers {
+		_, td := p.Head()
+		if bestPeer != nil {
+			if cmp := td.Cmp(bestTd); cmp < 0 {
+				continue
+			} else if cmp == 0 && rank(p.ID()) <= bestRank {
+				continue
+			}
+		}
+		bestPeer, bestTd, bestRank = p.Peer, td, rank(p.ID())
+	}
+	return bestPeer
+}
+
 // close disconnects all peers.
 func (ps *peerSet) close() {
 	ps.lock.Lock()
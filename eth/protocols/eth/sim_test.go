@@ -0,0 +1,104 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations/simnet"
+)
+
+// This test runs the protocol handler on a simulated network link and checks that
+// requests are answered after the round-trip time of the link, and that the handler
+// terminates when the link is partitioned.
+func TestHandlerSimulated(t *testing.T) {
+	backend := newTestBackend(16)
+	defer backend.close()
+
+	var (
+		latency       = 150 * time.Millisecond
+		sim           = simnet.New(1, simnet.Link{Latency: latency})
+		local, remote = sim.NewAddr().IP, sim.NewAddr().IP
+		app, rw       = sim.MsgPipe(remote, local)
+	)
+	peer := NewPeer(ETH66, p2p.NewPeer(enode.ID{1}, "peer", nil), rw, backend.TxPool())
+	defer peer.Close()
+
+	errc := make(chan error, 1)
+	go func() { errc <- Handle(backend, peer) }()
+
+	// Request some headers from the handler.
+	type response struct {
+		packet *BlockHeadersPacket66
+		at     mclock.AbsTime
+		err    error
+	}
+	resc := make(chan response, 1)
+	go func() {
+		msg, err := app.ReadMsg()
+		if err != nil {
+			resc <- response{err: err}
+			return
+		}
+		res := response{packet: new(BlockHeadersPacket66), at: sim.Clock().Now()}
+		res.err = msg.Decode(res.packet)
+		resc <- res
+	}()
+	err := p2p.Send(app, GetBlockHeadersMsg, &GetBlockHeadersPacket66{
+		RequestId:             1,
+		GetBlockHeadersPacket: &GetBlockHeadersPacket{Origin: HashOrNumber{Number: 1}, Amount: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res response
+	if !sim.RunUntil(time.Minute, func() bool {
+		select {
+		case res = <-resc:
+			return true
+		default:
+			return false
+		}
+	}) {
+		t.Fatal("no response")
+	}
+	if res.err != nil {
+		t.Fatal("invalid response:", res.err)
+	}
+	if res.at != mclock.AbsTime(2*latency) {
+		t.Errorf("response arrived at %v, want %v", time.Duration(res.at), 2*latency)
+	}
+	if res.packet.RequestId != 1 || len(res.packet.BlockHeadersPacket) != 5 {
+		t.Errorf("wrong response: id %d, %d headers", res.packet.RequestId, len(res.packet.BlockHeadersPacket))
+	}
+
+	// Partitioning the link drops the connection.
+	sim.Partition([]net.IP{local}, []net.IP{remote})
+	select {
+	case err := <-errc:
+		if err != p2p.ErrPipeClosed {
+			t.Fatalf("wrong handler error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler didn't terminate after partition")
+	}
+}
@@ -75,8 +75,11 @@ type Backend interface {
 	Handle(peer *Peer, packet Packet) error
 }
 
-// MakeProtocols constructs the P2P protocol definitions for `snap`.
-func MakeProtocols(backend Backend, dnsdisc enode.Iterator) []p2p.Protocol {
+// MakeProtocols constructs the P2P protocol definitions for `snap`. The serving
+// budgets are shared by all protocol versions.
+func MakeProtocols(backend Backend, dnsdisc enode.Iterator, config ServeConfig) []p2p.Protocol {
+	limiter := newServeLimiter(config)
+
 	protocols := make([]p2p.Protocol, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
 		version := version // Closure
@@ -86,7 +89,10 @@ func MakeProtocols(backend Backend, dnsdisc enode.Iterator) []p2p.Protocol {
 			Version: version,
 			Length:  protocolLengths[version],
 			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
-				return backend.RunPeer(newPeer(version, p, rw), func(peer *Peer) error {
+				peer := newPeer(version, p, rw)
+				peer.serve = limiter.peer(p.Trusted(), p.Closed())
+
+				return backend.RunPeer(peer, func(peer *Peer) error {
 					return handle(backend, peer)
 				})
 			},
@@ -139,6 +145,10 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if req.Bytes > softResponseLimit {
 			req.Bytes = softResponseLimit
 		}
+		if err := peer.serve.wait(); err != nil {
+			return err
+		}
+
 		// Retrieve the requested state and bail out if non existent
 		tr, err := trie.New(req.Root, backend.Chain().StateCache().TrieDB())
 		if err != nil {
@@ -188,7 +198,10 @@ func handleMessage(backend Backend, peer *Peer) error {
 		var proofs [][]byte
 		for _, blob := range proof.NodeList() {
 			proofs = append(proofs, blob)
+			size += uint64(len(blob))
 		}
+		peer.serve.charge(size)
+
 		// Send back anything accumulated
 		return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{
 			ID:       req.ID,
@@ -219,6 +232,10 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if req.Bytes > softResponseLimit {
 			req.Bytes = softResponseLimit
 		}
+		if err := peer.serve.wait(); err != nil {
+			return err
+		}
+
 		// TODO(karalabe): Do we want to enforce > 0 accounts and 1 account if origin is set?
 		// TODO(karalabe):   - Logging locally is not ideal as remote faulst annoy the local user
 		// TODO(karalabe):   - Dropping the remote peer is less flexible wrt client bugs (slow is better than non-functional)
@@ -315,6 +332,11 @@ func handleMessage(backend Backend, peer *Peer) error {
 				break
 			}
 		}
+		for _, blob := range proofs {
+			size += uint64(len(blob))
+		}
+		peer.serve.charge(size)
+
 		// Send back anything accumulated
 		return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{
 			ID:    req.ID,
@@ -350,6 +372,10 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if len(req.Hashes) > maxCodeLookups {
 			req.Hashes = req.Hashes[:maxCodeLookups]
 		}
+		if err := peer.serve.wait(); err != nil {
+			return err
+		}
+
 		// Retrieve bytecodes until the packet size limit is reached
 		var (
 			codes [][]byte
@@ -368,6 +394,8 @@ func handleMessage(backend Backend, peer *Peer) error {
 				break
 			}
 		}
+		peer.serve.charge(bytes)
+
 		// Send back anything accumulated
 		return p2p.Send(peer.rw, ByteCodesMsg, &ByteCodesPacket{
 			ID:    req.ID,
@@ -391,6 +419,10 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if req.Bytes > softResponseLimit {
 			req.Bytes = softResponseLimit
 		}
+		if err := peer.serve.wait(); err != nil {
+			return err
+		}
+
 		// Make sure we have the state associated with the request
 		triedb := backend.Chain().StateCache().TrieDB()
 
@@ -461,6 +493,8 @@ func handleMessage(backend Backend, peer *Peer) error {
 				break
 			}
 		}
+		peer.serve.charge(bytes)
+
 		// Send back anything accumulated
 		return p2p.Send(peer.rw, TrieNodesMsg, &TrieNodesPacket{
 			ID:    req.ID,
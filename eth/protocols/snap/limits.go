@@ -0,0 +1,202 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"golang.org/x/time/rate"
+)
+
+// maxResponseBytes is the largest size a single response is accounted with. It
+// is also the minimum burst of the byte budgets, so every response fits. Replies
+// may exceed the soft limit by the lookup slack and the last item or proof.
+const maxResponseBytes = 2 * softResponseLimit
+
+// ServeConfig contains the budgets for serving `snap` requests to remote peers.
+// Zero values disable the respective limit.
+//
+// Trusted peers are exempt from the per-peer budgets and are never throttled by
+// the global ones, though the requests and data served to them still count
+// against these.
+type ServeConfig struct {
+	PeerRequests  uint64 // Requests per second served to a single peer
+	PeerBytes     uint64 // Bytes per second served to a single peer
+	TotalRequests uint64 // Requests per second served to all peers together
+	TotalBytes    uint64 // Bytes per second served to all peers together
+}
+
+// DefaultServeConfig contains the default serving budgets, letting a handful of
+// peers sync at full speed without saturating the local disk.
+var DefaultServeConfig = ServeConfig{
+	PeerRequests:  50,
+	PeerBytes:     8 * 1024 * 1024,
+	TotalRequests: 400,
+	TotalBytes:    48 * 1024 * 1024,
+}
+
+// ServeStats is the accounting of the data served to a remote peer.
+type ServeStats struct {
+	Requests  uint64 `json:"requests"`  // Number of requests served
+	Bytes     uint64 `json:"bytes"`     // Number of bytes served
+	Throttled uint64 `json:"throttled"` // Number of requests delayed by a budget
+}
+
+// serveLimiter enforces the global serving budgets.
+type serveLimiter struct {
+	config   ServeConfig
+	requests *rate.Limiter // Global request budget (nil if unlimited)
+	bytes    *rate.Limiter // Global byte budget (nil if unlimited)
+}
+
+// newServeLimiter creates the global serving budgets.
+func newServeLimiter(config ServeConfig) *serveLimiter {
+	return &serveLimiter{
+		config:   config,
+		requests: newRequestLimiter(config.TotalRequests),
+		bytes:    newByteLimiter(config.TotalBytes),
+	}
+}
+
+// newRequestLimiter creates a request budget, allowing short bursts of at most
+// one second worth of requests.
+func newRequestLimiter(limit uint64) *rate.Limiter {
+	if limit == 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(limit), int(limit))
+}
+
+// newByteLimiter creates a byte budget, allowing short bursts of at most one
+// second worth of data, or a single maximum size response.
+func newByteLimiter(limit uint64) *rate.Limiter {
+	if limit == 0 {
+		return nil
+	}
+	burst := limit
+	if burst < maxResponseBytes {
+		burst = maxResponseBytes
+	}
+	return rate.NewLimiter(rate.Limit(limit), int(burst))
+}
+
+// peer creates the budget tracker of a single remote peer. Throttled requests
+// are aborted once the quit channel is closed.
+func (l *serveLimiter) peer(trusted bool, quit <-chan struct{}) *peerLimiter {
+	p := &peerLimiter{
+		global:  l,
+		trusted: trusted,
+		quit:    quit,
+	}
+	if !trusted {
+		p.requests = newRequestLimiter(l.config.PeerRequests)
+		p.bytes = newByteLimiter(l.config.PeerBytes)
+	}
+	return p
+}
+
+// peerLimiter enforces the serving budgets of a single remote peer and tracks
+// the data served to it.
+type peerLimiter struct {
+	global   *serveLimiter
+	trusted  bool
+	requests *rate.Limiter   // Per-peer request budget (nil if unlimited or trusted)
+	bytes    *rate.Limiter   // Per-peer byte budget (nil if unlimited or trusted)
+	quit     <-chan struct{} // Closed when the peer is shutting down
+
+	served    uint64 // Number of requests served (atomic)
+	sent      uint64 // Number of bytes served (atomic)
+	throttled uint64 // Number of requests delayed by a budget (atomic)
+}
+
+// wait blocks until the budgets allow serving the next request of the peer, or
+// returns an error if the peer shuts down meanwhile.
+//
+// Byte budgets are charged after serving, so a large response pushes them into
+// debt and delays the next request instead.
+func (p *peerLimiter) wait() error {
+	if p == nil {
+		return nil
+	}
+	atomic.AddUint64(&p.served, 1)
+	servedRequestMeter.Mark(1)
+
+	// Trusted peers draw from the global budgets like everyone else, but without
+	// waiting, throttling the untrusted peers if needed
+	var (
+		now   = time.Now()
+		delay time.Duration
+	)
+	for _, limiter := range []*rate.Limiter{p.requests, p.bytes, p.global.requests, p.global.bytes} {
+		if limiter == nil {
+			continue
+		}
+		if d := limiter.ReserveN(now, 1).DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 || p.trusted {
+		return nil
+	}
+	atomic.AddUint64(&p.throttled, 1)
+	throttledRequestMeter.Mark(1)
+	throttleTimer.Update(delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-p.quit:
+		return p2p.ErrShuttingDown
+	}
+}
+
+// charge accounts the size of a response against the byte budgets.
+func (p *peerLimiter) charge(size uint64) {
+	if p == nil {
+		return
+	}
+	atomic.AddUint64(&p.sent, size)
+	servedBytesMeter.Mark(int64(size))
+
+	if size > maxResponseBytes {
+		size = maxResponseBytes
+	}
+	now := time.Now()
+	if p.bytes != nil {
+		p.bytes.ReserveN(now, int(size))
+	}
+	if p.global.bytes != nil {
+		p.global.bytes.ReserveN(now, int(size))
+	}
+}
+
+// stats returns the accounting of the data served to the peer.
+func (p *peerLimiter) stats() *ServeStats {
+	if p == nil {
+		return nil
+	}
+	return &ServeStats{
+		Requests:  atomic.LoadUint64(&p.served),
+		Bytes:     atomic.LoadUint64(&p.sent),
+		Throttled: atomic.LoadUint64(&p.throttled),
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// Tests that requests beyond the per-peer request budget are throttled, except
+// for trusted peers.
+func TestServePeerRequestBudget(t *testing.T) {
+	limiter := newServeLimiter(ServeConfig{PeerRequests: 10})
+
+	peer, trusted := limiter.peer(false, nil), limiter.peer(true, nil)
+	for i := 0; i < 10; i++ {
+		peer.wait()
+	}
+	if stats := peer.stats(); stats.Throttled != 0 {
+		t.Fatalf("requests within budget throttled: %d", stats.Throttled)
+	}
+	peer.wait()
+	if stats := peer.stats(); stats.Requests != 11 || stats.Throttled != 1 {
+		t.Fatalf("request accounting mismatch: have %d/%d, want %d/%d", stats.Requests, stats.Throttled, 11, 1)
+	}
+	for i := 0; i < 20; i++ {
+		trusted.wait()
+	}
+	if stats := trusted.stats(); stats.Throttled != 0 {
+		t.Fatalf("trusted peer throttled: %d", stats.Throttled)
+	}
+}
+
+// Tests that trusted peers use up the global budget before untrusted ones.
+func TestServeTrustedPriority(t *testing.T) {
+	limiter := newServeLimiter(ServeConfig{TotalRequests: 10})
+
+	trusted, peer := limiter.peer(true, nil), limiter.peer(false, nil)
+	for i := 0; i < 11; i++ {
+		trusted.wait()
+	}
+	peer.wait()
+	if stats := peer.stats(); stats.Throttled != 1 {
+		t.Fatalf("untrusted peer not throttled after trusted used the budget")
+	}
+}
+
+// Tests that the data served to trusted peers counts against the global byte
+// budget too, throttling untrusted peers once exhausted.
+func TestServeTrustedBytes(t *testing.T) {
+	limiter := newServeLimiter(ServeConfig{TotalBytes: maxResponseBytes})
+
+	trusted, peer := limiter.peer(true, nil), limiter.peer(false, nil)
+	for i := 0; i < 2; i++ {
+		trusted.wait()
+		trusted.charge(maxResponseBytes)
+	}
+
+	peer.wait()
+	if stats := trusted.stats(); stats.Throttled != 0 {
+		t.Fatalf("trusted peer throttled: %d", stats.Throttled)
+	}
+	if stats := peer.stats(); stats.Throttled != 1 {
+		t.Fatalf("untrusted peer not throttled after trusted used the byte budget")
+	}
+}
+
+// Tests that throttled requests are aborted if the peer shuts down meanwhile.
+func TestServeWaitInterrupt(t *testing.T) {
+	var (
+		limiter = newServeLimiter(ServeConfig{PeerRequests: 1})
+		quit    = make(chan struct{})
+		peer    = limiter.peer(false, quit)
+	)
+	if err := peer.wait(); err != nil {
+		t.Fatalf("request within budget failed: %v", err)
+	}
+	errc := make(chan error)
+	go func() { errc <- peer.wait() }()
+
+	time.Sleep(50 * time.Millisecond)
+	close(quit)
+
+	select {
+	case err := <-errc:
+		if err != p2p.ErrShuttingDown {
+			t.Fatalf("interrupted wait error mismatch: have %v, want %v", err, p2p.ErrShuttingDown)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("throttled request not interrupted")
+	}
+}
+
+// Tests that served bytes are charged against the byte budgets, delaying the
+// next request once exhausted.
+func TestServeByteBudget(t *testing.T) {
+	limiter := newServeLimiter(ServeConfig{PeerBytes: 8 * maxResponseBytes})
+
+	peer := limiter.peer(false, nil)
+	peer.wait()
+	for i := 0; i < 9; i++ {
+		peer.charge(maxResponseBytes)
+	}
+	peer.wait()
+	if stats := peer.stats(); stats.Bytes != 9*maxResponseBytes || stats.Throttled != 1 {
+		t.Fatalf("byte accounting mismatch: have %d/%d, want %d/%d", stats.Bytes, stats.Throttled, 9*maxResponseBytes, 1)
+	}
+}
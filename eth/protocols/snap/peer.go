@@ -30,6 +30,8 @@ type Peer struct {
 	rw        p2p.MsgReadWriter // Input/output streams for snap
 	version   uint              // Protocol version negotiated
 
+	serve *peerLimiter // Serving budgets and accounting of the peer
+
 	logger log.Logger // Contextual logger with the peer id injected
 }
 
@@ -56,6 +58,11 @@ func (p *Peer) Version() uint {
 	return p.version
 }
 
+// ServeStats retrieves the accounting of the data served to the peer.
+func (p *Peer) ServeStats() *ServeStats {
+	return p.serve.stats()
+}
+
 // Log overrides the P2P logget with the higher level one containing only the id.
 func (p *Peer) Log() log.Logger {
 	return p.logger
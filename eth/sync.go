@@ -250,8 +250,8 @@ func (cs *chainSyncer) nextSyncOp() *chainSyncOp {
 	if cs.handler.peers.len() < minPeers {
 		return nil
 	}
-	// We have enough peers, check TD
-	peer := cs.handler.peers.peerWithHighestTD()
+	// We have enough peers, check TD. Prefer peers which served us well before.
+	peer := cs.handler.peers.peerForSync(cs.handler.downloader.PeerRank)
 	if peer == nil {
 		return nil
 	}
@@ -301,6 +301,8 @@ type rpcProgress struct {
 	HighestBlock  hexutil.Uint64
 	PulledStates  hexutil.Uint64
 	KnownStates   hexutil.Uint64
+	TargetBlock   hexutil.Uint64
+	TargetHeaders hexutil.Uint64
 }
 
 // SyncProgress retrieves the current progress of the sync algorithm. If there's
@@ -325,6 +327,8 @@ func (ec *Client) SyncProgress(ctx context.Context) (*ethereum.SyncProgress, err
 		HighestBlock:  uint64(progress.HighestBlock),
 		PulledStates:  uint64(progress.PulledStates),
 		KnownStates:   uint64(progress.KnownStates),
+		TargetBlock:   uint64(progress.TargetBlock),
+		TargetHeaders: uint64(progress.TargetHeaders),
 	}, nil
 }
 
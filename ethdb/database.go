@@ -79,6 +79,10 @@ type AncientReader interface {
 	// Ancients returns the ancient item numbers in the ancient store.
 	Ancients() (uint64, error)
 
+	// AncientTail returns the number of the first ancient block whose body and
+	// receipts were not yet expired from the ancient store.
+	AncientTail() (uint64, error)
+
 	// AncientSize returns the ancient size of the specified category.
 	AncientSize(kind string) (uint64, error)
 }
@@ -92,6 +96,10 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// TruncateAncientTail discards the bodies and receipts of the ancient blocks
+	// below the given number from the ancient store.
+	TruncateAncientTail(tail uint64) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
@@ -103,6 +103,8 @@ type SyncProgress struct {
 	HighestBlock  uint64 // Highest alleged block number in the chain
 	PulledStates  uint64 // Number of state trie entries already downloaded
 	KnownStates   uint64 // Total number of state trie entries known about
+	TargetBlock   uint64 // Block number of the trusted sync target (zero if none)
+	TargetHeaders uint64 // Number of headers retrieved backwards from the sync target
 }
 
 // ChainSyncReader wraps access to the node's current sync status. If there's no
@@ -0,0 +1,374 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package era implements a flat-file archive format for chain history.
+//
+// An archive holds a contiguous range of at most MaxBlocks blocks, each stored
+// with its header, body, receipts and total difficulty. The layout is:
+//
+//   header  := magic | version | start
+//   entry   := length | snappy(rlp([header, body, receipts, td]))
+//   index   := offset(entry 0) | ... | offset(entry N-1)
+//   trailer := accumulator | start | count | offset(index)
+//
+// All integers are 8 byte big endian, except for the 4 byte entry length. The
+// accumulator is a merkle root committing to the hash and total difficulty of
+// every block in the archive, so a single trusted hash per archive is enough to
+// authenticate the entire content.
+package era
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/golang/snappy"
+)
+
+const (
+	// MaxBlocks is the maximum number of blocks stored in a single archive.
+	MaxBlocks = 8192
+
+	// version is the current version of the archive format.
+	version = 1
+
+	headerSize  = 8 + 8 + 8
+	trailerSize = common.HashLength + 8 + 8 + 8
+)
+
+var (
+	// magic is the prefix of every archive file.
+	magic = []byte("gethera\x00")
+
+	// ErrTooManyBlocks is returned if more than MaxBlocks blocks are added to
+	// an archive.
+	ErrTooManyBlocks = errors.New("archive full")
+
+	// errNotFound is returned if a block is requested which is not contained
+	// in the archive.
+	errNotFound = errors.New("block not found in archive")
+)
+
+// entry is the RLP encoded content of a single block in the archive.
+type entry struct {
+	Header   *types.Header
+	Body     *types.Body
+	Receipts []*types.Receipt
+	TD       *big.Int
+}
+
+// Builder assembles an archive from consecutive blocks.
+type Builder struct {
+	w       io.Writer
+	start   uint64
+	written uint64
+
+	offsets []uint64
+	hashes  []common.Hash
+	tds     []*big.Int
+}
+
+// NewBuilder creates an archive builder writing into w, with the first block
+// to be added being the one with the given number.
+func NewBuilder(w io.Writer, start uint64) (*Builder, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint64(header[8:], version)
+	binary.BigEndian.PutUint64(header[16:], start)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Builder{w: w, start: start, written: headerSize}, nil
+}
+
+// Add appends a block, its receipts and total difficulty to the archive.
+func (b *Builder) Add(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	if len(b.hashes) >= MaxBlocks {
+		return ErrTooManyBlocks
+	}
+	if want := b.start + uint64(len(b.hashes)); block.NumberU64() != want {
+		return fmt.Errorf("unexpected block number: have %d, want %d", block.NumberU64(), want)
+	}
+	if n := len(b.hashes); n > 0 && block.ParentHash() != b.hashes[n-1] {
+		return fmt.Errorf("non contiguous block %d: parent %x, want %x", block.NumberU64(), block.ParentHash(), b.hashes[n-1])
+	}
+	blob, err := rlp.EncodeToBytes(&entry{
+		Header:   block.Header(),
+		Body:     block.Body(),
+		Receipts: receipts,
+		TD:       td,
+	})
+	if err != nil {
+		return err
+	}
+	blob = snappy.Encode(nil, blob)
+
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(blob)))
+	if _, err := b.w.Write(length); err != nil {
+		return err
+	}
+	if _, err := b.w.Write(blob); err != nil {
+		return err
+	}
+	b.offsets = append(b.offsets, b.written)
+	b.hashes = append(b.hashes, block.Hash())
+	b.tds = append(b.tds, new(big.Int).Set(td))
+	b.written += uint64(len(length) + len(blob))
+	return nil
+}
+
+// Finalize writes out the index and the trailer of the archive, returning the
+// accumulator root of the contained blocks.
+func (b *Builder) Finalize() (common.Hash, error) {
+	if len(b.hashes) == 0 {
+		return common.Hash{}, errors.New("empty archive")
+	}
+	root := ComputeAccumulator(b.hashes, b.tds)
+
+	buf := make([]byte, 8*len(b.offsets)+trailerSize)
+	for i, offset := range b.offsets {
+		binary.BigEndian.PutUint64(buf[8*i:], offset)
+	}
+	trailer := buf[8*len(b.offsets):]
+	copy(trailer, root[:])
+	binary.BigEndian.PutUint64(trailer[common.HashLength:], b.start)
+	binary.BigEndian.PutUint64(trailer[common.HashLength+8:], uint64(len(b.offsets)))
+	binary.BigEndian.PutUint64(trailer[common.HashLength+16:], b.written)
+
+	if _, err := b.w.Write(buf); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+// ComputeAccumulator calculates the accumulator root of a list of block hashes
+// and their total difficulties. The leaves are padded to MaxBlocks and the
+// number of blocks is mixed into the root.
+func ComputeAccumulator(hashes []common.Hash, tds []*big.Int) common.Hash {
+	level := make([]common.Hash, MaxBlocks)
+	for i := range hashes {
+		level[i] = crypto.Keccak256Hash(hashes[i][:], common.BigToHash(tds[i]).Bytes())
+	}
+	for len(level) > 1 {
+		next := make([]common.Hash, len(level)/2)
+		for i := range next {
+			next[i] = crypto.Keccak256Hash(level[2*i][:], level[2*i+1][:])
+		}
+		level = next
+	}
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, uint64(len(hashes)))
+	return crypto.Keccak256Hash(level[0][:], count)
+}
+
+// Filename returns the canonical name of an archive of the given network,
+// starting at the given epoch and with the given accumulator root.
+func Filename(network string, epoch uint64, root common.Hash) string {
+	return fmt.Sprintf("%s-%05d-%x.era", network, epoch, root[:4])
+}
+
+// Era is an opened archive file.
+type Era struct {
+	f           *os.File
+	start       uint64
+	count       uint64
+	accumulator common.Hash
+	offsets     []uint64
+	end         uint64 // Offset of the index, the end of the entries
+}
+
+// Open opens the archive at the given path and loads its index.
+func Open(path string) (*Era, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEra(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid archive %s: %v", path, err)
+	}
+	return e, nil
+}
+
+// newEra parses the header, trailer and index of an archive.
+func newEra(f *os.File) (*Era, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(stat.Size())
+	if size < headerSize+trailerSize {
+		return nil, errors.New("file too short")
+	}
+	header := make([]byte, headerSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:8], magic) {
+		return nil, errors.New("invalid magic")
+	}
+	if v := binary.BigEndian.Uint64(header[8:]); v != version {
+		return nil, fmt.Errorf("unsupported version %d", v)
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := f.ReadAt(trailer, int64(size-trailerSize)); err != nil {
+		return nil, err
+	}
+	e := &Era{
+		f:           f,
+		start:       binary.BigEndian.Uint64(trailer[common.HashLength:]),
+		count:       binary.BigEndian.Uint64(trailer[common.HashLength+8:]),
+		accumulator: common.BytesToHash(trailer[:common.HashLength]),
+		end:         binary.BigEndian.Uint64(trailer[common.HashLength+16:]),
+	}
+	if start := binary.BigEndian.Uint64(header[16:]); start != e.start {
+		return nil, fmt.Errorf("start mismatch: header %d, trailer %d", start, e.start)
+	}
+	if e.count == 0 || e.count > MaxBlocks {
+		return nil, fmt.Errorf("invalid block count %d", e.count)
+	}
+	if e.end < headerSize || e.end+8*e.count+trailerSize != size {
+		return nil, errors.New("invalid index offset")
+	}
+	index := make([]byte, 8*e.count)
+	if _, err := f.ReadAt(index, int64(e.end)); err != nil {
+		return nil, err
+	}
+	e.offsets = make([]uint64, e.count)
+	for i := range e.offsets {
+		e.offsets[i] = binary.BigEndian.Uint64(index[8*i:])
+		if e.offsets[i] < headerSize || e.offsets[i]+4 > e.end || (i > 0 && e.offsets[i] <= e.offsets[i-1]) {
+			return nil, fmt.Errorf("invalid offset for entry %d", i)
+		}
+	}
+	return e, nil
+}
+
+// Close closes the underlying archive file.
+func (e *Era) Close() error {
+	return e.f.Close()
+}
+
+// Start returns the number of the first block in the archive.
+func (e *Era) Start() uint64 {
+	return e.start
+}
+
+// Count returns the number of blocks in the archive.
+func (e *Era) Count() uint64 {
+	return e.count
+}
+
+// Accumulator returns the accumulator root stored in the archive.
+func (e *Era) Accumulator() common.Hash {
+	return e.accumulator
+}
+
+// GetBlockByNumber retrieves a block, its receipts and total difficulty from
+// the archive.
+func (e *Era) GetBlockByNumber(number uint64) (*types.Block, types.Receipts, *big.Int, error) {
+	if number < e.start || number >= e.start+e.count {
+		return nil, nil, nil, errNotFound
+	}
+	offset := e.offsets[number-e.start]
+
+	length := make([]byte, 4)
+	if _, err := e.f.ReadAt(length, int64(offset)); err != nil {
+		return nil, nil, nil, err
+	}
+	size := uint64(binary.BigEndian.Uint32(length))
+	if offset+4+size > e.end {
+		return nil, nil, nil, fmt.Errorf("entry %d overflows index", number)
+	}
+	blob := make([]byte, size)
+	if _, err := e.f.ReadAt(blob, int64(offset+4)); err != nil {
+		return nil, nil, nil, err
+	}
+	blob, err := snappy.Decode(nil, blob)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("entry %d: %v", number, err)
+	}
+	var item entry
+	if err := rlp.DecodeBytes(blob, &item); err != nil {
+		return nil, nil, nil, fmt.Errorf("entry %d: %v", number, err)
+	}
+	if item.Header.Number.Uint64() != number {
+		return nil, nil, nil, fmt.Errorf("entry %d: number mismatch %d", number, item.Header.Number)
+	}
+	block := types.NewBlockWithHeader(item.Header).WithBody(item.Body.Transactions, item.Body.Uncles)
+	return block, item.Receipts, item.TD, nil
+}
+
+// Verify checks the integrity of the entire archive: every block body and the
+// receipts are checked against their header, headers must form a chain with
+// consistent total difficulties, and the accumulator root recomputed from the
+// content must match the stored one.
+func (e *Era) Verify() error {
+	var (
+		hashes = make([]common.Hash, 0, e.count)
+		tds    = make([]*big.Int, 0, e.count)
+	)
+	for number := e.start; number < e.start+e.count; number++ {
+		block, receipts, td, err := e.GetBlockByNumber(number)
+		if err != nil {
+			return err
+		}
+		if err := VerifyBlock(block, receipts); err != nil {
+			return err
+		}
+		if n := len(hashes); n > 0 {
+			if block.ParentHash() != hashes[n-1] {
+				return fmt.Errorf("block %d: parent hash mismatch", number)
+			}
+			if want := new(big.Int).Add(tds[n-1], block.Difficulty()); td.Cmp(want) != 0 {
+				return fmt.Errorf("block %d: total difficulty mismatch: have %v, want %v", number, td, want)
+			}
+		}
+		hashes = append(hashes, block.Hash())
+		tds = append(tds, td)
+	}
+	if root := ComputeAccumulator(hashes, tds); root != e.accumulator {
+		return fmt.Errorf("accumulator mismatch: have %x, want %x", root, e.accumulator)
+	}
+	return nil
+}
+
+// VerifyBlock checks that the transactions, uncles and receipts of a block match
+// the roots committed to in its header.
+func VerifyBlock(block *types.Block, receipts types.Receipts) error {
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != block.TxHash() {
+		return fmt.Errorf("block %d: transaction root mismatch: have %x, want %x", block.NumberU64(), hash, block.TxHash())
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return fmt.Errorf("block %d: uncle root mismatch: have %x, want %x", block.NumberU64(), hash, block.UncleHash())
+	}
+	if hash := types.DeriveSha(receipts, trie.NewStackTrie(nil)); hash != block.ReceiptHash() {
+		return fmt.Errorf("block %d: receipt root mismatch: have %x, want %x", block.NumberU64(), hash, block.ReceiptHash())
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// makeChain generates a chain of n blocks with a few transactions in each,
+// returning the blocks, their receipts and total difficulties.
+func makeChain(t *testing.T, n int) ([]*types.Block, []types.Receipts, []*big.Int) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{testAddress: {Balance: big.NewInt(1000000000000000000)}}}
+		genesis = gspec.MustCommit(db)
+		signer  = types.LatestSigner(params.TestChainConfig)
+	)
+	blocks, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, n, func(i int, gen *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(gen.TxNonce(testAddress), common.Address{0x01}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	blocks = append([]*types.Block{genesis}, blocks...)
+	receipts = append([]types.Receipts{nil}, receipts...)
+
+	tds := make([]*big.Int, len(blocks))
+	tds[0] = genesis.Difficulty()
+	for i := 1; i < len(blocks); i++ {
+		tds[i] = new(big.Int).Add(tds[i-1], blocks[i].Difficulty())
+	}
+	return blocks, receipts, tds
+}
+
+// writeArchive writes the given blocks into an archive file.
+func writeArchive(t *testing.T, path string, blocks []*types.Block, receipts []types.Receipts, tds []*big.Int) common.Hash {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	builder, err := NewBuilder(f, blocks[0].NumberU64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		if err := builder.Add(block, receipts[i], tds[i]); err != nil {
+			t.Fatalf("failed to add block %d: %v", block.NumberU64(), err)
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// Tests that an archive can be written, read back and verified.
+func TestArchiveRoundtrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "era-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blocks, receipts, tds := makeChain(t, 64)
+	path := filepath.Join(dir, "test.era")
+	root := writeArchive(t, path, blocks, receipts, tds)
+
+	e, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if e.Start() != 0 || e.Count() != uint64(len(blocks)) {
+		t.Fatalf("range mismatch: have %d+%d, want %d+%d", e.Start(), e.Count(), 0, len(blocks))
+	}
+	if e.Accumulator() != root {
+		t.Fatalf("accumulator mismatch: have %x, want %x", e.Accumulator(), root)
+	}
+	for i, want := range blocks {
+		block, rs, td, err := e.GetBlockByNumber(uint64(i))
+		if err != nil {
+			t.Fatalf("failed to read block %d: %v", i, err)
+		}
+		if block.Hash() != want.Hash() {
+			t.Errorf("block %d hash mismatch: have %x, want %x", i, block.Hash(), want.Hash())
+		}
+		if len(rs) != len(receipts[i]) {
+			t.Errorf("block %d receipt count mismatch: have %d, want %d", i, len(rs), len(receipts[i]))
+		}
+		if td.Cmp(tds[i]) != 0 {
+			t.Errorf("block %d td mismatch: have %v, want %v", i, td, tds[i])
+		}
+	}
+	if _, _, _, err := e.GetBlockByNumber(uint64(len(blocks))); err == nil {
+		t.Errorf("retrieved block out of range")
+	}
+	if err := e.Verify(); err != nil {
+		t.Fatalf("failed to verify archive: %v", err)
+	}
+}
+
+// Tests that tampered archives are detected by the verification.
+func TestArchiveTampered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "era-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blocks, receipts, tds := makeChain(t, 16)
+
+	// Drop the receipts of a non-empty block
+	dropped := receipts[3]
+	receipts[3] = nil
+	path := filepath.Join(dir, "receipts.era")
+	writeArchive(t, path, blocks, receipts, tds)
+
+	e, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Verify(); err == nil {
+		t.Errorf("archive with missing receipts verified")
+	}
+	e.Close()
+
+	// Restore the receipts but lie about the total difficulty
+	receipts[3] = dropped
+	tds[5] = new(big.Int).Add(tds[5], common.Big1)
+	path = filepath.Join(dir, "td.era")
+	writeArchive(t, path, blocks, receipts, tds)
+
+	e, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Verify(); err == nil {
+		t.Errorf("archive with invalid total difficulty verified")
+	}
+	e.Close()
+
+	// Ensure non contiguous blocks are rejected by the builder
+	f, err := os.Create(filepath.Join(dir, "gap.era"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	builder, _ := NewBuilder(f, 0)
+	builder.Add(blocks[0], receipts[0], tds[0])
+	if err := builder.Add(blocks[2], receipts[2], tds[2]); err == nil {
+		t.Errorf("non contiguous block accepted")
+	}
+}
@@ -71,6 +71,8 @@ func (s *PublicEthereumAPI) GasPrice(ctx context.Context) (*hexutil.Big, error)
 // - highestBlock:  block number of the highest block header this node has received from peers
 // - pulledStates:  number of state entries processed until now
 // - knownStates:   number of known state entries that still need to be pulled
+// - targetBlock:   block number of the trusted sync target, if one is configured
+// - targetHeaders: number of headers retrieved backwards from the sync target
 func (s *PublicEthereumAPI) Syncing() (interface{}, error) {
 	progress := s.b.Downloader().Progress()
 
@@ -79,13 +81,18 @@ func (s *PublicEthereumAPI) Syncing() (interface{}, error) {
 		return false, nil
 	}
 	// Otherwise gather the block sync stats
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"startingBlock": hexutil.Uint64(progress.StartingBlock),
 		"currentBlock":  hexutil.Uint64(progress.CurrentBlock),
 		"highestBlock":  hexutil.Uint64(progress.HighestBlock),
 		"pulledStates":  hexutil.Uint64(progress.PulledStates),
 		"knownStates":   hexutil.Uint64(progress.KnownStates),
-	}, nil
+	}
+	if progress.TargetBlock != 0 {
+		stats["targetBlock"] = hexutil.Uint64(progress.TargetBlock)
+		stats["targetHeaders"] = hexutil.Uint64(progress.TargetHeaders)
+	}
+	return stats, nil
 }
 
 // PublicTxPoolAPI offers and API for the transaction pool. It only operates on data that is non confidential.
@@ -110,7 +117,7 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range pending {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
@@ -118,13 +125,36 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range queue {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
 	return content
 }
 
+// ContentFrom returns the transactions contained within the transaction pool
+// that were sent from the given address.
+func (s *PublicTxPoolAPI) ContentFrom(addr common.Address) map[string]map[string]*RPCTransaction {
+	content := make(map[string]map[string]*RPCTransaction, 2)
+	pending, queue := s.b.TxPoolContentFrom(addr)
+
+	// Build the pending transactions
+	dump := make(map[string]*RPCTransaction, len(pending))
+	for _, tx := range pending {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
+	}
+	content["pending"] = dump
+
+	// Build the queued transactions
+	dump = make(map[string]*RPCTransaction, len(queue))
+	for _, tx := range queue {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
+	}
+	content["queued"] = dump
+
+	return content
+}
+
 // Status returns the number of pending and queued transaction in the pool.
 func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	pending, queue := s.b.Stats()
@@ -1265,8 +1295,8 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 	return result
 }
 
-// newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
-func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
+// NewRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
+func NewRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
 	return newRPCTransaction(tx, common.Hash{}, 0, 0)
 }
 
@@ -1395,7 +1425,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
-		return newRPCPendingTransaction(tx), nil
+		return NewRPCPendingTransaction(tx), nil
 	}
 
 	// Transaction unknown, return as such
@@ -1690,6 +1720,93 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, input
 	return SubmitTransaction(ctx, s.b, tx)
 }
 
+// ConditionalTxArgs represents the conditions a transaction may be included under.
+type ConditionalTxArgs struct {
+	BlockNumberMin *hexutil.Uint64                                `json:"blockNumberMin"`
+	BlockNumberMax *hexutil.Uint64                                `json:"blockNumberMax"`
+	TimestampMin   *hexutil.Uint64                                `json:"timestampMin"`
+	TimestampMax   *hexutil.Uint64                                `json:"timestampMax"`
+	KnownAccounts  map[common.Address]map[common.Hash]common.Hash `json:"knownAccounts"`
+}
+
+// toConditions converts the arguments to the conditions tracked by the pool.
+func (args *ConditionalTxArgs) toConditions() *core.TxConditions {
+	return &core.TxConditions{
+		BlockNumberMin: (*uint64)(args.BlockNumberMin),
+		BlockNumberMax: (*uint64)(args.BlockNumberMax),
+		TimestampMin:   (*uint64)(args.TimestampMin),
+		TimestampMax:   (*uint64)(args.TimestampMax),
+		KnownAccounts:  args.KnownAccounts,
+	}
+}
+
+// SendRawTransactionConditional adds the signed transaction to the transaction
+// pool, to be included only in blocks within the given block number and timestamp
+// window, and only while the given storage slots hold the expected values. The
+// transaction is dropped once the conditions can no longer hold.
+//
+// The conditions are only enforced by the local miner, the transaction is still
+// propagated to the network, where other miners may include it unconditionally.
+func (s *PublicTransactionPoolAPI) SendRawTransactionConditional(ctx context.Context, input hexutil.Bytes, args ConditionalTxArgs) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+		return common.Hash{}, err
+	}
+	if !s.b.UnprotectedAllowed() && !tx.Protected() {
+		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
+	}
+	if err := s.b.SendConditionalTx(ctx, tx, args.toConditions()); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted conditional transaction", "hash", tx.Hash().Hex(), "nonce", tx.Nonce())
+	return tx.Hash(), nil
+}
+
+// defaultPrivateTxMaxBlocks is the number of blocks a private transaction waits
+// for inclusion by default before expiring.
+const defaultPrivateTxMaxBlocks = 25
+
+// PrivateTxArgs represents the options for submitting a private transaction.
+type PrivateTxArgs struct {
+	MaxBlocks  *hexutil.Uint64 `json:"maxBlocks"`
+	MakePublic bool            `json:"makePublic"`
+}
+
+// SendPrivateRawTransaction adds the signed transaction to the private pool, to be
+// included by the local miner only without ever being announced to the network.
+// If not included within the allowed number of blocks (at most core.MaxPrivateTxBlocks),
+// the transaction is dropped, or broadcast like a regular one if requested.
+func (s *PublicTransactionPoolAPI) SendPrivateRawTransaction(ctx context.Context, input hexutil.Bytes, args *PrivateTxArgs) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+		return common.Hash{}, err
+	}
+	if !s.b.UnprotectedAllowed() && !tx.Protected() {
+		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
+	}
+	var (
+		maxBlocks  = uint64(defaultPrivateTxMaxBlocks)
+		makePublic bool
+	)
+	if args != nil {
+		if args.MaxBlocks != nil {
+			maxBlocks = uint64(*args.MaxBlocks)
+		}
+		makePublic = args.MakePublic
+	}
+	if err := s.b.SendPrivateTx(ctx, tx, maxBlocks, makePublic); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted private transaction", "hash", tx.Hash().Hex(), "nonce", tx.Nonce(), "maxblocks", maxBlocks, "public", makePublic)
+	return tx.Hash(), nil
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
@@ -1769,7 +1886,7 @@ func (s *PublicTransactionPoolAPI) PendingTransactions() ([]*RPCTransaction, err
 	for _, tx := range pending {
 		from, _ := types.Sender(s.signer, tx)
 		if _, exists := accounts[from]; exists {
-			transactions = append(transactions, newRPCPendingTransaction(tx))
+			transactions = append(transactions, NewRPCPendingTransaction(tx))
 		}
 	}
 	return transactions, nil
@@ -0,0 +1,238 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callBundleTimeout is the maximum time a bundle simulation may run for.
+const callBundleTimeout = 5 * time.Second
+
+// PublicBundleAPI provides an API to submit transaction bundles for atomic
+// inclusion in a block and to simulate them.
+type PublicBundleAPI struct {
+	b Backend
+}
+
+// NewPublicBundleAPI creates a new bundle API.
+func NewPublicBundleAPI(b Backend) *PublicBundleAPI {
+	return &PublicBundleAPI{b}
+}
+
+// SendBundleArgs represents the arguments for submitting a bundle.
+type SendBundleArgs struct {
+	Txs          []hexutil.Bytes `json:"txs"`
+	BlockNumber  hexutil.Uint64  `json:"blockNumber"`
+	MinTimestamp *hexutil.Uint64 `json:"minTimestamp"`
+	MaxTimestamp *hexutil.Uint64 `json:"maxTimestamp"`
+}
+
+// decodeBundleTxs decodes the signed transactions of a bundle.
+func decodeBundleTxs(b Backend, encoded []hexutil.Bytes) (types.Transactions, error) {
+	if len(encoded) == 0 {
+		return nil, errors.New("bundle contains no transactions")
+	}
+	txs := make(types.Transactions, len(encoded))
+	for i, input := range encoded {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(input); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		if err := checkTxFee(tx.GasPrice(), tx.Gas(), b.RPCTxFeeCap()); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		if !b.UnprotectedAllowed() && !tx.Protected() {
+			return nil, fmt.Errorf("invalid transaction %d: only replay-protected (EIP-155) transactions allowed over RPC", i)
+		}
+		txs[i] = tx
+	}
+	return txs, nil
+}
+
+// SendBundle submits an ordered list of signed transactions to be included in
+// the given block atomically: all of them in order, or none. Bundles containing
+// failing or reverting transactions are never included. Bundles may not exceed
+// the block gas limit, and the worst paying ones are evicted if too many are
+// pending. It returns the hash of the bundle.
+func (s *PublicBundleAPI) SendBundle(ctx context.Context, args SendBundleArgs) (common.Hash, error) {
+	txs, err := decodeBundleTxs(s.b, args.Txs)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	bundle := &types.Bundle{
+		Txs:         txs,
+		BlockNumber: uint64(args.BlockNumber),
+	}
+	if args.MinTimestamp != nil {
+		bundle.MinTimestamp = uint64(*args.MinTimestamp)
+	}
+	if args.MaxTimestamp != nil {
+		bundle.MaxTimestamp = uint64(*args.MaxTimestamp)
+	}
+	if err := s.b.SendBundle(ctx, bundle); err != nil {
+		return common.Hash{}, err
+	}
+	return bundle.Hash(), nil
+}
+
+// CallBundleArgs represents the arguments for simulating a bundle.
+type CallBundleArgs struct {
+	Txs              []hexutil.Bytes       `json:"txs"`
+	StateBlockNumber rpc.BlockNumberOrHash `json:"stateBlockNumber"`
+	BlockNumber      *hexutil.Uint64       `json:"blockNumber"`
+	Coinbase         *common.Address       `json:"coinbase"`
+	Timestamp        *hexutil.Uint64       `json:"timestamp"`
+	GasLimit         *hexutil.Uint64       `json:"gasLimit"`
+}
+
+// BundleTxResult is the outcome of a single transaction of a simulated bundle.
+type BundleTxResult struct {
+	TxHash       common.Hash    `json:"txHash"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	GasPrice     *hexutil.Big   `json:"gasPrice"`
+	CoinbaseDiff *hexutil.Big   `json:"coinbaseDiff"`
+	ReturnData   hexutil.Bytes  `json:"returnData,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	Revert       hexutil.Bytes  `json:"revert,omitempty"`
+}
+
+// CallBundleResult is the outcome of a simulated bundle.
+type CallBundleResult struct {
+	BundleHash       common.Hash      `json:"bundleHash"`
+	Results          []BundleTxResult `json:"results"`
+	TotalGasUsed     hexutil.Uint64   `json:"totalGasUsed"`
+	CoinbaseDiff     *hexutil.Big     `json:"coinbaseDiff"`
+	BundleGasPrice   *hexutil.Big     `json:"bundleGasPrice"`
+	StateBlockNumber hexutil.Uint64   `json:"stateBlockNumber"`
+}
+
+// CallBundle simulates a bundle on top of the given state, in a block following
+// it, without submitting the bundle. Unlike inclusion by the miner, reverting
+// transactions are reported instead of rejecting the whole bundle.
+func (s *PublicBundleAPI) CallBundle(ctx context.Context, args CallBundleArgs) (*CallBundleResult, error) {
+	txs, err := decodeBundleTxs(s.b, args.Txs)
+	if err != nil {
+		return nil, err
+	}
+	state, parent, err := s.b.StateAndHeaderByNumberOrHash(ctx, args.StateBlockNumber)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   parent.Coinbase,
+		Difficulty: parent.Difficulty,
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + 1,
+	}
+	if args.Coinbase != nil {
+		header.Coinbase = *args.Coinbase
+	}
+	if args.BlockNumber != nil {
+		header.Number = new(big.Int).SetUint64(uint64(*args.BlockNumber))
+	}
+	if args.Timestamp != nil {
+		header.Time = uint64(*args.Timestamp)
+	}
+	if args.GasLimit != nil {
+		header.GasLimit = uint64(*args.GasLimit)
+	}
+	// Setup context so it may be cancelled when the simulation takes too long
+	ctx, cancel := context.WithTimeout(ctx, callBundleTimeout)
+	defer cancel()
+
+	var (
+		signer   = types.MakeSigner(s.b.ChainConfig(), header.Number)
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		balance  = state.GetBalance(header.Coinbase)
+		totalGas uint64
+	)
+	result := &CallBundleResult{
+		BundleHash:       (&types.Bundle{Txs: txs}).Hash(),
+		StateBlockNumber: hexutil.Uint64(parent.Number.Uint64()),
+	}
+	for i, tx := range txs {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		state.Prepare(tx.Hash(), common.Hash{}, i)
+
+		evm, vmError, err := s.b.GetEVM(ctx, msg, state, header)
+		if err != nil {
+			return nil, err
+		}
+		// The engine may not be able to derive the beneficiary of a block which
+		// isn't sealed, use the requested one
+		evm.Context.Coinbase = header.Coinbase
+
+		// Wait for the context to be done and cancel the evm. Even if the
+		// EVM has finished, cancelling may be done (repeatedly)
+		go func() {
+			<-ctx.Done()
+			evm.Cancel()
+		}()
+		txBalance := state.GetBalance(header.Coinbase)
+		res, err := core.ApplyMessage(evm, msg, gp)
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", callBundleTimeout)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d [%v] failed: %w", i, tx.Hash().Hex(), err)
+		}
+		state.Finalise(s.b.ChainConfig().IsEIP158(header.Number))
+
+		txResult := BundleTxResult{
+			TxHash:       tx.Hash(),
+			GasUsed:      hexutil.Uint64(res.UsedGas),
+			GasPrice:     (*hexutil.Big)(tx.GasPrice()),
+			CoinbaseDiff: (*hexutil.Big)(new(big.Int).Sub(state.GetBalance(header.Coinbase), txBalance)),
+		}
+		if res.Err != nil {
+			txResult.Error = res.Err.Error()
+			txResult.Revert = res.Revert()
+		} else {
+			txResult.ReturnData = res.Return()
+		}
+		result.Results = append(result.Results, txResult)
+		totalGas += res.UsedGas
+	}
+	payment := new(big.Int).Sub(state.GetBalance(header.Coinbase), balance)
+
+	result.TotalGasUsed = hexutil.Uint64(totalGas)
+	result.CoinbaseDiff = (*hexutil.Big)(payment)
+	result.BundleGasPrice = (*hexutil.Big)(new(big.Int))
+	if totalGas > 0 {
+		result.BundleGasPrice = (*hexutil.Big)(new(big.Int).Div(payment, new(big.Int).SetUint64(totalGas)))
+	}
+	return result, nil
+}
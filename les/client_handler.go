@@ -72,7 +72,7 @@ func newClientHandler(ulcServers []string, ulcFraction int, checkpoint *params.T
 		height = (checkpoint.SectionIndex+1)*params.CHTFrequency - 1
 	}
 	handler.fetcher = newLightFetcher(backend.blockchain, backend.engine, backend.peers, handler.ulc, backend.chainDb, backend.reqDist, handler.synchronise)
-	handler.downloader = downloader.New(height, backend.chainDb, nil, backend.eventMux, nil, backend.blockchain, handler.removePeer)
+	handler.downloader = downloader.New(height, backend.chainDb, nil, backend.eventMux, nil, backend.blockchain, handler.dropPeer)
 	handler.backend.peers.subscribe((*downloaderPeerNotify)(handler))
 	return handler
 }
@@ -368,6 +368,12 @@ func (h *clientHandler) removePeer(id string) {
 	h.backend.peers.unregister(id)
 }
 
+// dropPeer is the callback of the downloader to remove a misbehaving peer. The
+// penalty is ignored as light servers are not scored by the networking layer.
+func (h *clientHandler) dropPeer(id string, penalty p2p.Penalty) {
+	h.removePeer(id)
+}
+
 type peerConnection struct {
 	handler *clientHandler
 	peer    *serverPeer
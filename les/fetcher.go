@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/light"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 )
 
@@ -166,7 +167,7 @@ func newLightFetcher(chain *light.LightChain, engine consensus.Engine, peers *se
 		return engine.VerifyHeader(chain, header, ulc == nil)
 	}
 	heighter := func() uint64 { return chain.CurrentHeader().Number.Uint64() }
-	dropper := func(id string) { peers.unregister(id) }
+	dropper := func(id string, penalty p2p.Penalty) { peers.unregister(id) }
 	inserter := func(headers []*types.Header) (int, error) {
 		// Disable PoW checking explicitly if we are running in ulc mode.
 		checkFreq := 1
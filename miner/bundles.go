@@ -0,0 +1,315 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// maxPendingBundles is the maximum number of bundles tracked at once.
+	maxPendingBundles = 1024
+
+	// maxBundleTxs is the maximum number of transactions in a single bundle.
+	maxBundleTxs = 64
+
+	// maxBundleSize is the maximum encoded size of the transactions of a bundle.
+	maxBundleSize = 512 * 1024
+
+	// maxBundleFutureBlocks is how far ahead of the chain head a bundle may target.
+	maxBundleFutureBlocks = 256
+
+	// maxSimulatedBundles is the maximum number of bundles simulated per block.
+	maxSimulatedBundles = 128
+
+	// bundleSimulationTimeout is the maximum time spent simulating the bundles of
+	// a block, so that they can't delay sealing it.
+	bundleSimulationTimeout = 250 * time.Millisecond
+)
+
+var (
+	errBundleEmpty     = errors.New("bundle contains no transactions")
+	errBundleOversized = errors.New("bundle too large")
+	errBundleGasLimit  = errors.New("bundle exceeds block gas limit")
+	errBundleTimestamp = errors.New("bundle minimum timestamp exceeds maximum")
+	errBundleStale     = errors.New("bundle target block already mined")
+	errBundleTooFar    = errors.New("bundle target block too far in the future")
+	errBundlePoolFull  = errors.New("too many pending bundles")
+	errBundleReverted  = errors.New("bundle transaction reverted")
+	errBundleNoPayment = errors.New("bundle pays nothing to the coinbase")
+)
+
+// pooledBundle is a bundle tracked by the pool, along with the effective price it
+// pays, used to evict the cheapest bundles when the pool is full.
+type pooledBundle struct {
+	bundle *types.Bundle
+	price  *big.Int // Price of the last simulation, or the gas price until simulated
+}
+
+// bundlePool tracks the bundles submitted for inclusion in upcoming blocks.
+type bundlePool struct {
+	bundles []*pooledBundle
+	lock    sync.Mutex
+}
+
+// add validates a bundle against the current head and schedules it for inclusion.
+// If the pool is full, the cheapest bundle is evicted if it pays less than the
+// new one.
+func (p *bundlePool) add(bundle *types.Bundle, head *types.Header) error {
+	if len(bundle.Txs) == 0 {
+		return errBundleEmpty
+	}
+	if len(bundle.Txs) > maxBundleTxs {
+		return errBundleOversized
+	}
+	var (
+		gas  uint64
+		size common.StorageSize
+	)
+	for _, tx := range bundle.Txs {
+		if size += tx.Size(); size > maxBundleSize {
+			return errBundleOversized
+		}
+		if gas += tx.Gas(); gas > head.GasLimit {
+			return errBundleGasLimit
+		}
+	}
+	if bundle.MaxTimestamp != 0 && bundle.MinTimestamp > bundle.MaxTimestamp {
+		return errBundleTimestamp
+	}
+	number := head.Number.Uint64()
+	if bundle.BlockNumber <= number {
+		return errBundleStale
+	}
+	if bundle.BlockNumber > number+maxBundleFutureBlocks {
+		return errBundleTooFar
+	}
+	entry := &pooledBundle{bundle: bundle, price: bundleGasPrice(bundle)}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.prune(number + 1)
+	if len(p.bundles) >= maxPendingBundles {
+		cheapest := 0
+		for i, pooled := range p.bundles {
+			if pooled.price.Cmp(p.bundles[cheapest].price) < 0 {
+				cheapest = i
+			}
+		}
+		if p.bundles[cheapest].price.Cmp(entry.price) >= 0 {
+			return errBundlePoolFull
+		}
+		log.Trace("Evicted underpriced bundle", "hash", p.bundles[cheapest].bundle.Hash(), "price", p.bundles[cheapest].price)
+		p.bundles[cheapest] = entry
+		return nil
+	}
+	p.bundles = append(p.bundles, entry)
+	return nil
+}
+
+// bundleGasPrice returns the average gas price of the transactions of a bundle,
+// weighted by their gas limits. It estimates the effective price of a bundle
+// until it gets simulated.
+func bundleGasPrice(bundle *types.Bundle) *big.Int {
+	var (
+		fees = new(big.Int)
+		gas  = new(big.Int)
+	)
+	for _, tx := range bundle.Txs {
+		limit := new(big.Int).SetUint64(tx.Gas())
+		fees.Add(fees, limit.Mul(limit, tx.GasPrice()))
+		gas.Add(gas, new(big.Int).SetUint64(tx.Gas()))
+	}
+	if gas.Sign() == 0 {
+		return fees
+	}
+	return fees.Div(fees, gas)
+}
+
+// pending returns the bundles eligible for inclusion in a block with the given
+// number and timestamp, best paying first, dropping the ones targeting earlier
+// blocks.
+func (p *bundlePool) pending(number uint64, time uint64) []*pooledBundle {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.prune(number)
+
+	var bundles []*pooledBundle
+	for _, pooled := range p.bundles {
+		if pooled.bundle.Eligible(number, time) {
+			bundles = append(bundles, pooled)
+		}
+	}
+	sort.SliceStable(bundles, func(i, j int) bool {
+		return bundles[i].price.Cmp(bundles[j].price) > 0
+	})
+	return bundles
+}
+
+// reprice updates the effective price of a pooled bundle after simulating it.
+func (p *bundlePool) reprice(pooled *pooledBundle, price *big.Int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pooled.price = price
+}
+
+// prune drops all the bundles targeting blocks before the given number. The
+// lock must be held by the caller.
+func (p *bundlePool) prune(number uint64) {
+	bundles := p.bundles[:0]
+	for _, pooled := range p.bundles {
+		if pooled.bundle.BlockNumber >= number {
+			bundles = append(bundles, pooled)
+		}
+	}
+	for i := len(bundles); i < len(p.bundles); i++ {
+		p.bundles[i] = nil
+	}
+	p.bundles = bundles
+}
+
+// simulatedBundle is a bundle which was successfully executed on top of the
+// pending state, along with the price it effectively pays.
+type simulatedBundle struct {
+	bundle  *types.Bundle
+	gasUsed uint64
+	price   *big.Int // Coinbase balance increase per gas unit
+}
+
+// bundlesByPrice is a list of simulated bundles, ordered by their effective gas
+// price, from which bundles are consumed as they are committed.
+type bundlesByPrice []*simulatedBundle
+
+// Peek returns the best paying remaining bundle, nil if none is left.
+func (s *bundlesByPrice) Peek() *simulatedBundle {
+	if len(*s) == 0 {
+		return nil
+	}
+	return (*s)[0]
+}
+
+// Pop removes the best paying remaining bundle.
+func (s *bundlesByPrice) Pop() {
+	*s = (*s)[1:]
+}
+
+// simulateBundle executes a bundle on top of the given state, returning the gas
+// it uses and the amount it pays to the coinbase. The bundle is rejected if any
+// of its transactions fail or revert. The state is modified.
+func (w *worker) simulateBundle(bundle *types.Bundle, statedb *state.StateDB, header *types.Header, gas uint64, coinbase common.Address) (uint64, *big.Int, error) {
+	var (
+		gasPool = new(core.GasPool).AddGas(gas)
+		gasUsed = new(uint64)
+		balance = statedb.GetBalance(coinbase)
+	)
+	for i, tx := range bundle.Txs {
+		if tx.Protected() && !w.chainConfig.IsEIP155(header.Number) {
+			return 0, nil, types.ErrInvalidChainId
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+
+		receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, gasPool, statedb, header, tx, gasUsed, *w.chain.GetVMConfig())
+		if err != nil {
+			return 0, nil, err
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return 0, nil, errBundleReverted
+		}
+	}
+	return *gasUsed, new(big.Int).Sub(statedb.GetBalance(coinbase), balance), nil
+}
+
+// simulateBundles executes the bundles eligible for the current block on top of
+// the current state and orders the successful ones by the price they effectively
+// pay. The best paying bundles are simulated first, up to a limited count and
+// time, so the simulations can't delay the block.
+func (w *worker) simulateBundles(coinbase common.Address) bundlesByPrice {
+	gas := w.current.header.GasLimit
+	if w.current.gasPool != nil {
+		gas = w.current.gasPool.Gas()
+	}
+	var (
+		simulated bundlesByPrice
+		pending   = w.bundles.pending(w.current.header.Number.Uint64(), w.current.header.Time)
+		start     = time.Now()
+	)
+	for i, pooled := range pending {
+		if i >= maxSimulatedBundles || time.Since(start) > bundleSimulationTimeout {
+			log.Debug("Skipped simulating bundles", "count", len(pending)-i, "elapsed", common.PrettyDuration(time.Since(start)))
+			break
+		}
+		bundle := pooled.bundle
+		gasUsed, payment, err := w.simulateBundle(bundle, w.current.state.Copy(), w.current.header, gas, coinbase)
+		if err == nil && payment.Sign() <= 0 {
+			err = errBundleNoPayment
+		}
+		if err != nil {
+			log.Debug("Bundle simulation failed", "hash", bundle.Hash(), "err", err)
+			w.bundles.reprice(pooled, new(big.Int))
+			continue
+		}
+		price := new(big.Int).Div(payment, new(big.Int).SetUint64(gasUsed))
+		w.bundles.reprice(pooled, price)
+
+		simulated = append(simulated, &simulatedBundle{
+			bundle:  bundle,
+			gasUsed: gasUsed,
+			price:   price,
+		})
+	}
+	sort.SliceStable(simulated, func(i, j int) bool {
+		return simulated[i].price.Cmp(simulated[j].price) > 0
+	})
+	return simulated
+}
+
+// commitBundle includes all the transactions of the bundle into the current
+// block, or none of them if any fails or reverts on top of the current state.
+func (w *worker) commitBundle(bundle *types.Bundle, coinbase common.Address) ([]*types.Log, error) {
+	// Execute the bundle on a copy first, transactions can't be rolled back
+	// from the block state once finalised
+	if _, _, err := w.simulateBundle(bundle, w.current.state.Copy(), w.current.header, w.current.gasPool.Gas(), coinbase); err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for _, tx := range bundle.Txs {
+		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
+
+		txLogs, err := w.commitTransaction(tx, coinbase)
+		if err != nil {
+			// Execution is deterministic, this should never happen
+			log.Error("Bundle transaction failed after successful simulation", "hash", tx.Hash(), "err", err)
+			return logs, err
+		}
+		logs = append(logs, txLogs...)
+		w.current.tcount++
+	}
+	return logs, nil
+}
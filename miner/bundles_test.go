@@ -0,0 +1,164 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that bundles are included atomically ahead of the pool transactions if
+// they pay more, and that failing or ineligible bundles are skipped.
+func TestBundleInclusion(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	var (
+		b      = newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+		signer = types.LatestSigner(ethashChainConfig)
+		sink   = common.Address{0xaa}
+	)
+	transfer := func(key *ecdsa.PrivateKey, nonce uint64, to common.Address, value int64, price int64) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.LegacyTx{
+			Nonce:    nonce,
+			To:       &to,
+			Value:    big.NewInt(value),
+			Gas:      params.TxGas,
+			GasPrice: big.NewInt(price),
+		})
+	}
+	if errs := b.txPool.AddRemotesSync([]*types.Transaction{transfer(testBankKey, 0, testUserAddress, 1000, 10)}); errs[0] != nil {
+		t.Fatalf("failed to add pool transaction: %v", errs[0])
+	}
+	w := newWorker(testConfig, ethashChainConfig, engine, b, new(event.TypeMux), nil, false)
+	defer w.close()
+	w.setEtherbase(common.Address{0xcb})
+
+	genesis := b.chain.CurrentBlock().Header()
+
+	// Pays an effective price of 15 per gas unit, more than the pool transaction
+	winner := &types.Bundle{
+		Txs:         types.Transactions{transfer(testBankKey, 0, testUserAddress, 1000, 30), transfer(testUserKey, 0, sink, 1, 0)},
+		BlockNumber: 1,
+	}
+	bundles := []*types.Bundle{
+		// Fails because of the second transaction, despite paying a lot
+		{Txs: types.Transactions{transfer(testBankKey, 0, testUserAddress, 1000, 100), transfer(testUserKey, 5, sink, 1, 0)}, BlockNumber: 1},
+		// Targets a different block
+		{Txs: types.Transactions{transfer(testBankKey, 0, testUserAddress, 1000, 200)}, BlockNumber: 2},
+		// Expired
+		{Txs: types.Transactions{transfer(testBankKey, 0, testUserAddress, 1000, 300)}, BlockNumber: 1, MaxTimestamp: 1},
+		winner,
+	}
+	for i, bundle := range bundles {
+		if err := w.bundles.add(bundle, genesis); err != nil {
+			t.Fatalf("bundle %d: failed to add: %v", i, err)
+		}
+	}
+	if err := w.bundles.add(&types.Bundle{Txs: winner.Txs, BlockNumber: 0}, genesis); err != errBundleStale {
+		t.Fatalf("stale bundle error mismatch: have %v, want %v", err, errBundleStale)
+	}
+	if err := w.bundles.add(&types.Bundle{BlockNumber: 1}, genesis); err != errBundleEmpty {
+		t.Fatalf("empty bundle error mismatch: have %v, want %v", err, errBundleEmpty)
+	}
+	w.commitNewWork(nil, true, time.Now().Unix())
+
+	block, state := w.pending()
+	if block.Transactions().Len() != len(winner.Txs) {
+		t.Fatalf("transaction count mismatch: have %d, want %d", block.Transactions().Len(), len(winner.Txs))
+	}
+	for i, tx := range block.Transactions() {
+		if tx.Hash() != winner.Txs[i].Hash() {
+			t.Errorf("transaction %d: hash mismatch: have %x, want %x", i, tx.Hash(), winner.Txs[i].Hash())
+		}
+	}
+	if balance := state.GetBalance(sink); balance.Cmp(common.Big1) != 0 {
+		t.Errorf("sink balance mismatch: have %v, want 1", balance)
+	}
+	// The bundle targeting the next block should still be tracked
+	if pending := w.bundles.pending(2, 0); len(pending) != 1 {
+		t.Errorf("pending bundle count mismatch: have %d, want 1", len(pending))
+	}
+}
+
+// Tests that oversized and far future bundles are rejected, and that the cheapest
+// bundles are evicted once the pool is full.
+func TestBundlePoolLimits(t *testing.T) {
+	var (
+		pool   = new(bundlePool)
+		head   = &types.Header{Number: big.NewInt(10), GasLimit: 10 * params.TxGas}
+		signer = types.HomesteadSigner{}
+		nonce  uint64
+	)
+	transfer := func(gas uint64, price int64) *types.Transaction {
+		nonce++
+		return types.MustSignNewTx(testBankKey, signer, &types.LegacyTx{
+			Nonce:    nonce,
+			To:       &testUserAddress,
+			Gas:      gas,
+			GasPrice: big.NewInt(price),
+		})
+	}
+	oversized := new(types.Bundle)
+	for i := 0; i <= maxBundleTxs; i++ {
+		oversized.Txs = append(oversized.Txs, transfer(params.TxGas, 1))
+	}
+	tests := []struct {
+		bundle *types.Bundle
+		err    error
+	}{
+		{&types.Bundle{Txs: oversized.Txs, BlockNumber: 11}, errBundleOversized},
+		{&types.Bundle{Txs: types.Transactions{transfer(11*params.TxGas, 1)}, BlockNumber: 11}, errBundleGasLimit},
+		{&types.Bundle{Txs: types.Transactions{transfer(params.TxGas, 1)}, BlockNumber: 11 + maxBundleFutureBlocks}, errBundleTooFar},
+	}
+	for i, tt := range tests {
+		if err := pool.add(tt.bundle, head); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Fill up the pool and ensure only better paying bundles get in
+	for i := 0; i < maxPendingBundles; i++ {
+		if err := pool.add(&types.Bundle{Txs: types.Transactions{transfer(params.TxGas, int64(2+i))}, BlockNumber: 11}, head); err != nil {
+			t.Fatalf("bundle %d: failed to add: %v", i, err)
+		}
+	}
+	if err := pool.add(&types.Bundle{Txs: types.Transactions{transfer(params.TxGas, 2)}, BlockNumber: 11}, head); err != errBundlePoolFull {
+		t.Fatalf("underpriced bundle error mismatch: have %v, want %v", err, errBundlePoolFull)
+	}
+	if err := pool.add(&types.Bundle{Txs: types.Transactions{transfer(params.TxGas, 10000)}, BlockNumber: 11}, head); err != nil {
+		t.Fatalf("failed to add overpriced bundle: %v", err)
+	}
+	pending := pool.pending(11, 0)
+	if len(pending) != maxPendingBundles {
+		t.Fatalf("pending bundle count mismatch: have %d, want %d", len(pending), maxPendingBundles)
+	}
+	if price := pending[0].price.Int64(); price != 10000 {
+		t.Errorf("best bundle price mismatch: have %d, want %d", price, 10000)
+	}
+	if price := pending[len(pending)-1].price.Int64(); price != 3 {
+		t.Errorf("cheapest bundle price mismatch: have %d, want %d", price, 3)
+	}
+}
@@ -50,6 +50,9 @@ type Config struct {
 	GasPrice  *big.Int       // Minimum gas price for mining a transaction
 	Recommit  time.Duration  // The time interval for miner to re-create mining work.
 	Noverify  bool           // Disable remote mining solution verification(only useful in ethash).
+
+	TxSource  TxSource  `toml:"-"` // Source of the transactions to include (default = transaction pool)
+	TxOrderer TxOrderer `toml:"-"` // Strategy ordering the transactions (default = by price and nonce)
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -193,6 +196,12 @@ func (miner *Miner) PendingBlock() *types.Block {
 	return miner.worker.pendingBlock()
 }
 
+// AddBundle schedules a transaction bundle for atomic inclusion in the block it
+// targets, ahead of the pool transactions paying less.
+func (miner *Miner) AddBundle(bundle *types.Bundle) error {
+	return miner.worker.bundles.add(bundle, miner.eth.BlockChain().CurrentBlock().Header())
+}
+
 func (miner *Miner) SetEtherbase(addr common.Address) {
 	miner.coinbase = addr
 	miner.worker.setEtherbase(addr)
@@ -0,0 +1,67 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxSource provides the transactions the worker fills new blocks with. The
+// transaction pool is the default source.
+type TxSource interface {
+	// Pending returns all the executable transactions, grouped by sender and
+	// sorted by nonce.
+	Pending() (map[common.Address]types.Transactions, error)
+
+	// Locals returns the senders whose transactions are included before any
+	// other ones, regardless of the ordering.
+	Locals() []common.Address
+}
+
+// TxSet is an ordered set of transactions, consumed by the worker one by one
+// while filling a block.
+type TxSet interface {
+	// Peek returns the next transaction to include, nil if none is left.
+	Peek() *types.Transaction
+
+	// Shift replaces the current transaction with the next one from the same
+	// sender, called after it was included or skipped.
+	Shift()
+
+	// Pop removes the current transaction along with all the subsequent ones
+	// from the same sender, called if it can't be included.
+	Pop()
+}
+
+// TxOrderer decides the order in which the worker attempts to include the
+// transactions of a source into a block.
+type TxOrderer interface {
+	// Order creates the set of transactions to include into the block with the
+	// given header. The transactions of each sender are sorted by nonce, the
+	// set must preserve that order. The map may be modified.
+	Order(signer types.Signer, txs map[common.Address]types.Transactions, header *types.Header) TxSet
+}
+
+// priceOrderer is the default transaction orderer, including the transactions
+// by decreasing gas price while respecting nonces.
+type priceOrderer struct{}
+
+// Order implements TxOrderer, ordering the transactions by price and nonce.
+func (priceOrderer) Order(signer types.Signer, txs map[common.Address]types.Transactions, header *types.Header) TxSet {
+	return types.NewTransactionsByPriceAndNonce(signer, txs)
+}
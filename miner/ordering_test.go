@@ -0,0 +1,180 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testTxSource is a transaction source serving a fixed set of transactions,
+// optionally restricted to a set of allowed senders.
+type testTxSource struct {
+	signer  types.Signer
+	txs     []*types.Transaction
+	allowed map[common.Address]bool
+}
+
+func (s *testTxSource) Pending() (map[common.Address]types.Transactions, error) {
+	pending := make(map[common.Address]types.Transactions)
+	for _, tx := range s.txs {
+		from, _ := types.Sender(s.signer, tx)
+		if s.allowed == nil || s.allowed[from] {
+			pending[from] = append(pending[from], tx)
+		}
+	}
+	return pending, nil
+}
+
+func (s *testTxSource) Locals() []common.Address { return nil }
+
+// fifoOrderer is a transaction orderer including transactions in the order they
+// were submitted to the test source, regardless of their price.
+type fifoOrderer struct {
+	arrivals []*types.Transaction
+}
+
+func (o *fifoOrderer) Order(signer types.Signer, txs map[common.Address]types.Transactions, header *types.Header) TxSet {
+	set := &fifoTxSet{signer: signer, dropped: make(map[common.Address]bool)}
+	for _, tx := range o.arrivals {
+		from, _ := types.Sender(signer, tx)
+		for _, pending := range txs[from] {
+			if pending.Hash() == tx.Hash() {
+				set.txs = append(set.txs, tx)
+			}
+		}
+	}
+	return set
+}
+
+// fifoTxSet is a transaction set consumed in submission order.
+type fifoTxSet struct {
+	signer  types.Signer
+	txs     []*types.Transaction
+	dropped map[common.Address]bool
+}
+
+func (s *fifoTxSet) Peek() *types.Transaction {
+	for len(s.txs) > 0 {
+		if from, _ := types.Sender(s.signer, s.txs[0]); !s.dropped[from] {
+			return s.txs[0]
+		}
+		s.txs = s.txs[1:]
+	}
+	return nil
+}
+
+func (s *fifoTxSet) Shift() { s.txs = s.txs[1:] }
+
+func (s *fifoTxSet) Pop() {
+	from, _ := types.Sender(s.signer, s.txs[0])
+	s.dropped[from] = true
+}
+
+// Tests that the worker fills blocks using the configured transaction source
+// and orderer.
+func TestCustomTxStrategy(t *testing.T) {
+	var (
+		signer = types.LatestSigner(ethashChainConfig)
+		keys   = make([]*ecdsa.PrivateKey, 3)
+		addrs  = make([]common.Address, len(keys))
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	transfer := func(key *ecdsa.PrivateKey, nonce uint64, price int64) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.LegacyTx{
+			Nonce:    nonce,
+			To:       &testUserAddress,
+			Gas:      params.TxGas,
+			GasPrice: big.NewInt(price),
+		})
+	}
+	// Free transactions from empty accounts, followed by a paying one
+	var (
+		free0  = transfer(keys[0], 0, 0)
+		free1  = transfer(keys[1], 0, 0)
+		free1b = transfer(keys[1], 1, 0)
+		free2  = transfer(keys[2], 0, 0)
+		paid   = transfer(testBankKey, 0, 10)
+		txs    = []*types.Transaction{free1, free0, free2, free1b, paid}
+	)
+	tests := []struct {
+		source  TxSource
+		orderer TxOrderer
+		want    []*types.Transaction
+	}{
+		// Default ordering by price, ties broken by nonce
+		{
+			source: &testTxSource{signer: signer, txs: txs},
+			want:   []*types.Transaction{paid}, // followed by all the others
+		},
+		// First come first served
+		{
+			source:  &testTxSource{signer: signer, txs: txs},
+			orderer: &fifoOrderer{arrivals: txs},
+			want:    []*types.Transaction{free1, free0, free2, free1b, paid},
+		},
+		// Allow-listed senders only
+		{
+			source:  &testTxSource{signer: signer, txs: txs, allowed: map[common.Address]bool{addrs[1]: true, testBankAddress: true}},
+			orderer: &fifoOrderer{arrivals: txs},
+			want:    []*types.Transaction{free1, free1b, paid},
+		},
+	}
+	for i, tt := range tests {
+		engine := ethash.NewFaker()
+
+		config := *testConfig
+		config.TxSource = tt.source
+		config.TxOrderer = tt.orderer
+
+		b := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+		w := newWorker(&config, ethashChainConfig, engine, b, new(event.TypeMux), nil, false)
+		w.setEtherbase(testBankAddress)
+		w.commitNewWork(nil, true, time.Now().Unix())
+
+		block, _ := w.pending()
+		have := block.Transactions()
+		if tt.orderer == nil && len(have) == len(txs) {
+			// The free transactions are ordered arbitrarily after the paid one
+			have = have[:1]
+		}
+		if len(have) != len(tt.want) {
+			t.Errorf("test %d: transaction count mismatch: have %d, want %d", i, len(have), len(tt.want))
+		} else {
+			for j, tx := range have {
+				if tx.Hash() != tt.want[j].Hash() {
+					t.Errorf("test %d, tx %d: hash mismatch: have %x, want %x", i, j, tx.Hash(), tt.want[j].Hash())
+				}
+			}
+		}
+		w.close()
+		engine.Close()
+	}
+}
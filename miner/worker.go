@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -91,6 +92,8 @@ type environment struct {
 	header   *types.Header
 	txs      []*types.Transaction
 	receipts []*types.Receipt
+
+	conditions map[common.Hash]*core.TxConditions // Conditions of the pooled transactions, retrieved per commit
 }
 
 // task contains all information for consensus engine sealing and result submitting.
@@ -128,6 +131,8 @@ type worker struct {
 	engine      consensus.Engine
 	eth         Backend
 	chain       *core.BlockChain
+	source      TxSource
+	orderer     TxOrderer
 
 	// Feeds
 	pendingLogsFeed event.Feed
@@ -154,6 +159,7 @@ type worker struct {
 	localUncles  map[common.Hash]*types.Block // A set of side blocks generated locally as the possible uncle blocks.
 	remoteUncles map[common.Hash]*types.Block // A set of side blocks as the possible uncle blocks.
 	unconfirmed  *unconfirmedBlocks           // A set of locally mined blocks pending canonicalness confirmations.
+	bundles      *bundlePool                  // A set of transaction bundles to include atomically.
 
 	mu       sync.RWMutex // The lock used to protect the coinbase and extra fields
 	coinbase common.Address
@@ -195,10 +201,13 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		eth:                eth,
 		mux:                mux,
 		chain:              eth.BlockChain(),
+		source:             config.TxSource,
+		orderer:            config.TxOrderer,
 		isLocalBlock:       isLocalBlock,
 		localUncles:        make(map[common.Hash]*types.Block),
 		remoteUncles:       make(map[common.Hash]*types.Block),
 		unconfirmed:        newUnconfirmedBlocks(eth.BlockChain(), miningLogAtDepth),
+		bundles:            new(bundlePool),
 		pendingTasks:       make(map[common.Hash]*task),
 		txsCh:              make(chan core.NewTxsEvent, txChanSize),
 		chainHeadCh:        make(chan core.ChainHeadEvent, chainHeadChanSize),
@@ -211,6 +220,12 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		resubmitIntervalCh: make(chan time.Duration),
 		resubmitAdjustCh:   make(chan *intervalAdjust, resubmitAdjustChanSize),
 	}
+	if worker.source == nil {
+		worker.source = eth.TxPool()
+	}
+	if worker.orderer == nil {
+		worker.orderer = priceOrderer{}
+	}
 	// Subscribe NewTxsEvent for tx pool
 	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
 	// Subscribe events for blockchain
@@ -485,7 +500,11 @@ func (w *worker) mainLoop() {
 			// Note all transactions received may not be continuous with transactions
 			// already included in the current mining block. These transactions will
 			// be automatically eliminated.
-			if !w.isRunning() && w.current != nil {
+			if !w.isRunning() && w.current != nil && w.config.TxSource != nil {
+				// A custom source may not include the new transactions, regenerate
+				// the pending block from scratch
+				w.commitNewWork(nil, true, time.Now().Unix())
+			} else if !w.isRunning() && w.current != nil {
 				// If block is already full, abort
 				if gp := w.current.gasPool; gp != nil && gp.Gas() < params.TxGas {
 					continue
@@ -499,9 +518,10 @@ func (w *worker) mainLoop() {
 					acc, _ := types.Sender(w.current.signer, tx)
 					txs[acc] = append(txs[acc], tx)
 				}
-				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs)
+				txset := w.orderer.Order(w.current.signer, txs, w.current.header)
 				tcount := w.current.tcount
-				w.commitTransactions(txset, coinbase, nil)
+				w.current.conditions = w.eth.TxPool().AllConditions()
+				w.commitTransactions(txset, nil, coinbase, nil)
 				// Only update the snapshot if any new transactons were added
 				// to the pending block
 				if tcount != w.current.tcount {
@@ -747,7 +767,30 @@ func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Addres
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
+// mergePrivateTxs merges the private transactions of an account into its pending
+// ones, keeping them sorted by nonce. Private transactions take precedence over
+// public ones with the same nonce.
+func mergePrivateTxs(public types.Transactions, private types.Transactions) types.Transactions {
+	nonces := make(map[uint64]struct{}, len(private))
+	for _, tx := range private {
+		nonces[tx.Nonce()] = struct{}{}
+	}
+	merged := make(types.Transactions, 0, len(public)+len(private))
+	for _, tx := range public {
+		if _, ok := nonces[tx.Nonce()]; !ok {
+			merged = append(merged, tx)
+		}
+	}
+	merged = append(merged, private...)
+	sort.Sort(types.TxByNonce(merged))
+	return merged
+}
+
+// commitTransactions fills the current block with the given transactions, in the
+// order of the set. Bundles are included atomically ahead of the transactions
+// whenever they pay a higher effective price, the ones committed or rejected are
+// consumed from the set.
+func (w *worker) commitTransactions(txs TxSet, bundles *bundlesByPrice, coinbase common.Address, interrupt *int32) bool {
 	// Short circuit if current is nil
 	if w.current == nil {
 		return true
@@ -757,8 +800,10 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
 	}
 
-	var coalescedLogs []*types.Log
-
+	var (
+		coalescedLogs []*types.Log
+		unmet         []common.Hash // Conditional transactions failing on the pending state
+	)
 	for {
 		// In the following three cases, we will interrupt the execution of the transaction.
 		// (1) new head block event arrival, the interrupt signal is 1
@@ -785,8 +830,21 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			log.Trace("Not enough gas for further transactions", "have", w.current.gasPool, "want", params.TxGas)
 			break
 		}
-		// Retrieve the next transaction and abort if all done
+		// Retrieve the next transaction and include any better paying bundle first
 		tx := txs.Peek()
+		if bundles != nil {
+			if bundle := bundles.Peek(); bundle != nil && (tx == nil || bundle.price.Cmp(tx.GasPrice()) > 0) {
+				bundles.Pop()
+
+				logs, err := w.commitBundle(bundle.bundle, coinbase)
+				if err != nil {
+					log.Debug("Bundle rejected", "hash", bundle.bundle.Hash(), "err", err)
+				}
+				coalescedLogs = append(coalescedLogs, logs...)
+				continue
+			}
+		}
+		// Abort if all done
 		if tx == nil {
 			break
 		}
@@ -803,6 +861,23 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			txs.Pop()
 			continue
 		}
+		// Skip the account if the conditions of the transaction aren't met, the
+		// subsequent ones can't be included without it either
+		if conds := w.current.conditions[tx.Hash()]; conds != nil {
+			if !conds.Eligible(w.current.header) {
+				log.Trace("Skipping transaction with ineligible conditions", "hash", tx.Hash(), "sender", from)
+
+				txs.Pop()
+				continue
+			}
+			if err := conds.CheckState(w.current.state); err != nil {
+				log.Trace("Skipping transaction with unmet conditions", "hash", tx.Hash(), "sender", from, "err", err)
+				unmet = append(unmet, tx.Hash())
+
+				txs.Pop()
+				continue
+			}
+		}
 		// Start executing the transaction
 		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
 
@@ -842,6 +917,11 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		}
 	}
 
+	// Drop the conditional transactions whose storage preconditions don't hold in
+	// the pending state
+	if len(unmet) > 0 {
+		w.eth.TxPool().DropConditional(unmet)
+	}
 	if !w.isRunning() && len(coalescedLogs) > 0 {
 		// We don't push the pendingLogsEvent while we are mining. The reason is that
 		// when we are mining, the worker will regenerate a mining block every 3 seconds.
@@ -952,35 +1032,51 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	}
 
 	// Fill the block with all available pending transactions.
-	pending, err := w.eth.TxPool().Pending()
+	pending, err := w.source.Pending()
 	if err != nil {
 		log.Error("Failed to fetch pending transactions", "err", err)
 		return
 	}
+	// Retrieve the conditions of the pending transactions once for the whole commit
+	w.current.conditions = w.eth.TxPool().AllConditions()
+
+	// Merge in the private transactions, they are only ever included locally
+	if private := w.eth.TxPool().Private(); len(private) > 0 {
+		if pending == nil {
+			pending = make(map[common.Address]types.Transactions)
+		}
+		for from, txs := range private {
+			pending[from] = mergePrivateTxs(pending[from], txs)
+		}
+	}
+	// Simulate the bundles targeting this block on top of the pending state
+	bundles := w.simulateBundles(w.coinbase)
+
 	// Short circuit if there is no available pending transactions.
 	// But if we disable empty precommit already, ignore it. Since
 	// empty block is necessary to keep the liveness of the network.
-	if len(pending) == 0 && atomic.LoadUint32(&w.noempty) == 0 {
+	if len(pending) == 0 && len(bundles) == 0 && atomic.LoadUint32(&w.noempty) == 0 {
 		w.updateSnapshot()
 		return
 	}
 	// Split the pending transactions into locals and remotes
 	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
-	for _, account := range w.eth.TxPool().Locals() {
+	for _, account := range w.source.Locals() {
 		if txs := remoteTxs[account]; len(txs) > 0 {
 			delete(remoteTxs, account)
 			localTxs[account] = txs
 		}
 	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
+		txs := w.orderer.Order(w.current.signer, localTxs, w.current.header)
+		if w.commitTransactions(txs, nil, w.coinbase, interrupt) {
 			return
 		}
 	}
-	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
+	// Bundles compete with the remote transactions, local ones retain priority
+	if len(remoteTxs) > 0 || len(bundles) > 0 {
+		txs := w.orderer.Order(w.current.signer, remoteTxs, w.current.header)
+		if w.commitTransactions(txs, &bundles, w.coinbase, interrupt) {
 			return
 		}
 	}
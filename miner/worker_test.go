@@ -516,3 +516,28 @@ func testAdjustInterval(t *testing.T, chainConfig *params.ChainConfig, engine co
 		t.Error("interval reset timeout")
 	}
 }
+
+// Tests that private transactions are merged into the pending ones in nonce
+// order, taking precedence over public ones with the same nonce.
+func TestMergePrivateTxs(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := types.HomesteadSigner{}
+
+	sign := func(nonce uint64, price int64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(0), params.TxGas, big.NewInt(price), nil), signer, key)
+		return tx
+	}
+	public := types.Transactions{sign(0, 1), sign(1, 1), sign(3, 1)}
+	private := types.Transactions{sign(1, 2), sign(2, 2)}
+
+	merged := mergePrivateTxs(public, private)
+	want := types.Transactions{public[0], private[0], private[1], public[2]}
+	if len(merged) != len(want) {
+		t.Fatalf("merged transaction count mismatch: have %d, want %d", len(merged), len(want))
+	}
+	for i := range want {
+		if merged[i].Hash() != want[i].Hash() {
+			t.Errorf("transaction %d mismatch: have nonce %d price %v, want nonce %d price %v", i, merged[i].Nonce(), merged[i].GasPrice(), want[i].Nonce(), want[i].GasPrice())
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -29,6 +30,10 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// maxBanDuration is the longest temporary ban accepted via the admin API, longer
+// requested durations are capped to it.
+const maxBanDuration = 10 * 365 * 24 * time.Hour
+
 // apis returns the collection of built-in RPC APIs.
 func (n *Node) apis() []rpc.API {
 	return []rpc.API{
@@ -124,6 +129,58 @@ func (api *privateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 
+// BanPeer bans a node, given as enode URL or node ID, or an IP address or
+// network in CIDR notation, from connecting for the given number of seconds.
+// The ban is permanent if no duration is given, durations beyond ten years are
+// capped.
+func (api *privateAdminAPI) BanPeer(target string, seconds *uint64, reason *string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	var (
+		duration time.Duration
+		why      = "manual"
+	)
+	if seconds != nil {
+		duration = maxBanDuration
+		if *seconds < uint64(maxBanDuration/time.Second) {
+			duration = time.Duration(*seconds) * time.Second
+		}
+	}
+	if reason != nil {
+		why = *reason
+	}
+	if err := server.BanPeer(target, duration, why); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnbanPeer lifts the ban of a node or IP network.
+func (api *privateAdminAPI) UnbanPeer(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if err := server.UnbanPeer(target); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListBans retrieves the bans enforced by the node's p2p.Server.
+func (api *privateAdminAPI) ListBans() ([]*p2p.BanInfo, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Bans(), nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *privateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
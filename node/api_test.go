@@ -24,6 +24,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/stretchr/testify/assert"
@@ -350,3 +351,32 @@ func not(ok bool) string {
 	}
 	return "not "
 }
+
+// Tests that overly long ban durations requested via the admin API are capped
+// instead of overflowing into the past.
+func TestBanPeerDuration(t *testing.T) {
+	stack, err := New(testNodeConfig())
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	api := &privateAdminAPI{stack}
+
+	seconds := uint64(1 << 63)
+	if _, err := api.BanPeer("10.0.0.0/8", &seconds, nil); err != nil {
+		t.Fatalf("failed to ban network: %v", err)
+	}
+	bans, err := api.ListBans()
+	if err != nil {
+		t.Fatalf("failed to list bans: %v", err)
+	}
+	if len(bans) != 1 || bans[0].Expiry == nil {
+		t.Fatalf("ban mismatch: %v", bans)
+	}
+	if expiry := *bans[0].Expiry; expiry.Before(time.Now().Add(maxBanDuration-time.Hour)) || expiry.After(time.Now().Add(maxBanDuration)) {
+		t.Fatalf("ban expiry mismatch: have %v, want ~%v", expiry, time.Now().Add(maxBanDuration))
+	}
+}
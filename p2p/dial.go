@@ -78,6 +78,7 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errBanned           = errors.New("banned")
 	errNoPort           = errors.New("node does not provide TCP port")
 )
 
@@ -130,10 +131,11 @@ type dialScheduler struct {
 type dialSetupFunc func(net.Conn, connFlag, *enode.Node) error
 
 type dialConfig struct {
-	self           enode.ID         // our own ID
-	maxDialPeers   int              // maximum number of dialed peers
-	maxActiveDials int              // maximum number of active dials
-	netRestrict    *netutil.Netlist // IP whitelist, disabled if nil
+	self           enode.ID               // our own ID
+	maxDialPeers   int                    // maximum number of dialed peers
+	maxActiveDials int                    // maximum number of active dials
+	netRestrict    *netutil.Netlist       // IP whitelist, disabled if nil
+	banned         func(*enode.Node) bool // Ban list, disabled if nil
 	resolver       nodeResolver
 	dialer         NodeDialer
 	log            log.Logger
@@ -281,11 +283,8 @@ loop:
 			if exists {
 				continue loop
 			}
-			task := newDialTask(node, staticDialedConn)
-			d.static[id] = task
-			if d.checkDial(node) == nil {
-				d.addToStaticPool(task)
-			}
+			d.static[id] = newDialTask(node, staticDialedConn)
+			d.updateStaticPool(id)
 
 		case node := <-d.remStaticCh:
 			id := node.ID()
@@ -407,6 +406,9 @@ func (d *dialScheduler) checkDial(n *enode.Node) error {
 	if d.history.contains(string(n.ID().Bytes())) {
 		return errRecentlyDialed
 	}
+	if d.banned != nil && d.banned(n) {
+		return errBanned
+	}
 	return nil
 }
 
@@ -424,8 +426,15 @@ func (d *dialScheduler) startStaticDials(n int) (started int) {
 // updateStaticPool attempts to move the given static dial back into staticPool.
 func (d *dialScheduler) updateStaticPool(id enode.ID) {
 	task, ok := d.static[id]
-	if ok && task.staticPoolIndex < 0 && d.checkDial(task.dest) == nil {
+	if !ok || task.staticPoolIndex >= 0 {
+		return
+	}
+	switch d.checkDial(task.dest) {
+	case nil:
 		d.addToStaticPool(task)
+	case errBanned:
+		// Bans are lifted without notice, check again when the history expires.
+		d.history.add(string(id.Bytes()), d.clock.Now().Add(dialHistoryExpiration))
 	}
 }
 
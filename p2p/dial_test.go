@@ -153,6 +153,37 @@ func TestDialSchedNetRestrict(t *testing.T) {
 }
 
 // This test checks that static dials work and obey the limits.
+// This test checks that banned nodes are not dialed.
+func TestDialSchedBanned(t *testing.T) {
+	t.Parallel()
+
+	nodes := []*enode.Node{
+		newNode(uintID(0x01), "127.0.0.1:30303"),
+		newNode(uintID(0x02), "127.0.0.2:30303"),
+		newNode(uintID(0x03), "127.0.2.3:30303"),
+		newNode(uintID(0x04), "127.0.2.4:30303"),
+	}
+	config := dialConfig{
+		banned: func(n *enode.Node) bool {
+			return n.ID() == uintID(0x01) || n.IP().Equal(net.IP{127, 0, 2, 4})
+		},
+		maxActiveDials: 10,
+		maxDialPeers:   10,
+	}
+	runDialTest(t, config, []dialTestRound{
+		{
+			discovered:   nodes,
+			wantNewDials: nodes[1:3],
+		},
+		{
+			succeeded: []enode.ID{
+				nodes[1].ID(),
+				nodes[2].ID(),
+			},
+		},
+	})
+}
+
 func TestDialSchedStaticDial(t *testing.T) {
 	t.Parallel()
 
@@ -19,6 +19,7 @@ package discover
 import (
 	"crypto/ecdsa"
 	"net"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/log"
@@ -67,6 +68,18 @@ func ListenUDP(c UDPConn, ln *enode.LocalNode, cfg Config) (*UDPv4, error) {
 	return ListenV4(c, ln, cfg)
 }
 
+// simEpoch is the wall-clock time at which simulated clocks start.
+var simEpoch = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// wallTime returns the current wall-clock time according to the given clock. Simulated
+// clocks are mapped onto wall-clock time starting at simEpoch.
+func wallTime(clock mclock.Clock) time.Time {
+	if _, ok := clock.(mclock.System); ok {
+		return time.Now()
+	}
+	return simEpoch.Add(time.Duration(clock.Now()))
+}
+
 // ReadPacket is a packet that couldn't be handled. Those packets are sent to the unhandled
 // channel if configured.
 type ReadPacket struct {
@@ -130,10 +130,10 @@ func (it *lookup) startQueries() bool {
 }
 
 func (it *lookup) slowdown() {
-	sleep := time.NewTimer(1 * time.Second)
+	sleep := it.tab.clock.NewTimer(1 * time.Second)
 	defer sleep.Stop()
 	select {
-	case <-sleep.C:
+	case <-sleep.C():
 	case <-it.tab.closeReq:
 	}
 }
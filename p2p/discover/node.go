@@ -22,9 +22,9 @@ import (
 	"errors"
 	"math/big"
 	"net"
-	"time"
 
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 )
@@ -33,8 +33,8 @@ import (
 // The fields of Node may not be modified.
 type node struct {
 	enode.Node
-	addedAt        time.Time // time when the node was added to the table
-	livenessChecks uint      // how often liveness was checked
+	addedAt        mclock.AbsTime // time when the node was added to the table
+	livenessChecks uint           // how often liveness was checked
 }
 
 type encPubkey [64]byte
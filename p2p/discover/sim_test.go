@@ -0,0 +1,181 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover_test
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations/simnet"
+)
+
+// The tests in this file run discovery on a simulated network. They live in an
+// external test package because simnet depends on package p2p, which imports
+// package discover.
+
+const simNodes = 16
+
+// simLink is a lossy wide-area network.
+var simLink = simnet.Link{Latency: 40 * time.Millisecond, Jitter: 40 * time.Millisecond, Loss: 0.05}
+
+// simKey derives the key of a simulated node from the seed.
+func simKey(seed int64, i int) *ecdsa.PrivateKey {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(seed))
+	binary.BigEndian.PutUint64(b[8:], uint64(i))
+	key, err := crypto.ToECDSA(crypto.Keccak256(b[:]))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// simListen creates the socket and local node of a simulated node.
+func simListen(t *testing.T, sim *simnet.Network, key *ecdsa.PrivateKey) (*simnet.PacketConn, *enode.LocalNode) {
+	addr := sim.NewAddr()
+	conn, err := sim.Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := enode.OpenDB("")
+	ln := enode.NewLocalNode(db, key)
+	ln.SetStaticIP(addr.IP)
+	ln.SetFallbackUDP(addr.Port)
+	return conn, ln
+}
+
+// runLookups performs the lookups concurrently while driving the simulation.
+func runLookups(t *testing.T, sim *simnet.Network, lookups []func() bool) {
+	results := make(chan bool, len(lookups))
+	for _, fn := range lookups {
+		go func(fn func() bool) { results <- fn() }(fn)
+	}
+	var done, found int
+	sim.RunUntil(time.Hour, func() bool {
+		for {
+			select {
+			case r := <-results:
+				done++
+				if r {
+					found++
+				}
+			default:
+				return done == len(lookups)
+			}
+		}
+	})
+	if done < len(lookups) {
+		t.Fatalf("%d of %d lookups didn't finish", len(lookups)-done, len(lookups))
+	}
+	// Some lookups fail because packet loss breaks the endpoint proof between
+	// nodes, but most should succeed.
+	if found < len(lookups)/2 {
+		t.Fatalf("only %d of %d lookups found their target", found, len(lookups))
+	}
+}
+
+func TestSimV4(t *testing.T) {
+	var (
+		sim   = simnet.New(1, simLink)
+		keys  []*ecdsa.PrivateKey
+		nodes []*discover.UDPv4
+	)
+	for i := 0; i < simNodes; i++ {
+		key := simKey(1, i)
+		conn, ln := simListen(t, sim, key)
+		cfg := discover.Config{PrivateKey: key, Clock: sim.Clock()}
+		if i > 0 {
+			cfg.Bootnodes = []*enode.Node{nodes[0].Self()}
+		}
+		node, err := discover.ListenV4(conn, ln, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer node.Close()
+		// Nodes join one by one, giving them time to bootstrap.
+		sim.Run(time.Second)
+		keys, nodes = append(keys, key), append(nodes, node)
+	}
+	// Let the nodes revalidate their tables.
+	sim.Run(time.Minute)
+
+	// Every node looks up the node on the opposite side of the network.
+	var lookups []func() bool
+	for i := range nodes {
+		src, dst := nodes[i], nodes[(i+simNodes/2)%simNodes]
+		key := keys[(i+simNodes/2)%simNodes]
+		lookups = append(lookups, func() bool {
+			for _, n := range src.LookupPubkey(&key.PublicKey) {
+				if n.ID() == dst.Self().ID() {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	runLookups(t, sim, lookups)
+}
+
+func TestSimV5(t *testing.T) {
+	var (
+		sim   = simnet.New(1, simLink)
+		nodes []*discover.UDPv5
+	)
+	for i := 0; i < simNodes; i++ {
+		key := simKey(1, i)
+		conn, ln := simListen(t, sim, key)
+		cfg := discover.Config{PrivateKey: key, Clock: sim.Clock()}
+		if i > 0 {
+			cfg.Bootnodes = []*enode.Node{nodes[0].Self()}
+		}
+		node, err := discover.ListenV5(conn, ln, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer node.Close()
+		// Nodes join one by one, giving them time to bootstrap.
+		sim.Run(time.Second)
+		nodes = append(nodes, node)
+	}
+	// Let the nodes revalidate their tables.
+	sim.Run(time.Minute)
+	for i, n := range nodes {
+		if len(n.AllNodes()) == 0 {
+			t.Fatalf("node %d has an empty table", i)
+		}
+	}
+
+	// Every node looks up the node on the opposite side of the network.
+	var lookups []func() bool
+	for i := range nodes {
+		src, dst := nodes[i], nodes[(i+simNodes/2)%simNodes]
+		lookups = append(lookups, func() bool {
+			for _, n := range src.Lookup(dst.Self().ID()) {
+				if n.ID() == dst.Self().ID() {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	runLookups(t, sim, lookups)
+}
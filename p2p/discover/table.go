@@ -33,6 +33,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
@@ -72,6 +73,7 @@ type Table struct {
 	ips     netutil.DistinctNetSet
 
 	log        log.Logger
+	clock      mclock.Clock
 	db         *enode.DB // database of known nodes
 	net        transport
 	refreshReq chan chan struct{}
@@ -99,7 +101,7 @@ type bucket struct {
 	ips          netutil.DistinctNetSet
 }
 
-func newTable(t transport, db *enode.DB, bootnodes []*enode.Node, log log.Logger) (*Table, error) {
+func newTable(t transport, db *enode.DB, cfg Config) (*Table, error) {
 	tab := &Table{
 		net:        t,
 		db:         db,
@@ -109,9 +111,10 @@ func newTable(t transport, db *enode.DB, bootnodes []*enode.Node, log log.Logger
 		closed:     make(chan struct{}),
 		rand:       mrand.New(mrand.NewSource(0)),
 		ips:        netutil.DistinctNetSet{Subnet: tableSubnet, Limit: tableIPLimit},
-		log:        log,
+		log:        cfg.Log,
+		clock:      cfg.Clock,
 	}
-	if err := tab.setFallbackNodes(bootnodes); err != nil {
+	if err := tab.setFallbackNodes(cfg.Bootnodes); err != nil {
 		return nil, err
 	}
 	for i := range tab.buckets {
@@ -217,9 +220,9 @@ func (tab *Table) refresh() <-chan struct{} {
 // loop schedules runs of doRefresh, doRevalidate and copyLiveNodes.
 func (tab *Table) loop() {
 	var (
-		revalidate     = time.NewTimer(tab.nextRevalidateTime())
-		refresh        = time.NewTicker(refreshInterval)
-		copyNodes      = time.NewTicker(copyNodesInterval)
+		revalidate     = tab.clock.NewTimer(tab.nextRevalidateTime())
+		refresh        = tab.clock.NewTimer(refreshInterval)
+		copyNodes      = tab.clock.NewTimer(copyNodesInterval)
 		refreshDone    = make(chan struct{})           // where doRefresh reports completion
 		revalidateDone chan struct{}                   // where doRevalidate reports completion
 		waiting        = []chan struct{}{tab.initDone} // holds waiting callers while doRefresh runs
@@ -234,7 +237,8 @@ func (tab *Table) loop() {
 loop:
 	for {
 		select {
-		case <-refresh.C:
+		case <-refresh.C():
+			refresh.Reset(refreshInterval)
 			tab.seedRand()
 			if refreshDone == nil {
 				refreshDone = make(chan struct{})
@@ -251,13 +255,14 @@ loop:
 				close(ch)
 			}
 			waiting, refreshDone = nil, nil
-		case <-revalidate.C:
+		case <-revalidate.C():
 			revalidateDone = make(chan struct{})
 			go tab.doRevalidate(revalidateDone)
 		case <-revalidateDone:
 			revalidate.Reset(tab.nextRevalidateTime())
 			revalidateDone = nil
-		case <-copyNodes.C:
+		case <-copyNodes.C():
+			copyNodes.Reset(copyNodesInterval)
 			go tab.copyLiveNodes()
 		case <-tab.closeReq:
 			break loop
@@ -305,7 +310,7 @@ func (tab *Table) loadSeedNodes() {
 	seeds = append(seeds, tab.nursery...)
 	for i := range seeds {
 		seed := seeds[i]
-		age := log.Lazy{Fn: func() interface{} { return time.Since(tab.db.LastPongReceived(seed.ID(), seed.IP())) }}
+		age := log.Lazy{Fn: func() interface{} { return wallTime(tab.clock).Sub(tab.db.LastPongReceived(seed.ID(), seed.IP())) }}
 		tab.log.Trace("Found seed node in database", "id", seed.ID(), "addr", seed.addr(), "age", age)
 		tab.addSeenNode(seed)
 	}
@@ -382,7 +387,7 @@ func (tab *Table) copyLiveNodes() {
 	tab.mutex.Lock()
 	defer tab.mutex.Unlock()
 
-	now := time.Now()
+	now := tab.clock.Now()
 	for _, b := range &tab.buckets {
 		for _, n := range b.entries {
 			if n.livenessChecks > 0 && now.Sub(n.addedAt) >= seedMinTableTime {
@@ -484,7 +489,7 @@ func (tab *Table) addSeenNode(n *node) {
 	// Add to end of bucket:
 	b.entries = append(b.entries, n)
 	b.replacements = deleteNode(b.replacements, n)
-	n.addedAt = time.Now()
+	n.addedAt = tab.clock.Now()
 	if tab.nodeAddedHook != nil {
 		tab.nodeAddedHook(n)
 	}
@@ -526,7 +531,7 @@ func (tab *Table) addVerifiedNode(n *node) {
 	// Add to front of bucket.
 	b.entries, _ = pushNode(b.entries, n, bucketSize)
 	b.replacements = deleteNode(b.replacements, n)
-	n.addedAt = time.Now()
+	n.addedAt = tab.clock.Now()
 	if tab.nodeAddedHook != nil {
 		tab.nodeAddedHook(n)
 	}
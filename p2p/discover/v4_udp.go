@@ -29,6 +29,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/discover/v4wire"
@@ -68,6 +69,7 @@ const (
 type UDPv4 struct {
 	conn        UDPConn
 	log         log.Logger
+	clock       mclock.Clock
 	netrestrict *netutil.Netlist
 	priv        *ecdsa.PrivateKey
 	localNode   *enode.LocalNode
@@ -98,7 +100,7 @@ type replyMatcher struct {
 	ptype byte
 
 	// time when the request must complete
-	deadline time.Time
+	deadline mclock.AbsTime
 
 	// callback is called when a matching reply arrives. If it returns matched == true, the
 	// reply was acceptable. The second return value indicates whether the callback should
@@ -141,9 +143,10 @@ func ListenV4(c UDPConn, ln *enode.LocalNode, cfg Config) (*UDPv4, error) {
 		closeCtx:        closeCtx,
 		cancelCloseCtx:  cancel,
 		log:             cfg.Log,
+		clock:           cfg.Clock,
 	}
 
-	tab, err := newTable(t, ln.Database(), cfg.Bootnodes, t.log)
+	tab, err := newTable(t, ln.Database(), cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -161,6 +164,16 @@ func (t *UDPv4) Self() *enode.Node {
 	return t.localNode.Node()
 }
 
+// now returns the current wall-clock time.
+func (t *UDPv4) now() time.Time {
+	return wallTime(t.clock)
+}
+
+// expired checks whether the given UNIX time stamp is in the past.
+func (t *UDPv4) expired(ts uint64) bool {
+	return time.Unix(int64(ts), 0).Before(t.now())
+}
+
 // Close shuts down the socket and aborts any running queries.
 func (t *UDPv4) Close() {
 	t.closeOnce.Do(func() {
@@ -253,7 +266,7 @@ func (t *UDPv4) makePing(toaddr *net.UDPAddr) *v4wire.Ping {
 		Version:    4,
 		From:       t.ourEndpoint(),
 		To:         v4wire.NewEndpoint(toaddr, 0),
-		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Expiration: uint64(t.now().Add(expiration).Unix()),
 		Rest:       []rlp.RawValue{seq},
 	}
 }
@@ -322,7 +335,7 @@ func (t *UDPv4) findnode(toid enode.ID, toaddr *net.UDPAddr, target v4wire.Pubke
 	})
 	t.send(toaddr, toid, &v4wire.Findnode{
 		Target:     target,
-		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Expiration: uint64(t.now().Add(expiration).Unix()),
 	})
 	// Ensure that callers don't see a timeout if the node actually responded. Since
 	// findnode can receive more than one neighbors response, the reply matcher will be
@@ -342,7 +355,7 @@ func (t *UDPv4) RequestENR(n *enode.Node) (*enode.Node, error) {
 	t.ensureBond(n.ID(), addr)
 
 	req := &v4wire.ENRRequest{
-		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Expiration: uint64(t.now().Add(expiration).Unix()),
 	}
 	packet, hash, err := v4wire.Encode(t.priv, req)
 	if err != nil {
@@ -411,12 +424,14 @@ func (t *UDPv4) loop() {
 
 	var (
 		plist        = list.New()
-		timeout      = time.NewTimer(0)
+		timeout      = t.clock.NewTimer(0)
 		nextTimeout  *replyMatcher // head of plist when timeout was last reset
 		contTimeouts = 0           // number of continuous timeouts to do NTP checks
 		ntpWarnTime  = time.Unix(0, 0)
 	)
-	<-timeout.C // ignore first timeout
+	if !timeout.Stop() {
+		<-timeout.C() // ignore first timeout
+	}
 	defer timeout.Stop()
 
 	resetTimeout := func() {
@@ -424,7 +439,7 @@ func (t *UDPv4) loop() {
 			return
 		}
 		// Start the timer so it fires when the next pending reply has expired.
-		now := time.Now()
+		now := t.clock.Now()
 		for el := plist.Front(); el != nil; el = el.Next() {
 			nextTimeout = el.Value.(*replyMatcher)
 			if dist := nextTimeout.deadline.Sub(now); dist < 2*respTimeout {
@@ -452,7 +467,7 @@ func (t *UDPv4) loop() {
 			return
 
 		case p := <-t.addReplyMatcher:
-			p.deadline = time.Now().Add(respTimeout)
+			p.deadline = t.clock.Now().Add(respTimeout)
 			plist.PushBack(p)
 
 		case r := <-t.gotreply:
@@ -474,20 +489,21 @@ func (t *UDPv4) loop() {
 			}
 			r.matched <- matched
 
-		case now := <-timeout.C:
+		case now := <-timeout.C():
 			nextTimeout = nil
 
 			// Notify and remove callbacks whose deadline is in the past.
 			for el := plist.Front(); el != nil; el = el.Next() {
 				p := el.Value.(*replyMatcher)
-				if now.After(p.deadline) || now.Equal(p.deadline) {
+				if now >= p.deadline {
 					p.errc <- errTimeout
 					plist.Remove(el)
 					contTimeouts++
 				}
 			}
-			// If we've accumulated too many timeouts, do an NTP time sync check
-			if contTimeouts > ntpFailureThreshold {
+			// If we've accumulated too many timeouts, do an NTP time sync check.
+			// This is skipped for simulated clocks.
+			if _, system := t.clock.(mclock.System); system && contTimeouts > ntpFailureThreshold {
 				if time.Since(ntpWarnTime) >= ntpWarningCooldown {
 					ntpWarnTime = time.Now()
 					go checkClockDrift()
@@ -562,18 +578,18 @@ func (t *UDPv4) handlePacket(from *net.UDPAddr, buf []byte) error {
 
 // checkBond checks if the given node has a recent enough endpoint proof.
 func (t *UDPv4) checkBond(id enode.ID, ip net.IP) bool {
-	return time.Since(t.db.LastPongReceived(id, ip)) < bondExpiration
+	return t.now().Sub(t.db.LastPongReceived(id, ip)) < bondExpiration
 }
 
 // ensureBond solicits a ping from a node if we haven't seen a ping from it for a while.
 // This ensures there is a valid endpoint proof on the remote end.
 func (t *UDPv4) ensureBond(toid enode.ID, toaddr *net.UDPAddr) {
-	tooOld := time.Since(t.db.LastPingReceived(toid, toaddr.IP)) > bondExpiration
+	tooOld := t.now().Sub(t.db.LastPingReceived(toid, toaddr.IP)) > bondExpiration
 	if tooOld || t.db.FindFails(toid, toaddr.IP) > maxFindnodeFailures {
 		rm := t.sendPing(toid, toaddr, nil)
 		<-rm.errc
 		// Wait for them to ping back and process our pong.
-		time.Sleep(respTimeout)
+		t.clock.Sleep(respTimeout)
 	}
 }
 
@@ -649,7 +665,7 @@ func (t *UDPv4) verifyPing(h *packetHandlerV4, from *net.UDPAddr, fromID enode.I
 	if err != nil {
 		return err
 	}
-	if v4wire.Expired(req.Expiration) {
+	if t.expired(req.Expiration) {
 		return errExpired
 	}
 	h.senderKey = senderKey
@@ -664,13 +680,13 @@ func (t *UDPv4) handlePing(h *packetHandlerV4, from *net.UDPAddr, fromID enode.I
 	t.send(from, fromID, &v4wire.Pong{
 		To:         v4wire.NewEndpoint(from, req.From.TCP),
 		ReplyTok:   mac,
-		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Expiration: uint64(t.now().Add(expiration).Unix()),
 		Rest:       []rlp.RawValue{seq},
 	})
 
 	// Ping back if our last pong on file is too far in the past.
 	n := wrapNode(enode.NewV4(h.senderKey, from.IP, int(req.From.TCP), from.Port))
-	if time.Since(t.db.LastPongReceived(n.ID(), from.IP)) > bondExpiration {
+	if t.now().Sub(t.db.LastPongReceived(n.ID(), from.IP)) > bondExpiration {
 		t.sendPing(fromID, from, func() {
 			t.tab.addVerifiedNode(n)
 		})
@@ -679,7 +695,7 @@ func (t *UDPv4) handlePing(h *packetHandlerV4, from *net.UDPAddr, fromID enode.I
 	}
 
 	// Update node database and endpoint predictor.
-	t.db.UpdateLastPingReceived(n.ID(), from.IP, time.Now())
+	t.db.UpdateLastPingReceived(n.ID(), from.IP, t.now())
 	t.localNode.UDPEndpointStatement(from, &net.UDPAddr{IP: req.To.IP, Port: int(req.To.UDP)})
 }
 
@@ -688,14 +704,14 @@ func (t *UDPv4) handlePing(h *packetHandlerV4, from *net.UDPAddr, fromID enode.I
 func (t *UDPv4) verifyPong(h *packetHandlerV4, from *net.UDPAddr, fromID enode.ID, fromKey v4wire.Pubkey) error {
 	req := h.Packet.(*v4wire.Pong)
 
-	if v4wire.Expired(req.Expiration) {
+	if t.expired(req.Expiration) {
 		return errExpired
 	}
 	if !t.handleReply(fromID, from.IP, req) {
 		return errUnsolicitedReply
 	}
 	t.localNode.UDPEndpointStatement(from, &net.UDPAddr{IP: req.To.IP, Port: int(req.To.UDP)})
-	t.db.UpdateLastPongReceived(fromID, from.IP, time.Now())
+	t.db.UpdateLastPongReceived(fromID, from.IP, t.now())
 	return nil
 }
 
@@ -704,7 +720,7 @@ func (t *UDPv4) verifyPong(h *packetHandlerV4, from *net.UDPAddr, fromID enode.I
 func (t *UDPv4) verifyFindnode(h *packetHandlerV4, from *net.UDPAddr, fromID enode.ID, fromKey v4wire.Pubkey) error {
 	req := h.Packet.(*v4wire.Findnode)
 
-	if v4wire.Expired(req.Expiration) {
+	if t.expired(req.Expiration) {
 		return errExpired
 	}
 	if !t.checkBond(fromID, from.IP) {
@@ -728,7 +744,7 @@ func (t *UDPv4) handleFindnode(h *packetHandlerV4, from *net.UDPAddr, fromID eno
 
 	// Send neighbors in chunks with at most maxNeighbors per packet
 	// to stay below the packet size limit.
-	p := v4wire.Neighbors{Expiration: uint64(time.Now().Add(expiration).Unix())}
+	p := v4wire.Neighbors{Expiration: uint64(t.now().Add(expiration).Unix())}
 	var sent bool
 	for _, n := range closest {
 		if netutil.CheckRelayIP(from.IP, n.IP()) == nil {
@@ -750,7 +766,7 @@ func (t *UDPv4) handleFindnode(h *packetHandlerV4, from *net.UDPAddr, fromID eno
 func (t *UDPv4) verifyNeighbors(h *packetHandlerV4, from *net.UDPAddr, fromID enode.ID, fromKey v4wire.Pubkey) error {
 	req := h.Packet.(*v4wire.Neighbors)
 
-	if v4wire.Expired(req.Expiration) {
+	if t.expired(req.Expiration) {
 		return errExpired
 	}
 	if !t.handleReply(fromID, from.IP, h.Packet) {
@@ -764,7 +780,7 @@ func (t *UDPv4) verifyNeighbors(h *packetHandlerV4, from *net.UDPAddr, fromID en
 func (t *UDPv4) verifyENRRequest(h *packetHandlerV4, from *net.UDPAddr, fromID enode.ID, fromKey v4wire.Pubkey) error {
 	req := h.Packet.(*v4wire.ENRRequest)
 
-	if v4wire.Expired(req.Expiration) {
+	if t.expired(req.Expiration) {
 		return errExpired
 	}
 	if !t.checkBond(fromID, from.IP) {
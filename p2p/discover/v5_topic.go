@@ -0,0 +1,532 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	topicAdLifetime       = 15 * time.Minute // lifetime of a topic advertisement
+	topicQueueLimit       = 100              // max advertisements per topic
+	topicTableLimit       = 5000             // max advertisements in total
+	topicQueryResultLimit = 16               // applies in TOPICQUERY handler
+	topicTicketWindow     = 10 * time.Second // time after the waiting time in which a ticket is valid
+	topicMaxTicketWait    = topicAdLifetime  // registrants don't wait longer than this for a ticket
+
+	topicRegistrarLimit  = 8                // number of nodes near the topic advertised at
+	topicRefreshMargin   = time.Minute      // advertisements are renewed this long before expiry
+	topicRetryInterval   = 30 * time.Second // delay between failed registration rounds
+	topicSearchInterval  = 10 * time.Second // delay between topic search lookups
+	topicTicketKeyLength = 32
+)
+
+var (
+	errInvalidTicket  = errors.New("invalid ticket")
+	errTicketWait     = errors.New("ticket waiting time too long")
+	errNotRegistered  = errors.New("registration rejected")
+	errInvalidTopicID = errors.New("invalid topic")
+)
+
+// Topic is the identifier of a discovery topic.
+type Topic [32]byte
+
+// NewTopic creates the identifier of a named topic, the hash of its name.
+func NewTopic(name string) Topic {
+	return Topic(crypto.Keccak256Hash([]byte(name)))
+}
+
+func (t Topic) String() string {
+	return fmt.Sprintf("%x", t[:])
+}
+
+// parseTopic converts a topic as found in a protocol message.
+func parseTopic(b []byte) (Topic, error) {
+	var topic Topic
+	if len(b) != len(topic) {
+		return topic, errInvalidTopicID
+	}
+	copy(topic[:], b)
+	return topic, nil
+}
+
+// topicAd is an advertisement of a node in a topic queue.
+type topicAd struct {
+	node   *enode.Node
+	expiry mclock.AbsTime
+}
+
+// topicTable stores the advertisements registered at the local node. Since all
+// advertisements have the same lifetime, the queues are ordered by expiry.
+type topicTable struct {
+	clock  mclock.Clock
+	queues map[Topic][]*topicAd
+	total  int
+	mu     sync.Mutex
+}
+
+func newTopicTable(clock mclock.Clock) *topicTable {
+	return &topicTable{clock: clock, queues: make(map[Topic][]*topicAd)}
+}
+
+// expire removes all expired advertisements. The lock must be held.
+func (tt *topicTable) expire() {
+	now := tt.clock.Now()
+	for topic, queue := range tt.queues {
+		n := 0
+		for n < len(queue) && queue[n].expiry <= now {
+			n++
+		}
+		tt.total -= n
+		if n == len(queue) {
+			delete(tt.queues, topic)
+		} else {
+			tt.queues[topic] = queue[n:]
+		}
+	}
+}
+
+// index returns the position of a node's advertisement in a topic queue, or -1.
+func (tt *topicTable) index(topic Topic, id enode.ID) int {
+	for i, ad := range tt.queues[topic] {
+		if ad.node.ID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// waitTime returns how long a node has to wait until its advertisement can be
+// admitted into a topic queue. Renewals of existing advertisements are admitted
+// immediately.
+func (tt *topicTable) waitTime(topic Topic, id enode.ID) time.Duration {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	tt.expire()
+	if tt.index(topic, id) >= 0 {
+		return 0
+	}
+	now := tt.clock.Now()
+	if queue := tt.queues[topic]; len(queue) >= topicQueueLimit {
+		return time.Duration(queue[0].expiry - now)
+	}
+	if tt.total < topicTableLimit {
+		return 0
+	}
+	// The table is full, wait for the earliest expiry in any queue.
+	var earliest mclock.AbsTime
+	for _, queue := range tt.queues {
+		if earliest == 0 || queue[0].expiry < earliest {
+			earliest = queue[0].expiry
+		}
+	}
+	return time.Duration(earliest - now)
+}
+
+// add inserts or renews the advertisement of a node, returning whether it was
+// admitted.
+func (tt *topicTable) add(topic Topic, n *enode.Node) bool {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	tt.expire()
+	queue := tt.queues[topic]
+	if i := tt.index(topic, n.ID()); i >= 0 {
+		queue = append(queue[:i], queue[i+1:]...)
+	} else {
+		if len(queue) >= topicQueueLimit || tt.total >= topicTableLimit {
+			return false
+		}
+		tt.total++
+	}
+	tt.queues[topic] = append(queue, &topicAd{node: n, expiry: tt.clock.Now().Add(topicAdLifetime)})
+	return true
+}
+
+// nodes returns the most recently registered advertisers of a topic.
+func (tt *topicTable) nodes(topic Topic, limit int) []*enode.Node {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	tt.expire()
+	queue := tt.queues[topic]
+	nodes := make([]*enode.Node, 0, min(limit, len(queue)))
+	for i := len(queue) - 1; i >= 0 && len(nodes) < limit; i-- {
+		nodes = append(nodes, queue[i].node)
+	}
+	return nodes
+}
+
+// topicTicket is issued by registrars in response to REQUESTTICKET. The ticket is
+// authenticated, so registrars don't need to keep any state about issued tickets.
+type topicTicket struct {
+	Topic  Topic
+	Node   enode.ID
+	IP     net.IP
+	Issued uint64 // registrar time of issue
+	Wait   uint64 // waiting time in nanoseconds
+	MAC    []byte
+}
+
+// mac computes the authentication code of the ticket.
+func (tk *topicTicket) mac(key []byte) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{tk.Topic, tk.Node, tk.IP, tk.Issued, tk.Wait})
+	h := hmac.New(sha256.New, key)
+	h.Write(enc)
+	return h.Sum(nil)
+}
+
+// RegisterTopic starts advertising the local node in the given topic. The node
+// is advertised at the nodes closest to the topic until UnregisterTopic is called
+// or the transport is closed.
+func (t *UDPv5) RegisterTopic(topic Topic) {
+	t.topicLock.Lock()
+	defer t.topicLock.Unlock()
+
+	if _, ok := t.topicRegs[topic]; ok || t.closeCtx.Err() != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(t.closeCtx)
+	t.topicRegs[topic] = cancel
+	t.wg.Add(1)
+	go t.topicRegisterLoop(ctx, topic)
+}
+
+// UnregisterTopic stops advertising the local node in the given topic. Existing
+// advertisements remain active until they expire.
+func (t *UDPv5) UnregisterTopic(topic Topic) {
+	t.topicLock.Lock()
+	defer t.topicLock.Unlock()
+
+	if cancel, ok := t.topicRegs[topic]; ok {
+		cancel()
+		delete(t.topicRegs, topic)
+	}
+}
+
+// topicRegisterLoop advertises the local node at the nodes closest to the topic,
+// renewing the advertisements before they expire.
+func (t *UDPv5) topicRegisterLoop(ctx context.Context, topic Topic) {
+	defer t.wg.Done()
+
+	for {
+		registrars := t.newLookup(ctx, enode.ID(topic)).run()
+		if len(registrars) > topicRegistrarLimit {
+			registrars = registrars[:topicRegistrarLimit]
+		}
+		results := make(chan error, len(registrars))
+		for _, n := range registrars {
+			go func(n *enode.Node) { results <- t.registerTopicAt(ctx, n, topic) }(n)
+		}
+		registered := 0
+		for _, n := range registrars {
+			if err := <-results; err == nil {
+				registered++
+			} else {
+				t.log.Trace("Topic registration failed", "topic", topic, "id", n.ID(), "err", err)
+			}
+		}
+		next := topicRetryInterval
+		if registered > 0 {
+			next = topicAdLifetime - topicRefreshMargin
+		}
+		t.log.Debug("Registered topic", "topic", topic, "registrars", registered, "next", next)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.clock.After(next):
+		}
+	}
+}
+
+// registerTopicAt obtains a ticket from a registrar, waits for the ticket to
+// become valid and registers the local node with it.
+func (t *UDPv5) registerTopicAt(ctx context.Context, n *enode.Node, topic Topic) error {
+	ticket, wait, err := t.requestTicket(n, topic)
+	if err != nil {
+		return err
+	}
+	if wait > topicMaxTicketWait {
+		return errTicketWait
+	}
+	select {
+	case <-ctx.Done():
+		return errClosed
+	case <-t.clock.After(wait):
+	}
+	registered, err := t.regtopic(n, ticket)
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return errNotRegistered
+	}
+	return nil
+}
+
+// requestTicket calls REQUESTTICKET on a node and waits for the ticket, returning
+// it along with its waiting time.
+func (t *UDPv5) requestTicket(n *enode.Node, topic Topic) ([]byte, time.Duration, error) {
+	resp := t.call(n, v5wire.TicketMsg, &v5wire.RequestTicket{Topic: topic[:]})
+	defer t.callDone(resp)
+
+	select {
+	case p := <-resp.ch:
+		blob := p.(*v5wire.Ticket).Ticket
+		var tk topicTicket
+		if err := rlp.DecodeBytes(blob, &tk); err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", errInvalidTicket, err)
+		}
+		if tk.Topic != topic {
+			return nil, 0, fmt.Errorf("%w: wrong topic %v", errInvalidTicket, tk.Topic)
+		}
+		return blob, time.Duration(tk.Wait), nil
+	case err := <-resp.err:
+		return nil, 0, err
+	}
+}
+
+// regtopic calls REGTOPIC on a node and waits for the confirmation.
+func (t *UDPv5) regtopic(n *enode.Node, ticket []byte) (bool, error) {
+	req := &v5wire.Regtopic{Ticket: ticket, ENR: t.localNode.Node().Record()}
+	resp := t.call(n, v5wire.RegconfirmationMsg, req)
+	defer t.callDone(resp)
+
+	select {
+	case p := <-resp.ch:
+		return p.(*v5wire.Regconfirmation).Registered, nil
+	case err := <-resp.err:
+		return false, err
+	}
+}
+
+// topicQuery calls TOPICQUERY on a node and waits for responses.
+func (t *UDPv5) topicQuery(n *enode.Node, topic Topic) ([]*enode.Node, error) {
+	resp := t.call(n, v5wire.NodesMsg, &v5wire.TopicQuery{Topic: topic[:]})
+	return t.waitForNodes(resp, nil)
+}
+
+// TopicSearch returns an iterator over the nodes advertising the given topic. The
+// search repeatedly looks up the nodes closest to the topic and queries them for
+// their advertisements.
+func (t *UDPv5) TopicSearch(topic Topic) enode.Iterator {
+	ctx, cancel := context.WithCancel(t.closeCtx)
+	return &topicIterator{
+		t:      t,
+		topic:  topic,
+		ctx:    ctx,
+		cancel: cancel,
+		seen:   make(map[enode.ID]struct{}),
+	}
+}
+
+// topicIterator iterates over the advertisers of a topic found by topic searches.
+type topicIterator struct {
+	t      *UDPv5
+	topic  Topic
+	ctx    context.Context
+	cancel func()
+	lookup *lookup
+	buffer []*enode.Node
+	seen   map[enode.ID]struct{}
+
+	found   []*enode.Node // results of TOPICQUERY calls made by the lookup
+	foundMu sync.Mutex
+}
+
+// Node returns the current node.
+func (it *topicIterator) Node() *enode.Node {
+	if len(it.buffer) == 0 {
+		return nil
+	}
+	return it.buffer[0]
+}
+
+// Next moves to the next node.
+func (it *topicIterator) Next() bool {
+	// Consume next node in buffer.
+	if len(it.buffer) > 0 {
+		it.buffer = it.buffer[1:]
+	}
+	// Advance the lookup to refill the buffer.
+	for len(it.buffer) == 0 {
+		if it.ctx.Err() != nil {
+			it.lookup = nil
+			it.buffer = nil
+			return false
+		}
+		if it.lookup == nil {
+			it.lookup = it.newLookup()
+			it.collect(it.t.topics.nodes(it.topic, topicQueryResultLimit))
+			continue
+		}
+		if !it.lookup.advance() {
+			it.lookup = nil
+			if len(it.buffer) == 0 && !it.collectFound() {
+				select {
+				case <-it.ctx.Done():
+				case <-it.t.clock.After(topicSearchInterval):
+				}
+			}
+			continue
+		}
+		it.collectFound()
+	}
+	return true
+}
+
+// newLookup creates a lookup toward the topic, calling TOPICQUERY on all nodes
+// queried by the lookup.
+func (it *topicIterator) newLookup() *lookup {
+	target := enode.ID(it.topic)
+	return newLookup(it.ctx, it.t.tab, target, func(n *node) ([]*node, error) {
+		if nodes, err := it.t.topicQuery(unwrapNode(n), it.topic); err == nil {
+			it.foundMu.Lock()
+			it.found = append(it.found, nodes...)
+			it.foundMu.Unlock()
+		}
+		return it.t.lookupWorker(n, target)
+	})
+}
+
+// collectFound moves the results of TOPICQUERY calls into the buffer, returning
+// whether any new nodes were found.
+func (it *topicIterator) collectFound() bool {
+	it.foundMu.Lock()
+	found := it.found
+	it.found = nil
+	it.foundMu.Unlock()
+
+	return it.collect(found)
+}
+
+// collect adds previously unseen nodes to the buffer.
+func (it *topicIterator) collect(nodes []*enode.Node) bool {
+	added := false
+	for _, n := range nodes {
+		if _, ok := it.seen[n.ID()]; ok || n.ID() == it.t.Self().ID() {
+			continue
+		}
+		it.seen[n.ID()] = struct{}{}
+		it.buffer = append(it.buffer, n)
+		added = true
+	}
+	return added
+}
+
+// Close ends the iterator.
+func (it *topicIterator) Close() {
+	it.cancel()
+}
+
+// handleRequestTicket issues a ticket for the requested topic.
+func (t *UDPv5) handleRequestTicket(p *v5wire.RequestTicket, fromID enode.ID, fromAddr *net.UDPAddr) {
+	topic, err := parseTopic(p.Topic)
+	if err != nil {
+		t.log.Debug("Invalid "+p.Name(), "id", fromID, "addr", fromAddr, "err", err)
+		return
+	}
+	tk := &topicTicket{
+		Topic:  topic,
+		Node:   fromID,
+		IP:     fromAddr.IP,
+		Issued: uint64(t.clock.Now()),
+		Wait:   uint64(t.topics.waitTime(topic, fromID)),
+	}
+	tk.MAC = tk.mac(t.ticketKey)
+	enc, _ := rlp.EncodeToBytes(tk)
+	t.sendResponse(fromID, fromAddr, &v5wire.Ticket{ReqID: p.ReqID, Ticket: enc})
+}
+
+// handleRegtopic admits the sender into a topic queue if its ticket is valid.
+func (t *UDPv5) handleRegtopic(p *v5wire.Regtopic, fromID enode.ID, fromAddr *net.UDPAddr) {
+	registered := false
+	topic, n, err := t.checkRegtopic(p, fromID, fromAddr)
+	if err == nil {
+		registered = t.topics.add(topic, n)
+	} else {
+		t.log.Debug("Invalid "+p.Name(), "id", fromID, "addr", fromAddr, "err", err)
+	}
+	t.sendResponse(fromID, fromAddr, &v5wire.Regconfirmation{ReqID: p.ReqID, Registered: registered})
+}
+
+// checkRegtopic verifies the ticket and record of a REGTOPIC request.
+func (t *UDPv5) checkRegtopic(p *v5wire.Regtopic, fromID enode.ID, fromAddr *net.UDPAddr) (Topic, *enode.Node, error) {
+	var tk topicTicket
+	if err := rlp.DecodeBytes(p.Ticket, &tk); err != nil {
+		return Topic{}, nil, fmt.Errorf("%w: %v", errInvalidTicket, err)
+	}
+	if !hmac.Equal(tk.MAC, tk.mac(t.ticketKey)) {
+		return Topic{}, nil, fmt.Errorf("%w: bad MAC", errInvalidTicket)
+	}
+	if tk.Node != fromID || !tk.IP.Equal(fromAddr.IP) {
+		return Topic{}, nil, fmt.Errorf("%w: issued to another node", errInvalidTicket)
+	}
+	var (
+		now   = t.clock.Now()
+		valid = mclock.AbsTime(tk.Issued).Add(time.Duration(tk.Wait))
+	)
+	if now < valid || now > valid.Add(topicTicketWindow) {
+		return Topic{}, nil, fmt.Errorf("%w: used outside of validity window", errInvalidTicket)
+	}
+	if p.ENR == nil {
+		return Topic{}, nil, errors.New("missing record")
+	}
+	n, err := enode.New(t.validSchemes, p.ENR)
+	if err != nil {
+		return Topic{}, nil, err
+	}
+	if n.ID() != fromID {
+		return Topic{}, nil, errors.New("record of another node")
+	}
+	return tk.Topic, n, nil
+}
+
+// handleTopicQuery returns the advertisers of a topic to the requester.
+func (t *UDPv5) handleTopicQuery(p *v5wire.TopicQuery, fromID enode.ID, fromAddr *net.UDPAddr) {
+	topic, err := parseTopic(p.Topic)
+	if err != nil {
+		t.log.Debug("Invalid "+p.Name(), "id", fromID, "addr", fromAddr, "err", err)
+		return
+	}
+	var nodes []*enode.Node
+	for _, n := range t.topics.nodes(topic, topicQueryResultLimit) {
+		if n.ID() == fromID || netutil.CheckRelayIP(fromAddr.IP, n.IP()) != nil {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	for _, resp := range packNodes(p.ReqID, nodes) {
+		t.sendResponse(fromID, fromAddr, resp)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/p2p/discover/v5wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// This test checks the admission and expiry of advertisements in the topic table.
+func TestTopicTable(t *testing.T) {
+	var (
+		clock = new(mclock.Simulated)
+		tt    = newTopicTable(clock)
+		topic = NewTopic("test")
+		nodes = nodesAtDistance(enode.ID{}, 256, topicQueueLimit+1)
+	)
+	for i, n := range nodes[:topicQueueLimit] {
+		if wait := tt.waitTime(topic, n.ID()); wait != 0 {
+			t.Fatalf("node %d: nonzero waiting time %v with room in queue", i, wait)
+		}
+		if !tt.add(topic, n) {
+			t.Fatalf("node %d: not admitted", i)
+		}
+		clock.Run(time.Second)
+	}
+	// The queue is full now, the next node has to wait for the first ad to expire.
+	last := nodes[topicQueueLimit]
+	want := topicAdLifetime - topicQueueLimit*time.Second
+	if wait := tt.waitTime(topic, last.ID()); wait != want {
+		t.Fatalf("wrong waiting time %v, want %v", wait, want)
+	}
+	if tt.add(topic, last) {
+		t.Fatal("node admitted into full queue")
+	}
+	// Renewals are admitted immediately, moving the ad to the end of the queue.
+	if wait := tt.waitTime(topic, nodes[0].ID()); wait != 0 {
+		t.Fatalf("nonzero waiting time %v for renewal", wait)
+	}
+	if !tt.add(topic, nodes[0]) {
+		t.Fatal("renewal not admitted")
+	}
+	if got := tt.nodes(topic, 1); len(got) != 1 || got[0].ID() != nodes[0].ID() {
+		t.Fatal("renewed node is not the most recent advertiser")
+	}
+	// After the second ad expires, there is room again.
+	clock.Run(want + time.Second)
+	if wait := tt.waitTime(topic, last.ID()); wait != 0 {
+		t.Fatalf("nonzero waiting time %v after expiry", wait)
+	}
+	if !tt.add(topic, last) {
+		t.Fatal("node not admitted after expiry")
+	}
+	if tt.total != topicQueueLimit {
+		t.Fatalf("wrong total %d, want %d", tt.total, topicQueueLimit)
+	}
+	// Everything expires eventually.
+	clock.Run(topicAdLifetime)
+	if n := len(tt.nodes(topic, topicQueryResultLimit)); n != 0 {
+		t.Fatalf("%d nodes left after expiry", n)
+	}
+	if tt.total != 0 {
+		t.Fatalf("wrong total %d after expiry", tt.total)
+	}
+}
+
+// This test checks that REQUESTTICKET, REGTOPIC and TOPICQUERY are handled correctly.
+func TestUDPv5_topicHandling(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	topic := NewTopic("test")
+	remote := test.getNode(test.remotekey, test.remoteaddr).Node()
+
+	// Topics of invalid length are ignored.
+	test.packetIn(&v5wire.RequestTicket{ReqID: []byte{0}, Topic: []byte{1, 2, 3}})
+
+	// Get a ticket.
+	var ticket []byte
+	test.packetIn(&v5wire.RequestTicket{ReqID: []byte{1}, Topic: topic[:]})
+	test.waitPacketOut(func(p *v5wire.Ticket, addr *net.UDPAddr, _ v5wire.Nonce) {
+		if !bytes.Equal(p.ReqID, []byte{1}) {
+			t.Fatalf("wrong request ID %v in TICKET", p.ReqID)
+		}
+		var tk topicTicket
+		if err := rlp.DecodeBytes(p.Ticket, &tk); err != nil {
+			t.Fatal("invalid ticket:", err)
+		}
+		if tk.Topic != topic || tk.Node != remote.ID() || tk.Wait != 0 {
+			t.Fatalf("wrong ticket contents: %+v", tk)
+		}
+		ticket = p.Ticket
+	})
+
+	// Tampered tickets are rejected.
+	tampered := common.CopyBytes(ticket)
+	tampered[len(tampered)-1] ^= 0xff
+	test.packetIn(&v5wire.Regtopic{ReqID: []byte{2}, Ticket: tampered, ENR: remote.Record()})
+	test.expectRegconfirmation([]byte{2}, false)
+
+	// Tickets can't be used by other nodes.
+	otherKey, otherAddr := newkey(), &net.UDPAddr{IP: net.IP{10, 0, 1, 100}, Port: 30303}
+	other := test.getNode(otherKey, otherAddr).Node()
+	test.packetInFrom(otherKey, otherAddr, &v5wire.Regtopic{ReqID: []byte{3}, Ticket: ticket, ENR: other.Record()})
+	test.expectRegconfirmation([]byte{3}, false)
+
+	// The record has to match the sender.
+	test.packetIn(&v5wire.Regtopic{ReqID: []byte{4}, Ticket: ticket, ENR: other.Record()})
+	test.expectRegconfirmation([]byte{4}, false)
+
+	// This registration works.
+	test.packetIn(&v5wire.Regtopic{ReqID: []byte{5}, Ticket: ticket, ENR: remote.Record()})
+	test.expectRegconfirmation([]byte{5}, true)
+
+	// The advertiser is returned by TOPICQUERY.
+	test.packetInFrom(otherKey, otherAddr, &v5wire.TopicQuery{ReqID: []byte{6}, Topic: topic[:]})
+	test.expectNodes([]byte{6}, 1, []*enode.Node{remote})
+
+	// Other topics are empty.
+	otherTopic := NewTopic("other")
+	test.packetInFrom(otherKey, otherAddr, &v5wire.TopicQuery{ReqID: []byte{7}, Topic: otherTopic[:]})
+	test.expectNodes([]byte{7}, 1, nil)
+}
+
+func (test *udpV5Test) expectRegconfirmation(wantReqID []byte, wantRegistered bool) {
+	test.t.Helper()
+	test.waitPacketOut(func(p *v5wire.Regconfirmation, addr *net.UDPAddr, _ v5wire.Nonce) {
+		if !bytes.Equal(p.ReqID, wantReqID) {
+			test.t.Fatalf("wrong request ID %v in REGCONFIRMATION, want %v", p.ReqID, wantReqID)
+		}
+		if p.Registered != wantRegistered {
+			test.t.Fatalf("wrong registration result %v, want %v", p.Registered, wantRegistered)
+		}
+	})
+}
+
+// This test checks that topic advertisements can be found by topic search.
+func TestUDPv5_topicE2E(t *testing.T) {
+	t.Parallel()
+
+	const N = 5
+	var nodes []*UDPv5
+	for i := 0; i < N; i++ {
+		var cfg Config
+		if len(nodes) > 0 {
+			cfg.Bootnodes = []*enode.Node{nodes[0].Self()}
+		}
+		node := startLocalhostV5(t, cfg)
+		nodes = append(nodes, node)
+		defer node.Close()
+	}
+	// Fill the tables.
+	for _, n := range nodes {
+		n.Lookup(n.Self().ID())
+	}
+
+	// Advertise two of the nodes.
+	topic := NewTopic("test")
+	advertisers := map[enode.ID]bool{nodes[1].Self().ID(): true, nodes[2].Self().ID(): true}
+	nodes[1].RegisterTopic(topic)
+	nodes[2].RegisterTopic(topic)
+
+	// Search for them.
+	it := nodes[N-1].TopicSearch(topic)
+	defer it.Close()
+	timeout := time.AfterFunc(30*time.Second, it.Close)
+	defer timeout.Stop()
+
+	for len(advertisers) > 0 && it.Next() {
+		id := it.Node().ID()
+		if !advertisers[id] {
+			t.Fatalf("search returned unexpected node %v", id)
+		}
+		delete(advertisers, id)
+	}
+	if len(advertisers) > 0 {
+		t.Fatalf("search didn't find %d advertisers", len(advertisers))
+	}
+}
@@ -40,6 +40,7 @@ const (
 	dbVersionKey   = "version" // Version of the database to flush if changes
 	dbNodePrefix   = "n:"      // Identifier to prefix node entries with
 	dbLocalPrefix  = "local:"
+	dbBanPrefix    = "ban:" // Identifier to prefix ban entries with, keyed by target
 	dbDiscoverRoot = "v4"
 	dbDiscv5Root   = "v5"
 
@@ -476,6 +477,58 @@ seek:
 	return nodes
 }
 
+// Ban is a ban on a node or on an IP network, persisted in the node database.
+type Ban struct {
+	Target string    // Node ID in hex or IP network in CIDR notation
+	Expiry time.Time // Time at which the ban is lifted, zero if permanent
+	Reason string    // Human readable reason of the ban
+}
+
+// banEntry is the database representation of a ban.
+type banEntry struct {
+	Expiry uint64 // Unix time in seconds, zero if permanent
+	Reason string
+}
+
+// Bans retrieves all the bans stored in the database, including expired ones.
+func (db *DB) Bans() []Ban {
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbBanPrefix)), nil)
+	defer it.Release()
+
+	var bans []Ban
+	for it.Next() {
+		var entry banEntry
+		if err := rlp.DecodeBytes(it.Value(), &entry); err != nil {
+			continue
+		}
+		ban := Ban{Target: string(it.Key()[len(dbBanPrefix):]), Reason: entry.Reason}
+		if entry.Expiry != 0 {
+			ban.Expiry = time.Unix(int64(entry.Expiry), 0)
+		}
+		bans = append(bans, ban)
+	}
+	return bans
+}
+
+// UpdateBan stores a ban in the database, replacing any previous ban of the
+// same target.
+func (db *DB) UpdateBan(ban Ban) error {
+	entry := banEntry{Reason: ban.Reason}
+	if !ban.Expiry.IsZero() {
+		entry.Expiry = uint64(ban.Expiry.Unix())
+	}
+	blob, err := rlp.EncodeToBytes(&entry)
+	if err != nil {
+		return err
+	}
+	return db.lvl.Put([]byte(dbBanPrefix+ban.Target), blob, nil)
+}
+
+// DeleteBan removes the ban of a target from the database.
+func (db *DB) DeleteBan(target string) error {
+	return db.lvl.Delete([]byte(dbBanPrefix+target), nil)
+}
+
 // reads the next node record from the iterator, skipping over other
 // database entries.
 func nextNode(it iterator.Iterator) *Node {
@@ -473,3 +473,32 @@ func TestDBExpireV5(t *testing.T) {
 	db.UpdateFindFailsV5(ID{}, ip, 4)
 	db.expireNodes()
 }
+
+func TestDBBans(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+
+	expiry := time.Unix(time.Now().Unix()+3600, 0)
+	bans := []Ban{
+		{Target: ID{0x01}.String(), Expiry: expiry, Reason: "misbehavior"},
+		{Target: "10.0.0.0/8", Reason: "manual"},
+	}
+	for _, ban := range bans {
+		if err := db.UpdateBan(ban); err != nil {
+			t.Fatalf("failed to store ban %q: %v", ban.Target, err)
+		}
+	}
+	if have := db.Bans(); !reflect.DeepEqual(have, bans) {
+		t.Errorf("ban list mismatch:\nhave %v\nwant %v", have, bans)
+	}
+	// Ban entries must not be mistaken for nodes
+	if seeds := db.QuerySeeds(10, time.Hour); len(seeds) != 0 {
+		t.Errorf("bans returned as seeds: %v", seeds)
+	}
+	if err := db.DeleteBan(bans[0].Target); err != nil {
+		t.Fatalf("failed to delete ban: %v", err)
+	}
+	if have := db.Bans(); !reflect.DeepEqual(have, bans[1:]) {
+		t.Errorf("ban list mismatch after deletion:\nhave %v\nwant %v", have, bans[1:])
+	}
+}
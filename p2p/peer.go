@@ -116,6 +116,9 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	// penalize charges the peer with misbehavior penalty if set
+	penalize func(Penalty)
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -191,6 +194,14 @@ func (p *Peer) Disconnect(reason DiscReason) {
 	}
 }
 
+// Penalize charges the peer with a misbehavior penalty. Peers accumulating too
+// much penalty are disconnected and temporarily banned.
+func (p *Peer) Penalize(penalty Penalty) {
+	if p.penalize != nil {
+		p.penalize(penalty)
+	}
+}
+
 // String implements fmt.Stringer.
 func (p *Peer) String() string {
 	id := p.ID()
@@ -202,6 +213,16 @@ func (p *Peer) Inbound() bool {
 	return p.rw.is(inboundConn)
 }
 
+// Trusted returns true if the peer is configured as a trusted node
+func (p *Peer) Trusted() bool {
+	return p.rw.is(trustedConn)
+}
+
+// Closed returns a channel which is closed once the peer is shutting down.
+func (p *Peer) Closed() <-chan struct{} {
+	return p.closed
+}
+
 func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 	protomap := matchProtocols(protocols, conn.caps, conn)
 	p := &Peer{
@@ -0,0 +1,306 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	recordFileLimit = 32 * 1024 * 1024 // Size of a recording file before it is rotated
+	recordFileCount = 4                // Number of rotated recording files kept per peer
+
+	// RecordFileExt is the file extension of traffic recordings.
+	RecordFileExt = ".rlp"
+)
+
+// MsgRecord is a single message of a traffic recording.
+type MsgRecord struct {
+	Time     uint64 // UNIX time in nanoseconds
+	Inbound  bool   // Whether the message was received from the peer
+	Protocol string // Name of the protocol, empty for base protocol messages
+	Version  uint   // Version of the protocol
+	Code     uint64 // Message code relative to the protocol offset
+	Payload  []byte // RLP-encoded message content
+}
+
+// ReceivedAt returns the time at which the message was recorded.
+func (r *MsgRecord) ReceivedAt() time.Time {
+	return time.Unix(0, int64(r.Time))
+}
+
+// Msg returns the recorded message.
+func (r *MsgRecord) Msg() Msg {
+	return Msg{
+		Code:       r.Code,
+		Size:       uint32(len(r.Payload)),
+		Payload:    bytes.NewReader(r.Payload),
+		ReceivedAt: r.ReceivedAt(),
+	}
+}
+
+// RecordFile returns the path of the current recording file of a peer within
+// the recording directory.
+func RecordFile(dir string, id enode.ID) string {
+	return filepath.Join(dir, id.String()+RecordFileExt)
+}
+
+// ReadRecording reads all messages of a traffic recording.
+func ReadRecording(r io.Reader) ([]*MsgRecord, error) {
+	var (
+		stream  = rlp.NewStream(bufio.NewReader(r), 0)
+		records []*MsgRecord
+	)
+	for {
+		rec := new(MsgRecord)
+		if err := stream.Decode(rec); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, fmt.Errorf("invalid record %d: %v", len(records), err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// ReadRecordingFile reads all messages of a traffic recording file.
+func ReadRecordingFile(file string) ([]*MsgRecord, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return ReadRecording(fd)
+}
+
+// msgRecorder writes the decrypted traffic of a single peer connection into
+// a set of rotating files.
+type msgRecorder struct {
+	path   string
+	protos []*protoRW
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// newMsgRecorder opens the recording file of the peer, appending to any
+// recording of previous connections.
+func newMsgRecorder(dir string, id enode.ID, protos map[string]*protoRW) (*msgRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	r := &msgRecorder{path: RecordFile(dir, id)}
+	for _, proto := range protos {
+		r.protos = append(r.protos, proto)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *msgRecorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, stat.Size()
+	return nil
+}
+
+// rotate moves the current file out of the way, shifting older files and
+// dropping the oldest one.
+func (r *msgRecorder) rotate() error {
+	r.file.Close()
+	r.file = nil
+	for i := recordFileCount - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d", r.path, i-1)
+		if i == 1 {
+			from = r.path
+		}
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return r.open()
+}
+
+// record writes a message to the recording. The message payload is consumed
+// and replaced by a reader over the recorded content.
+func (r *msgRecorder) record(msg *Msg, inbound bool) error {
+	payload, err := ioutil.ReadAll(io.LimitReader(msg.Payload, int64(msg.Size)))
+	if err != nil {
+		return err
+	}
+	msg.Payload = bytes.NewReader(payload)
+
+	rec := &MsgRecord{
+		Time:    uint64(time.Now().UnixNano()),
+		Inbound: inbound,
+		Code:    msg.Code,
+		Payload: payload,
+	}
+	if msg.Code >= baseProtocolLength {
+		for _, proto := range r.protos {
+			if msg.Code >= proto.offset && msg.Code < proto.offset+proto.Length {
+				rec.Protocol, rec.Version, rec.Code = proto.Name, proto.Version, msg.Code-proto.offset
+				break
+			}
+		}
+	}
+	enc, err := rlp.EncodeToBytes(rec)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return errRecorderClosed
+	}
+	if r.size > 0 && r.size+int64(len(enc)) > recordFileLimit {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(enc)
+	r.size += int64(n)
+	return err
+}
+
+func (r *msgRecorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+var errRecorderClosed = errors.New("recorder closed")
+
+// recordingTransport is a transport which records all messages sent and received
+// after the handshakes.
+type recordingTransport struct {
+	transport
+	rec *msgRecorder
+	log func(msg string, ctx ...interface{})
+}
+
+func (t *recordingTransport) ReadMsg() (Msg, error) {
+	msg, err := t.transport.ReadMsg()
+	if err == nil {
+		t.record(&msg, true)
+	}
+	return msg, err
+}
+
+func (t *recordingTransport) WriteMsg(msg Msg) error {
+	t.record(&msg, false)
+	return t.transport.WriteMsg(msg)
+}
+
+func (t *recordingTransport) record(msg *Msg, inbound bool) {
+	if err := t.rec.record(msg, inbound); err != nil && err != errRecorderClosed {
+		t.log("Failed to record message", "code", msg.Code, "err", err)
+	}
+}
+
+func (t *recordingTransport) close(err error) {
+	t.transport.close(err)
+	t.rec.close()
+}
+
+// Replayer is a MsgReadWriter which feeds the inbound messages of a single protocol
+// from a traffic recording to a protocol handler. Messages written by the handler
+// are collected and can be compared against the outbound messages of the recording.
+type Replayer struct {
+	protocol string
+	inbound  []*MsgRecord
+
+	mu      sync.Mutex
+	written []*MsgRecord
+}
+
+// NewReplayer creates a replayer for the messages of the given protocol.
+func NewReplayer(records []*MsgRecord, protocol string) *Replayer {
+	r := &Replayer{protocol: protocol}
+	for _, rec := range records {
+		if rec.Inbound && rec.Protocol == protocol {
+			r.inbound = append(r.inbound, rec)
+		}
+	}
+	return r
+}
+
+// ReadMsg returns the next recorded inbound message. It returns io.EOF when
+// the recording is exhausted.
+func (r *Replayer) ReadMsg() (Msg, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.inbound) == 0 {
+		return Msg{}, io.EOF
+	}
+	rec := r.inbound[0]
+	r.inbound = r.inbound[1:]
+	return rec.Msg(), nil
+}
+
+// WriteMsg collects a message written by the handler.
+func (r *Replayer) WriteMsg(msg Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.written = append(r.written, &MsgRecord{
+		Time:     uint64(time.Now().UnixNano()),
+		Protocol: r.protocol,
+		Code:     msg.Code,
+		Payload:  payload,
+	})
+	return nil
+}
+
+// Written returns the messages written by the handler so far.
+func (r *Replayer) Written() []*MsgRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*MsgRecord(nil), r.written...)
+}
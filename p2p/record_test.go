@@ -0,0 +1,187 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// recordTestProtocol reads a number and answers with its successor.
+var recordTestProtocol = Protocol{
+	Name:    "a",
+	Version: 2,
+	Length:  5,
+	Run: func(peer *Peer, rw MsgReadWriter) error {
+		var n []uint
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Code != 2 {
+			return fmt.Errorf("unexpected message code %d", msg.Code)
+		}
+		if err := msg.Decode(&n); err != nil {
+			return err
+		}
+		return Send(rw, 3, []uint{n[0] + 1})
+	},
+}
+
+// This test checks that the recorder writes the traffic of a peer, and that
+// the recording can be replayed into the protocol handler.
+func TestPeerRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-record-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		fd1, fd2   = net.Pipe()
+		key1, key2 = newkey(), newkey()
+		t1         = newTestTransport(&key2.PublicKey, fd1, nil)
+		t2         = newTestTransport(&key1.PublicKey, fd2, &key1.PublicKey)
+		protos     = []Protocol{recordTestProtocol}
+	)
+	c1 := &conn{fd: fd1, node: newNode(uintID(1), ""), transport: t1, caps: []Cap{protos[0].cap()}}
+	c2 := &conn{fd: fd2, node: newNode(uintID(2), ""), transport: t2}
+	defer c2.close(errProtocolReturned)
+
+	peer := newPeer(log.Root(), c1, protos)
+	rec, err := newMsgRecorder(dir, c1.node.ID(), peer.running)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1.transport = &recordingTransport{transport: c1.transport, rec: rec, log: peer.log.Debug}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := peer.run()
+		errc <- err
+	}()
+
+	// Talk to the protocol and let it finish.
+	if err := Send(c2, baseProtocolLength+2, []uint{41}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExpectMsg(c2, baseProtocolLength+3, []uint{42}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != errProtocolReturned {
+			t.Fatalf("peer returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("peer did not return")
+	}
+
+	// Check the recording.
+	records, err := ReadRecordingFile(RecordFile(dir, c1.node.ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var protoRecords []*MsgRecord
+	for _, r := range records {
+		if r.Protocol != "" {
+			protoRecords = append(protoRecords, r)
+		}
+	}
+	if len(protoRecords) != 2 {
+		t.Fatalf("wrong number of protocol records %d, want 2", len(protoRecords))
+	}
+	checkRecord(t, protoRecords[0], true, 2, []uint{41})
+	checkRecord(t, protoRecords[1], false, 3, []uint{42})
+
+	// Replay the recording.
+	replayer := NewReplayer(records, recordTestProtocol.Name)
+	if err := recordTestProtocol.Run(nil, replayer); err != nil {
+		t.Fatal("replay failed:", err)
+	}
+	if _, err := replayer.ReadMsg(); err != io.EOF {
+		t.Fatalf("wrong error after replay: %v", err)
+	}
+	written := replayer.Written()
+	if len(written) != 1 {
+		t.Fatalf("wrong number of written messages %d, want 1", len(written))
+	}
+	if written[0].Code != protoRecords[1].Code || !bytes.Equal(written[0].Payload, protoRecords[1].Payload) {
+		t.Fatalf("replayed response %+v doesn't match recording %+v", written[0], protoRecords[1])
+	}
+}
+
+func checkRecord(t *testing.T, r *MsgRecord, inbound bool, code uint64, content interface{}) {
+	t.Helper()
+	want, _ := rlp.EncodeToBytes(content)
+	if r.Inbound != inbound || r.Protocol != "a" || r.Version != 2 || r.Code != code || !bytes.Equal(r.Payload, want) {
+		t.Errorf("wrong record %+v", r)
+	}
+}
+
+// This test checks that recording files are rotated.
+func TestRecorderRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-record-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := uintID(1)
+	rec, err := newMsgRecorder(dir, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.close()
+
+	// Write one message into each file, rotating more often than files are kept.
+	for i := 0; i < recordFileCount+2; i++ {
+		if i > 0 {
+			if err := rec.rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		msg := Msg{Code: uint64(i), Size: 1, Payload: bytes.NewReader([]byte{0x80})}
+		if err := rec.record(&msg, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < recordFileCount; i++ {
+		file := RecordFile(dir, id)
+		if i > 0 {
+			file = fmt.Sprintf("%s.%d", file, i)
+		}
+		records, err := ReadRecordingFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := uint64(recordFileCount + 1 - i); len(records) != 1 || records[0].Code != want {
+			t.Fatalf("file %d: wrong content %v, want message %d", i, records, want)
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", RecordFile(dir, id), recordFileCount)); !os.IsNotExist(err) {
+		t.Fatal("too many recording files kept")
+	}
+}
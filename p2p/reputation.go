@@ -0,0 +1,320 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Penalty is a misbehavior score charged to a peer by protocol handlers.
+type Penalty int
+
+const (
+	PenaltyUselessResponse Penalty = 10 // Peer responded with irrelevant or unexpected data
+	PenaltyTimeout         Penalty = 25 // Peer failed to deliver requested data in time
+	PenaltyInvalidBlock    Penalty = 60 // Peer delivered a block or header failing validation, banned if repeated
+)
+
+const (
+	// banScore is the misbehavior score at which a peer gets banned.
+	banScore = 100
+
+	// scoreHalfLife is the time it takes for misbehavior scores to halve.
+	scoreHalfLife = 10 * time.Minute
+
+	// defaultBanDuration is the duration of automatic bans if not configured.
+	defaultBanDuration = time.Hour
+)
+
+// BanInfo represents a short summary of a ban enforced by the server.
+type BanInfo struct {
+	Target string     `json:"target"`           // Node ID or IP network in CIDR notation
+	Expiry *time.Time `json:"expiry,omitempty"` // Time at which the ban is lifted, nil if permanent
+	Reason string     `json:"reason"`
+}
+
+// peerScore is the decaying misbehavior score of a node.
+type peerScore struct {
+	value   float64
+	updated time.Time
+}
+
+// reputation tracks the misbehavior scores of peers and the bans of nodes and IP
+// networks, persisting the latter into the node database.
+type reputation struct {
+	db       *enode.DB
+	duration time.Duration
+	log      log.Logger
+	now      func() time.Time
+
+	scores map[enode.ID]*peerScore
+	nodes  map[enode.ID]enode.Ban // Banned nodes
+	nets   map[string]*net.IPNet  // Banned IP networks, keyed by CIDR notation
+	bans   map[string]enode.Ban   // All bans, keyed by target
+	lock   sync.Mutex
+}
+
+// newReputation creates a reputation tracker, loading the previously persisted
+// bans from the node database.
+func newReputation(db *enode.DB, duration time.Duration, logger log.Logger) *reputation {
+	if duration == 0 {
+		duration = defaultBanDuration
+	}
+	r := &reputation{
+		db:       db,
+		duration: duration,
+		log:      logger,
+		now:      time.Now,
+		scores:   make(map[enode.ID]*peerScore),
+		nodes:    make(map[enode.ID]enode.Ban),
+		nets:     make(map[string]*net.IPNet),
+		bans:     make(map[string]enode.Ban),
+	}
+	for _, ban := range db.Bans() {
+		if !r.active(ban) {
+			db.DeleteBan(ban.Target)
+			continue
+		}
+		if _, err := r.insert(ban); err != nil {
+			logger.Warn("Dropping invalid ban", "target", ban.Target, "err", err)
+			db.DeleteBan(ban.Target)
+		}
+	}
+	return r
+}
+
+// parseBanTarget parses a node given as enode URL, node record or node ID, or an
+// IP address or network in CIDR notation. The returned target is normalized.
+func parseBanTarget(target string) (string, *enode.ID, *net.IPNet, error) {
+	if strings.Contains(target, "/") {
+		_, network, err := net.ParseCIDR(target)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return network.String(), nil, network, nil
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		network := &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return network.String(), nil, network, nil
+	}
+	if id, err := enode.ParseID(target); err == nil {
+		return id.String(), &id, nil, nil
+	}
+	node, err := enode.Parse(enode.ValidSchemes, target)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid ban target %q", target)
+	}
+	id := node.ID()
+	return id.String(), &id, nil, nil
+}
+
+// insert adds a ban to the in-memory ban set without persisting it, returning
+// the normalized ban target.
+func (r *reputation) insert(ban enode.Ban) (string, error) {
+	target, id, network, err := parseBanTarget(ban.Target)
+	if err != nil {
+		return "", err
+	}
+	ban.Target = target
+	if id != nil {
+		r.nodes[*id] = ban
+	} else {
+		r.nets[target] = network
+	}
+	r.bans[target] = ban
+	return target, nil
+}
+
+// remove deletes a ban from the in-memory ban set and from the database.
+func (r *reputation) remove(target string) {
+	if ban, ok := r.bans[target]; ok {
+		delete(r.bans, target)
+		delete(r.nets, target)
+		if id, err := enode.ParseID(ban.Target); err == nil {
+			delete(r.nodes, id)
+		}
+	}
+	if err := r.db.DeleteBan(target); err != nil {
+		r.log.Warn("Failed to delete ban", "target", target, "err", err)
+	}
+}
+
+// ban bans a node or IP network for the given duration, permanently if zero.
+func (r *reputation) ban(target string, duration time.Duration, reason string) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ban := enode.Ban{Target: target, Reason: reason}
+	if duration > 0 {
+		ban.Expiry = r.now().Add(duration)
+	}
+	target, err := r.insert(ban)
+	if err != nil {
+		return "", err
+	}
+	ban = r.bans[target]
+	if id, err := enode.ParseID(ban.Target); err == nil {
+		delete(r.scores, id)
+	}
+	if err := r.db.UpdateBan(ban); err != nil {
+		r.log.Warn("Failed to persist ban", "target", ban.Target, "err", err)
+	}
+	return ban.Target, nil
+}
+
+// unban lifts the ban of a node or IP network.
+func (r *reputation) unban(target string) error {
+	target, _, _, err := parseBanTarget(target)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.bans[target]; !ok {
+		return fmt.Errorf("%s is not banned", target)
+	}
+	r.remove(target)
+	return nil
+}
+
+// banned reports whether a node or its IP address is banned. If the IP of the
+// node is not known, only its ID is checked.
+func (r *reputation) banned(id enode.ID, ip net.IP) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if ban, ok := r.nodes[id]; ok {
+		if r.active(ban) {
+			return true
+		}
+		r.remove(ban.Target)
+	}
+	return ip != nil && r.bannedNet(ip)
+}
+
+// bannedNode reports whether a node or its IP address is banned.
+func (r *reputation) bannedNode(n *enode.Node) bool {
+	return r.banned(n.ID(), n.IP())
+}
+
+// bannedIP reports whether an IP address is within a banned network.
+func (r *reputation) bannedIP(ip net.IP) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.bannedNet(ip)
+}
+
+// bannedNet reports whether an IP address is within a banned network. The lock
+// must be held by the caller.
+func (r *reputation) bannedNet(ip net.IP) bool {
+	for target, network := range r.nets {
+		if !network.Contains(ip) {
+			continue
+		}
+		if r.active(r.bans[target]) {
+			return true
+		}
+		r.remove(target)
+	}
+	return false
+}
+
+// active reports whether a ban is permanent or not yet expired.
+func (r *reputation) active(ban enode.Ban) bool {
+	return ban.Expiry.IsZero() || ban.Expiry.After(r.now())
+}
+
+// penalize charges a node with a misbehavior penalty, returning whether its
+// score crossed the ban threshold. The score of a node decays over time.
+func (r *reputation) penalize(id enode.ID, penalty Penalty) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+	score := r.scores[id]
+	if score == nil {
+		score = &peerScore{updated: now}
+		r.scores[id] = score
+	}
+	score.value = decayScore(score.value, now.Sub(score.updated)) + float64(penalty)
+	score.updated = now
+
+	// Clean up the scores of well behaving nodes every once in a while
+	for other, s := range r.scores {
+		if decayScore(s.value, now.Sub(s.updated)) < 1 {
+			delete(r.scores, other)
+		}
+	}
+	return score.value >= banScore
+}
+
+// score returns the current misbehavior score of a node.
+func (r *reputation) score(id enode.ID) float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	score := r.scores[id]
+	if score == nil {
+		return 0
+	}
+	return decayScore(score.value, r.now().Sub(score.updated))
+}
+
+// list returns all the active bans, sorted by target.
+func (r *reputation) list() []*BanInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	bans := make([]*BanInfo, 0, len(r.bans))
+	for target, ban := range r.bans {
+		if !r.active(ban) {
+			r.remove(target)
+			continue
+		}
+		info := &BanInfo{Target: target, Reason: ban.Reason}
+		if !ban.Expiry.IsZero() {
+			expiry := ban.Expiry
+			info.Expiry = &expiry
+		}
+		bans = append(bans, info)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Target < bans[j].Target })
+	return bans
+}
+
+// decayScore halves a misbehavior score every scoreHalfLife.
+func decayScore(value float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return value
+	}
+	return value * math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+}
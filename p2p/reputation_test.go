@@ -0,0 +1,136 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func newTestReputation(db *enode.DB, now *time.Time) *reputation {
+	r := newReputation(db, 0, log.Root())
+	r.now = func() time.Time { return *now }
+	return r
+}
+
+// Tests that misbehavior scores accumulate, decay over time and cross the ban
+// threshold only when enough penalties are charged in a short time.
+func TestReputationPenalties(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	now := time.Now()
+	r := newTestReputation(db, &now)
+
+	id := enode.ID{0x01}
+	for i := 0; i < 3; i++ {
+		if r.penalize(id, PenaltyTimeout) {
+			t.Fatalf("penalty %d: ban threshold crossed early", i)
+		}
+	}
+	// After a half-life, the score should have decayed enough to allow two more
+	// timeouts, but not three
+	now = now.Add(scoreHalfLife)
+	if have, want := r.score(id), float64(3*PenaltyTimeout)/2; have != want {
+		t.Fatalf("decayed score mismatch: have %v, want %v", have, want)
+	}
+	for i := 0; i < 2; i++ {
+		if r.penalize(id, PenaltyTimeout) {
+			t.Fatalf("penalty %d: ban threshold crossed after decay", i)
+		}
+	}
+	if !r.penalize(id, PenaltyTimeout) {
+		t.Fatalf("ban threshold not crossed")
+	}
+	// A single invalid block might be an honest mistake (e.g. a local bug or a
+	// reorg race), repeated ones should be banned
+	if r.penalize(enode.ID{0x02}, PenaltyInvalidBlock) {
+		t.Fatalf("single invalid block crossed the ban threshold")
+	}
+	if !r.penalize(enode.ID{0x02}, PenaltyInvalidBlock) {
+		t.Fatalf("repeated invalid blocks didn't cross the ban threshold")
+	}
+}
+
+// Tests that node and network bans are enforced until they expire, and are
+// persisted in the node database.
+func TestReputationBans(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	now := time.Now()
+	r := newTestReputation(db, &now)
+
+	var (
+		node  = enode.ID{0x01}
+		other = enode.ID{0x02}
+	)
+	if _, err := r.ban(node.String(), time.Hour, "test"); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	if _, err := r.ban("10.1.0.0/16", 0, "test"); err != nil {
+		t.Fatalf("failed to ban network: %v", err)
+	}
+	if target, err := r.ban("192.168.1.1", 2*time.Hour, "test"); err != nil || target != "192.168.1.1/32" {
+		t.Fatalf("failed to ban address: target %q, err %v", target, err)
+	}
+	if _, err := r.ban("not a node", 0, "test"); err == nil {
+		t.Fatalf("invalid target banned")
+	}
+	tests := []struct {
+		id     enode.ID
+		ip     net.IP
+		banned bool
+	}{
+		{node, nil, true},
+		{other, nil, false},
+		{other, net.IP{10, 1, 200, 1}, true},
+		{other, net.IP{10, 2, 0, 1}, false},
+		{other, net.IP{192, 168, 1, 1}, true},
+		{other, net.IP{192, 168, 1, 2}, false},
+	}
+	for i, tt := range tests {
+		if banned := r.banned(tt.id, tt.ip); banned != tt.banned {
+			t.Errorf("test %d: ban mismatch: have %v, want %v", i, banned, tt.banned)
+		}
+	}
+	// Reload the bans from the database and let the node ban expire
+	r = newTestReputation(db, &now)
+	if bans := r.list(); len(bans) != 3 {
+		t.Fatalf("persisted ban count mismatch: have %d, want 3", len(bans))
+	}
+	now = now.Add(time.Hour)
+	if r.banned(node, nil) {
+		t.Errorf("expired node ban still enforced")
+	}
+	if bans := db.Bans(); len(bans) != 2 {
+		t.Errorf("expired ban not deleted from database: have %d bans, want 2", len(bans))
+	}
+	if err := r.unban("10.1.0.0/16"); err != nil {
+		t.Fatalf("failed to unban network: %v", err)
+	}
+	if r.bannedIP(net.IP{10, 1, 200, 1}) {
+		t.Errorf("unbanned network still enforced")
+	}
+	if err := r.unban("10.1.0.0/16"); err == nil {
+		t.Errorf("unbanned network unbanned again")
+	}
+}
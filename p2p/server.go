@@ -123,6 +123,10 @@ type Config struct {
 	// live nodes in the network.
 	NodeDatabase string `toml:",omitempty"`
 
+	// BanDuration is the duration of the automatic bans of peers accumulating too
+	// much misbehavior penalty. Zero defaults to one hour.
+	BanDuration time.Duration `toml:",omitempty"`
+
 	// Protocols should contain the protocols supported
 	// by the server. Matching protocols are launched for
 	// each peer.
@@ -152,6 +156,10 @@ type Config struct {
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
 
+	// RecordDir is the directory into which the decrypted traffic of all peers
+	// is recorded for protocol debugging. Recording is disabled if empty.
+	RecordDir string `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
@@ -178,12 +186,13 @@ type Server struct {
 	peerFeed     event.Feed
 	log          log.Logger
 
-	nodedb    *enode.DB
-	localnode *enode.LocalNode
-	ntab      *discover.UDPv4
-	DiscV5    *discover.UDPv5
-	discmix   *enode.FairMix
-	dialsched *dialScheduler
+	nodedb     *enode.DB
+	reputation *reputation
+	localnode  *enode.LocalNode
+	ntab       *discover.UDPv4
+	DiscV5     *discover.UDPv5
+	discmix    *enode.FairMix
+	dialsched  *dialScheduler
 
 	// Channels into the run loop.
 	quit                    chan struct{}
@@ -370,6 +379,75 @@ func (srv *Server) RemoveTrustedPeer(node *enode.Node) {
 	}
 }
 
+// BanPeer bans a node, given as enode URL, node record or node ID, or an IP
+// address or network in CIDR notation, for the given duration, permanently if
+// zero. Connected peers matching the ban are disconnected.
+func (srv *Server) BanPeer(target string, duration time.Duration, reason string) error {
+	rep := srv.runningReputation()
+	if rep == nil {
+		return errServerStopped
+	}
+	target, err := rep.ban(target, duration, reason)
+	if err != nil {
+		return err
+	}
+	srv.log.Info("Banned peers", "target", target, "duration", common.PrettyDuration(duration), "reason", reason)
+
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		for _, p := range peers {
+			if rep.banned(p.ID(), netutil.AddrIP(p.RemoteAddr())) {
+				p.Disconnect(DiscUselessPeer)
+			}
+		}
+	})
+	return nil
+}
+
+// UnbanPeer lifts the ban of a node or IP network, given in any of the forms
+// accepted by BanPeer.
+func (srv *Server) UnbanPeer(target string) error {
+	rep := srv.runningReputation()
+	if rep == nil {
+		return errServerStopped
+	}
+	return rep.unban(target)
+}
+
+// Bans returns the bans currently enforced by the server.
+func (srv *Server) Bans() []*BanInfo {
+	rep := srv.runningReputation()
+	if rep == nil {
+		return nil
+	}
+	return rep.list()
+}
+
+// runningReputation returns the reputation tracker if the server is running.
+func (srv *Server) runningReputation() *reputation {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if !srv.running {
+		return nil
+	}
+	return srv.reputation
+}
+
+// penalize charges a peer with a misbehavior penalty, banning and disconnecting
+// it if its score crosses the ban threshold. Trusted peers are never banned.
+func (srv *Server) penalize(p *Peer, penalty Penalty) {
+	if !srv.reputation.penalize(p.ID(), penalty) || p.rw.is(trustedConn) {
+		return
+	}
+	target, err := srv.reputation.ban(p.ID().String(), srv.reputation.duration, "misbehavior")
+	if err != nil {
+		p.log.Warn("Failed to ban misbehaving peer", "err", err)
+		return
+	}
+	p.log.Debug("Banned misbehaving peer", "target", target, "duration", common.PrettyDuration(srv.reputation.duration))
+	p.Disconnect(DiscUselessPeer)
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -473,6 +551,7 @@ func (srv *Server) Start() (err error) {
 	if err := srv.setupLocalNode(); err != nil {
 		return err
 	}
+	srv.reputation = newReputation(srv.nodedb, srv.BanDuration, srv.log)
 	if srv.ListenAddr != "" {
 		if err := srv.setupListening(); err != nil {
 			return err
@@ -621,6 +700,7 @@ func (srv *Server) setupDialScheduler() {
 		maxActiveDials: srv.MaxPendingPeers,
 		log:            srv.Logger,
 		netRestrict:    srv.NetRestrict,
+		banned:         srv.reputation.bannedNode,
 		dialer:         srv.Dialer,
 		clock:          srv.clock,
 	}
@@ -810,6 +890,8 @@ func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount in
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case srv.reputation.banned(c.node.ID(), netutil.AddrIP(c.fd.RemoteAddr())):
+		return errBanned
 	default:
 		return nil
 	}
@@ -905,6 +987,10 @@ func (srv *Server) checkInboundConn(fd net.Conn, remoteIP net.IP) error {
 	if srv.NetRestrict != nil && !srv.NetRestrict.Contains(remoteIP) {
 		return fmt.Errorf("not whitelisted in NetRestrict")
 	}
+	// Reject connections from banned networks.
+	if srv.reputation.bannedIP(remoteIP) {
+		return errBanned
+	}
 	// Reject Internet peers that try too often.
 	now := srv.clock.Now()
 	srv.inboundHistory.expire(now, nil)
@@ -1014,11 +1100,20 @@ func (srv *Server) checkpoint(c *conn, stage chan<- *conn) error {
 
 func (srv *Server) launchPeer(c *conn) *Peer {
 	p := newPeer(srv.log, c, srv.Protocols)
+	p.penalize = func(penalty Penalty) { srv.penalize(p, penalty) }
 	if srv.EnableMsgEvents {
 		// If message events are enabled, pass the peerFeed
 		// to the peer.
 		p.events = &srv.peerFeed
 	}
+	if srv.RecordDir != "" {
+		rec, err := newMsgRecorder(srv.RecordDir, c.node.ID(), p.running)
+		if err != nil {
+			p.log.Warn("Failed to start traffic recording", "err", err)
+		} else {
+			c.transport = &recordingTransport{transport: c.transport, rec: rec, log: p.log.Debug}
+		}
+	}
 	go srv.runPeer(p)
 	return p
 }
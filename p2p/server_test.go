@@ -453,6 +453,85 @@ func TestServerSetupConn(t *testing.T) {
 	}
 }
 
+// Tests that connections from banned nodes and networks are rejected right after
+// the encryption handshake, and that misbehaving peers are banned automatically.
+func TestServerBans(t *testing.T) {
+	var (
+		clientkey = newkey()
+		clientpub = &clientkey.PublicKey
+		clientid  = enode.PubkeyToIDV4(clientpub)
+		tt        *setupTransport
+	)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    10,
+			NoDial:      true,
+			NoDiscovery: true,
+			Protocols:   []Protocol{discard},
+			Logger:      testlog.Logger(t, log.LvlTrace),
+		},
+		newTransport: func(fd net.Conn, dialDest *ecdsa.PublicKey) transport {
+			tt = &setupTransport{pubkey: clientpub, phs: protoHandshake{ID: crypto.FromECDSAPub(clientpub)[1:]}}
+			return tt
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("couldn't start server: %v", err)
+	}
+	defer srv.Stop()
+
+	check := func(banned bool) {
+		t.Helper()
+
+		p1, _ := net.Pipe()
+		conn := &fakeAddrConn{p1, &net.TCPAddr{IP: net.IP{10, 1, 2, 3}, Port: 30303}}
+		srv.SetupConn(conn, inboundConn, nil)
+		if banned {
+			if tt.closeErr != errBanned || tt.calls != "doEncHandshake,close," {
+				t.Fatalf("banned connection not rejected: calls %q, err %v", tt.calls, tt.closeErr)
+			}
+		} else if tt.closeErr == errBanned {
+			t.Fatalf("connection rejected as banned")
+		}
+	}
+	check(false)
+
+	// Ban the node itself, then its network
+	if err := srv.BanPeer(clientid.String(), time.Hour, "test"); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	check(true)
+	if err := srv.UnbanPeer(clientid.String()); err != nil {
+		t.Fatalf("failed to unban node: %v", err)
+	}
+	check(false)
+
+	if err := srv.BanPeer("10.1.0.0/16", 0, "test"); err != nil {
+		t.Fatalf("failed to ban network: %v", err)
+	}
+	check(true)
+	if err := srv.UnbanPeer("10.1.0.0/16"); err != nil {
+		t.Fatalf("failed to unban network: %v", err)
+	}
+	check(false)
+
+	// Misbehaving peers should be banned by the server once crossing the threshold
+	peer := NewPeer(clientid, "test", nil)
+	peer.penalize = func(penalty Penalty) { srv.penalize(peer, penalty) }
+	peer.Penalize(PenaltyInvalidBlock)
+	if len(srv.Bans()) != 0 {
+		t.Fatalf("peer banned after a single offence")
+	}
+	peer.Penalize(PenaltyInvalidBlock)
+
+	bans := srv.Bans()
+	if len(bans) != 1 || bans[0].Target != clientid.String() || bans[0].Expiry == nil {
+		t.Fatalf("misbehaving peer not banned: %v", bans)
+	}
+	check(true)
+}
+
 type setupTransport struct {
 	pubkey            *ecdsa.PublicKey
 	encHandshakeErr   error
@@ -0,0 +1,359 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package simnet implements an in-memory network running on virtual time.
+//
+// All hosts of the network share a simulated clock. Packets and messages are delivered
+// by timers of that clock, with latency and packet loss drawn from a seeded random
+// source. Time only advances when the simulation is driven by Run or RunUntil, which
+// fire timers one at a time and wait for the simulated nodes to finish processing
+// each event before moving on. This makes it possible to simulate hours of network
+// activity within seconds, and to reproduce the behavior of the network from a seed.
+//
+// Nodes must be configured to use the simulated clock returned by Clock. Network
+// endpoints are created with Listen (datagrams, e.g. for discovery) and MsgPipe
+// (devp2p message streams, e.g. for eth protocol handlers).
+package simnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+)
+
+const (
+	// settleTime is the real time for which the network must be idle before the
+	// simulated nodes are considered done with processing the current event.
+	settleTime = 200 * time.Microsecond
+
+	// maxSettleTime is the maximum real time spent waiting for the nodes to process
+	// an event. It prevents endpoints whose input is never read from stalling the
+	// simulation.
+	maxSettleTime = 100 * time.Millisecond
+)
+
+var errClosed = errors.New("use of closed network connection")
+
+// Link configures the transfer of packets between two hosts.
+type Link struct {
+	Latency time.Duration // One-way delay of packets
+	Jitter  time.Duration // Maximum random delay added to the latency
+	Loss    float64       // Probability of losing a datagram, between 0 and 1
+}
+
+// hostPair is the key of per-link settings.
+type hostPair [2]string
+
+func makeHostPair(a, b net.IP) hostPair {
+	as, bs := a.String(), b.String()
+	if as > bs {
+		as, bs = bs, as
+	}
+	return hostPair{as, bs}
+}
+
+// Network is a simulated network.
+type Network struct {
+	clock mclock.Simulated
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	link    Link
+	links   map[hostPair]Link
+	blocked map[hostPair]bool
+	conns   map[string]*PacketConn
+	pipes   []*MsgPipeRW
+	lastIP  uint32
+	events  uint64 // counts all network activity, for detecting idleness
+}
+
+// New creates a network. All random decisions of the network are derived from the seed.
+// The given link settings apply to all pairs of hosts unless overridden by SetLink.
+func New(seed int64, link Link) *Network {
+	return &Network{
+		rand:    rand.New(rand.NewSource(seed)),
+		link:    link,
+		links:   make(map[hostPair]Link),
+		blocked: make(map[hostPair]bool),
+		conns:   make(map[string]*PacketConn),
+	}
+}
+
+// Clock returns the virtual clock of the network.
+func (n *Network) Clock() *mclock.Simulated {
+	return &n.clock
+}
+
+// SetLink configures the link between hosts a and b.
+func (n *Network) SetLink(a, b net.IP, link Link) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.links[makeHostPair(a, b)] = link
+}
+
+// Partition blocks all communication between the hosts in a and the hosts in b.
+// Packets in flight are lost and message pipes crossing the partition are closed.
+func (n *Network) Partition(a, b []net.IP) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, ipa := range a {
+		for _, ipb := range b {
+			n.blocked[makeHostPair(ipa, ipb)] = true
+		}
+	}
+	for _, p := range n.pipes {
+		if n.blocked[makeHostPair(p.local, p.remote)] {
+			p.closeLocked()
+		}
+	}
+}
+
+// Heal removes all partitions.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.blocked = make(map[hostPair]bool)
+}
+
+// NewAddr returns an address on a host which is not in use yet.
+func (n *Network) NewAddr() *net.UDPAddr {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.lastIP++
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, 10<<24|n.lastIP)
+	return &net.UDPAddr{IP: ip, Port: 30303}
+}
+
+// Listen creates a datagram endpoint on the given address.
+func (n *Network) Listen(addr *net.UDPAddr) (*PacketConn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := addr.String()
+	if n.conns[key] != nil {
+		return nil, fmt.Errorf("address %v already in use", addr)
+	}
+	c := &PacketConn{
+		net:  n,
+		addr: &net.UDPAddr{IP: addr.IP, Port: addr.Port},
+		cond: sync.NewCond(&n.mu),
+	}
+	n.conns[key] = c
+	return c, nil
+}
+
+// linkTo returns the settings of the link between two hosts. It also returns
+// whether the link is partitioned. It must be called with n.mu held.
+func (n *Network) linkTo(a, b net.IP) (Link, bool) {
+	key := makeHostPair(a, b)
+	link, ok := n.links[key]
+	if !ok {
+		link = n.link
+	}
+	return link, n.blocked[key]
+}
+
+// delay returns the transfer time of a packet on the link. It must be called
+// with n.mu held.
+func (n *Network) delay(link Link) time.Duration {
+	d := link.Latency
+	if link.Jitter > 0 {
+		d += time.Duration(n.rand.Int63n(int64(link.Jitter)))
+	}
+	return d
+}
+
+// Run advances virtual time by d. Timers fire in order and the simulation waits for
+// the nodes to process each event before advancing further.
+func (n *Network) Run(d time.Duration) {
+	end := n.clock.Now().Add(d)
+	for n.step(end) {
+	}
+}
+
+// RunUntil advances virtual time until cond returns true, but by at most timeout.
+// It reports whether cond was satisfied.
+func (n *Network) RunUntil(timeout time.Duration, cond func() bool) bool {
+	end := n.clock.Now().Add(timeout)
+	for {
+		if cond() {
+			return true
+		}
+		if !n.step(end) {
+			return cond()
+		}
+	}
+}
+
+// step waits until the nodes are done with processing and then fires the next
+// timer, if it is due before end. Otherwise the clock is moved to end. It returns
+// false when end has been reached.
+func (n *Network) step(end mclock.AbsTime) bool {
+	n.settle()
+	now := n.clock.Now()
+	next, ok := n.clock.NextTimer()
+	if !ok || next > end {
+		n.clock.Run(end.Sub(now))
+		n.settle()
+		return false
+	}
+	n.clock.Run(next.Sub(now))
+	return true
+}
+
+// settle waits until all input has been processed and the network has been quiet
+// for settleTime.
+func (n *Network) settle() {
+	var (
+		deadline   = time.Now().Add(maxSettleTime)
+		lastEvents uint64
+		lastTimers = -1
+	)
+	for time.Now().Before(deadline) {
+		time.Sleep(settleTime)
+		n.mu.Lock()
+		idle, events := n.idle(), n.events
+		n.mu.Unlock()
+		timers := n.clock.ActiveTimers()
+		if idle && events == lastEvents && timers == lastTimers {
+			return
+		}
+		lastEvents, lastTimers = events, timers
+	}
+}
+
+// idle reports whether all endpoints have processed their input. It must be called
+// with n.mu held.
+func (n *Network) idle() bool {
+	for _, c := range n.conns {
+		if c.busy || len(c.queue) > 0 {
+			return false
+		}
+	}
+	for _, p := range n.pipes {
+		if !p.closed && (p.busy || len(p.queue) > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// PacketConn is a datagram endpoint on the simulated network. It implements the
+// UDPConn interface of package discover.
+type PacketConn struct {
+	net   *Network
+	addr  *net.UDPAddr
+	cond  *sync.Cond
+	queue []packet
+
+	// busy is set while the reader processes the last packet, i.e. until it
+	// comes back to read the next one.
+	busy   bool
+	closed bool
+}
+
+type packet struct {
+	from *net.UDPAddr
+	data []byte
+}
+
+// ReadFromUDP blocks until a packet arrives.
+func (c *PacketConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+
+	c.busy = false
+	for len(c.queue) == 0 && !c.closed {
+		c.cond.Wait()
+	}
+	if c.closed {
+		return 0, nil, errClosed
+	}
+	p := c.queue[0]
+	c.queue = c.queue[1:]
+	c.busy = true
+	c.net.events++
+	return copy(b, p.data), p.from, nil
+}
+
+// WriteToUDP sends a packet. The packet is delivered after the latency of the link
+// unless it gets lost.
+func (c *PacketConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	n := c.net
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if c.closed {
+		return 0, errClosed
+	}
+	n.events++
+	link, blocked := n.linkTo(c.addr.IP, addr.IP)
+	if blocked || n.rand.Float64() < link.Loss {
+		return len(b), nil
+	}
+	var (
+		to = addr.String()
+		p  = packet{from: c.addr, data: append([]byte(nil), b...)}
+	)
+	n.clock.AfterFunc(n.delay(link), func() { n.deliver(to, p) })
+	return len(b), nil
+}
+
+// deliver adds a packet to the queue of its destination.
+func (n *Network) deliver(to string, p packet) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.events++
+	dst := n.conns[to]
+	if dst == nil || dst.closed {
+		return
+	}
+	if _, blocked := n.linkTo(p.from.IP, dst.addr.IP); blocked {
+		return
+	}
+	dst.queue = append(dst.queue, p)
+	dst.cond.Broadcast()
+}
+
+// Close closes the endpoint, freeing its address.
+func (c *PacketConn) Close() error {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+
+	if !c.closed {
+		c.closed, c.busy, c.queue = true, false, nil
+		delete(c.net.conns, c.addr.String())
+		c.cond.Broadcast()
+	}
+	return nil
+}
+
+// LocalAddr returns the address of the endpoint.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return c.addr
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simnet
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+type received struct {
+	seq uint32
+	at  mclock.AbsTime
+}
+
+// sendPackets sends count numbered packets from addr1 to addr2 and returns the
+// packets received, along with their arrival times.
+func sendPackets(t *testing.T, n *Network, addr1, addr2 *net.UDPAddr, count int) []received {
+	a, err := n.Listen(addr1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.Listen(addr2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	defer b.Close()
+
+	var (
+		mu   sync.Mutex
+		recv []received
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		buf := make([]byte, 16)
+		for {
+			nbytes, from, err := b.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if !from.IP.Equal(a.addr.IP) || nbytes != 4 {
+				t.Errorf("wrong packet from %v, size %d", from, nbytes)
+			}
+			mu.Lock()
+			recv = append(recv, received{binary.BigEndian.Uint32(buf), n.Clock().Now()})
+			mu.Unlock()
+		}
+	}()
+	for i := 0; i < count; i++ {
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(i))
+		if _, err := a.WriteToUDP(buf[:], b.addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n.Run(time.Second)
+	b.Close()
+	<-done
+	return recv
+}
+
+func TestNetworkLatency(t *testing.T) {
+	n := New(1, Link{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	recv := sendPackets(t, n, n.NewAddr(), n.NewAddr(), 100)
+	if len(recv) != 100 {
+		t.Fatalf("received %d packets, want 100", len(recv))
+	}
+	for _, r := range recv {
+		if r.at < mclock.AbsTime(50*time.Millisecond) || r.at >= mclock.AbsTime(60*time.Millisecond) {
+			t.Fatalf("packet %d arrived at %v, outside of latency bounds", r.seq, time.Duration(r.at))
+		}
+	}
+}
+
+func TestNetworkLoss(t *testing.T) {
+	link := Link{Latency: 10 * time.Millisecond, Loss: 0.3}
+	n1 := New(1, link)
+	recv1 := sendPackets(t, n1, n1.NewAddr(), n1.NewAddr(), 1000)
+	if len(recv1) < 600 || len(recv1) > 800 {
+		t.Fatalf("received %d of 1000 packets with 30%% loss", len(recv1))
+	}
+	// The same seed loses the same packets.
+	n2 := New(1, link)
+	recv2 := sendPackets(t, n2, n2.NewAddr(), n2.NewAddr(), 1000)
+	if len(recv1) != len(recv2) {
+		t.Fatalf("same seed received %d and %d packets", len(recv1), len(recv2))
+	}
+	for i := range recv1 {
+		if recv1[i].seq != recv2[i].seq {
+			t.Fatalf("same seed lost different packets")
+		}
+	}
+}
+
+func TestNetworkPartition(t *testing.T) {
+	var (
+		n    = New(1, Link{Latency: 10 * time.Millisecond})
+		a, b = n.NewAddr(), n.NewAddr()
+	)
+	n.Partition([]net.IP{a.IP}, []net.IP{b.IP})
+	if recv := sendPackets(t, n, a, b, 10); len(recv) != 0 {
+		t.Fatalf("received %d packets across partition", len(recv))
+	}
+	n.Heal()
+	if recv := sendPackets(t, n, a, b, 10); len(recv) != 10 {
+		t.Fatalf("received %d packets after healing, want 10", len(recv))
+	}
+}
+
+func TestMsgPipe(t *testing.T) {
+	var (
+		n      = New(1, Link{Latency: 100 * time.Millisecond, Jitter: 50 * time.Millisecond})
+		ha, hb = n.NewAddr().IP, n.NewAddr().IP
+		a, b   = n.MsgPipe(ha, hb)
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for i := uint64(0); i < 10; i++ {
+			msg, err := b.ReadMsg()
+			if err != nil {
+				t.Errorf("read error: %v", err)
+				return
+			}
+			if msg.Code != i {
+				t.Errorf("got message %d, want %d", msg.Code, i)
+			}
+			if now := n.Clock().Now(); now < mclock.AbsTime(100*time.Millisecond) {
+				t.Errorf("message %d arrived early at %v", i, time.Duration(now))
+			}
+			msg.Discard()
+		}
+	}()
+	for i := uint64(0); i < 10; i++ {
+		if err := p2p.Send(a, i, []uint{1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !n.RunUntil(time.Second, func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}) {
+		t.Fatal("messages not delivered")
+	}
+
+	// Partitioning closes the pipe.
+	n.Partition([]net.IP{ha}, []net.IP{hb})
+	if err := p2p.Send(a, 0, []uint{1}); err != p2p.ErrPipeClosed {
+		t.Fatalf("wrong error after partition: %v", err)
+	}
+	if _, err := b.ReadMsg(); err != p2p.ErrPipeClosed {
+		t.Fatalf("wrong read error after partition: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simnet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// MsgPipe creates a message pipe between hosts a and b. The ends of the pipe behave
+// like the ones created by p2p.MsgPipe, but messages are delivered after the latency
+// of the link. Messages are delivered in order and are never lost. If the link is
+// partitioned, the pipe is closed.
+func (n *Network) MsgPipe(a, b net.IP) (*MsgPipeRW, *MsgPipeRW) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var (
+		closing = new(bool)
+		pa      = &MsgPipeRW{net: n, local: a, remote: b, cond: sync.NewCond(&n.mu), closing: closing}
+		pb      = &MsgPipeRW{net: n, local: b, remote: a, cond: sync.NewCond(&n.mu), closing: closing}
+	)
+	pa.peer, pb.peer = pb, pa
+	n.pipes = append(n.pipes, pa, pb)
+	return pa, pb
+}
+
+// MsgPipeRW is an endpoint of a simulated message pipe.
+type MsgPipeRW struct {
+	net           *Network
+	local, remote net.IP
+	peer          *MsgPipeRW
+	cond          *sync.Cond
+	queue         []pipeMsg
+	inflight      []pipeMsg // sent messages, ordered by delivery time
+	closing       *bool     // shared between both ends
+	busy          bool
+	closed        bool
+}
+
+type pipeMsg struct {
+	code    uint64
+	payload []byte
+	at      mclock.AbsTime // delivery time
+}
+
+// WriteMsg sends a message to the other end of the pipe. It doesn't wait for the
+// message to be delivered.
+func (p *MsgPipeRW) WriteMsg(msg p2p.Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	n := p.net
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if p.closed {
+		return p2p.ErrPipeClosed
+	}
+	n.events++
+	link, blocked := n.linkTo(p.local, p.remote)
+	if blocked {
+		p.closeLocked()
+		return p2p.ErrPipeClosed
+	}
+	// Messages can't overtake each other, so the delivery time is at least
+	// the one of the previous message.
+	now := n.clock.Now()
+	at := now.Add(n.delay(link))
+	if len(p.inflight) > 0 && at < p.inflight[len(p.inflight)-1].at {
+		at = p.inflight[len(p.inflight)-1].at
+	}
+	p.inflight = append(p.inflight, pipeMsg{code: msg.Code, payload: payload, at: at})
+	n.clock.AfterFunc(at.Sub(now), p.deliver)
+	return nil
+}
+
+// deliver moves all in-flight messages which are due to the other end of the pipe.
+// Timers firing at the same time run in arbitrary order, so this doesn't rely on
+// the timer to identify the message.
+func (p *MsgPipeRW) deliver() {
+	p.net.mu.Lock()
+	defer p.net.mu.Unlock()
+
+	p.net.events++
+	now := p.net.clock.Now()
+	for len(p.inflight) > 0 && p.inflight[0].at <= now {
+		if !p.peer.closed {
+			p.peer.queue = append(p.peer.queue, p.inflight[0])
+		}
+		p.inflight = p.inflight[1:]
+	}
+	p.peer.cond.Broadcast()
+}
+
+// ReadMsg returns the next message sent by the other end of the pipe.
+func (p *MsgPipeRW) ReadMsg() (p2p.Msg, error) {
+	p.net.mu.Lock()
+	defer p.net.mu.Unlock()
+
+	p.busy = false
+	for len(p.queue) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return p2p.Msg{}, p2p.ErrPipeClosed
+	}
+	m := p.queue[0]
+	p.queue = p.queue[1:]
+	p.busy = true
+	p.net.events++
+	return p2p.Msg{Code: m.code, Size: uint32(len(m.payload)), Payload: bytes.NewReader(m.payload)}, nil
+}
+
+// Close unblocks any pending ReadMsg and WriteMsg calls on both ends of the pipe.
+// They will return p2p.ErrPipeClosed.
+func (p *MsgPipeRW) Close() error {
+	p.net.mu.Lock()
+	defer p.net.mu.Unlock()
+
+	p.closeLocked()
+	return nil
+}
+
+func (p *MsgPipeRW) closeLocked() {
+	if *p.closing {
+		return
+	}
+	*p.closing = true
+	for _, end := range []*MsgPipeRW{p, p.peer} {
+		end.closed, end.busy, end.queue, end.inflight = true, false, nil, nil
+		end.cond.Broadcast()
+	}
+}